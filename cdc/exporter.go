@@ -0,0 +1,221 @@
+package cdc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+)
+
+// Config of the Exporter
+type Config struct {
+	// Dir is where the JSONL file is written. Point it to storage shared by all nodes,
+	// so the files written by different leaders end up in the same place.
+	Dir string
+
+	// ChangesPerFile is the number of change in one file before it is rotated.
+	ChangesPerFile uint64
+
+	// Interval is how often the change log is polled.
+	Interval time.Duration
+
+	// BatchSize is the maximum number of change read from the change log in one poll.
+	BatchSize int
+}
+
+// Exporter write the change log recorded by the FSM into rotating JSONL files, only when this node is the leader.
+//
+// File is rotated every ChangesPerFile changes and named after its first offset, so the content of each file is
+// deterministic: the change log is the same in every replica. When the file is full, the leader replicate its last
+// offset using CDCEXPORTED command. A new leader continue from the first file which is not completed yet and rewrite it
+// from the beginning, so a file written by two leaders has the same content, never missing or duplicating a change.
+type Exporter struct {
+	conf   Config
+	raft   gossip.Service
+	repo   repo.Service
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	closed sync.Once
+
+	// state of current leadership term, reset when leadership is lost
+	file      *os.File
+	writer    *bufio.Writer
+	fileStart uint64
+	written   uint64
+}
+
+// Start run the export loop in background until Stop is called.
+func (e *Exporter) Start() error {
+	if err := os.MkdirAll(e.conf.Dir, 0755); err != nil {
+		return err
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		ticker := time.NewTicker(e.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.stop:
+				e.closeFile()
+				return
+			case <-ticker.C:
+			}
+
+			if !e.raft.IsLeader() {
+				e.closeFile()
+				continue
+			}
+
+			if err := e.export(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "[CDC] error export changes: %s\n", err.Error())
+				e.closeFile()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop the export loop and close the current file.
+func (e *Exporter) Stop() {
+	e.closed.Do(func() {
+		close(e.stop)
+	})
+	e.wg.Wait()
+}
+
+// export write all new changes, opening the file of the first not completed file when needed.
+func (e *Exporter) export() error {
+	if e.file == nil {
+		exported, err := e.repo.ChangesExported()
+		if err != nil {
+			return err
+		}
+
+		if err = e.openFile(exported + 1); err != nil {
+			return err
+		}
+	}
+
+	for {
+		changes, first, _, err := e.repo.Changes(e.written+1, e.conf.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			return e.sync()
+		}
+
+		if first > e.written+1 || changes[0].Offset != e.written+1 {
+			return fmt.Errorf("change %d is already deleted from change log, increase the retention", e.written+1)
+		}
+
+		for _, c := range changes {
+			if c.Offset-e.fileStart >= e.conf.ChangesPerFile {
+				if err = e.rotate(c.Offset); err != nil {
+					return err
+				}
+			}
+
+			data, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+
+			if _, err = e.writer.Write(append(data, '\n')); err != nil {
+				return err
+			}
+
+			e.written = c.Offset
+		}
+	}
+}
+
+// rotate complete the current file, save the checkpoint and open the next file starting from offset.
+func (e *Exporter) rotate(offset uint64) error {
+	if err := e.sync(); err != nil {
+		return err
+	}
+
+	if _, err := e.raft.DoOperation(model.CommandPayload{
+		Operation: fsm.OpChangesExported,
+		Offset:    offset - 1,
+	}); err != nil {
+		return err
+	}
+
+	e.closeFile()
+	return e.openFile(offset)
+}
+
+// openFile open the file containing the change at offset, truncating it and writing from its first change.
+func (e *Exporter) openFile(offset uint64) error {
+	start := offset - (offset-1)%e.conf.ChangesPerFile
+	name := filepath.Join(e.conf.Dir, fmt.Sprintf("changes-%020d.jsonl", start))
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	e.file = f
+	e.writer = bufio.NewWriter(f)
+	e.fileStart = start
+	e.written = start - 1
+	return nil
+}
+
+func (e *Exporter) sync() error {
+	if err := e.writer.Flush(); err != nil {
+		return err
+	}
+
+	return e.file.Sync()
+}
+
+func (e *Exporter) closeFile() {
+	if e.file == nil {
+		return
+	}
+
+	_ = e.writer.Flush()
+	if err := e.file.Close(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "[CDC] error close file: %s\n", err.Error())
+	}
+
+	e.file = nil
+	e.writer = nil
+}
+
+func NewExporter(conf Config, raft gossip.Service, repo repo.Service) *Exporter {
+	if conf.ChangesPerFile == 0 {
+		conf.ChangesPerFile = 100000
+	}
+
+	if conf.Interval <= 0 {
+		conf.Interval = time.Second
+	}
+
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1000
+	}
+
+	return &Exporter{
+		conf: conf,
+		raft: raft,
+		repo: repo,
+		stop: make(chan struct{}),
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 	"ysf/canoe/pkg/httpclient"
+	"ysf/canoe/shard"
 )
 
 type Client struct {
@@ -14,6 +15,10 @@ type Client struct {
 	httpClient httpclient.HttpRequester
 	srvInfo    []*serverInfo
 	leader     *serverInfo
+
+	// shards is nil when the cluster is not sharded, groupLeaders is the HTTP address of each group leader
+	shards       *shard.Map
+	groupLeaders map[string]string
 }
 
 type dataStat struct {
@@ -24,6 +29,15 @@ type respStat struct {
 	Data dataStat `json:"data"`
 }
 
+type respMembers struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Leader  bool   `json:"leader"`
+		Gossip  string `json:"gossip"`
+		Healthy *bool  `json:"healthy"`
+	} `json:"data"`
+}
+
 type serverInfo struct {
 	respStat   respStat
 	raftServer RaftServer
@@ -59,13 +73,82 @@ func (c *Client) sync() {
 			continue
 		}
 	}
+
+	c.evictStale()
+}
+
+// evictStale remove member of the cluster which is not listed in Config.RaftServers, only when it is listed
+// in Config.StaleNodes or the leader report it is unhealthy or dead. Healthy member is never removed,
+// it may be added by other client or operator which this client does not know.
+// It is skipped when PathMembers or PathRemove is not configured.
+func (c *Client) evictStale() {
+	if c.conf.PathMembers == "" || c.conf.PathRemove == "" || c.leader.raftServer.HttpAddress == "" {
+		return
+	}
+
+	ctx := context.Background()
+	correlationID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	membersAddr := fmt.Sprintf("%s%s", c.leader.raftServer.HttpAddress, c.conf.PathMembers)
+	respHttpMembers, err := c.httpClient.Get(ctx, correlationID, membersAddr, http.Header{
+		"Content-Type": []string{"application/json"},
+	})
+
+	if err != nil || respHttpMembers.Raw.StatusCode != http.StatusOK {
+		return
+	}
+
+	var members = respMembers{}
+	if err = respHttpMembers.To(ctx, &members); err != nil {
+		return
+	}
+
+	var known = make(map[string]bool)
+	for _, raftServer := range c.conf.RaftServers {
+		known[raftServer.NodeID] = true
+	}
+
+	var stale = make(map[string]bool)
+	for _, id := range c.conf.StaleNodes {
+		stale[id] = true
+	}
+
+	removeAddr := fmt.Sprintf("%s%s", c.leader.raftServer.HttpAddress, c.conf.PathRemove)
+	for _, member := range members.Data {
+		if known[member.ID] || member.Leader {
+			continue
+		}
+
+		unhealthy := (member.Healthy != nil && !*member.Healthy) || member.Gossip == "dead"
+		if !stale[member.ID] && !unhealthy {
+			continue
+		}
+
+		body, _ := json.Marshal(map[string]string{
+			"node_id": member.ID,
+		})
+
+		respHttpRemove, err := c.httpClient.Post(ctx, correlationID, removeAddr, http.Header{
+			"Content-Type": []string{"application/json"},
+		}, body)
+
+		if err != nil || respHttpRemove.Raw.StatusCode != http.StatusOK {
+			fmt.Printf("failed to remove stale node %s\n", member.ID)
+			continue
+		}
+	}
 }
 
 func (c Client) SendCommand(data []byte) {
 	ctx := context.Background()
 	correlationID := fmt.Sprintf("%d", time.Now().UnixNano())
 
-	storeAddr := fmt.Sprintf("%s%s", c.leader.raftServer.HttpAddress, "/store")
+	var form struct {
+		Key string `json:"key"`
+	}
+	_ = json.Unmarshal(data, &form)
+
+	storeAddr := fmt.Sprintf("%s%s", c.addressFor(form.Key), "/store")
 
 	respHttpStore, err := c.httpClient.Post(ctx, correlationID, storeAddr, http.Header{
 		"Content-Type": []string{"application/json"},
@@ -148,6 +231,7 @@ func New(conf Config) *Client {
 
 	c.leaderElection()
 	c.sync()
+	c.loadShards()
 
 	return c
 }
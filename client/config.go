@@ -5,6 +5,14 @@ type Config struct {
 	PathStat    string       `json:"path_stat"`
 	PathJoin    string       `json:"path_join"`
 	PathRemove  string       `json:"path_remove"`
+	PathMembers string       `json:"path_members"`
+
+	// StaleNodes is the node id removed from the cluster when it is not in RaftServers,
+	// other member is only removed when the leader report it unhealthy or dead.
+	StaleNodes []string `json:"stale_nodes"`
+
+	// PathShards is the shard map endpoint, command is sent to the leader of the group owning the key when it is set
+	PathShards string `json:"path_shards"`
 }
 
 type RaftServer struct {
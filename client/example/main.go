@@ -24,9 +24,11 @@ func main() {
 				HttpAddress: "http://localhost:2224",
 			},
 		},
-		PathStat:   "/raft/stats",
-		PathJoin:   "/raft/join",
-		PathRemove: "",
+		PathStat:    "/raft/stats",
+		PathJoin:    "/raft/join",
+		PathRemove:  "/raft/remove",
+		PathMembers: "/raft/members",
+		PathShards:  "/shards",
 	}
 
 	body, _ := json.Marshal(map[string]string{
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type respReservation struct {
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+}
+
+// Sequence hand out ID from the block reserved from the cluster.
+// When the block is used up, it transparently reserves the next block from the leader,
+// so most ID is allocated locally without round trip to the cluster.
+// The ID is strictly increasing for one Sequence, but unused ID in a block is lost when the process exit.
+type Sequence struct {
+	client    *Client
+	name      string
+	blockSize int64
+
+	mu   sync.Mutex
+	next int64
+	last int64
+}
+
+// Sequence return the ID generator of named sequence. The sequence must be created first using POST /sequence.
+func (c *Client) Sequence(name string, blockSize int64) *Sequence {
+	if blockSize <= 0 {
+		blockSize = 1
+	}
+
+	return &Sequence{
+		client:    c,
+		name:      name,
+		blockSize: blockSize,
+		next:      1,
+		last:      0,
+	}
+}
+
+// Next return the next ID, reserving new block when needed.
+func (s *Sequence) Next() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next > s.last {
+		r, err := s.reserve()
+		if err != nil {
+			return 0, err
+		}
+
+		s.next, s.last = r.First, r.Last
+	}
+
+	id := s.next
+	s.next++
+	return id, nil
+}
+
+// reserve ask the leader for a new block. When it fails, the leader is looked up again and the request is retried once,
+// because the leader may have changed since the client is created.
+func (s *Sequence) reserve() (r respReservation, err error) {
+	r, err = s.client.reserveSequence(s.name, s.blockSize)
+	if err == nil {
+		return
+	}
+
+	s.client.leaderElection()
+	return s.client.reserveSequence(s.name, s.blockSize)
+}
+
+func (c *Client) reserveSequence(name string, count int64) (r respReservation, err error) {
+	ctx := context.Background()
+	correlationID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	if c.leader == nil || c.leader.raftServer.HttpAddress == "" {
+		return r, fmt.Errorf("no leader found")
+	}
+
+	reserveAddr := fmt.Sprintf("%s/sequence/%s/reserve", c.leader.raftServer.HttpAddress, url.PathEscape(name))
+	body, _ := json.Marshal(map[string]int64{
+		"count": count,
+	})
+
+	resp, err := c.httpClient.Post(ctx, correlationID, reserveAddr, http.Header{
+		"Content-Type": []string{"application/json"},
+	}, body)
+
+	if err != nil {
+		return r, err
+	}
+
+	if resp.Raw.StatusCode != http.StatusOK {
+		return r, fmt.Errorf("reserve sequence %s: status %d %v", name, resp.Raw.StatusCode, resp.Raw.Body)
+	}
+
+	err = resp.To(ctx, &r)
+	if err == nil && r.Last < r.First {
+		err = fmt.Errorf("reserve sequence %s: empty block", name)
+	}
+
+	return
+}
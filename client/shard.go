@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	"ysf/canoe/shard"
+)
+
+type respShards struct {
+	Data struct {
+		Initialized bool       `json:"initialized"`
+		Map         *shard.Map `json:"map"`
+		Groups      []struct {
+			ID     string `json:"id"`
+			Leader string `json:"leader"`
+		} `json:"groups"`
+	} `json:"data"`
+}
+
+// loadShards read the shard map and the group leaders from the leader, so command is sent to the group leader directly.
+// It is skipped when PathShards is not configured or sharding is not initialized.
+func (c *Client) loadShards() {
+	c.shards, c.groupLeaders = nil, nil
+	if c.conf.PathShards == "" || c.leader == nil || c.leader.raftServer.HttpAddress == "" {
+		return
+	}
+
+	ctx := context.Background()
+	correlationID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	shardsAddr := fmt.Sprintf("%s%s", c.leader.raftServer.HttpAddress, c.conf.PathShards)
+	respHttpShards, err := c.httpClient.Get(ctx, correlationID, shardsAddr, http.Header{
+		"Content-Type": []string{"application/json"},
+	})
+
+	if err != nil || respHttpShards.Raw.StatusCode != http.StatusOK {
+		return
+	}
+
+	var data = respShards{}
+	if err = respHttpShards.To(ctx, &data); err != nil || !data.Data.Initialized || data.Data.Map == nil {
+		return
+	}
+
+	c.shards = data.Data.Map
+	c.groupLeaders = make(map[string]string)
+	for _, g := range data.Data.Groups {
+		if g.Leader != "" {
+			c.groupLeaders[g.ID] = c.httpAddress(g.Leader)
+		}
+	}
+}
+
+// httpAddress return the HTTP address of the node with the raft address.
+// Shard group use raft multiplexed on the HTTP port, so unknown raft address is the HTTP address itself.
+func (c *Client) httpAddress(raftAddress string) string {
+	for _, raftServer := range c.conf.RaftServers {
+		if raftServer.RaftAddress == raftAddress {
+			return raftServer.HttpAddress
+		}
+	}
+
+	return "http://" + raftAddress
+}
+
+// addressFor return the HTTP address of the group leader owning the key, or the leader when it is not known.
+func (c *Client) addressFor(key string) string {
+	if c.shards != nil {
+		if addr, ok := c.groupLeaders[c.shards.Owner(key)]; ok {
+			return addr
+		}
+	}
+
+	return c.leader.raftServer.HttpAddress
+}
@@ -1,14 +1,95 @@
 package main
 
 import (
+	"fmt"
+	"time"
+	"ysf/canoe/gossip"
+	"ysf/canoe/pkg/raftstream"
+
 	"github.com/spf13/viper"
 )
 
 type configRaft struct {
-	NodeId    string `mapstructure:"node_id"`
-	Host      string `mapstructure:"host"`
-	Port      int    `mapstructure:"port"`
-	VolumeDir string `mapstructure:"volume_dir"`
+	NodeId          string `mapstructure:"node_id"`
+	Host            string `mapstructure:"host"`
+	Port            int    `mapstructure:"port"`
+	VolumeDir       string `mapstructure:"volume_dir"`
+	Bootstrap       bool   `mapstructure:"bootstrap"`
+	BootstrapExpect int    `mapstructure:"bootstrap_expect"`
+	Suffrage        string `mapstructure:"suffrage"`
+	PromoteMaxLag   uint64 `mapstructure:"promote_max_lag"`
+
+	// DrainTimeout is the time to wait in-flight operation on shutdown, before leadership is transferred
+	DrainTimeout    time.Duration `mapstructure:"drain_timeout"`
+	LeaveOnShutdown bool          `mapstructure:"leave_on_shutdown"`
+
+	// LogStore is bolt or badger, bolt log is copied to badger using cmd/raftmigrate
+	LogStore string `mapstructure:"log_store"`
+
+	// Multiplex carry raft traffic on the HTTP server port, host and port of raft is ignored
+	Multiplex bool `mapstructure:"multiplex"`
+
+	TLS    configRaftTLS    `mapstructure:"tls"`
+	Tuning configRaftTuning `mapstructure:"tuning"`
+}
+
+// configRaftTuning is raft timing and sizing, zero value use the default
+type configRaftTuning struct {
+	HeartbeatTimeout   time.Duration `mapstructure:"heartbeat_timeout"`
+	ElectionTimeout    time.Duration `mapstructure:"election_timeout"`
+	LeaderLeaseTimeout time.Duration `mapstructure:"leader_lease_timeout"`
+	CommitTimeout      time.Duration `mapstructure:"commit_timeout"`
+	SnapshotInterval   time.Duration `mapstructure:"snapshot_interval"`
+	SnapshotThreshold  uint64        `mapstructure:"snapshot_threshold"`
+	SnapshotRetain     int           `mapstructure:"snapshot_retain"`
+	TrailingLogs       uint64        `mapstructure:"trailing_logs"`
+	MaxAppendEntries   int           `mapstructure:"max_append_entries"`
+	LogCacheSize       int           `mapstructure:"log_cache_size"`
+	ApplyTimeout       time.Duration `mapstructure:"apply_timeout"`
+	TransportMaxPool   int           `mapstructure:"transport_max_pool"`
+	TransportTimeout   time.Duration `mapstructure:"transport_timeout"`
+}
+
+func (c configRaftTuning) config() gossip.TuningConfig {
+	return gossip.TuningConfig{
+		HeartbeatTimeout:   c.HeartbeatTimeout,
+		ElectionTimeout:    c.ElectionTimeout,
+		LeaderLeaseTimeout: c.LeaderLeaseTimeout,
+		CommitTimeout:      c.CommitTimeout,
+		SnapshotInterval:   c.SnapshotInterval,
+		SnapshotThreshold:  c.SnapshotThreshold,
+		SnapshotRetain:     c.SnapshotRetain,
+		TrailingLogs:       c.TrailingLogs,
+		MaxAppendEntries:   c.MaxAppendEntries,
+		LogCacheSize:       c.LogCacheSize,
+		ApplyTimeout:       c.ApplyTimeout,
+		TransportMaxPool:   c.TransportMaxPool,
+		TransportTimeout:   c.TransportTimeout,
+	}
+}
+
+// configRaftTLS is mutual TLS of raft transport, certificate must be usable for both server and client auth
+type configRaftTLS struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	CertFile       string        `mapstructure:"cert_file"`
+	KeyFile        string        `mapstructure:"key_file"`
+	CAFile         string        `mapstructure:"ca_file"`
+	VerifyNodeID   bool          `mapstructure:"verify_node_id"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+func (c configRaftTLS) config() *raftstream.TLSConfig {
+	if !c.Enabled {
+		return nil
+	}
+
+	return &raftstream.TLSConfig{
+		CertFile:       c.CertFile,
+		KeyFile:        c.KeyFile,
+		CAFile:         c.CAFile,
+		VerifyNodeID:   c.VerifyNodeID,
+		ReloadInterval: c.ReloadInterval,
+	}
 }
 
 type configServer struct {
@@ -16,16 +97,155 @@ type configServer struct {
 	Port int    `mapstructure:"port"`
 }
 
-// configLeaderServer is the host port of raft leader address
+// configLeaderServer is the host port of raft leader address, used as the join seed when join.seeds is empty
 type configLeaderServer struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
 }
 
+// configJoin is the automatic join on startup, seeds is the HTTP join endpoint of nodes in the cluster
+type configJoin struct {
+	Seeds      []string      `mapstructure:"seeds"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+// joinSeeds return the configured seeds, or the join endpoint of leader_server when no seed is set.
+func (c config) joinSeeds() []string {
+	if len(c.Join.Seeds) > 0 {
+		return c.Join.Seeds
+	}
+
+	if c.LeaderServer.Host == "" || c.LeaderServer.Port == 0 {
+		return nil
+	}
+
+	// do not join to itself
+	if c.LeaderServer.Host == c.Server.Host && c.LeaderServer.Port == c.Server.Port {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("http://%s:%d/raft/join", c.LeaderServer.Host, c.LeaderServer.Port)}
+}
+
+// configResp is the optional redis protocol (RESP2) listener
+type configResp struct {
+	Enabled bool         `mapstructure:"enabled"`
+	Host    string       `mapstructure:"host"`
+	Port    int          `mapstructure:"port"`
+	Peers   []configPeer `mapstructure:"peers"`
+}
+
+// configMemcache is the optional memcached ASCII protocol listener
+type configMemcache struct {
+	Enabled bool         `mapstructure:"enabled"`
+	Host    string       `mapstructure:"host"`
+	Port    int          `mapstructure:"port"`
+	Peers   []configPeer `mapstructure:"peers"`
+}
+
+// configPeer map raft address of a node to its listener address, used to point client to the leader
+type configPeer struct {
+	RaftAddress string `mapstructure:"raft_address"`
+	Address     string `mapstructure:"address"`
+}
+
+// peerAddress return the listener address of node with the raft address, or the raft address itself if not found.
+func peerAddress(peers []configPeer, raftAddress string) string {
+	for _, peer := range peers {
+		if peer.RaftAddress == raftAddress {
+			return peer.Address
+		}
+	}
+
+	return raftAddress
+}
+
+// configGossip is the optional SWIM gossip, used for discovery and failure detection next to raft
+type configGossip struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Host      string        `mapstructure:"host"`
+	Port      int           `mapstructure:"port"`
+	Seeds     []string      `mapstructure:"seeds"`
+	ReapAfter time.Duration `mapstructure:"reap_after"`
+}
+
+// configAutopilot remove dead server and promote stable server on the leader, it need gossip enabled
+type configAutopilot struct {
+	Enabled                 bool          `mapstructure:"enabled"`
+	DeadServerThreshold     time.Duration `mapstructure:"dead_server_threshold"`
+	LastContactThreshold    time.Duration `mapstructure:"last_contact_threshold"`
+	MaxTrailingLogs         uint64        `mapstructure:"max_trailing_logs"`
+	ServerStabilizationTime time.Duration `mapstructure:"server_stabilization_time"`
+}
+
+// configCdc is change data capture. Enabled and Retention change the replicated state, so it must be the same on every node.
+type configCdc struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Retention      uint64 `mapstructure:"retention"`
+	ExportDir      string `mapstructure:"export_dir"`
+	ChangesPerFile uint64 `mapstructure:"changes_per_file"`
+}
+
+// configExpiry purge the expired keys on the leader, expired key is hidden before it is purged
+type configExpiry struct {
+	Interval  time.Duration `mapstructure:"interval"`
+	BatchSize int           `mapstructure:"batch_size"`
+}
+
+// configWebhook POST leadership and membership events observed by this node to the URL
+type configWebhook struct {
+	URL        string        `mapstructure:"url"`
+	Events     []string      `mapstructure:"events"`
+	Secret     string        `mapstructure:"secret"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	MaxRetries int           `mapstructure:"max_retries"`
+}
+
+type configEvents struct {
+	Webhooks []configWebhook `mapstructure:"webhooks"`
+}
+
+// configShards run the shard groups of the keyspace next to the default raft group, it need raft.multiplex
+type configShards struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// configReplication ship the committed operations of this cluster to the standby cluster at targets, when it is not empty
+type configReplication struct {
+	Targets   []string      `mapstructure:"targets"`
+	Interval  time.Duration `mapstructure:"interval"`
+	BatchSize int           `mapstructure:"batch_size"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
 type config struct {
 	Server       configServer       `mapstructure:"server"`
 	LeaderServer configLeaderServer `mapstructure:"leader_server"`
+	Join         configJoin         `mapstructure:"join"`
+	Gossip       configGossip       `mapstructure:"gossip"`
+	Autopilot    configAutopilot    `mapstructure:"autopilot"`
 	Raft         configRaft         `mapstructure:"raft"`
+	Resp         configResp         `mapstructure:"resp"`
+	Memcache     configMemcache     `mapstructure:"memcache"`
+	Cdc          configCdc          `mapstructure:"cdc"`
+	Expiry       configExpiry       `mapstructure:"expiry"`
+	Events       configEvents       `mapstructure:"events"`
+	Shards       configShards       `mapstructure:"shards"`
+	Replication  configReplication  `mapstructure:"replication"`
+}
+
+// validate check the combination of config which can not be checked by each package
+func (c config) validate() error {
+	if c.Raft.BootstrapExpect > 1 && len(c.joinSeeds()) == 0 {
+		return fmt.Errorf("raft.bootstrap_expect %d require join.seeds to discover the other nodes", c.Raft.BootstrapExpect)
+	}
+
+	if c.Shards.Enabled && !c.Raft.Multiplex {
+		return fmt.Errorf("shards need raft.multiplex, the shard groups share the HTTP port")
+	}
+
+	return nil
 }
 
 func readConfig() (conf config, err error) {
@@ -45,5 +265,10 @@ func readConfig() (conf config, err error) {
 		return
 	}
 
+	err = conf.validate()
+	if err != nil {
+		return
+	}
+
 	return
 }
@@ -1,20 +1,38 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	"ysf/canoe/cdc"
 	"ysf/canoe/dependency"
+	"ysf/canoe/expiry"
+	"ysf/canoe/fsm"
 	"ysf/canoe/gossip"
+	"ysf/canoe/internal/handler/adminctrl"
+	"ysf/canoe/internal/handler/cdcctrl"
 	"ysf/canoe/internal/handler/raftctrl"
+	"ysf/canoe/internal/handler/replctrl"
+	"ysf/canoe/internal/handler/seqctrl"
+	"ysf/canoe/internal/handler/shardctrl"
 	"ysf/canoe/internal/handler/storectrl"
+	"ysf/canoe/internal/handler/zsetctrl"
+	"ysf/canoe/memcache"
+	"ysf/canoe/multiraft"
+	"ysf/canoe/pkg/raftstream"
+	"ysf/canoe/replication"
 	"ysf/canoe/repo"
+	"ysf/canoe/resp"
 	"ysf/canoe/server"
+	"ysf/canoe/webhook"
 
 	"github.com/dgraph-io/badger/v2"
+	"github.com/hashicorp/raft"
 	"go.uber.org/zap"
 )
 
@@ -53,7 +71,75 @@ func main() {
 	// Join server must done in leader server, otherwise it will fail
 	// https://github.com/hashicorp/raft/blob/v1.1.2/api.go#L796
 	raftBindAddr := fmt.Sprintf("%s:%d", conf.Raft.Host, conf.Raft.Port)
-	g, err := gossip.New(conf.Raft.NodeId, raftBindAddr, conf.Raft.VolumeDir, repoDB)
+	serverAddr := fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port)
+
+	// ========= Share the HTTP port with raft, the connection is routed by its first byte
+	var (
+		raftStream     raft.StreamLayer
+		serverListener net.Listener
+		mux            *raftstream.Mux
+	)
+
+	if conf.Raft.Multiplex {
+		advertise, err := net.ResolveTCPAddr("tcp", serverAddr)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		ln, err := net.Listen("tcp", serverAddr)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		mux = raftstream.NewMux(ln, advertise, 0)
+		go func() {
+			_ = mux.Serve()
+		}()
+
+		defer func() {
+			_ = mux.Close()
+		}()
+
+		raftBindAddr = serverAddr
+		raftStream = mux.RaftLayer()
+		serverListener = mux.HTTPListener()
+	}
+
+	g, err := gossip.New(gossip.Config{
+		NodeID:          conf.Raft.NodeId,
+		RaftBindAddress: raftBindAddr,
+		RaftDir:         conf.Raft.VolumeDir,
+		Bootstrap:       conf.Raft.Bootstrap,
+		BootstrapExpect: conf.Raft.BootstrapExpect,
+		Suffrage:        conf.Raft.Suffrage,
+		PromoteMaxLag:   conf.Raft.PromoteMaxLag,
+		TLS:             conf.Raft.TLS.config(),
+		Stream:          raftStream,
+		Tuning:          conf.Raft.Tuning.config(),
+		LogStore:        conf.Raft.LogStore,
+		FSM: fsm.Options{
+			CDC:          conf.Cdc.Enabled,
+			CDCRetention: conf.Cdc.Retention,
+		},
+		Membership: gossip.MembershipConfig{
+			Enabled:     conf.Gossip.Enabled,
+			BindAddress: fmt.Sprintf("%s:%d", conf.Gossip.Host, conf.Gossip.Port),
+			Seeds:       conf.Gossip.Seeds,
+			Meta: map[string]string{
+				gossip.MetaHTTPAddress: serverAddr,
+			},
+			ReapAfter: conf.Gossip.ReapAfter,
+		},
+		Autopilot: gossip.AutopilotConfig{
+			Enabled:                 conf.Autopilot.Enabled,
+			DeadServerThreshold:     conf.Autopilot.DeadServerThreshold,
+			LastContactThreshold:    conf.Autopilot.LastContactThreshold,
+			MaxTrailingLogs:         conf.Autopilot.MaxTrailingLogs,
+			ServerStabilizationTime: conf.Autopilot.ServerStabilizationTime,
+		},
+	}, repoDB)
 	if err != nil {
 		log.Fatal(err)
 		return
@@ -65,12 +151,116 @@ func main() {
 		}
 	}()
 
-	dep := dependency.NewDep(g)
+	// ========= Join to the cluster in background until this node is admitted by the leader
+	joinCtx, cancelJoin := context.WithCancel(context.Background())
+	defer cancelJoin()
+
+	g.AutoJoin(joinCtx, gossip.JoinConfig{
+		Seeds:      conf.joinSeeds(),
+		MaxBackoff: conf.Join.MaxBackoff,
+	})
+
+	dep := dependency.NewDep(g, repoDB)
+
+	// ========= Run the shard groups, operation sent through dep.Do is routed to the group owning the key
+	var shardHost *multiraft.Host
+	if conf.Shards.Enabled {
+		shardHost, err = multiraft.New(multiraft.Config{
+			NodeID:   conf.Raft.NodeId,
+			RaftDir:  conf.Raft.VolumeDir,
+			DB:       badgerDB,
+			Mux:      mux,
+			TLS:      conf.Raft.TLS.config(),
+			Tuning:   conf.Raft.Tuning.config(),
+			LogStore: conf.Raft.LogStore,
+			FSM: fsm.Options{
+				CDC:          conf.Cdc.Enabled,
+				CDCRetention: conf.Cdc.Retention,
+			},
+			Interval: conf.Shards.Interval,
+			Expiry: expiry.Config{
+				Interval:  conf.Expiry.Interval,
+				BatchSize: conf.Expiry.BatchSize,
+			},
+		}, g, repoDB)
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		shardHost.Start()
+		defer shardHost.Stop()
+
+		dep.SetRouter(shardHost)
+	}
+
+	// ========= Purge the expired keys when this node is the leader
+	reaper := expiry.NewReaper(expiry.Config{
+		Interval:  conf.Expiry.Interval,
+		BatchSize: conf.Expiry.BatchSize,
+	}, g, repoDB)
+
+	reaper.Start()
+	defer reaper.Stop()
+
+	// ========= Export change log to JSONL file when this node is the leader
+	if conf.Cdc.Enabled && conf.Cdc.ExportDir != "" {
+		exporter := cdc.NewExporter(cdc.Config{
+			Dir:            conf.Cdc.ExportDir,
+			ChangesPerFile: conf.Cdc.ChangesPerFile,
+		}, g, repoDB)
+
+		if err := exporter.Start(); err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		defer exporter.Stop()
+	}
+
+	// ========= Ship the committed operations to the standby cluster when this node is the leader
+	var shipper *replication.Shipper
+	if len(conf.Replication.Targets) > 0 {
+		shipper = replication.NewShipper(replication.Config{
+			Targets:   conf.Replication.Targets,
+			Interval:  conf.Replication.Interval,
+			BatchSize: conf.Replication.BatchSize,
+			Timeout:   conf.Replication.Timeout,
+		}, g, repoDB)
+
+		if err := shipper.Start(); err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		defer shipper.Stop()
+
+		dep.AddStats(shipper.Stats)
+	}
+
+	// ========= Send leadership and membership events to the webhooks
+	for _, wh := range conf.Events.Webhooks {
+		notifier := webhook.NewNotifier(webhook.Config{
+			URL:        wh.URL,
+			Events:     wh.Events,
+			Secret:     wh.Secret,
+			Timeout:    wh.Timeout,
+			MaxRetries: wh.MaxRetries,
+		}, g)
+
+		if err := notifier.Start(); err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		defer notifier.Stop()
+	}
 
 	// ========= Start server with graceful shutdown
 	srv := server.NewServer(server.Config{
 		EnableProfiling: true,
-		ListenAddress:   fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port),
+		ListenAddress:   serverAddr,
+		Listener:        serverListener,
 		WriteTimeout:    3 * time.Second,
 		ReadTimeout:     3 * time.Second,
 		ZapLogger:       zapLogger,
@@ -78,18 +268,72 @@ func main() {
 	})
 
 	srv.RegisterRoutes(raftctrl.Routes(dep))
+	srv.RegisterRoutes(adminctrl.Routes(dep))
 	srv.RegisterRoutes(storectrl.Routes(dep))
+	srv.RegisterRoutes(zsetctrl.Routes(dep))
+	srv.RegisterRoutes(seqctrl.Routes(dep))
+	srv.RegisterRoutes(cdcctrl.Routes(dep))
+	srv.RegisterRoutes(replctrl.Routes(dep, shipper))
+
+	if shardHost != nil {
+		srv.RegisterRoutes(shardctrl.Routes(shardHost))
+	}
 
-	var apiErrChan = make(chan error, 1)
+	var apiErrChan = make(chan error, 3)
 	go func() {
 		apiErrChan <- srv.Start()
 	}()
 
+	// ========= Start optional redis protocol server, it shares the same gossip and repo as the HTTP API
+	if conf.Resp.Enabled {
+		respSrv := resp.NewServer(resp.Config{
+			ListenAddress: fmt.Sprintf("%s:%d", conf.Resp.Host, conf.Resp.Port),
+			IdleTimeout:   5 * time.Minute,
+			LeaderAddress: func() string {
+				return peerAddress(conf.Resp.Peers, g.Leader())
+			},
+		}, dep)
+
+		defer respSrv.Shutdown()
+
+		go func() {
+			apiErrChan <- respSrv.Start()
+		}()
+	}
+
+	// ========= Start optional memcached protocol server
+	if conf.Memcache.Enabled {
+		mcSrv := memcache.NewServer(memcache.Config{
+			ListenAddress: fmt.Sprintf("%s:%d", conf.Memcache.Host, conf.Memcache.Port),
+			IdleTimeout:   5 * time.Minute,
+			LeaderAddress: func() string {
+				return peerAddress(conf.Memcache.Peers, g.Leader())
+			},
+		}, dep)
+
+		defer mcSrv.Shutdown()
+
+		go func() {
+			apiErrChan <- mcSrv.Start()
+		}()
+	}
+
 	var signalChan = make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 	select {
 	case <-signalChan:
 		_, _ = fmt.Fprintf(os.Stdout, "exiting...\n")
+
+		// leader hand over the leadership before shutdown, so write is not unavailable until election timeout
+		drainTimeout := conf.Raft.DrainTimeout
+		if drainTimeout <= 0 {
+			drainTimeout = 5 * time.Second
+		}
+
+		if err := g.Drain(drainTimeout, conf.Raft.LeaveOnShutdown); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error drain: %s\n", err.Error())
+		}
+
 		srv.Shutdown()
 
 	case err := <-apiErrChan:
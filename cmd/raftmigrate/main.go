@@ -0,0 +1,30 @@
+// Command raftmigrate copy the bolt raft log store of a stopped node into the badger log store.
+// After migration, set raft.log_store: badger in config.yaml and start the node.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"ysf/canoe/gossip"
+)
+
+func main() {
+	dir := flag.String("dir", "", "raft volume_dir of the node, the node must be stopped")
+	flag.Parse()
+
+	if *dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	result, err := gossip.MigrateLogStore(*dir)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "migration failed: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("copied %d logs (index %d to %d) and %d stable keys\n",
+		result.Logs, result.FirstIndex, result.LastIndex, result.StableKeys)
+	fmt.Println("set raft.log_store: badger in config.yaml, then start the node")
+}
@@ -0,0 +1,100 @@
+// Command raftpeers show the raft state of a stopped node and write the peers.json used to recover lost quorum.
+//
+// Run it on every surviving node to compare their last index and configuration, then write the same peers.json
+// with the surviving servers in each node and start them again:
+//
+//	go run ./cmd/raftpeers -dir node_1_data
+//	go run ./cmd/raftpeers -dir node_1_data -keep node_1,node_2 -write
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"ysf/canoe/gossip"
+)
+
+func main() {
+	dir := flag.String("dir", "", "raft volume_dir of the node, the node must be stopped")
+	logStore := flag.String("log-store", gossip.LogStoreBolt, "raft.log_store of the node, bolt or badger")
+	keep := flag.String("keep", "", "comma separated id of the surviving servers, default is every server in the configuration")
+	write := flag.Bool("write", false, "write "+gossip.PeersFile+" in the raft dir with the kept servers")
+	flag.Parse()
+
+	if *dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	state, err := gossip.InspectRaftState(*dir, *logStore)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "read raft state failed: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("current term %d, last index %d term %d, snapshot index %d\n",
+		state.CurrentTerm, state.LastIndex, state.LastTerm, state.SnapshotIndex)
+	fmt.Printf("configuration at index %d:\n", state.ConfigurationIndex)
+	for _, p := range state.Configuration {
+		fmt.Printf("  %s at %s %s\n", p.ID, p.Address, suffrage(p))
+	}
+
+	if !state.HasState() {
+		_, _ = fmt.Fprintf(os.Stderr, "node has no raft state, bootstrap or join it instead\n")
+		os.Exit(1)
+	}
+
+	peers := state.Configuration
+	if *keep != "" {
+		peers, err = keepPeers(state.Configuration, strings.Split(*keep, ","))
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if !*write {
+		return
+	}
+
+	if err := gossip.WritePeersFile(*dir, peers); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "write %s failed: %s\n", gossip.PeersFile, err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("wrote %s with %d servers, write the same file in every surviving node, then start them\n",
+		gossip.PeersFile, len(peers))
+}
+
+// keepPeers return the servers with the ids, in the order of the configuration
+func keepPeers(configuration []gossip.PeerEntry, ids []string) ([]gossip.PeerEntry, error) {
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			wanted[id] = true
+		}
+	}
+
+	var peers []gossip.PeerEntry
+	for _, p := range configuration {
+		if wanted[p.ID] {
+			peers = append(peers, p)
+			delete(wanted, p.ID)
+		}
+	}
+
+	for id := range wanted {
+		return nil, fmt.Errorf("server %s is not in the configuration", id)
+	}
+
+	return peers, nil
+}
+
+func suffrage(p gossip.PeerEntry) string {
+	if p.NonVoter {
+		return gossip.SuffrageNonvoter
+	}
+
+	return gossip.SuffrageVoter
+}
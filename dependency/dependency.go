@@ -1,19 +1,94 @@
 package dependency
 
 import (
+	"encoding/json"
 	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
 )
 
+// Router run the operation in the raft group owning its keys, see multiraft.Host.
+type Router interface {
+	DoOperation(payload model.CommandPayload) (interface{}, error)
+	RepoFor(key string) (repo.Service, error)
+}
+
 type Dep struct {
-	raft gossip.Service
+	raft   gossip.Service
+	repo   repo.Service
+	router Router
+	stats  []func() map[string]string
 }
 
 func (d *Dep) GetGossip() gossip.Service {
 	return d.raft
 }
 
-func NewDep(raft gossip.Service) *Dep {
+// GetRepo return the local data repository.
+// Mutation must always go through GetGossip().DoOperation, so it is replicated.
+func (d *Dep) GetRepo() repo.Service {
+	return d.repo
+}
+
+// SetRouter route the operation sent using Do to the shard group owning the key.
+func (d *Dep) SetRouter(router Router) {
+	d.router = router
+}
+
+// Do run the operation in the raft group owning the keys when sharding is enabled, otherwise in the only group.
+func (d *Dep) Do(payload model.CommandPayload) (interface{}, error) {
+	if d.router != nil {
+		return d.router.DoOperation(payload)
+	}
+
+	return d.raft.DoOperation(payload)
+}
+
+// Sharded return true when the operation is routed to the shard groups, see SetRouter.
+func (d *Dep) Sharded() bool {
+	return d.router != nil
+}
+
+// DecodeResult copy the result returned by Do into out, which is the result type of the FSM such as fsm.CountResult.
+// Result of the operation forwarded to the leader of other shard group is decoded JSON, so it is converted through JSON.
+func DecodeResult(result, out interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// RepoFor return the local repository of the raft group owning the key.
+func (d *Dep) RepoFor(key string) (repo.Service, error) {
+	if d.router != nil {
+		return d.router.RepoFor(key)
+	}
+
+	return d.repo, nil
+}
+
+// AddStats add the stats of a background component, for example the replication shipper, to Stats.
+func (d *Dep) AddStats(stats func() map[string]string) {
+	d.stats = append(d.stats, stats)
+}
+
+// Stats return the raft stats of this node merged with the stats added using AddStats.
+func (d *Dep) Stats() map[string]string {
+	stats := d.raft.Stats()
+	for _, fn := range d.stats {
+		for k, v := range fn() {
+			stats[k] = v
+		}
+	}
+
+	return stats
+}
+
+func NewDep(raft gossip.Service, repo repo.Service) *Dep {
 	return &Dep{
 		raft: raft,
+		repo: repo,
 	}
 }
@@ -0,0 +1,126 @@
+package expiry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+)
+
+// Config of the Reaper
+type Config struct {
+	// Interval is how often the expired keys is looked up.
+	Interval time.Duration
+
+	// BatchSize is the maximum number of key purged by one PURGEEXPIRED command.
+	BatchSize int
+}
+
+// Reaper delete the expired keys from the repo, only when this node is the leader.
+//
+// Expired key is hidden by the FSM, which decide the expiry at the time stamped in the log entry by the leader,
+// but it is still saved until it is deleted. The leader look up the keys expired at its clock and replicate them
+// using PURGEEXPIRED command, the FSM only delete the key which is still expired at the time of the command,
+// so a key written again after it is looked up is kept.
+type Reaper struct {
+	conf   Config
+	raft   gossip.Service
+	repo   repo.Service
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	closed sync.Once
+}
+
+// Start run the purge loop in background until Stop is called.
+func (r *Reaper) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if !r.raft.IsLeader() {
+				continue
+			}
+
+			if err := r.purge(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "[EXPIRY] error purge expired keys: %s\n", err.Error())
+			}
+		}
+	}()
+}
+
+// Stop the purge loop.
+func (r *Reaper) Stop() {
+	r.closed.Do(func() {
+		close(r.stop)
+	})
+	r.wg.Wait()
+}
+
+// purge delete the expired keys batch by batch until no key is expired or a batch delete nothing.
+func (r *Reaper) purge() error {
+	for {
+		now := time.Now().Unix()
+		keys, err := r.repo.ExpiredKeys(now, r.conf.BatchSize)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+
+		resp, err := r.raft.DoOperation(model.CommandPayload{
+			Operation: fsm.OpPurgeExpired,
+			Keys:      keys,
+			Now:       now,
+		})
+
+		// the standby delete the keys when the primary purge them
+		if errors.Is(err, fsm.ErrReadOnly) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if result, ok := resp.(fsm.CountResult); !ok || result.Count == 0 || len(keys) < r.conf.BatchSize {
+			return nil
+		}
+
+		select {
+		case <-r.stop:
+			return nil
+		default:
+		}
+	}
+}
+
+// NewReaper return Reaper purging the expired keys of repo through raft.
+func NewReaper(conf Config, raft gossip.Service, repo repo.Service) *Reaper {
+	if conf.Interval <= 0 {
+		conf.Interval = time.Second
+	}
+
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1000
+	}
+
+	return &Reaper{
+		conf: conf,
+		raft: raft,
+		repo: repo,
+		stop: make(chan struct{}),
+	}
+}
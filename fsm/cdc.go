@@ -0,0 +1,151 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+
+	"github.com/hashicorp/raft"
+)
+
+// OpChangesExported save the offset of the last change exported by the leader, see cdc.Exporter.
+const OpChangesExported = "CDCEXPORTED"
+
+// keyState is the value of a key (or sorted set member) captured before and after the mutation.
+type keyState struct {
+	key    string
+	member string
+	value  json.RawMessage
+}
+
+// captureState return the current state of every key changed by the operation, nil for read only operation.
+func (s FSM) captureState(op string, payload model.CommandPayload) []keyState {
+	var states []keyState
+	switch op {
+	case "SET", OpAdd, OpReplace, OpCAS, OpTouch, OpExpire, OpIncr, OpDecr, OpIncrBy:
+		states = []keyState{{key: payload.Key}}
+	case OpDel, OpMSet:
+		states = make([]keyState, 0, len(payload.Keys))
+		for _, key := range payload.Keys {
+			states = append(states, keyState{key: key})
+		}
+	case OpZAdd, OpZIncrBy, OpZRem:
+		states = []keyState{{key: payload.Key, member: payload.Member}}
+	case OpSeqCreate, OpSeqReserve:
+		states = []keyState{{key: payload.Key}}
+	default:
+		return nil
+	}
+
+	for i := range states {
+		states[i].value = s.stateValue(op, states[i])
+	}
+
+	return states
+}
+
+// stateValue return the JSON value of the key, or nil when the key does not exist.
+func (s FSM) stateValue(op string, st keyState) json.RawMessage {
+	var (
+		value interface{}
+		err   error
+	)
+
+	switch op {
+	case OpZAdd, OpZIncrBy, OpZRem:
+		var (
+			score float64
+			ok    bool
+		)
+
+		score, ok, err = s.db.ZScore(st.key, st.member)
+		if ok {
+			value = score
+		}
+
+	case OpSeqCreate, OpSeqReserve:
+		var seq repo.Sequence
+		seq, err = s.db.SeqInfo(st.key)
+		if err == nil {
+			value = seq
+		} else {
+			// sequence does not exist yet
+			err = nil
+		}
+
+	default:
+		var items []*repo.Item
+		items, err = s.db.GetItems(st.key)
+		if err == nil && items[0] != nil {
+			if !items[0].Raw {
+				return items[0].Value
+			}
+
+			// raw bytes is written as base64 string
+			value = items[0].Value
+		}
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error capture state of %s: %s\n", st.key, err.Error())
+		return nil
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// recordChanges add one change for each key captured before the mutation to the pending changes of the log entry,
+// they are appended by appendChanges in the same transaction as the mutation.
+func (s FSM) recordChanges(log *raft.Log, op string, payload model.CommandPayload, before []keyState) {
+	for _, st := range before {
+		*s.changes = append(*s.changes, repo.Change{
+			Index:     log.Index,
+			Term:      log.Term,
+			Operation: op,
+			Key:       st.key,
+			Member:    st.member,
+			OldValue:  st.value,
+			NewValue:  s.stateValue(op, st),
+		})
+	}
+}
+
+// appendChanges save the changes recorded while applying the log entry.
+func (s FSM) appendChanges(log *raft.Log) error {
+	if err := s.db.AppendChanges(*s.changes, s.opt.CDCRetention); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error record changes of index %d: %s\n", log.Index, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// applyChangesExported only move forward, so a late command from old leader never move the checkpoint back.
+func (s FSM) applyChangesExported(payload model.CommandPayload) interface{} {
+	exported, err := s.db.ChangesExported()
+	if err != nil {
+		return err
+	}
+
+	if payload.Offset <= exported {
+		return exported
+	}
+
+	if err = s.db.SetChangesExported(payload.Offset); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error save exported change offset %s\n", err.Error())
+		return err
+	}
+
+	return payload.Offset
+}
@@ -0,0 +1,51 @@
+package fsm
+
+import (
+	"fmt"
+	"os"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+)
+
+// Counter operation names accepted in model.CommandPayload.Operation
+const (
+	OpIncr   = "INCR"
+	OpDecr   = "DECR"
+	OpIncrBy = "INCRBY"
+)
+
+// CounterResult is returned by INCR, DECR and INCRBY.
+type CounterResult struct {
+	Value int64 `json:"value"`
+}
+
+// applyCounter run the read-modify-write of counter inside the FSM,
+// so concurrent increments from different clients are never lost.
+func (s FSM) applyCounter(op string, payload model.CommandPayload) interface{} {
+	if payload.Key == "" {
+		return fmt.Errorf("empty key")
+	}
+
+	var delta int64
+	switch op {
+	case OpIncr:
+		delta = 1
+	case OpDecr:
+		delta = -1
+	case OpIncrBy:
+		delta = payload.Delta
+	}
+
+	value, err := s.db.IncrBy(payload.Key, delta, repo.CounterOptions{
+		Min:       payload.Min,
+		Max:       payload.Max,
+		Clamp:     payload.Clamp,
+		MustExist: payload.MustExist,
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error %s on key %s: %s\n", op, payload.Key, err.Error())
+		return err
+	}
+
+	return CounterResult{Value: value}
+}
@@ -1,7 +1,9 @@
 package fsm
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,8 +14,23 @@ import (
 	"github.com/hashicorp/raft"
 )
 
+// Options is the FSM behaviour which must be the same on every node, because it changes the replicated state.
+type Options struct {
+	// CDC record every committed mutation in the change log, see repo.Change.
+	CDC bool
+
+	// CDCRetention is the number of newest change kept in the change log, older change is deleted.
+	CDCRetention uint64
+}
+
 type FSM struct {
-	db repo.Service
+	db      repo.Service
+	opt     Options
+	fence   *fenceState
+	replica *replicaState
+
+	// changes is the change recorded while applying one log entry, see withRepo
+	changes *[]repo.Change
 }
 
 // Apply log is invoked once a log entry is committed.
@@ -23,41 +40,175 @@ type FSM struct {
 func (s FSM) Apply(log *raft.Log) interface{} {
 	switch log.Type {
 	case raft.LogCommand:
+		// After restart, raft re-apply the log entries since the last snapshot,
+		// but the data is already persisted in BadgerDB. Skip it, so operation such as ZINCRBY is not applied twice.
+		applied, err := s.db.AppliedIndex()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error get applied index %s\n", err.Error())
+			return err
+		}
+
+		if log.Index <= applied {
+			return nil
+		}
+
 		var payload = model.CommandPayload{}
 		if err := json.Unmarshal(log.Data, &payload); err != nil {
 			_, _ = fmt.Fprintf(os.Stderr, "error marshalling store payload %s\n", err.Error())
+			s.saveAppliedIndex(log.Index)
 			return nil
 		}
 
+		// The operation, its changes and the applied index is committed in one transaction,
+		// so the entry is either skipped or applied again completely when the node crash in the middle.
+		// Key expiry is decided at the time stamped by the leader, entry written before it is stamped never expire a key.
 		op := strings.ToUpper(strings.TrimSpace(payload.Operation))
-		switch op {
-		case "SET":
-			if err := s.db.Set(payload.Key, payload.Value); err != nil {
-				_, _ = fmt.Fprintf(os.Stderr, "error save data %s\n", err.Error())
-				return nil
+		var resp interface{}
+		err = s.db.Clock(payload.Now).Atomic(log.Index, func(tx repo.Service) error {
+			fs := s.withRepo(tx)
+			resp = fs.applyLog(log, op, payload)
+			if err, rejected := resp.(error); rejected {
+				return err
 			}
-			return payload.Value
-		case "GET":
-			return s.db.Get(payload.Key)
+
+			return fs.appendChanges(log)
+		})
+
+		if err == nil {
+			return resp
+		}
+
+		// Rejected operation is rejected again when replayed, so only the applied index is saved.
+		if _, rejected := resp.(error); rejected {
+			s.saveAppliedIndex(log.Index)
+			return resp
 		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "error commit operation %s\n", err.Error())
+		if err := s.reload(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error reload state %s\n", err.Error())
+		}
+
+		if (op == OpReplicate || op == OpReplicaSeed) && errors.Is(err, repo.ErrTxnTooBig) {
+			return ErrBatchTooBig
+		}
+
+		return err
 	}
 
 	_, _ = fmt.Fprintf(os.Stderr, "not raft log command type\n")
 	return nil
 }
 
-// snapshotNoop will be called during make snapshotNoop.
-// snapshotNoop is used to support log compaction.
-// No need to call snapshot since it already persisted in disk (using BoltDb) when raft calling Apply function.
-// TODO: using badger db to save snapshot in different directory?
+// applyLog run the operation of the log entry.
+func (s FSM) applyLog(log *raft.Log, op string, payload model.CommandPayload) interface{} {
+	if err := s.checkReadOnly(op); err != nil {
+		return err
+	}
+
+	switch op {
+	case OpReplicate, OpReplicaRole, OpReplicaSeed:
+		return s.applyReplica(log, op, payload)
+	case OpShardMap, OpShardFence, OpShardUnfence:
+		return s.applyShard(log.Index, op, payload)
+	}
+
+	return s.applyCommand(log, op, payload)
+}
+
+// withRepo return the FSM using db, it is used to run the operation in the transaction given by repo.Service.Atomic.
+// Change recorded by the returned FSM is kept until appendChanges.
+func (s FSM) withRepo(db repo.Service) FSM {
+	s.db = db
+	s.changes = &[]repo.Change{}
+	return s
+}
+
+// withClock return the FSM deciding key expiry at now, the recorded change is shared with s.
+func (s FSM) withClock(now int64) FSM {
+	s.db = s.db.Clock(now)
+	return s
+}
+
+func (s FSM) saveAppliedIndex(index uint64) {
+	if err := s.db.SetAppliedIndex(index); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error save applied index %s\n", err.Error())
+	}
+}
+
+// applyCommand run the operation and record the change when CDC is enabled.
+func (s FSM) applyCommand(log *raft.Log, op string, payload model.CommandPayload) interface{} {
+	if !s.opt.CDC {
+		return s.apply(op, payload)
+	}
+
+	// capture the value before and after the mutation for change data capture
+	before := s.captureState(op, payload)
+	resp := s.apply(op, payload)
+	if _, failed := resp.(error); !failed && before != nil {
+		s.recordChanges(log, op, payload, before)
+	}
+
+	return resp
+}
+
+// apply run the operation in payload against the repo.
+func (s FSM) apply(op string, payload model.CommandPayload) interface{} {
+	if err := s.checkFence(op, payload); err != nil {
+		return err
+	}
+
+	switch op {
+	case "SET":
+		if payload.Data != nil {
+			return s.applyItem(op, payload)
+		}
+
+		var err error
+		if payload.ExpireAt > 0 {
+			err = s.db.SetExpireAt(payload.Key, payload.Value, payload.ExpireAt)
+		} else {
+			err = s.db.Set(payload.Key, payload.Value)
+		}
+
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error save data %s\n", err.Error())
+			return nil
+		}
+		return payload.Value
+	case "GET":
+		return s.db.Get(payload.Key)
+	case OpZAdd, OpZIncrBy, OpZRem, OpZScore, OpZRank, OpZRange, OpZRangeByScore:
+		return s.applyZSet(op, payload)
+	case OpIncr, OpDecr, OpIncrBy:
+		return s.applyCounter(op, payload)
+	case OpSeqCreate, OpSeqReserve, OpSeqInfo:
+		return s.applySequence(op, payload)
+	case OpDel, OpExists, OpMGet, OpMSet, OpExpire, OpPurgeExpired:
+		return s.applyKeys(op, payload)
+	case OpAdd, OpReplace, OpCAS, OpTouch, OpGetItems:
+		return s.applyItem(op, payload)
+	case OpChangesExported:
+		return s.applyChangesExported(payload)
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "unknown operation %s\n", op)
+	return fmt.Errorf("unknown operation %s", op)
+}
+
+// Snapshot return the point-in-time copy of the repository, see SnapshotHeader for the format.
+// Raft compact the log up to the snapshot index after it is persisted.
 func (s FSM) Snapshot() (raft.FSMSnapshot, error) {
-	return newSnapshotNoop()
+	return newSnapshot(s.db)
 }
 
-// Restore is used to restore an FSM from a snapshotNoop. It is not called
+// Restore is used to restore an FSM from a snapshot. It is not called
 // concurrently with any other command. The FSM must discard all previous
 // state.
-// Restore will update all data in BadgerDB
+// The data in BadgerDB is kept when it already applied the snapshot index, which is the case when the node restart,
+// the log after the snapshot is then skipped by Apply until the applied index.
+// Restore stopped in the middle does not save the applied index, so the snapshot is restored again after restart.
+// Snapshot taken by older version is empty, the data is already persisted in BadgerDB so nothing is restored.
 func (s FSM) Restore(rClose io.ReadCloser) error {
 	defer func() {
 		if err := rClose.Close(); err != nil {
@@ -66,33 +217,79 @@ func (s FSM) Restore(rClose io.ReadCloser) error {
 	}()
 
 	_, _ = fmt.Fprintf(os.Stdout, "[START RESTORE] read all message from snapshot\n")
-	var totalRestored int
 
-	decoder := json.NewDecoder(rClose)
-	for decoder.More() {
-		var data = &model.CommandPayload{}
-		err := decoder.Decode(data)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] error decode data %s\n", err.Error())
-			return err
-		}
+	decoder := json.NewDecoder(bufio.NewReader(rClose))
 
-		if err := s.db.Set(data.Key, data.Value); err != nil {
-			_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] error persist data %s\n", err.Error())
-			return err
+	var header SnapshotHeader
+	if err := decoder.Decode(&header); err == io.EOF {
+		_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] empty snapshot, keep data in BadgerDB\n")
+		return nil
+	} else if err != nil {
+		_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] error decode header %s\n", err.Error())
+		return err
+	}
+
+	if header.Format != SnapshotFormat || header.Version != 1 {
+		return fmt.Errorf("unknown snapshot format %q version %d", header.Format, header.Version)
+	}
+
+	applied, err := s.db.AppliedIndex()
+	if err != nil {
+		return err
+	}
+
+	if applied >= header.AppliedIndex {
+		_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] applied index %d is not behind snapshot %d, keep data in BadgerDB\n",
+			applied, header.AppliedIndex)
+		return nil
+	}
+
+	var totalRestored int
+	err = s.db.Restore(func() (*repo.SnapshotEntry, error) {
+		var entry = &repo.SnapshotEntry{}
+		if err := decoder.Decode(entry); err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
 		}
 
 		totalRestored++
+		return entry, nil
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] error persist data %s\n", err.Error())
+		return err
+	}
+
+	if err := s.reload(); err != nil {
+		return err
 	}
 
-	// read closing bracket
-	_, err := decoder.Token()
+	_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] success restore %d entries until index %d\n", totalRestored, header.AppliedIndex)
+	return nil
+}
+
+// reload the cached state after the repository is replaced by a snapshot, or the transaction which changed it
+// is not committed.
+func (s FSM) reload() error {
+	fence, err := loadFence(s.db)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] error %s\n", err.Error())
 		return err
 	}
 
-	_, _ = fmt.Fprintf(os.Stdout, "[END RESTORE] success restore %d messages in snapshot\n", totalRestored)
+	replica, err := loadReplicaState(s.db)
+	if err != nil {
+		return err
+	}
+
+	s.fence.mu.Lock()
+	s.fence.parts = fence.parts
+	s.fence.mu.Unlock()
+
+	s.replica.mu.Lock()
+	s.replica.standby = replica.standby
+	s.replica.mu.Unlock()
+
 	return nil
 }
 
@@ -101,8 +298,21 @@ func (s FSM) Restore(rClose io.ReadCloser) error {
 // Finite State Machine (FSM) provides an interface that can be implemented by
 // clients to make use of the replicated log.
 // This is use BadgerDB. You can change it using other persistent database.
-func NewFSM(db repo.Service) (raft.FSM, error) {
+func NewFSM(db repo.Service, opt Options) (raft.FSM, error) {
+	fence, err := loadFence(db)
+	if err != nil {
+		return nil, err
+	}
+
+	replica, err := loadReplicaState(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FSM{
-		db: db,
+		db:      db,
+		opt:     opt,
+		fence:   fence,
+		replica: replica,
 	}, nil
 }
@@ -0,0 +1,208 @@
+package fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/hashicorp/raft"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newTestRepo(t *testing.T) repo.Service {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	s, _ := repo.NewBadger(db)
+	return s
+}
+
+func newLog(index uint64, payload model.CommandPayload) *raft.Log {
+	data, _ := json.Marshal(payload)
+	return &raft.Log{Index: index, Term: 1, Type: raft.LogCommand, Data: data}
+}
+
+// crashRepo panic after the operation run in Atomic but before the transaction is committed, like a process crash.
+type crashRepo struct {
+	repo.Service
+}
+
+func (c crashRepo) Atomic(index uint64, fn func(tx repo.Service) error) error {
+	return c.Service.Atomic(index, func(tx repo.Service) error {
+		_ = fn(tx)
+		panic("crash")
+	})
+}
+
+func (c crashRepo) Clock(now int64) repo.Service {
+	return crashRepo{c.Service.Clock(now)}
+}
+
+func TestFSM_Apply(t *testing.T) {
+	convey.Convey("Apply log entry", t, func() {
+		db := newTestRepo(t)
+		f, err := NewFSM(db, Options{CDC: true})
+		convey.So(err, convey.ShouldBeNil)
+
+		incr := newLog(5, model.CommandPayload{Operation: OpZIncrBy, Key: "z", Member: "a", Score: 10})
+
+		convey.Convey("Replayed entry is skipped", func() {
+			convey.So(f.Apply(incr), convey.ShouldResemble, ZScoreResult{Exist: true, Score: 10})
+			convey.So(f.Apply(incr), convey.ShouldBeNil)
+
+			score, _, _ := db.ZScore("z", "a")
+			convey.So(score, convey.ShouldEqual, 10)
+		})
+
+		convey.Convey("Entry is applied exactly once when replayed after crash in the middle", func() {
+			crashed, _ := NewFSM(crashRepo{db}, Options{CDC: true})
+			convey.So(func() { crashed.Apply(incr) }, convey.ShouldPanic)
+
+			applied, _ := db.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 0)
+			_, ok, _ := db.ZScore("z", "a")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			// restart and replay the log since the last snapshot
+			restarted, _ := NewFSM(db, Options{CDC: true})
+			convey.So(restarted.Apply(incr), convey.ShouldResemble, ZScoreResult{Exist: true, Score: 10})
+			convey.So(restarted.Apply(incr), convey.ShouldBeNil)
+
+			score, _, _ := db.ZScore("z", "a")
+			convey.So(score, convey.ShouldEqual, 10)
+
+			applied, _ = db.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 5)
+
+			_, _, last, _ := db.Changes(1, 10)
+			convey.So(last, convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Rejected entry still advance the applied index", func() {
+			resp := f.Apply(newLog(6, model.CommandPayload{Operation: OpZIncrBy, Member: "a", Score: 1}))
+			convey.So(resp, convey.ShouldBeError)
+
+			applied, _ := db.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 6)
+		})
+
+		convey.Convey("Expiry is decided at the time stamped by the leader, not when the entry is applied", func() {
+			set := newLog(6, model.CommandPayload{Operation: "SET", Key: "k", Value: "5", ExpireAt: 110, Now: 100})
+			incr := newLog(7, model.CommandPayload{Operation: OpIncr, Key: "k", Now: 105})
+			get := newLog(8, model.CommandPayload{Operation: OpGetItems, Keys: []string{"k"}, Now: 110})
+
+			// the local clock is far after the expiry time, like a follower catching up late
+			convey.So(f.Apply(set), convey.ShouldEqual, "5")
+			convey.So(f.Apply(incr), convey.ShouldResemble, CounterResult{Value: 6})
+
+			items, _ := db.Clock(109).GetItems("k")
+			convey.So(items[0].ExpireAt, convey.ShouldEqual, 110)
+			convey.So(f.Apply(get), convey.ShouldResemble, []*repo.Item{nil})
+
+			purge := newLog(9, model.CommandPayload{Operation: OpPurgeExpired, Keys: []string{"k"}, Now: 110})
+			convey.So(f.Apply(purge), convey.ShouldResemble, CountResult{Count: 1})
+		})
+	})
+}
+
+func TestFSM_ApplyReplicate(t *testing.T) {
+	convey.Convey("Apply replicated batch in standby", t, func() {
+		db := newTestRepo(t)
+		f, _ := NewFSM(db, Options{})
+		convey.So(f.Apply(newLog(1, model.CommandPayload{Operation: OpReplicaRole, Value: repo.RoleStandby})), convey.ShouldHaveSameTypeAs, repo.ReplicaState{})
+
+		var commands []model.CommittedCommand
+		for i, key := range []string{"a", "b", "c"} {
+			data, _ := json.Marshal(model.CommandPayload{Operation: OpIncrBy, Key: key, Delta: 1})
+			commands = append(commands, model.CommittedCommand{Index: uint64(i + 10), Term: 1, Data: data})
+		}
+
+		data, _ := json.Marshal(ReplicateBatch{From: 1, Last: 12, Commands: commands})
+		batch := newLog(2, model.CommandPayload{Operation: OpReplicate, Data: data})
+
+		convey.Convey("Batch and checkpoint is not applied partly when the node crash in the middle", func() {
+			crashed, _ := NewFSM(crashRepo{db}, Options{})
+			convey.So(func() { crashed.Apply(batch) }, convey.ShouldPanic)
+
+			state, _ := db.ReplicaState()
+			convey.So(state.AppliedIndex, convey.ShouldEqual, 0)
+			ok, _ := db.Has("a")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			restarted, _ := NewFSM(db, Options{})
+			resp := restarted.Apply(batch)
+			convey.So(resp, convey.ShouldHaveSameTypeAs, repo.ReplicaState{})
+			convey.So(resp.(repo.ReplicaState).AppliedIndex, convey.ShouldEqual, 12)
+
+			// the same batch shipped again by a new primary leader is skipped
+			again, _ := json.Marshal(ReplicateBatch{From: 10, Last: 12, Commands: commands})
+			restarted.Apply(newLog(3, model.CommandPayload{Operation: OpReplicate, Data: again}))
+
+			items, _ := db.GetItems("a", "b", "c")
+			for _, item := range items {
+				convey.So(string(item.Value), convey.ShouldEqual, "1")
+			}
+		})
+	})
+}
+
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+type failReader struct{}
+
+func (failReader) Read([]byte) (int, error) { return 0, errors.New("killed") }
+
+func TestFSM_Restore(t *testing.T) {
+	convey.Convey("Restore snapshot", t, func() {
+		source := newTestRepo(t)
+		for i := 0; i < 16; i++ {
+			_ = source.Set(fmt.Sprintf("big-%02d", i), strings.Repeat("x", 1<<20))
+		}
+		_ = source.SetAppliedIndex(20)
+
+		f, _ := NewFSM(source, Options{})
+		snap, err := f.Snapshot()
+		convey.So(err, convey.ShouldBeNil)
+
+		sink := &bufferSink{}
+		convey.So(snap.Persist(sink), convey.ShouldBeNil)
+		data := sink.Bytes()
+
+		convey.Convey("Restore killed halfway is done again after restart", func() {
+			db := newTestRepo(t)
+			target, _ := NewFSM(db, Options{})
+
+			half := io.MultiReader(bytes.NewReader(data[:len(data)*3/4]), failReader{})
+			convey.So(target.Restore(ioutil.NopCloser(half)), convey.ShouldNotBeNil)
+
+			restarted, _ := NewFSM(db, Options{})
+			convey.So(restarted.Restore(ioutil.NopCloser(bytes.NewReader(data))), convey.ShouldBeNil)
+
+			applied, _ := db.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 20)
+
+			ok, _ := db.Has("big-15")
+			convey.So(ok, convey.ShouldBeTrue)
+		})
+	})
+}
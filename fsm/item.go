@@ -0,0 +1,76 @@
+package fsm
+
+import (
+	"fmt"
+	"os"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+)
+
+// Item operation names accepted in model.CommandPayload.Operation.
+// SET is also handled here when payload.Data is not nil.
+const (
+	OpAdd      = "ADD"
+	OpReplace  = "REPLACE"
+	OpCAS      = "CAS"
+	OpTouch    = "TOUCH"
+	OpGetItems = "GETITEMS"
+)
+
+// ItemResult is returned by SET with Data, ADD, REPLACE and CAS.
+type ItemResult struct {
+	Revision uint64 `json:"revision"`
+}
+
+// applyItem run operation which work with the stored bytes and its metadata.
+// GETITEMS return []*repo.Item, nil for missing key. TOUCH return CountResult.
+func (s FSM) applyItem(op string, payload model.CommandPayload) interface{} {
+	var (
+		resp interface{}
+		err  error
+	)
+
+	opt := repo.SetOptions{
+		Mode:     repo.SetAlways,
+		ExpireAt: payload.ExpireAt,
+		Flags:    payload.Flags,
+		Raw:      payload.Raw,
+	}
+
+	switch op {
+	case "SET", OpAdd, OpReplace, OpCAS:
+		switch op {
+		case OpAdd:
+			opt.Mode = repo.SetIfAbsent
+		case OpReplace:
+			opt.Mode = repo.SetIfPresent
+		case OpCAS:
+			if payload.Revision == 0 {
+				return fmt.Errorf("empty revision")
+			}
+			opt.Revision = payload.Revision
+		}
+
+		var rev uint64
+		rev, err = s.db.SetItem(payload.Key, payload.Data, opt)
+		resp = ItemResult{Revision: rev}
+
+	case OpTouch:
+		var ok bool
+		ok, err = s.db.Expire(payload.Key, payload.ExpireAt)
+		resp = CountResult{}
+		if ok {
+			resp = CountResult{Count: 1}
+		}
+
+	case OpGetItems:
+		resp, err = s.db.GetItems(payload.Keys...)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error %s on key %s: %s\n", op, payload.Key, err.Error())
+		return err
+	}
+
+	return resp
+}
@@ -0,0 +1,93 @@
+package fsm
+
+import (
+	"fmt"
+	"os"
+	"ysf/canoe/model"
+)
+
+// Multi-key operation names accepted in model.CommandPayload.Operation
+const (
+	OpDel    = "DEL"
+	OpExists = "EXISTS"
+	OpMGet   = "MGET"
+	OpMSet   = "MSET"
+	OpExpire = "EXPIRE"
+
+	// OpPurgeExpired delete the Keys which are expired at the time of the log entry, see expiry.Reaper.
+	OpPurgeExpired = "PURGEEXPIRED"
+)
+
+// CountResult is returned by DEL, EXISTS, EXPIRE and PURGEEXPIRED.
+type CountResult struct {
+	Count int `json:"count"`
+}
+
+// applyKeys run operation on plain key value. Unlike GET, MGET return nil for missing key.
+func (s FSM) applyKeys(op string, payload model.CommandPayload) interface{} {
+	var (
+		resp interface{}
+		err  error
+	)
+
+	switch op {
+	case OpDel:
+		var n int
+		n, err = s.db.Delete(payload.Keys...)
+		resp = CountResult{Count: n}
+
+	case OpExists:
+		var n int
+		for _, key := range payload.Keys {
+			var ok bool
+			ok, err = s.db.Has(key)
+			if err != nil {
+				break
+			}
+
+			if ok {
+				n++
+			}
+		}
+		resp = CountResult{Count: n}
+
+	case OpMGet:
+		values := make([]interface{}, len(payload.Keys))
+		for i, key := range payload.Keys {
+			var ok bool
+			ok, err = s.db.Has(key)
+			if err != nil {
+				break
+			}
+
+			if ok {
+				values[i] = s.db.Get(key)
+			}
+		}
+		resp = values
+
+	case OpMSet:
+		err = s.db.MSet(payload.Keys, payload.Values)
+		resp = CountResult{Count: len(payload.Keys)}
+
+	case OpPurgeExpired:
+		var n int
+		n, err = s.db.PurgeExpired(payload.Keys...)
+		resp = CountResult{Count: n}
+
+	case OpExpire:
+		var ok bool
+		ok, err = s.db.Expire(payload.Key, payload.ExpireAt)
+		resp = CountResult{}
+		if ok {
+			resp = CountResult{Count: 1}
+		}
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error %s: %s\n", op, err.Error())
+		return err
+	}
+
+	return resp
+}
@@ -0,0 +1,316 @@
+package fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+
+	"github.com/hashicorp/raft"
+)
+
+// Cross-cluster replication operation names accepted in model.CommandPayload.Operation
+const (
+	// OpReplicate apply the operations shipped from the primary cluster, Data is ReplicateBatch.
+	OpReplicate = "REPLICATE"
+
+	// OpReplicaRole change the replication role to Value, repo.RoleStandby or repo.RolePrimary.
+	OpReplicaRole = "REPLROLE"
+
+	// OpReplicaSeed copy the data of the primary cluster into the standby, Data is SeedBatch.
+	OpReplicaSeed = "REPLSEED"
+)
+
+var (
+	// ErrReadOnly is returned by write operation sent to the standby cluster.
+	ErrReadOnly = errors.New("cluster is a read-only standby, promote it to accept write")
+
+	// ErrNotStandby is returned by OpReplicate when the cluster is not a standby, for example after it is promoted.
+	ErrNotStandby = errors.New("cluster is not a standby")
+
+	// ErrStandbyNotEmpty is returned when the cluster with data is made standby, the standby must start from empty.
+	ErrStandbyNotEmpty = errors.New("cluster has data, standby must start empty")
+
+	// ErrSeedIncomplete is returned by OpReplicate while the standby is seeded, the seed must be completed first.
+	ErrSeedIncomplete = errors.New("standby seed is not completed")
+
+	// ErrBatchTooBig is returned by OpReplicate and OpReplicaSeed when the batch does not fit in one transaction, nothing is applied.
+	ErrBatchTooBig = errors.New("replicate batch is too big for one transaction, ship fewer commands")
+)
+
+// ReplicateBatch is the operations shipped from the primary cluster, From is the first raft index of the batch
+// and Last is the last raft index examined by the primary, which may be after the last command.
+type ReplicateBatch struct {
+	From     uint64                   `json:"from"`
+	Last     uint64                   `json:"last"`
+	Time     int64                    `json:"time"`
+	Commands []model.CommittedCommand `json:"commands"`
+}
+
+// SeedBatch is the copy of the primary data at Index, shipped when the log the standby need is already compacted.
+// The seed start with Clear batches, each deleting at most Clear keys of the standby data until nothing is left.
+// The data is then sent in Entries batches, and the Done batch set the standby applied index to Index,
+// so the primary continue shipping the log after it.
+type SeedBatch struct {
+	Index   uint64               `json:"index"`
+	Time    int64                `json:"time"`
+	Clear   int                  `json:"clear,omitempty"`
+	Entries []repo.SnapshotEntry `json:"entries,omitempty"`
+	Done    bool                 `json:"done,omitempty"`
+}
+
+// SeedResult is returned by OpReplicaSeed, Cleared is the number of key deleted by the Clear batch.
+type SeedResult struct {
+	repo.ReplicaState
+	Cleared int `json:"cleared"`
+}
+
+// ErrReplicationGap is returned when the batch does not continue from the applied index of the standby,
+// the primary must ship again from Applied + 1.
+type ErrReplicationGap struct {
+	Applied uint64
+}
+
+func (e ErrReplicationGap) Error() string {
+	return fmt.Sprintf("replication gap, standby applied index is %d", e.Applied)
+}
+
+// readOnlyOps is allowed on the standby, CDCEXPORTED is the checkpoint of the standby own change log exporter
+var readOnlyOps = map[string]bool{
+	"GET":             true,
+	OpMGet:            true,
+	OpExists:          true,
+	OpGetItems:        true,
+	OpZScore:          true,
+	OpZRank:           true,
+	OpZRange:          true,
+	OpZRangeByScore:   true,
+	OpSeqInfo:         true,
+	OpChangesExported: true,
+	OpReplicate:       true,
+	OpReplicaRole:     true,
+	OpReplicaSeed:     true,
+}
+
+// replicaState is the cached role of this cluster, it is checked before every operation.
+type replicaState struct {
+	mu      sync.RWMutex
+	standby bool
+}
+
+func loadReplicaState(db repo.Service) (*replicaState, error) {
+	state, err := db.ReplicaState()
+	if err != nil {
+		return nil, err
+	}
+
+	return &replicaState{standby: state.Role == repo.RoleStandby}, nil
+}
+
+func (r *replicaState) isStandby() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.standby
+}
+
+// checkReadOnly return ErrReadOnly when the operation changes the data of the standby.
+func (s FSM) checkReadOnly(op string) error {
+	if !readOnlyOps[op] && s.replica.isStandby() {
+		return ErrReadOnly
+	}
+
+	return nil
+}
+
+func (s FSM) applyReplica(log *raft.Log, op string, payload model.CommandPayload) interface{} {
+	var (
+		resp interface{}
+		err  error
+	)
+
+	switch op {
+	case OpReplicate:
+		resp, err = s.applyReplicate(log, payload)
+	case OpReplicaRole:
+		resp, err = s.applyReplicaRole(payload)
+	case OpReplicaSeed:
+		resp, err = s.applySeed(payload)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error %s: %s\n", op, err.Error())
+		return err
+	}
+
+	return resp
+}
+
+func (s FSM) applyReplicaRole(payload model.CommandPayload) (interface{}, error) {
+	role, _ := payload.Value.(string)
+
+	s.replica.mu.Lock()
+	defer s.replica.mu.Unlock()
+
+	state, err := s.db.ReplicaState()
+	if err != nil {
+		return nil, err
+	}
+
+	switch role {
+	case repo.RoleStandby:
+		if state.Role == repo.RoleStandby {
+			return state, nil
+		}
+
+		var found bool
+		if err := s.db.ForEachKey(func(string) bool {
+			found = true
+			return false
+		}); err != nil {
+			return nil, err
+		}
+
+		if found {
+			return nil, ErrStandbyNotEmpty
+		}
+
+		state = repo.ReplicaState{Role: repo.RoleStandby}
+
+	case repo.RolePrimary:
+		if state.SeedIndex != 0 {
+			return nil, ErrSeedIncomplete
+		}
+
+		// the applied index is kept, so the operator know the last primary operation in this cluster
+		state.Role = repo.RolePrimary
+
+	default:
+		return nil, fmt.Errorf("unknown replication role %q, use %s or %s", role, repo.RoleStandby, repo.RolePrimary)
+	}
+
+	if err := s.db.SetReplicaState(state); err != nil {
+		return nil, err
+	}
+
+	s.replica.standby = state.Role == repo.RoleStandby
+	return state, nil
+}
+
+// applyReplicate apply the commands of the primary in its raft index order, then save the primary index as checkpoint.
+// Command which is already applied is skipped, so shipping the same batch twice is safe.
+// The commands and the checkpoint is committed in the transaction of the log entry, so the batch is applied completely
+// or not at all.
+func (s FSM) applyReplicate(log *raft.Log, payload model.CommandPayload) (interface{}, error) {
+	var batch ReplicateBatch
+	if err := json.Unmarshal(payload.Data, &batch); err != nil {
+		return nil, fmt.Errorf("invalid replicate batch: %w", err)
+	}
+
+	state, err := s.db.ReplicaState()
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Role != repo.RoleStandby {
+		return nil, ErrNotStandby
+	}
+
+	if state.SeedIndex != 0 {
+		return nil, ErrSeedIncomplete
+	}
+
+	if batch.Last <= state.AppliedIndex {
+		return state, nil
+	}
+
+	if batch.From > state.AppliedIndex+1 {
+		return nil, ErrReplicationGap{Applied: state.AppliedIndex}
+	}
+
+	for _, cmd := range batch.Commands {
+		// the batch may overlap with the applied one, when the primary read the state from a lagging standby node
+		if cmd.Index <= state.AppliedIndex {
+			continue
+		}
+
+		var shipped = model.CommandPayload{}
+		if err := json.Unmarshal(cmd.Data, &shipped); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error unmarshal replicated command %d %s\n", cmd.Index, err.Error())
+			continue
+		}
+
+		op := strings.ToUpper(strings.TrimSpace(shipped.Operation))
+		switch op {
+		case OpReplicate, OpReplicaRole, OpReplicaSeed, OpChangesExported, OpShardMap, OpShardFence, OpShardUnfence:
+			// the state of the primary cluster itself is not replicated
+			continue
+		}
+
+		// rejected command is rejected the same way as in the primary, so the error is ignored
+		s.withClock(shipped.Now).applyCommand(log, op, shipped)
+	}
+
+	state.AppliedIndex = batch.Last
+	state.UpdatedAt = batch.Time
+	if err := s.db.SetReplicaState(state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// applySeed replace the data of the standby with the copy of the primary, see SeedBatch.
+// A new seed always start with Clear, so the data left by a seed stopped in the middle is deleted first.
+func (s FSM) applySeed(payload model.CommandPayload) (interface{}, error) {
+	var batch SeedBatch
+	if err := json.Unmarshal(payload.Data, &batch); err != nil {
+		return nil, fmt.Errorf("invalid seed batch: %w", err)
+	}
+
+	state, err := s.db.ReplicaState()
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Role != repo.RoleStandby {
+		return nil, ErrNotStandby
+	}
+
+	var result SeedResult
+	switch {
+	case batch.Clear > 0:
+		if result.Cleared, err = s.db.ClearData(batch.Clear); err != nil {
+			return nil, err
+		}
+
+		state.SeedIndex = batch.Index
+		state.AppliedIndex = 0
+
+	case state.SeedIndex != batch.Index:
+		return nil, fmt.Errorf("seed of primary index %d is not started, clear the standby first", batch.Index)
+
+	default:
+		if err := s.db.SeedData(batch.Entries); errors.Is(err, repo.ErrTxnTooBig) {
+			return nil, ErrBatchTooBig
+		} else if err != nil {
+			return nil, err
+		}
+
+		if batch.Done {
+			state.SeedIndex = 0
+			state.AppliedIndex = batch.Index
+			state.UpdatedAt = batch.Time
+		}
+	}
+
+	if err := s.db.SetReplicaState(state); err != nil {
+		return nil, err
+	}
+
+	result.ReplicaState = state
+	return result, nil
+}
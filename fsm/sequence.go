@@ -0,0 +1,42 @@
+package fsm
+
+import (
+	"fmt"
+	"os"
+	"ysf/canoe/model"
+)
+
+// Sequence operation names accepted in model.CommandPayload.Operation
+const (
+	OpSeqCreate  = "SEQCREATE"
+	OpSeqReserve = "SEQRESERVE"
+	OpSeqInfo    = "SEQINFO"
+)
+
+// applySequence run sequence operation, it returns repo.Sequence or repo.Reservation.
+func (s FSM) applySequence(op string, payload model.CommandPayload) interface{} {
+	if payload.Key == "" {
+		return fmt.Errorf("empty sequence name")
+	}
+
+	var (
+		resp interface{}
+		err  error
+	)
+
+	switch op {
+	case OpSeqCreate:
+		resp, err = s.db.SeqCreate(payload.Key, payload.Start)
+	case OpSeqReserve:
+		resp, err = s.db.SeqReserve(payload.Key, payload.Count)
+	case OpSeqInfo:
+		resp, err = s.db.SeqInfo(payload.Key)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error %s on sequence %s: %s\n", op, payload.Key, err.Error())
+		return err
+	}
+
+	return resp
+}
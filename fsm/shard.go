@@ -0,0 +1,197 @@
+package fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+	"ysf/canoe/shard"
+)
+
+// Shard operation names accepted in model.CommandPayload.Operation
+const (
+	// OpShardMap replace the shard map with Data, Revision is the version of the current map.
+	// It is applied only by the default group, which replicate the map to every node.
+	OpShardMap = "SHARDMAP"
+
+	// OpShardFence stop serving the part in Data, because it is given to another group. It returns FenceResult.
+	// The part is not scanned here, the caller check it has no key once the fence is applied, see multiraft.Host.AddGroup.
+	OpShardFence = "SHARDFENCE"
+
+	// OpShardUnfence serve the part in Data again, used when the shard map update is failed after the fence.
+	OpShardUnfence = "SHARDUNFENCE"
+)
+
+var (
+	// ErrKeyMoved is returned by operation on key which is owned by another group, the caller use outdated shard map.
+	ErrKeyMoved = errors.New("key is moved to another shard group, refresh the shard map")
+
+	// ErrPartNotEmpty is returned when the part given to another group has key.
+	ErrPartNotEmpty = errors.New("shard part has existing key, moving data between groups is not supported")
+
+	// ErrShardMapVersion is returned by OpShardMap when the map is changed by others since it is read.
+	ErrShardMapVersion = errors.New("shard map is changed concurrently, retry with the latest version")
+)
+
+// FenceResult is returned by OpShardFence. Index is the log index of the fence, once a replica applied it,
+// no key is added to the part anymore, so the keys found in the replica is final.
+type FenceResult struct {
+	Index uint64 `json:"index"`
+}
+
+// fenceState is the cached parts fenced in this group, it is checked before every operation.
+type fenceState struct {
+	mu    sync.RWMutex
+	parts []shard.Part
+}
+
+func loadFence(db repo.Service) (*fenceState, error) {
+	data, err := db.ShardFence()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fenceState{}
+	if data != nil {
+		if err := json.Unmarshal(data, &f.parts); err != nil {
+			return nil, fmt.Errorf("invalid shard fence: %w", err)
+		}
+	}
+
+	return f, nil
+}
+
+func (f *fenceState) contains(key string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, p := range f.parts {
+		if p.Contains(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkFence return ErrKeyMoved when one of the key used by the operation is fenced.
+func (s FSM) checkFence(op string, payload model.CommandPayload) error {
+	switch op {
+	case OpChangesExported, OpPurgeExpired:
+		// expired key in the moved part is still purged, it is not visible in either keyspace
+		return nil
+	}
+
+	if s.fence.contains(payload.Key) {
+		return ErrKeyMoved
+	}
+
+	for _, key := range payload.Keys {
+		if s.fence.contains(key) {
+			return ErrKeyMoved
+		}
+	}
+
+	return nil
+}
+
+func (s FSM) applyShard(index uint64, op string, payload model.CommandPayload) interface{} {
+	var (
+		resp interface{}
+		err  error
+	)
+
+	switch op {
+	case OpShardMap:
+		resp, err = s.applyShardMap(payload)
+	case OpShardFence, OpShardUnfence:
+		if err = s.applyFence(op, payload); err == nil && op == OpShardFence {
+			resp = FenceResult{Index: index}
+		}
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error %s: %s\n", op, err.Error())
+		return err
+	}
+
+	return resp
+}
+
+func (s FSM) applyShardMap(payload model.CommandPayload) (interface{}, error) {
+	var next shard.Map
+	if err := json.Unmarshal(payload.Data, &next); err != nil {
+		return nil, fmt.Errorf("invalid shard map: %w", err)
+	}
+
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	current, err := s.db.ShardMap()
+	if err != nil {
+		return nil, err
+	}
+
+	var version uint64
+	if current != nil {
+		var cur shard.Map
+		if err := json.Unmarshal(current, &cur); err != nil {
+			return nil, fmt.Errorf("invalid current shard map: %w", err)
+		}
+
+		version = cur.Version
+	}
+
+	if payload.Revision != version || next.Version != version+1 {
+		return nil, ErrShardMapVersion
+	}
+
+	if err := s.db.SetShardMap(payload.Data); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+func (s FSM) applyFence(op string, payload model.CommandPayload) error {
+	var part shard.Part
+	if err := json.Unmarshal(payload.Data, &part); err != nil {
+		return fmt.Errorf("invalid shard part: %w", err)
+	}
+
+	s.fence.mu.Lock()
+	defer s.fence.mu.Unlock()
+
+	parts := make([]shard.Part, 0, len(s.fence.parts)+1)
+	if op == OpShardFence {
+		parts = append(append(parts, s.fence.parts...), part)
+	} else {
+		for _, p := range s.fence.parts {
+			if !samePart(p, part) {
+				parts = append(parts, p)
+			}
+		}
+	}
+
+	data, err := json.Marshal(parts)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.SetShardFence(data); err != nil {
+		return err
+	}
+
+	s.fence.parts = parts
+	return nil
+}
+
+func samePart(a, b shard.Part) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
@@ -0,0 +1,66 @@
+package fsm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"ysf/canoe/repo"
+
+	"github.com/hashicorp/raft"
+)
+
+// SnapshotFormat is written in the first line of the snapshot, so the file can be recognized when inspected offline.
+const SnapshotFormat = "canoe-fsm-snapshot"
+
+// SnapshotHeader is the first line of the snapshot, it is followed by one repo.SnapshotEntry per line.
+// AppliedIndex is the last raft index applied to the data in the snapshot.
+type SnapshotHeader struct {
+	Format       string `json:"format"`
+	Version      int    `json:"version"`
+	AppliedIndex uint64 `json:"applied_index"`
+}
+
+type snapshot struct {
+	applied uint64
+	data    repo.Snapshot
+}
+
+// Persist write the header and every entry of the repository snapshot as JSON lines.
+func (s snapshot) Persist(sink raft.SnapshotSink) error {
+	w := bufio.NewWriter(sink)
+	encoder := json.NewEncoder(w)
+
+	err := encoder.Encode(SnapshotHeader{Format: SnapshotFormat, Version: 1, AppliedIndex: s.applied})
+	if err == nil {
+		err = s.data.ForEach(func(entry repo.SnapshotEntry) error {
+			return encoder.Encode(entry)
+		})
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s snapshot) Release() {
+	s.data.Release()
+}
+
+// newSnapshot is returned by an FSM in response to a snapshot.
+// Raft does not call Apply while it is taken, so the applied index match the repository snapshot,
+// and Persist is safe to run with concurrent calls to Apply.
+func newSnapshot(db repo.Service) (raft.FSMSnapshot, error) {
+	applied, err := db.AppliedIndex()
+	if err != nil {
+		return nil, fmt.Errorf("read applied index: %w", err)
+	}
+
+	return &snapshot{applied: applied, data: db.Snapshot()}, nil
+}
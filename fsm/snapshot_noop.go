@@ -1,19 +0,0 @@
-package fsm
-
-import (
-	"github.com/hashicorp/raft"
-)
-
-type snapshotNoop struct{}
-
-// Persist persist to disk. Return nil on success, otherwise return error.
-func (s snapshotNoop) Persist(_ raft.SnapshotSink) error { return nil }
-
-func (s snapshotNoop) Release() {}
-
-// newSnapshotNoop is returned by an FSM in response to a snapshotNoop
-// It must be safe to invoke FSMSnapshot methods with concurrent
-// calls to Apply.
-func newSnapshotNoop() (raft.FSMSnapshot, error) {
-	return &snapshotNoop{}, nil
-}
@@ -0,0 +1,102 @@
+package fsm
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"ysf/canoe/model"
+)
+
+// Sorted set operation names accepted in model.CommandPayload.Operation
+const (
+	OpZAdd          = "ZADD"
+	OpZIncrBy       = "ZINCRBY"
+	OpZRem          = "ZREM"
+	OpZScore        = "ZSCORE"
+	OpZRank         = "ZRANK"
+	OpZRange        = "ZRANGE"
+	OpZRangeByScore = "ZRANGEBYSCORE"
+)
+
+// ZAddResult is returned by ZADD.
+type ZAddResult struct {
+	Added bool `json:"added"`
+}
+
+// ZRemResult is returned by ZREM.
+type ZRemResult struct {
+	Removed bool `json:"removed"`
+}
+
+// ZScoreResult is returned by ZINCRBY and ZSCORE. Exist is false when member is not in the set.
+type ZScoreResult struct {
+	Exist bool    `json:"exist"`
+	Score float64 `json:"score"`
+}
+
+// ZRankResult is returned by ZRANK. Rank is zero based, lowest score has rank 0.
+type ZRankResult struct {
+	Exist bool  `json:"exist"`
+	Rank  int64 `json:"rank"`
+}
+
+// applyZSet run sorted set operation. Error is returned as value, so it will be available in ApplyFuture.
+func (s FSM) applyZSet(op string, payload model.CommandPayload) interface{} {
+	if payload.Key == "" {
+		return fmt.Errorf("empty key")
+	}
+
+	var (
+		resp interface{}
+		err  error
+	)
+
+	switch op {
+	case OpZAdd:
+		var added bool
+		added, err = s.db.ZAdd(payload.Key, payload.Member, payload.Score)
+		resp = ZAddResult{Added: added}
+
+	case OpZIncrBy:
+		var score float64
+		score, err = s.db.ZIncrBy(payload.Key, payload.Member, payload.Score)
+		resp = ZScoreResult{Exist: true, Score: score}
+
+	case OpZRem:
+		var removed bool
+		removed, err = s.db.ZRem(payload.Key, payload.Member)
+		resp = ZRemResult{Removed: removed}
+
+	case OpZScore:
+		var r ZScoreResult
+		r.Score, r.Exist, err = s.db.ZScore(payload.Key, payload.Member)
+		resp = r
+
+	case OpZRank:
+		var r ZRankResult
+		r.Rank, r.Exist, err = s.db.ZRank(payload.Key, payload.Member)
+		resp = r
+
+	case OpZRange:
+		resp, err = s.db.ZRange(payload.Key, payload.Start, payload.Stop)
+
+	case OpZRangeByScore:
+		min, max := math.Inf(-1), math.Inf(1)
+		if payload.ScoreMin != nil {
+			min = *payload.ScoreMin
+		}
+
+		if payload.ScoreMax != nil {
+			max = *payload.ScoreMax
+		}
+
+		resp, err = s.db.ZRangeByScore(payload.Key, min, max)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error %s on sorted set %s: %s\n", op, payload.Key, err.Error())
+		return err
+	}
+
+	return resp
+}
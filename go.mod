@@ -3,6 +3,7 @@ module ysf/canoe
 go 1.14
 
 require (
+	github.com/boltdb/bolt v1.3.1
 	github.com/dgraph-io/badger/v2 v2.0.3
 	github.com/hashicorp/raft v1.1.2
 	github.com/hashicorp/raft-boltdb v0.0.0-20191021154308-4207f1bf0617
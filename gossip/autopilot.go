@@ -0,0 +1,326 @@
+package gossip
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"ysf/canoe/gossip/swim"
+
+	"github.com/hashicorp/raft"
+)
+
+// AutopilotConfig is the leader loop which remove failed server and promote stable server.
+// It use the progress reported through gossip, so gossip must be enabled.
+type AutopilotConfig struct {
+	Enabled bool
+
+	// DeadServerThreshold is how long a server must be unhealthy before it is removed
+	DeadServerThreshold time.Duration
+
+	// LastContactThreshold and MaxTrailingLogs decide whether a server is healthy:
+	// it must be acked through gossip in LastContactThreshold, and its applied index at most MaxTrailingLogs behind.
+	LastContactThreshold time.Duration
+	MaxTrailingLogs      uint64
+
+	// ServerStabilizationTime is how long a new server must be healthy before promoted to voter
+	ServerStabilizationTime time.Duration
+
+	Interval time.Duration
+}
+
+// ServerHealth is the health of one server seen by the leader
+type ServerHealth struct {
+	ID           string     `json:"id"`
+	Address      string     `json:"address"`
+	Suffrage     string     `json:"suffrage"`
+	Leader       bool       `json:"leader"`
+	Healthy      bool       `json:"healthy"`
+	LastContact  *time.Time `json:"last_contact,omitempty"`
+	AppliedIndex uint64     `json:"applied_index"`
+	Lag          uint64     `json:"lag"`
+	StableSince  *time.Time `json:"stable_since,omitempty"`
+	FailedSince  *time.Time `json:"failed_since,omitempty"`
+}
+
+// ClusterHealth is healthy when every voter is healthy.
+// FailureTolerance is the number of voters which can fail without losing the quorum.
+type ClusterHealth struct {
+	Healthy          bool           `json:"healthy"`
+	FailureTolerance int            `json:"failure_tolerance"`
+	Servers          []ServerHealth `json:"servers"`
+}
+
+type serverState struct {
+	healthySince time.Time
+	failedSince  time.Time
+}
+
+type autopilot struct {
+	h    *handle
+	conf AutopilotConfig
+
+	mu     sync.RWMutex
+	state  map[string]*serverState
+	health *ClusterHealth
+
+	shutdownOnce sync.Once
+	shutdownCh   chan struct{}
+	wg           sync.WaitGroup
+}
+
+func newAutopilot(h *handle, conf AutopilotConfig) *autopilot {
+	if conf.DeadServerThreshold <= 0 {
+		conf.DeadServerThreshold = time.Minute
+	}
+
+	if conf.LastContactThreshold <= 0 {
+		conf.LastContactThreshold = 30 * time.Second
+	}
+
+	if conf.MaxTrailingLogs == 0 {
+		conf.MaxTrailingLogs = 250
+	}
+
+	if conf.ServerStabilizationTime <= 0 {
+		conf.ServerStabilizationTime = 10 * time.Second
+	}
+
+	if conf.Interval <= 0 {
+		conf.Interval = 2 * time.Second
+	}
+
+	return &autopilot{
+		h:          h,
+		conf:       conf,
+		state:      make(map[string]*serverState),
+		shutdownCh: make(chan struct{}),
+	}
+}
+
+func (a *autopilot) start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(a.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.shutdownCh:
+				return
+			case <-ticker.C:
+			}
+
+			if !a.h.IsLeader() {
+				// the health is tracked from the start of each leadership
+				a.mu.Lock()
+				a.state = make(map[string]*serverState)
+				a.health = nil
+				a.mu.Unlock()
+				continue
+			}
+
+			health, err := a.evaluate()
+			if err != nil {
+				fmt.Printf("autopilot failed evaluate health: %s\n", err.Error())
+				continue
+			}
+
+			a.cleanupDeadServers(health)
+			a.promoteStableServers(health)
+		}
+	}()
+}
+
+func (a *autopilot) shutdown() {
+	a.shutdownOnce.Do(func() {
+		close(a.shutdownCh)
+		a.wg.Wait()
+	})
+}
+
+// evaluate compute the health of every server in the configuration and keep it for the health endpoint
+func (a *autopilot) evaluate() (ClusterHealth, error) {
+	configFuture := a.h.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return ClusterHealth{}, err
+	}
+
+	commitIndex, err := strconv.ParseUint(a.h.raft.Stats()["commit_index"], 10, 64)
+	if err != nil {
+		return ClusterHealth{}, err
+	}
+
+	alive := make(map[string]bool)
+	for _, member := range a.h.membership.list.Members() {
+		alive[member.Name] = member.State == swim.StateAlive
+	}
+
+	now := time.Now()
+	leader := a.h.raft.Leader()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var (
+		health        = ClusterHealth{Healthy: true}
+		voters        int
+		healthyVoters int
+		known         = make(map[string]bool)
+	)
+
+	for _, srv := range configFuture.Configuration().Servers {
+		id := string(srv.ID)
+		known[id] = true
+
+		sh := ServerHealth{
+			ID:       id,
+			Address:  string(srv.Address),
+			Suffrage: srv.Suffrage.String(),
+			Leader:   srv.Address == leader,
+		}
+
+		if id == a.h.nodeID {
+			sh.AppliedIndex = a.h.raft.AppliedIndex()
+			sh.LastContact = &now
+			sh.Healthy = true
+		} else if progress, ok := a.h.membership.peerProgress(id); ok {
+			lastContact := progress.LastAck
+			sh.AppliedIndex = progress.AppliedIndex
+			sh.LastContact = &lastContact
+			sh.Healthy = alive[id] && now.Sub(lastContact) <= a.conf.LastContactThreshold
+		}
+
+		if commitIndex > sh.AppliedIndex {
+			sh.Lag = commitIndex - sh.AppliedIndex
+		}
+		sh.Healthy = sh.Healthy && sh.Lag <= a.conf.MaxTrailingLogs
+
+		st, ok := a.state[id]
+		if !ok {
+			st = &serverState{}
+			a.state[id] = st
+		}
+
+		if sh.Healthy {
+			st.failedSince = time.Time{}
+			if st.healthySince.IsZero() {
+				st.healthySince = now
+			}
+			stableSince := st.healthySince
+			sh.StableSince = &stableSince
+		} else {
+			st.healthySince = time.Time{}
+			if st.failedSince.IsZero() {
+				st.failedSince = now
+			}
+			failedSince := st.failedSince
+			sh.FailedSince = &failedSince
+		}
+
+		if srv.Suffrage == raft.Voter {
+			voters++
+			if sh.Healthy {
+				healthyVoters++
+			} else {
+				health.Healthy = false
+			}
+		}
+
+		health.Servers = append(health.Servers, sh)
+	}
+
+	for id := range a.state {
+		if !known[id] {
+			delete(a.state, id)
+		}
+	}
+
+	if tolerance := healthyVoters - (voters/2 + 1); tolerance > 0 {
+		health.FailureTolerance = tolerance
+	}
+
+	a.health = &health
+	return health, nil
+}
+
+// cleanupDeadServers remove server which is unhealthy longer than DeadServerThreshold.
+// At most one voter is removed each round, and none when half of the voters is failing,
+// because this leader may be the one which is cut from the others.
+func (a *autopilot) cleanupDeadServers(health ClusterHealth) {
+	var voters, failedVoters int
+	for _, sh := range health.Servers {
+		if sh.Suffrage == raft.Voter.String() {
+			voters++
+			if !sh.Healthy {
+				failedVoters++
+			}
+		}
+	}
+
+	removedVoter := false
+	for _, sh := range health.Servers {
+		if sh.Healthy || sh.FailedSince == nil || time.Since(*sh.FailedSince) < a.conf.DeadServerThreshold {
+			continue
+		}
+
+		isVoter := sh.Suffrage == raft.Voter.String()
+		if isVoter && (removedVoter || failedVoters*2 >= voters) {
+			continue
+		}
+
+		if err := a.h.Remove(sh.ID, false); err != nil {
+			fmt.Printf("autopilot failed remove dead server %s: %s\n", sh.ID, err.Error())
+			continue
+		}
+
+		fmt.Printf("autopilot removed dead server %s\n", sh.ID)
+		removedVoter = removedVoter || isVoter
+	}
+}
+
+// promoteStableServers promote non-voter which want to be a voter, once it is healthy for ServerStabilizationTime.
+// Non-voter which join as non-voter on purpose, for example read replica, is never promoted,
+// and demoted voter is only promoted again after it join the gossip again.
+func (a *autopilot) promoteStableServers(health ClusterHealth) {
+	wantVoter := make(map[string]bool)
+	for _, member := range a.h.membership.list.Members() {
+		wantVoter[member.Name] = member.Meta[MetaSuffrage] == SuffrageVoter
+	}
+
+	for _, sh := range health.Servers {
+		if sh.Suffrage != raft.Nonvoter.String() || !sh.Healthy || !wantVoter[sh.ID] || a.h.membership.isDemoted(sh.ID) {
+			continue
+		}
+
+		if sh.StableSince == nil || time.Since(*sh.StableSince) < a.conf.ServerStabilizationTime {
+			continue
+		}
+
+		if err := a.h.Promote(sh.ID, false); err != nil {
+			fmt.Printf("autopilot failed promote server %s: %s\n", sh.ID, err.Error())
+		}
+	}
+}
+
+// AutopilotHealth return the health of every server evaluated by the leader.
+func (h handle) AutopilotHealth() (ClusterHealth, error) {
+	if h.autopilot == nil {
+		return ClusterHealth{}, fmt.Errorf("autopilot is disabled")
+	}
+
+	if !h.IsLeader() {
+		return ClusterHealth{}, ErrNotLeader
+	}
+
+	h.autopilot.mu.RLock()
+	defer h.autopilot.mu.RUnlock()
+
+	if h.autopilot.health == nil {
+		return ClusterHealth{}, fmt.Errorf("health is not evaluated yet, retry in %s", h.autopilot.conf.Interval)
+	}
+
+	return *h.autopilot.health, nil
+}
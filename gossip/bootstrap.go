@@ -0,0 +1,125 @@
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"ysf/canoe/pkg/httpclient"
+
+	"github.com/hashicorp/raft"
+)
+
+type respNode struct {
+	Data NodeInfo `json:"data"`
+}
+
+// nodeURL return the node info endpoint next to the join endpoint of the seed, /raft/join become /raft/node.
+func nodeURL(seed string) (string, error) {
+	u, err := url.Parse(seed)
+	if err != nil {
+		return "", err
+	}
+
+	return u.ResolveReference(&url.URL{Path: "node"}).String(), nil
+}
+
+func (h handle) discoverSeed(ctx context.Context, httpRequester httpclient.HttpRequester, seed string) (info NodeInfo, err error) {
+	addr, err := nodeURL(seed)
+	if err != nil {
+		return
+	}
+
+	correlationID := fmt.Sprintf("%d", time.Now().UnixNano())
+	resp, err := httpRequester.Get(ctx, correlationID, addr, http.Header{
+		"Content-Type": []string{"application/json"},
+	})
+
+	if err != nil {
+		return
+	}
+
+	if resp.Raw.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status %d", resp.Raw.StatusCode)
+		return
+	}
+
+	var out = respNode{}
+	if err = resp.To(ctx, &out); err != nil {
+		return
+	}
+
+	return out.Data, nil
+}
+
+// bootstrapExpect discover the seeds and bootstrap the cluster once exactly the expected number of nodes is found.
+// The member list is every discovered node, so every node which discover the same nodes compute the same list.
+// More nodes advertising the same expected number is refused, choosing some of them would depend on which seeds
+// each node reach, and two nodes could bootstrap two clusters.
+// clusterExists is true when one of the seeds is already member of a cluster, then this node must join instead.
+func (h handle) bootstrapExpect(ctx context.Context, httpRequester httpclient.HttpRequester, seeds []string) (bootstrapped, clusterExists bool, err error) {
+	nodes := map[string]NodeInfo{
+		h.nodeID: h.Node(),
+	}
+
+	for _, seed := range seeds {
+		info, errDiscover := h.discoverSeed(ctx, httpRequester, seed)
+		if errDiscover != nil {
+			err = fmt.Errorf("%s: %s", seed, errDiscover.Error())
+			continue
+		}
+
+		if info.Bootstrapped {
+			return false, true, nil
+		}
+
+		if info.BootstrapExpect != h.expect {
+			return false, false, fmt.Errorf("node %s expect %d nodes, this node expect %d", info.ID, info.BootstrapExpect, h.expect)
+		}
+
+		nodes[info.ID] = info
+	}
+
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	if len(nodes) > h.expect {
+		return false, false, fmt.Errorf("discovered %d nodes %v expecting %d, refuse to bootstrap: "+
+			"fix bootstrap_expect or the seeds, or bootstrap one node and join the others", len(nodes), ids, h.expect)
+	}
+
+	if len(nodes) < h.expect {
+		if err == nil {
+			err = fmt.Errorf("discovered %d of %d expected nodes", len(nodes), h.expect)
+		}
+		return false, false, err
+	}
+
+	configuration := raft.Configuration{}
+	for _, id := range ids {
+		configuration.Servers = append(configuration.Servers, raft.Server{
+			ID:      raft.ServerID(id),
+			Address: raft.ServerAddress(nodes[id].Address),
+		})
+	}
+
+	for _, srv := range configuration.Servers {
+		if srv.ID == raft.ServerID(h.nodeID) {
+			// other node may already bootstrap and replicate the same configuration to this node
+			if err := h.raft.BootstrapCluster(configuration).Error(); err != nil && err != raft.ErrCantBootstrap {
+				return false, false, err
+			}
+
+			fmt.Printf("node %s bootstrapped cluster with %v\n", h.nodeID, ids)
+			return true, false, nil
+		}
+	}
+
+	// this node is not in the member list, it join after the others is bootstrapped
+	return false, false, fmt.Errorf("node is not in bootstrap member list %v, waiting to join", ids)
+}
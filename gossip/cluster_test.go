@@ -0,0 +1,109 @@
+package gossip_test
+
+import (
+	"testing"
+	"time"
+	"ysf/canoe/gossip"
+	"ysf/canoe/internal/testcluster"
+	"ysf/canoe/model"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestClusterMembership(t *testing.T) {
+	convey.Convey("Leadership transfer and remove in 3 nodes cluster", t, func() {
+		c := testcluster.New(t, testcluster.Options{Nodes: 3})
+		leader := c.WaitLeader(5 * time.Second)
+
+		members, err := leader.Gossip().Members()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(members), convey.ShouldEqual, 3)
+
+		convey.Convey("Leadership is moved to the chosen voter", func() {
+			target := c.Node((c.Index(leader) + 1) % 3)
+			_, err := leader.Gossip().TransferLeadership(target.ID)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(c.WaitLeader(5*time.Second), convey.ShouldEqual, target)
+		})
+
+		convey.Convey("Removed node no longer receive write", func() {
+			// every voter must have acknowledged the leader, otherwise the remove is refused
+			_, err := c.Apply(model.CommandPayload{Operation: "SET", Key: "before", Value: "remove"})
+			convey.So(err, convey.ShouldBeNil)
+			c.WaitConverged(5 * time.Second)
+
+			removed := c.Node((c.Index(leader) + 1) % 3)
+			convey.So(leader.Gossip().Remove(removed.ID, false), convey.ShouldBeNil)
+
+			members, err := leader.Gossip().Members()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(members), convey.ShouldEqual, 2)
+
+			_, err = c.Apply(model.CommandPayload{Operation: "SET", Key: "foo", Value: "bar"})
+			convey.So(err, convey.ShouldBeNil)
+
+			time.Sleep(200 * time.Millisecond)
+			has, err := removed.Repo().Has("foo")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(has, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("Remove is refused when the healthy voters left is less than the new quorum", func() {
+			unreachable := c.Node((c.Index(leader) + 1) % 3)
+			removed := c.Node((c.Index(leader) + 2) % 3)
+
+			c.Isolate(c.Index(unreachable))
+			time.Sleep(300 * time.Millisecond)
+
+			err := leader.Gossip().Remove(removed.ID, false)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "leaves 1 healthy voter of 2")
+
+			c.Heal()
+		})
+
+		convey.Convey("Demoted node is promoted again using the progress seen by the leader without gossip", func() {
+			target := c.Node((c.Index(leader) + 1) % 3)
+			_, err := c.Apply(model.CommandPayload{Operation: "SET", Key: "foo", Value: "bar"})
+			convey.So(err, convey.ShouldBeNil)
+			c.WaitConverged(5 * time.Second)
+
+			convey.So(leader.Gossip().Demote(target.ID, false), convey.ShouldBeNil)
+			convey.So(leader.Gossip().Promote(target.ID, false), convey.ShouldBeNil)
+
+			members, err := leader.Gossip().Members()
+			convey.So(err, convey.ShouldBeNil)
+			for _, member := range members {
+				convey.So(member.Suffrage, convey.ShouldEqual, "Voter")
+			}
+		})
+
+		convey.Convey("Leader report the match index of each follower without gossip", func() {
+			_, err := c.Apply(model.CommandPayload{Operation: "SET", Key: "foo", Value: "bar"})
+			convey.So(err, convey.ShouldBeNil)
+			c.WaitConverged(5 * time.Second)
+
+			members, err := leader.Gossip().Members()
+			convey.So(err, convey.ShouldBeNil)
+			for _, member := range members {
+				convey.So(member.MatchIndex, convey.ShouldNotBeNil)
+				convey.So(member.LastContact, convey.ShouldNotBeNil)
+				convey.So(member.Lag, convey.ShouldNotBeNil)
+				convey.So(*member.Lag, convey.ShouldEqual, 0)
+			}
+
+			follower := c.Node((c.Index(leader) + 1) % 3)
+			members, err = follower.Gossip().Members()
+			convey.So(err, convey.ShouldBeNil)
+			for _, member := range members {
+				convey.So(member.MatchIndex, convey.ShouldBeNil)
+			}
+		})
+
+		convey.Convey("Write on follower is refused", func() {
+			follower := c.Node((c.Index(leader) + 1) % 3)
+			_, err := follower.Gossip().DoOperation(model.CommandPayload{Operation: "SET", Key: "foo", Value: "bar"})
+			convey.So(err, convey.ShouldEqual, gossip.ErrNotLeader)
+		})
+	})
+}
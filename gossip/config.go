@@ -0,0 +1,101 @@
+package gossip
+
+import (
+	"fmt"
+	"ysf/canoe/fsm"
+	"ysf/canoe/pkg/raftstream"
+
+	"github.com/hashicorp/raft"
+)
+
+// Config is used by New.
+type Config struct {
+	NodeID          string
+	RaftBindAddress string
+	RaftDir         string
+
+	// Bootstrap start this node as a single server cluster when it has no raft state yet,
+	// set it only on one node and let the others join to it.
+	Bootstrap bool
+
+	// BootstrapExpect wait until this number of nodes, including itself, is discovered through the join seeds,
+	// then bootstrap the cluster with all of them. Every node must use the same number,
+	// so all of them compute the same member list. Bootstrap is refused when more nodes is discovered.
+	BootstrapExpect int
+
+	// InitialServers bootstrap the cluster with the servers when this node has no raft state yet,
+	// for example the members of a shard group. Every server must be started with the same list.
+	InitialServers []raft.Server
+
+	// Suffrage is requested when this node join the cluster, SuffrageVoter or SuffrageNonvoter.
+	// Non-voter replicate the log and serve local read, but is not counted in the quorum.
+	Suffrage string
+
+	// PromoteMaxLag is the maximum distance of the node match index from the leader commit index,
+	// so the node can be promoted to voter. Default is 1000.
+	PromoteMaxLag uint64
+
+	// TLS encrypt the raft transport with mutual TLS, nil means plain TCP
+	TLS *raftstream.TLSConfig
+
+	// Stream carry the raft traffic instead of listening on RaftBindAddress,
+	// for example raftstream.Mux sharing the HTTP port. Its address is advertised as the raft address.
+	Stream raft.StreamLayer
+
+	// Transport replace the network transport, for example raft.InmemTransport in test. Stream and TLS is ignored.
+	Transport raft.Transport
+
+	// LogStore is LogStoreBolt (default) or LogStoreBadger, existing bolt log must be migrated using MigrateLogStore
+	LogStore string
+
+	FSM fsm.Options
+
+	// Tuning is raft timing and sizing, zero value is replaced by the default
+	Tuning TuningConfig
+
+	// Membership is the optional SWIM gossip used for discovery and failure detection
+	Membership MembershipConfig
+
+	// Autopilot remove dead server and promote stable server on the leader, it need Membership enabled
+	Autopilot AutopilotConfig
+}
+
+func (c Config) validate() error {
+	if c.NodeID == "" {
+		return fmt.Errorf("empty node id")
+	}
+
+	if c.Bootstrap && c.BootstrapExpect > 0 {
+		return fmt.Errorf("bootstrap and bootstrap_expect can not be used together")
+	}
+
+	if len(c.InitialServers) > 0 && (c.Bootstrap || c.BootstrapExpect > 0) {
+		return fmt.Errorf("initial servers can not be used with bootstrap nor bootstrap_expect")
+	}
+
+	if c.BootstrapExpect < 0 {
+		return fmt.Errorf("bootstrap_expect must not be negative")
+	}
+
+	if _, err := isVoter(c.Suffrage); err != nil {
+		return err
+	}
+
+	if err := validLogStore(c.LogStore); err != nil {
+		return err
+	}
+
+	if err := c.Tuning.withDefaults().validate(); err != nil {
+		return err
+	}
+
+	if c.Autopilot.Enabled && !c.Membership.Enabled {
+		return fmt.Errorf("autopilot need gossip enabled to track the health of servers")
+	}
+
+	if c.Membership.Enabled && c.Membership.BindAddress == "" && c.Membership.Transport == nil {
+		return fmt.Errorf("gossip bind address is not set")
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package gossip
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// drainState reject new operation once draining, and count the in-flight operation.
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+func (d *drainState) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return false
+	}
+
+	d.inflight.Add(1)
+	return true
+}
+
+func (d *drainState) done() {
+	d.inflight.Done()
+}
+
+func (d *drainState) start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.draining = true
+}
+
+func (d *drainState) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.draining
+}
+
+// wait return false when the in-flight operation is not finished in timeout
+func (d *drainState) wait(timeout time.Duration) bool {
+	finished := make(chan struct{})
+	go func() {
+		d.inflight.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// TransferLeadership move the leadership to the voter with the id, or to the most caught up voter when id is empty.
+// It return the raft address of the new leader.
+func (h handle) TransferLeadership(nodeID string) (string, error) {
+	if h.raft.State() != raft.Leader {
+		return "", ErrNotLeader
+	}
+
+	var f raft.Future
+	if nodeID == "" {
+		// raft pick the voter with the highest match index
+		f = h.raft.LeadershipTransfer()
+	} else {
+		target, _, err := h.findServer(nodeID)
+		if err != nil {
+			return "", err
+		}
+
+		if target.Suffrage != raft.Voter {
+			return "", fmt.Errorf("node %s is not a voter", nodeID)
+		}
+
+		if target.ID == raft.ServerID(h.nodeID) {
+			return "", fmt.Errorf("node %s is already the leader", nodeID)
+		}
+
+		f = h.raft.LeadershipTransferToServer(target.ID, target.Address)
+	}
+
+	if err := f.Error(); err != nil {
+		return "", err
+	}
+
+	// this node step down once the transfer succeed, the new leader is known on its first heartbeat
+	deadline := time.Now().Add(time.Second)
+	for (h.raft.Leader() == "" || h.raft.Leader() == raft.ServerAddress(h.raftAddr)) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	fmt.Printf("leadership transferred to %s\n", h.raft.Leader())
+	return string(h.raft.Leader()), nil
+}
+
+// Drain prepare this node to shutdown. New operation is rejected with ErrDraining and in-flight operation is waited,
+// then the leadership is transferred when this node is the leader.
+// When leave is true, this node is also removed from the raft configuration:
+// the leader remove itself, and follower leave the gossip so the leader remove it.
+func (h handle) Drain(timeout time.Duration, leave bool) error {
+	h.drain.start()
+
+	if !h.drain.wait(timeout) {
+		fmt.Printf("in-flight operation is not finished in %s\n", timeout)
+	}
+
+	if h.IsLeader() {
+		switch {
+		case leave && h.membership == nil:
+			// removed leader step down once the configuration is committed
+			if err := h.Remove(h.nodeID, false); err != nil {
+				return err
+			}
+
+		case h.hasOtherVoter():
+			if _, err := h.TransferLeadership(""); err != nil {
+				return fmt.Errorf("error transfer leadership: %w", err)
+			}
+		}
+	}
+
+	if !leave {
+		return nil
+	}
+
+	if h.membership == nil {
+		if h.isMember() {
+			return fmt.Errorf("leaving as follower need gossip enabled, remove node %s from the leader instead", h.nodeID)
+		}
+		return nil
+	}
+
+	h.membership.leave(timeout)
+	return nil
+}
+
+func (h handle) hasOtherVoter() bool {
+	configFuture := h.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return false
+	}
+
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.Suffrage == raft.Voter && srv.ID != raft.ServerID(h.nodeID) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,272 @@
+package gossip
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Event type sent to the subscriber.
+const (
+	// EventLeadershipGained and EventLeadershipLost is this node becoming or stepping down as the leader
+	EventLeadershipGained = "leadership_gained"
+	EventLeadershipLost   = "leadership_lost"
+
+	// EventLeaderChange is this node observing a new leader, Leader is empty when there is no leader
+	EventLeaderChange = "leader_change"
+
+	// EventPeerAdded and EventPeerRemoved is observed only by the leader, when it start or stop replicating to a server.
+	// The leader observe every server as added when it gain the leadership.
+	EventPeerAdded   = "peer_added"
+	EventPeerRemoved = "peer_removed"
+
+	// EventFailedHeartbeat is the leader failing to send heartbeat to a follower
+	EventFailedHeartbeat = "failed_heartbeat"
+)
+
+// EventTypes is all event type, in the order of the constants.
+var EventTypes = []string{
+	EventLeadershipGained,
+	EventLeadershipLost,
+	EventLeaderChange,
+	EventPeerAdded,
+	EventPeerRemoved,
+	EventFailedHeartbeat,
+}
+
+const defaultSubscriptionBuffer = 64
+
+// Event is a change of leadership or membership observed by this node.
+// Field which does not apply to the event type is omitted.
+type Event struct {
+	Type        string     `json:"type"`
+	Time        time.Time  `json:"time"`
+	Node        string     `json:"node"`
+	Leader      string     `json:"leader,omitempty"`
+	LeaderID    string     `json:"leader_id,omitempty"`
+	PeerID      string     `json:"peer_id,omitempty"`
+	PeerAddress string     `json:"peer_address,omitempty"`
+	Suffrage    string     `json:"suffrage,omitempty"`
+	LastContact *time.Time `json:"last_contact,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// ValidateEventTypes return error when one of the types is unknown.
+func ValidateEventTypes(types []string) error {
+	for _, t := range types {
+		known := false
+		for _, et := range EventTypes {
+			known = known || t == et
+		}
+
+		if !known {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+
+	return nil
+}
+
+// Subscription receive the event published after it is created.
+// The event is dropped when the subscriber is slower than the buffer, so it never block raft.
+type Subscription struct {
+	bus     *eventBus
+	types   map[string]bool
+	ch      chan Event
+	dropped uint64
+	once    sync.Once
+}
+
+// Events return the channel of events, it is closed by Close or when the node is shut down.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped return the number of event dropped because the buffer is full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close stop receiving event and close the channel.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+func (s *Subscription) closeChannel() {
+	s.once.Do(func() {
+		close(s.ch)
+	})
+}
+
+// eventBus fan out the events to the subscriptions.
+type eventBus struct {
+	nodeID string
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func newEventBus(nodeID string) *eventBus {
+	return &eventBus{
+		nodeID: nodeID,
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+func (b *eventBus) subscribe(buffer int, types []string) *Subscription {
+	if buffer <= 0 {
+		buffer = defaultSubscriptionBuffer
+	}
+
+	s := &Subscription{
+		bus: b,
+		ch:  make(chan Event, buffer),
+	}
+
+	if len(types) > 0 {
+		s.types = make(map[string]bool)
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// subscribing after shutdown return closed subscription, the same as the subscription closed by shutdown
+	if b.closed {
+		s.closeChannel()
+		return s
+	}
+
+	b.subs[s] = struct{}{}
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subs, s)
+	s.closeChannel()
+}
+
+func (b *eventBus) publish(e Event) {
+	e.Node = b.nodeID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subs {
+		if s.types != nil && !s.types[e.Type] {
+			continue
+		}
+
+		select {
+		case s.ch <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subs {
+		delete(b.subs, s)
+		s.closeChannel()
+	}
+}
+
+// eventObserver translate the raft notification into events.
+// Leadership use raft NotifyCh, because LeaderCh drop the notification when nobody is receiving at that moment.
+type eventObserver struct {
+	bus      *eventBus
+	notifyCh chan bool
+	obsCh    chan raft.Observation
+	observer *raft.Observer
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newEventObserver(bus *eventBus) *eventObserver {
+	o := &eventObserver{
+		bus:      bus,
+		notifyCh: make(chan bool, 16),
+		obsCh:    make(chan raft.Observation, 64),
+		stop:     make(chan struct{}),
+	}
+
+	o.observer = raft.NewObserver(o.obsCh, false, func(obs *raft.Observation) bool {
+		switch obs.Data.(type) {
+		case raft.LeaderObservation, raft.PeerObservation:
+			return true
+		default:
+			return false
+		}
+	})
+
+	return o
+}
+
+// start register the observer and run the loop, nodeIDOf resolve the id of the leader address.
+func (o *eventObserver) start(r *raft.Raft, nodeIDOf func(raft.ServerAddress) (string, bool)) {
+	r.RegisterObserver(o.observer)
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+
+		for {
+			select {
+			case <-o.stop:
+				return
+
+			case leader := <-o.notifyCh:
+				if leader {
+					o.bus.publish(Event{Type: EventLeadershipGained})
+				} else {
+					o.bus.publish(Event{Type: EventLeadershipLost})
+				}
+
+			case obs := <-o.obsCh:
+				switch data := obs.Data.(type) {
+				case raft.LeaderObservation:
+					e := Event{Type: EventLeaderChange, Leader: string(data.Leader)}
+					if data.Leader != "" {
+						e.LeaderID, _ = nodeIDOf(data.Leader)
+					}
+					o.bus.publish(e)
+
+				case raft.PeerObservation:
+					e := Event{
+						Type:        EventPeerAdded,
+						PeerID:      string(data.Peer.ID),
+						PeerAddress: string(data.Peer.Address),
+						Suffrage:    data.Peer.Suffrage.String(),
+					}
+					if data.Removed {
+						e.Type = EventPeerRemoved
+					}
+					o.bus.publish(e)
+				}
+			}
+		}
+	}()
+}
+
+func (o *eventObserver) shutdown(r *raft.Raft) {
+	r.DeregisterObserver(o.observer)
+	close(o.stop)
+	o.wg.Wait()
+}
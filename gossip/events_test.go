@@ -0,0 +1,112 @@
+package gossip_test
+
+import (
+	"testing"
+	"time"
+	"ysf/canoe/gossip"
+	"ysf/canoe/internal/testcluster"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// waitEvent return the first event with the type, skipping the others.
+func waitEvent(sub *gossip.Subscription, eventType string, timeout time.Duration) (gossip.Event, bool) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return gossip.Event{}, false
+			}
+
+			if e.Type == eventType {
+				return e, true
+			}
+
+		case <-deadline:
+			return gossip.Event{}, false
+		}
+	}
+}
+
+func TestClusterEvents(t *testing.T) {
+	convey.Convey("Events observed in 3 nodes cluster", t, func() {
+		c := testcluster.New(t, testcluster.Options{Nodes: 3})
+		leader := c.WaitLeader(5 * time.Second)
+		target := c.Node((c.Index(leader) + 1) % 3)
+
+		convey.Convey("Leadership transfer is observed by the old and the new leader", func() {
+			oldSub := leader.Gossip().Subscribe(0, gossip.EventLeadershipLost)
+			defer oldSub.Close()
+
+			newSub := target.Gossip().Subscribe(0, gossip.EventLeadershipGained, gossip.EventLeaderChange, gossip.EventPeerAdded)
+			defer newSub.Close()
+
+			_, err := leader.Gossip().TransferLeadership(target.ID)
+			convey.So(err, convey.ShouldBeNil)
+
+			e, ok := waitEvent(oldSub, gossip.EventLeadershipLost, 5*time.Second)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(e.Node, convey.ShouldEqual, leader.ID)
+
+			_, ok = waitEvent(newSub, gossip.EventLeadershipGained, 5*time.Second)
+			convey.So(ok, convey.ShouldBeTrue)
+
+			// the new leader start replicating to every other server
+			e, ok = waitEvent(newSub, gossip.EventPeerAdded, 5*time.Second)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(e.PeerID, convey.ShouldNotEqual, target.ID)
+		})
+
+		convey.Convey("Leader change carry the id of the leader", func() {
+			sub := c.Node((c.Index(leader)+2)%3).Gossip().Subscribe(0, gossip.EventLeaderChange)
+			defer sub.Close()
+
+			_, err := leader.Gossip().TransferLeadership(target.ID)
+			convey.So(err, convey.ShouldBeNil)
+
+			var e gossip.Event
+			for e.LeaderID == "" {
+				var ok bool
+				e, ok = waitEvent(sub, gossip.EventLeaderChange, 5*time.Second)
+				convey.So(ok, convey.ShouldBeTrue)
+			}
+
+			convey.So(e.LeaderID, convey.ShouldEqual, target.ID)
+			convey.So(e.Leader, convey.ShouldEqual, string(target.Address))
+		})
+
+		convey.Convey("Removed peer and failed heartbeat is observed by the leader", func() {
+			sub := leader.Gossip().Subscribe(0, gossip.EventFailedHeartbeat, gossip.EventPeerRemoved)
+			defer sub.Close()
+
+			c.Isolate(c.Index(target))
+			e, ok := waitEvent(sub, gossip.EventFailedHeartbeat, 5*time.Second)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(e.PeerID, convey.ShouldEqual, target.ID)
+			convey.So(e.LastContact, convey.ShouldNotBeNil)
+			convey.So(e.Error, convey.ShouldNotBeEmpty)
+
+			c.Heal()
+			convey.So(leader.Gossip().Remove(target.ID, false), convey.ShouldBeNil)
+			e, ok = waitEvent(sub, gossip.EventPeerRemoved, 5*time.Second)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(e.PeerID, convey.ShouldEqual, target.ID)
+		})
+
+		convey.Convey("Subscription is closed when the node shut down", func() {
+			sub := target.Gossip().Subscribe(0)
+			c.Kill(c.Index(target))
+
+			_, ok := waitEvent(sub, "never", 5*time.Second)
+			convey.So(ok, convey.ShouldBeFalse)
+
+			select {
+			case _, open := <-sub.Events():
+				convey.So(open, convey.ShouldBeFalse)
+			default:
+				convey.So("subscription is not closed", convey.ShouldBeEmpty)
+			}
+		})
+	})
+}
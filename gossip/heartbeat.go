@@ -0,0 +1,80 @@
+package gossip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// heartbeatTransport keep when each follower last acknowledged the AppendEntries of this node,
+// and report the heartbeat which fail to reach the follower. Raft 1.1.2 does not expose either,
+// the leader use it to know which voter is still reachable. The heartbeat is the AppendEntries
+// without term index and log entries.
+// It also keep the replication progress of each follower seen by the leader, see progress.go.
+type heartbeatTransport struct {
+	raft.Transport
+	bus *eventBus
+
+	mu          sync.Mutex
+	lastContact map[raft.ServerID]time.Time
+	match       map[raft.ServerID]matchIndex
+}
+
+func newHeartbeatTransport(trans raft.Transport, bus *eventBus) *heartbeatTransport {
+	return &heartbeatTransport{
+		Transport:   trans,
+		bus:         bus,
+		lastContact: make(map[raft.ServerID]time.Time),
+		match:       make(map[raft.ServerID]matchIndex),
+	}
+}
+
+func (t *heartbeatTransport) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+	err := t.Transport.AppendEntries(id, target, args, resp)
+
+	t.mu.Lock()
+	if err == nil {
+		t.lastContact[id] = time.Now()
+		t.observeAppend(id, args, resp)
+	}
+	last, ok := t.lastContact[id]
+	t.mu.Unlock()
+
+	if err != nil && isHeartbeat(args) {
+		e := Event{
+			Type:        EventFailedHeartbeat,
+			PeerID:      string(id),
+			PeerAddress: string(target),
+			Error:       err.Error(),
+		}
+		if ok {
+			e.LastContact = &last
+		}
+		t.bus.publish(e)
+	}
+
+	return err
+}
+
+// lastContactOf return when the server last acknowledged AppendEntries of this node.
+func (t *heartbeatTransport) lastContactOf(id raft.ServerID) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.lastContact[id]
+	return last, ok
+}
+
+func isHeartbeat(args *raft.AppendEntriesRequest) bool {
+	return len(args.Entries) == 0 && args.PrevLogEntry == 0 && args.LeaderCommitIndex == 0
+}
+
+// Close close the wrapped transport, raft close the transport on shutdown when it can be closed.
+func (t *heartbeatTransport) Close() error {
+	if closer, ok := t.Transport.(raft.WithClose); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
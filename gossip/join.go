@@ -0,0 +1,225 @@
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"ysf/canoe/pkg/httpclient"
+
+	"github.com/hashicorp/raft"
+)
+
+// Join status reported in Stats as join_status
+const (
+	JoinStatusDisabled     = "disabled"
+	JoinStatusJoining      = "joining"
+	JoinStatusJoined       = "joined"
+	JoinStatusMember       = "already_member"
+	JoinStatusStopped      = "stopped"
+	JoinStatusWaiting      = "waiting_for_peers"
+	JoinStatusBootstrapped = "bootstrapped"
+)
+
+// JoinConfig is used by AutoJoin.
+type JoinConfig struct {
+	// Seeds is the HTTP join endpoint (for example http://127.0.0.1:2222/raft/join) of nodes in the cluster.
+	// It is tried in order until one of them admit this node.
+	Seeds []string
+
+	// MinBackoff and MaxBackoff is the wait time between each round of trying all seeds,
+	// doubled every failed round.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// RequestTimeout is the timeout of each join request.
+	RequestTimeout time.Duration
+}
+
+type joinState struct {
+	mu        sync.Mutex
+	status    string
+	attempts  int
+	lastError string
+	joinedVia string
+}
+
+func newJoinState() *joinState {
+	return &joinState{
+		status: JoinStatusDisabled,
+	}
+}
+
+func (j *joinState) set(fn func(j *joinState)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(j)
+}
+
+func (j *joinState) stats() map[string]string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return map[string]string{
+		"join_status":     j.status,
+		"join_attempts":   strconv.Itoa(j.attempts),
+		"join_last_error": j.lastError,
+		"join_via":        j.joinedVia,
+	}
+}
+
+// isMember return true when this node is already in the raft configuration,
+// which means it is bootstrapped or joined a cluster before.
+func (h handle) isMember() bool {
+	configFuture := h.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return false
+	}
+
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == raft.ServerID(h.nodeID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AutoJoin ask the seeds to add this node to the cluster in background, retrying with backoff until admitted
+// or the ctx is cancelled. It is skipped when this node is already member of a cluster.
+// The progress is reported in Stats.
+func (h handle) AutoJoin(ctx context.Context, conf JoinConfig) {
+	if len(conf.Seeds) == 0 {
+		return
+	}
+
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = time.Second
+	}
+
+	if conf.MaxBackoff < conf.MinBackoff {
+		conf.MaxBackoff = 30 * time.Second
+	}
+
+	if conf.RequestTimeout <= 0 {
+		conf.RequestTimeout = 5 * time.Second
+	}
+
+	if h.isMember() {
+		h.join.set(func(j *joinState) { j.status = JoinStatusMember })
+		fmt.Printf("node %s already member of cluster, skip auto join\n", h.nodeID)
+		return
+	}
+
+	h.join.set(func(j *joinState) {
+		j.status = JoinStatusJoining
+		if h.expect > 1 {
+			j.status = JoinStatusWaiting
+		}
+	})
+
+	httpRequester := httpclient.DefaultClient(&http.Client{
+		Timeout: conf.RequestTimeout,
+	})
+
+	body, _ := json.Marshal(map[string]string{
+		"node_id":      h.nodeID,
+		"raft_address": h.raftAddr,
+		"suffrage":     suffrageName(h.suffrage != SuffrageNonvoter),
+	})
+
+	go func() {
+		backoff := conf.MinBackoff
+		for !h.joinRound(ctx, httpRequester, conf.Seeds, body) {
+			select {
+			case <-ctx.Done():
+				h.join.set(func(j *joinState) { j.status = JoinStatusStopped })
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > conf.MaxBackoff {
+				backoff = conf.MaxBackoff
+			}
+		}
+	}()
+}
+
+// joinRound try to bootstrap or join once, it return true when this node no longer need to join.
+func (h handle) joinRound(ctx context.Context, httpRequester httpclient.HttpRequester, seeds []string, body []byte) bool {
+	// configuration may be replicated by other node which bootstrap with this node as the member
+	if h.isMember() {
+		h.join.set(func(j *joinState) {
+			j.status = JoinStatusJoined
+			j.lastError = ""
+		})
+		return true
+	}
+
+	if h.expect > 1 {
+		bootstrapped, clusterExists, err := h.bootstrapExpect(ctx, httpRequester, seeds)
+		if bootstrapped {
+			h.join.set(func(j *joinState) {
+				j.status = JoinStatusBootstrapped
+				j.lastError = ""
+			})
+			return true
+		}
+
+		if !clusterExists {
+			h.join.set(func(j *joinState) {
+				j.status = JoinStatusWaiting
+				j.attempts++
+				if err != nil {
+					j.lastError = err.Error()
+				}
+			})
+			return false
+		}
+
+		h.join.set(func(j *joinState) { j.status = JoinStatusJoining })
+	}
+
+	for _, seed := range seeds {
+		err := h.joinSeed(ctx, httpRequester, seed, body)
+		h.join.set(func(j *joinState) {
+			j.attempts++
+			if err != nil {
+				j.lastError = fmt.Sprintf("%s: %s", seed, err.Error())
+				return
+			}
+
+			j.status = JoinStatusJoined
+			j.lastError = ""
+			j.joinedVia = seed
+		})
+
+		if err == nil {
+			fmt.Printf("node %s joined cluster via %s\n", h.nodeID, seed)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h handle) joinSeed(ctx context.Context, httpRequester httpclient.HttpRequester, seed string, body []byte) error {
+	correlationID := fmt.Sprintf("%d", time.Now().UnixNano())
+	resp, err := httpRequester.Post(ctx, correlationID, seed, http.Header{
+		"Content-Type": []string{"application/json"},
+	}, body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.Raw.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %v", resp.Raw.StatusCode, resp.Raw.Body)
+	}
+
+	return nil
+}
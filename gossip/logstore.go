@@ -0,0 +1,163 @@
+package gossip
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"ysf/canoe/pkg/raftbadger"
+
+	"github.com/boltdb/bolt"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+
+	"github.com/hashicorp/raft"
+)
+
+// Raft log store selected by Config.LogStore
+const (
+	LogStoreBolt   = "bolt"
+	LogStoreBadger = "badger"
+)
+
+// File of each log store inside the raft directory
+const (
+	boltLogFile  = "raft.dataRepo"
+	badgerLogDir = "raft_log"
+)
+
+// migratingSuffix is added to the badger log directory while the migration is copying into it
+const migratingSuffix = ".migrating"
+
+// migrateOpenTimeout is the time to wait the lock of bolt file, it is locked while the node is running
+const migrateOpenTimeout = time.Second
+
+// logStore is raft.LogStore and raft.StableStore which is closed on shutdown
+type logStore interface {
+	raft.LogStore
+	raft.StableStore
+	io.Closer
+}
+
+func validLogStore(name string) error {
+	switch name {
+	case "", LogStoreBolt, LogStoreBadger:
+		return nil
+	default:
+		return fmt.Errorf("unknown log store %s, must be %s or %s", name, LogStoreBolt, LogStoreBadger)
+	}
+}
+
+// openLogStore open the selected store. It refuse to start with empty store when the other store exists,
+// because the node would lose its raft state and may bootstrap again.
+func openLogStore(name, raftDir string) (logStore, error) {
+	boltPath := filepath.Join(raftDir, boltLogFile)
+	badgerPath := filepath.Join(raftDir, badgerLogDir)
+
+	if name == LogStoreBadger {
+		store, err := raftbadger.Open(badgerPath)
+		if err != nil {
+			return nil, err
+		}
+
+		last, err := store.LastIndex()
+		if err == nil && last == 0 && exists(boltPath) {
+			err = fmt.Errorf("raft log is in %s, migrate it to %s before using badger log store", boltPath, badgerPath)
+		}
+
+		if err != nil {
+			_ = store.Close()
+			return nil, err
+		}
+
+		return store, nil
+	}
+
+	if !exists(boltPath) && exists(badgerPath) {
+		return nil, fmt.Errorf("raft log is in %s, set the log store to %s", badgerPath, LogStoreBadger)
+	}
+
+	// Create the backend raft store for logs and stable storage.
+	// https://github.com/hashicorp/consul/blob/aa121bc8d2b270c836b58e548e1cc8989b2ef921/agent/consul/server.go#L690-L702
+	// Vault also use like this,
+	// https://github.com/hashicorp/vault/blob/8813dc7363fab378f9019e78c14118facac110cf/physical/raft/raft.go#L242-L257
+	return raftboltdb.NewBoltStore(boltPath)
+}
+
+// MigrateLogStore copy the bolt log store in raftDir into the badger log store, the node must be stopped.
+// The bolt file is kept, remove it after the node is started with the badger log store.
+func MigrateLogStore(raftDir string) (raftbadger.MigrateResult, error) {
+	src, err := raftboltdb.New(raftboltdb.Options{
+		Path: filepath.Join(raftDir, boltLogFile),
+		BoltOptions: &bolt.Options{
+			ReadOnly: true,
+			Timeout:  migrateOpenTimeout,
+		},
+	})
+	if err != nil {
+		return raftbadger.MigrateResult{}, fmt.Errorf("open bolt log store, is the node stopped? %w", err)
+	}
+	defer src.Close()
+
+	badgerPath := filepath.Join(raftDir, badgerLogDir)
+	if err := removeEmptyLogStore(badgerPath); err != nil {
+		return raftbadger.MigrateResult{}, err
+	}
+
+	// the logs is copied into a temporary directory which is renamed when complete,
+	// so the node never start with the partial log store of an interrupted migration
+	tmpPath := badgerPath + migratingSuffix
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return raftbadger.MigrateResult{}, err
+	}
+
+	dst, err := raftbadger.Open(tmpPath)
+	if err != nil {
+		return raftbadger.MigrateResult{}, err
+	}
+
+	result, err := raftbadger.Migrate(src, dst)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = os.RemoveAll(tmpPath)
+		return result, err
+	}
+
+	return result, os.Rename(tmpPath, badgerPath)
+}
+
+// removeEmptyLogStore remove the badger log store which has no log, it is created when the node is started with
+// the badger log store before migration. Store which has log is refused.
+func removeEmptyLogStore(path string) error {
+	if !exists(path) {
+		return nil
+	}
+
+	store, err := raftbadger.Open(path)
+	if err != nil {
+		return err
+	}
+
+	last, err := store.LastIndex()
+	if cerr := store.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if last != 0 {
+		return fmt.Errorf("%s already has log until index %d", path, last)
+	}
+
+	return os.RemoveAll(path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
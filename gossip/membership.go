@@ -0,0 +1,376 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"ysf/canoe/gossip/swim"
+
+	"github.com/hashicorp/raft"
+)
+
+// Meta key disseminated through gossip
+const (
+	MetaRaftAddress = "raft_address"
+	MetaSuffrage    = "suffrage"
+	MetaHTTPAddress = "http_address"
+)
+
+// MembershipConfig is the SWIM gossip running next to raft. The leader add alive member to the raft configuration,
+// and remove member which left or dead longer than ReapAfter.
+// Member removed from the raft configuration, for example by /raft/remove, is only added again after it join
+// the gossip again, when it is restarted or come back from dead.
+type MembershipConfig struct {
+	Enabled     bool
+	BindAddress string
+
+	// Seeds is the gossip address of other nodes, joining is retried until one of them reply
+	Seeds []string
+
+	// Meta is disseminated to every node together with the raft address
+	Meta map[string]string
+
+	ReapAfter         time.Duration
+	ReconcileInterval time.Duration
+
+	// Transport replace the UDP transport, for example swim.InmemNetwork in test
+	Transport swim.Transport
+}
+
+// peerProgress is reported by the member in the ack of each ping
+type peerProgress struct {
+	AppliedIndex uint64
+	RTT          time.Duration
+	LastAck      time.Time
+}
+
+type ackPayload struct {
+	AppliedIndex uint64 `json:"applied_index"`
+}
+
+type membership struct {
+	h    *handle
+	conf MembershipConfig
+	list *swim.Memberlist
+
+	mu       sync.RWMutex
+	progress map[string]peerProgress
+
+	// removed is the member which left the raft configuration since it joined the gossip, and demoted is the member
+	// demoted to non-voter since then. They are tracked on every node from the configuration seen by reconcile,
+	// so a new leader does not add or promote it again either.
+	removed map[string]bool
+	demoted map[string]bool
+	servers map[string]raft.ServerSuffrage
+
+	reconcileCh  chan struct{}
+	shutdownOnce sync.Once
+	shutdownCh   chan struct{}
+	wg           sync.WaitGroup
+}
+
+func newMembership(h *handle, conf MembershipConfig) (*membership, error) {
+	if conf.ReapAfter <= 0 {
+		conf.ReapAfter = time.Minute
+	}
+
+	if conf.ReconcileInterval <= 0 {
+		conf.ReconcileInterval = 5 * time.Second
+	}
+
+	transport := conf.Transport
+	if transport == nil {
+		var err error
+		transport, err = swim.NewUDPTransport(conf.BindAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := &membership{
+		h:           h,
+		conf:        conf,
+		progress:    make(map[string]peerProgress),
+		removed:     make(map[string]bool),
+		demoted:     make(map[string]bool),
+		reconcileCh: make(chan struct{}, 1),
+		shutdownCh:  make(chan struct{}),
+	}
+
+	meta := map[string]string{}
+	for k, v := range conf.Meta {
+		meta[k] = v
+	}
+	meta[MetaRaftAddress] = h.raftAddr
+	meta[MetaSuffrage] = suffrageName(h.suffrage != SuffrageNonvoter)
+
+	swimConf := swim.DefaultConfig()
+	swimConf.Name = h.nodeID
+	swimConf.Meta = meta
+	swimConf.Transport = transport
+	swimConf.Events = m
+	swimConf.Ping = m
+
+	list, err := swim.Create(swimConf)
+	if err != nil {
+		_ = transport.Shutdown()
+		return nil, err
+	}
+
+	m.list = list
+
+	m.wg.Add(2)
+	go m.joinSeeds()
+	go m.reconcileLoop()
+
+	return m, nil
+}
+
+// joinSeeds retry with backoff until one of the seeds reply
+func (m *membership) joinSeeds() {
+	defer m.wg.Done()
+
+	if len(m.conf.Seeds) == 0 {
+		return
+	}
+
+	backoff := time.Second
+	for {
+		_, err := m.list.Join(m.conf.Seeds)
+		if err == nil {
+			return
+		}
+
+		fmt.Printf("node %s failed join gossip: %s\n", m.h.nodeID, err.Error())
+
+		select {
+		case <-m.shutdownCh:
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+func (m *membership) reconcileLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.conf.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.shutdownCh:
+			return
+		case <-ticker.C:
+		case <-m.reconcileCh:
+		}
+
+		m.reconcile()
+	}
+}
+
+func (m *membership) triggerReconcile() {
+	select {
+	case m.reconcileCh <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile make the raft configuration follow the gossip membership, it only change it on the leader.
+// Raft server which is not known by gossip, for example joined manually, is left as is.
+func (m *membership) reconcile() {
+	configFuture := m.h.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return
+	}
+
+	servers := make(map[string]raft.Server)
+	for _, srv := range configFuture.Configuration().Servers {
+		servers[string(srv.ID)] = srv
+	}
+
+	members := m.list.Members()
+	m.track(servers, members)
+	if !m.h.IsLeader() {
+		return
+	}
+
+	for _, member := range members {
+		raftAddress := member.Meta[MetaRaftAddress]
+		if member.Name == m.h.nodeID || raftAddress == "" {
+			continue
+		}
+
+		srv, inRaft := servers[member.Name]
+
+		var err error
+		switch member.State {
+		case swim.StateAlive:
+			if !inRaft && m.isRemoved(member.Name) {
+				continue
+			}
+
+			if !inRaft || string(srv.Address) != raftAddress {
+				err = m.h.Join(member.Name, raftAddress, member.Meta[MetaSuffrage])
+			}
+
+		case swim.StateLeft:
+			if inRaft {
+				err = m.h.Remove(member.Name, false)
+			}
+
+		case swim.StateDead:
+			// autopilot remove dead server using its own health check
+			if m.h.autopilot == nil && inRaft && time.Since(member.StateChange) >= m.conf.ReapAfter {
+				err = m.h.Remove(member.Name, false)
+			}
+		}
+
+		if err != nil {
+			fmt.Printf("failed reconcile member %s: %s\n", member.Name, err.Error())
+		}
+	}
+}
+
+// track remember the server which is removed from the raft configuration while it is still in the gossip,
+// and the voter which is demoted. Member which left or is dead is not remembered as removed,
+// it is added again as soon as it is alive.
+func (m *membership) track(servers map[string]raft.Server, members []swim.Member) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[string]raft.ServerSuffrage, len(servers))
+	for id, srv := range servers {
+		current[id] = srv.Suffrage
+		delete(m.removed, id)
+		if srv.Suffrage == raft.Voter {
+			delete(m.demoted, id)
+		}
+	}
+
+	for _, member := range members {
+		prev, was := m.servers[member.Name]
+		suffrage, is := current[member.Name]
+		gone := member.State == swim.StateLeft || member.State == swim.StateDead
+
+		switch {
+		case was && !is && !gone:
+			m.removed[member.Name] = true
+		case was && is && prev == raft.Voter && suffrage == raft.Nonvoter:
+			m.demoted[member.Name] = true
+		}
+	}
+
+	m.servers = current
+}
+
+func (m *membership) isRemoved(nodeID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.removed[nodeID]
+}
+
+// setDemoted is called by the leader right after it demote or promote the server, before reconcile see it.
+func (m *membership) setDemoted(nodeID string, demoted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if demoted {
+		m.demoted[nodeID] = true
+	} else {
+		delete(m.demoted, nodeID)
+	}
+}
+
+func (m *membership) isDemoted(nodeID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.demoted[nodeID]
+}
+
+// NotifyJoin is called for new member and member which come back after it left or is dead,
+// so it can be added to the raft configuration and promoted again.
+func (m *membership) NotifyJoin(member swim.Member) {
+	m.mu.Lock()
+	delete(m.removed, member.Name)
+	delete(m.demoted, member.Name)
+	m.mu.Unlock()
+
+	m.triggerReconcile()
+}
+
+func (m *membership) NotifyUpdate(member swim.Member) {
+	m.triggerReconcile()
+}
+
+func (m *membership) NotifyLeave(member swim.Member) {
+	m.mu.Lock()
+	delete(m.progress, member.Name)
+	m.mu.Unlock()
+
+	m.triggerReconcile()
+}
+
+func (m *membership) AckPayload() []byte {
+	payload, _ := json.Marshal(ackPayload{
+		AppliedIndex: m.h.raft.AppliedIndex(),
+	})
+
+	return payload
+}
+
+func (m *membership) NotifyPingComplete(member swim.Member, rtt time.Duration, payload []byte) {
+	var ack ackPayload
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.progress[member.Name] = peerProgress{
+		AppliedIndex: ack.AppliedIndex,
+		RTT:          rtt,
+		LastAck:      time.Now(),
+	}
+	m.mu.Unlock()
+}
+
+func (m *membership) peerProgress(nodeID string) (peerProgress, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	progress, ok := m.progress[nodeID]
+	return progress, ok
+}
+
+func (m *membership) stats() map[string]string {
+	count := map[swim.State]int{}
+	for _, member := range m.list.Members() {
+		count[member.State]++
+	}
+
+	return map[string]string{
+		"gossip_alive":   fmt.Sprint(count[swim.StateAlive]),
+		"gossip_suspect": fmt.Sprint(count[swim.StateSuspect]),
+		"gossip_dead":    fmt.Sprint(count[swim.StateDead] + count[swim.StateLeft]),
+	}
+}
+
+// leave the gossip gracefully, so the leader remove this node without waiting ReapAfter
+func (m *membership) leave(timeout time.Duration) {
+	m.list.Leave(timeout)
+}
+
+func (m *membership) shutdown() (err error) {
+	m.shutdownOnce.Do(func() {
+		close(m.shutdownCh)
+		m.wg.Wait()
+		err = m.list.Shutdown()
+	})
+
+	return
+}
@@ -0,0 +1,70 @@
+package gossip
+
+import (
+	"testing"
+	"ysf/canoe/gossip/swim"
+
+	"github.com/hashicorp/raft"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestMembership_TrackRemoved(t *testing.T) {
+	convey.Convey("Member removed from the raft configuration", t, func() {
+		m := &membership{
+			removed:     make(map[string]bool),
+			demoted:     make(map[string]bool),
+			reconcileCh: make(chan struct{}, 1),
+		}
+
+		servers := map[string]raft.Server{"n1": {ID: "n1"}, "n2": {ID: "n2"}, "n3": {ID: "n3"}}
+		members := []swim.Member{
+			{Name: "n1", State: swim.StateAlive},
+			{Name: "n2", State: swim.StateAlive},
+			{Name: "n3", State: swim.StateLeft},
+		}
+		m.track(servers, members)
+
+		delete(servers, "n2")
+		delete(servers, "n3")
+		m.track(servers, members)
+
+		convey.Convey("Alive member is not added again until it join the gossip again", func() {
+			convey.So(m.isRemoved("n2"), convey.ShouldBeTrue)
+
+			m.NotifyJoin(swim.Member{Name: "n2", State: swim.StateAlive})
+			convey.So(m.isRemoved("n2"), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("Member which left is added again as soon as it is alive", func() {
+			convey.So(m.isRemoved("n3"), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("Member added back to the configuration is forgotten", func() {
+			servers["n2"] = raft.Server{ID: "n2"}
+			m.track(servers, members)
+			convey.So(m.isRemoved("n2"), convey.ShouldBeFalse)
+		})
+	})
+}
+
+func TestMembership_TrackDemoted(t *testing.T) {
+	convey.Convey("Voter demoted to non-voter is not promoted again until it join the gossip again", t, func() {
+		m := &membership{
+			removed:     make(map[string]bool),
+			demoted:     make(map[string]bool),
+			reconcileCh: make(chan struct{}, 1),
+		}
+
+		members := []swim.Member{{Name: "n1", State: swim.StateAlive}, {Name: "n2", State: swim.StateAlive}}
+		m.track(map[string]raft.Server{"n1": {ID: "n1"}, "n2": {ID: "n2", Suffrage: raft.Voter}}, members)
+		m.track(map[string]raft.Server{"n1": {ID: "n1"}, "n2": {ID: "n2", Suffrage: raft.Nonvoter}}, members)
+		convey.So(m.isDemoted("n2"), convey.ShouldBeTrue)
+
+		m.NotifyJoin(swim.Member{Name: "n2", State: swim.StateAlive})
+		convey.So(m.isDemoted("n2"), convey.ShouldBeFalse)
+
+		m.setDemoted("n2", true)
+		m.track(map[string]raft.Server{"n1": {ID: "n1"}, "n2": {ID: "n2", Suffrage: raft.Voter}}, members)
+		convey.So(m.isDemoted("n2"), convey.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,127 @@
+package gossip
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// matchIndex is the last log index known to be replicated to the follower by the leader in term.
+type matchIndex struct {
+	term  uint64
+	index uint64
+}
+
+// observeAppend save the match index of the follower from the successful AppendEntries response,
+// heartbeat does not carry the log position so it is skipped. The caller must hold t.mu.
+func (t *heartbeatTransport) observeAppend(id raft.ServerID, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) {
+	if !resp.Success || isHeartbeat(args) {
+		return
+	}
+
+	index := args.PrevLogEntry
+	if n := len(args.Entries); n > 0 {
+		index = args.Entries[n-1].Index
+	}
+
+	t.observeMatch(id, args.Term, index)
+}
+
+// observeMatch only move the match index forward in the same term, the new leader start again from its own responses.
+func (t *heartbeatTransport) observeMatch(id raft.ServerID, term, index uint64) {
+	m := t.match[id]
+	if term > m.term || (term == m.term && index > m.index) {
+		t.match[id] = matchIndex{term: term, index: index}
+	}
+}
+
+// matchIndexOf return the match index of the follower seen by this node as the leader of term.
+// It is unknown when this node did not replicate to the follower in term yet.
+func (t *heartbeatTransport) matchIndexOf(id raft.ServerID, term uint64) (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m, ok := t.match[id]
+	if !ok || m.term != term {
+		return 0, false
+	}
+
+	return m.index, true
+}
+
+func (t *heartbeatTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+	err := t.Transport.InstallSnapshot(id, target, args, resp, data)
+	if err == nil && resp.Success {
+		t.mu.Lock()
+		t.lastContact[id] = time.Now()
+		t.observeMatch(id, args.Term, args.LastLogIndex)
+		t.mu.Unlock()
+	}
+
+	return err
+}
+
+// AppendEntriesPipeline wrap the pipeline of the transport, the response is observed when raft consume it.
+func (t *heartbeatTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	pipeline, err := t.Transport.AppendEntriesPipeline(id, target)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &progressPipeline{
+		AppendPipeline: pipeline,
+		id:             id,
+		trans:          t,
+		consumer:       make(chan raft.AppendFuture),
+		stop:           make(chan struct{}),
+	}
+	go p.forward()
+
+	return p, nil
+}
+
+// progressPipeline pass every completed AppendEntries to raft after observing its response.
+type progressPipeline struct {
+	raft.AppendPipeline
+	id       raft.ServerID
+	trans    *heartbeatTransport
+	consumer chan raft.AppendFuture
+	stop     chan struct{}
+	closed   sync.Once
+}
+
+func (p *progressPipeline) forward() {
+	for {
+		select {
+		case <-p.stop:
+			return
+		case future := <-p.AppendPipeline.Consumer():
+			if future.Error() == nil {
+				p.trans.mu.Lock()
+				p.trans.lastContact[p.id] = time.Now()
+				p.trans.observeAppend(p.id, future.Request(), future.Response())
+				p.trans.mu.Unlock()
+			}
+
+			select {
+			case p.consumer <- future:
+			case <-p.stop:
+				return
+			}
+		}
+	}
+}
+
+func (p *progressPipeline) Consumer() <-chan raft.AppendFuture {
+	return p.consumer
+}
+
+func (p *progressPipeline) Close() error {
+	p.closed.Do(func() {
+		close(p.stop)
+	})
+
+	return p.AppendPipeline.Close()
+}
@@ -5,43 +5,68 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"path/filepath"
+	"strconv"
 	"time"
 	"ysf/canoe/fsm"
+	"ysf/canoe/gossip/swim"
 	"ysf/canoe/model"
+	"ysf/canoe/pkg/raftstream"
 	"ysf/canoe/repo"
 
-	raftboltdb "github.com/hashicorp/raft-boltdb"
-
 	"github.com/hashicorp/raft"
 )
 
-const (
-	// The maxPool controls how many connections we will pool.
-	maxPool = 3
+type handle struct {
+	raft     *raft.Raft
+	nodeID   string
+	raftAddr string
+	expect   int
+	suffrage string
+	join     *joinState
+	drain    *drainState
+
+	// promoteMaxLag is the maximum distance of node match index from leader commit index to be promoted
+	promoteMaxLag uint64
+
+	tuning       TuningConfig
+	tls          bool
+	logStore     logStore
+	logStoreName string
+	snapshots    raft.SnapshotStore
+
+	// membership is nil when gossip is disabled, autopilot is nil when disabled
+	membership *membership
+	autopilot  *autopilot
+
+	events   *eventBus
+	observer *eventObserver
+
+	// trans see the AppendEntries response of every follower when this node is the leader
+	trans *heartbeatTransport
+}
 
-	// The timeout is used to apply I/O deadlines. For InstallSnapshot, we multiply
-	// the timeout by (SnapshotSize / TimeoutScale).
-	// https://github.com/hashicorp/raft/blob/v1.1.2/net_transport.go#L177-L181
-	tcpTimeout = 10 * time.Second
+func New(conf Config, dataRepo repo.Service) (*handle, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
 
-	// The `retain` parameter controls how many
-	// snapshots are retained. Must be at least 1.
-	raftSnapShotRetain = 2
+	if conf.PromoteMaxLag == 0 {
+		conf.PromoteMaxLag = defaultPromoteMaxLag
+	}
 
-	// raftLogCacheSize is the maximum number of logs to cache in-memory.
-	// This is used to reduce disk I/O for the recently committed entries.
-	raftLogCacheSize = 512
-)
+	conf.Tuning = conf.Tuning.withDefaults()
 
-type handle struct {
-	raft *raft.Raft
-}
+	if conf.LogStore == "" {
+		conf.LogStore = LogStoreBolt
+	}
 
-func New(nodeID, raftBindAddress, raftDir string, dataRepo repo.Service) (*handle, error) {
 	raftConf := raft.DefaultConfig()
-	raftConf.LocalID = raft.ServerID(nodeID)
-	raftConf.SnapshotThreshold = 1024
+	raftConf.LocalID = raft.ServerID(conf.NodeID)
+	conf.Tuning.raftConfig(raftConf)
+
+	events := newEventBus(conf.NodeID)
+	observer := newEventObserver(events)
+	raftConf.NotifyCh = observer.notifyCh
 
 	// For this example, we use in-memory database
 	// Vault using BoltDb: https://www.vaultproject.io/docs/internals/integrated-storage
@@ -49,67 +74,139 @@ func New(nodeID, raftBindAddress, raftDir string, dataRepo repo.Service) (*handl
 	// https://github.com/hashicorp/vault/blob/8813dc7363/physical/raft/fsm.go#L80
 	// https://github.com/hashicorp/vault/blob/8813dc7363/physical/raft/fsm.go#L620-L632
 	// Consul using MemDB https://www.consul.io/docs/internals/consensus.html#raft-protocol-overview
-	fsmStore, err := fsm.NewFSM(dataRepo)
+	fsmStore, err := fsm.NewFSM(dataRepo, conf.FSM)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create the backend raft store for logs and stable storage.
-	// https://github.com/hashicorp/consul/blob/aa121bc8d2b270c836b58e548e1cc8989b2ef921/agent/consul/server.go#L690-L702
-	// Vault also use like this,
-	// https://github.com/hashicorp/vault/blob/8813dc7363fab378f9019e78c14118facac110cf/physical/raft/raft.go#L242-L257
-	store, err := raftboltdb.NewBoltStore(filepath.Join(raftDir, "raft.dataRepo"))
+	store, err := openLogStore(conf.LogStore, conf.RaftDir)
 	if err != nil {
 		return nil, err
 	}
 
 	// Wrap the store in a LogCache to improve performance.
-	cacheStore, err := raft.NewLogCache(raftLogCacheSize, store)
+	cacheStore, err := raft.NewLogCache(conf.Tuning.LogCacheSize, store)
 	if err != nil {
 		return nil, err
 	}
 
-	snapshotStore, err := raft.NewFileSnapshotStore(raftDir, raftSnapShotRetain, os.Stdout)
+	snapshotStore, err := raft.NewFileSnapshotStore(conf.RaftDir, conf.Tuning.SnapshotRetain, os.Stdout)
 	if err != nil {
 		return nil, err
 	}
 
-	addr, err := net.ResolveTCPAddr("tcp", raftBindAddress)
+	transport, tlsStream, err := newTransport(conf)
 	if err != nil {
 		return nil, err
 	}
 
-	transport, err := raft.NewTCPTransport(raftBindAddress, addr, maxPool, tcpTimeout, os.Stdout)
+	// replace the configuration with peers.json before raft is started, when the quorum is lost for good
+	if err := recoverCluster(conf, raftConf, fsmStore, cacheStore, store, snapshotStore, transport); err != nil {
+		return nil, err
+	}
+
+	// node which already have raft state must never bootstrap again, its configuration is in the log or snapshot
+	hasState, err := raft.HasExistingState(cacheStore, store, snapshotStore)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := raft.NewRaft(raftConf, fsmStore, cacheStore, store, snapshotStore, transport)
+	trans := newHeartbeatTransport(transport, events)
+	r, err := raft.NewRaft(raftConf, fsmStore, cacheStore, store, snapshotStore, trans)
 	if err != nil {
 		return nil, err
 	}
 
-	// always start single server as a leader
-	configuration := raft.Configuration{
-		Servers: []raft.Server{
-			{
-				ID:      raft.ServerID(nodeID),
-				Address: transport.LocalAddr(),
+	h := &handle{
+		raft:          r,
+		nodeID:        conf.NodeID,
+		raftAddr:      string(transport.LocalAddr()),
+		suffrage:      conf.Suffrage,
+		join:          newJoinState(),
+		drain:         &drainState{},
+		promoteMaxLag: conf.PromoteMaxLag,
+		tuning:        conf.Tuning,
+		logStore:      store,
+		snapshots:     snapshotStore,
+		logStoreName:  conf.LogStore,
+		tls:           conf.TLS != nil,
+		events:        events,
+		observer:      observer,
+		trans:         trans,
+	}
+
+	observer.start(r, h.nodeIDOf)
+
+	if tlsStream != nil {
+		tlsStream.SetNodeIDResolver(h.nodeIDOf)
+	}
+
+	switch {
+	case hasState:
+		fmt.Printf("node %s has existing raft state, skip bootstrap\n", conf.NodeID)
+
+	case conf.Bootstrap || conf.BootstrapExpect == 1:
+		// start single server cluster, other node join to it
+		configuration := raft.Configuration{
+			Servers: []raft.Server{
+				{
+					ID:      raft.ServerID(conf.NodeID),
+					Address: transport.LocalAddr(),
+				},
 			},
-		},
+		}
+
+		if err := r.BootstrapCluster(configuration).Error(); err != nil {
+			return nil, err
+		}
+
+	case len(conf.InitialServers) > 0:
+		// bootstrapping every server with the same configuration is safe, they elect the leader among them
+		if err := r.BootstrapCluster(raft.Configuration{Servers: conf.InitialServers}).Error(); err != nil {
+			return nil, err
+		}
+
+	case conf.BootstrapExpect > 1:
+		// bootstrapped by AutoJoin once the expected number of nodes is discovered
+		h.expect = conf.BootstrapExpect
 	}
 
-	r.BootstrapCluster(configuration)
+	// autopilot is assigned before membership start, because membership reconcile check it
+	if conf.Autopilot.Enabled {
+		h.autopilot = newAutopilot(h, conf.Autopilot)
+	}
 
-	return &handle{
-		raft: r,
-	}, nil
+	if conf.Membership.Enabled {
+		h.membership, err = newMembership(h, conf.Membership)
+		if err != nil {
+			_ = r.Shutdown().Error()
+			observer.shutdown(r)
+			events.close()
+			return nil, err
+		}
+	}
+
+	if h.autopilot != nil {
+		h.autopilot.start()
+	}
+
+	return h, nil
 }
 
-// Join handle when raft join
-func (h handle) Join(nodeID, addr string) error {
+// Join handle when raft join, suffrage is SuffrageVoter or SuffrageNonvoter, empty means voter.
+func (h handle) Join(nodeID, addr, suffrage string) error {
 	if h.raft.State() != raft.Leader {
-		return fmt.Errorf("not a leader")
+		return ErrNotLeader
+	}
+
+	voter, err := isVoter(suffrage)
+	if err != nil {
+		return err
+	}
+
+	// autopilot promote the new server once it is stable, so it does not slow down the quorum while catching up
+	if voter && h.autopilot != nil {
+		voter = false
 	}
 
 	configFuture := h.raft.GetConfiguration()
@@ -137,62 +234,259 @@ func (h handle) Join(nodeID, addr string) error {
 	}
 
 	// This must be run on the leader or it will fail.
-	f := h.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(addr), 0, 0)
+	var f raft.IndexFuture
+	if voter {
+		f = h.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(addr), 0, 0)
+	} else {
+		// non-voter receive the log but is not counted in quorum, so it does not slow down write
+		f = h.raft.AddNonvoter(raft.ServerID(nodeID), raft.ServerAddress(addr), 0, 0)
+	}
+
 	if f.Error() != nil {
 		return f.Error()
 	}
 
-	fmt.Printf("node %s at %s joined successfully\n", nodeID, addr)
+	fmt.Printf("node %s at %s joined successfully as %s\n", nodeID, addr, suffrageName(voter))
 	return nil
 }
 
-// Join handle when raft join
-func (h handle) Remove(nodeID, addr string) error {
+// Remove remove the node from the raft configuration. This must be run on the leader.
+// Removing a voter is refused unless force is true when the healthy voters left is less than the quorum
+// of the new configuration, because the cluster could not commit anymore, see checkQuorumAfter.
+func (h handle) Remove(nodeID string, force bool) error {
 	if h.raft.State() != raft.Leader {
-		return fmt.Errorf("not a leader")
+		return ErrNotLeader
 	}
 
+	target, index, err := h.findServer(nodeID)
+	if err != nil {
+		return err
+	}
+
+	if target.Suffrage == raft.Voter && !force {
+		if err := h.checkQuorumAfter("removing", nodeID); err != nil {
+			return err
+		}
+	}
+
+	// prevIndex make sure the configuration is not changed by others since it is read
+	f := h.raft.RemoveServer(target.ID, index, 0)
+	if f.Error() != nil {
+		return f.Error()
+	}
+
+	fmt.Printf("node %s at %s removed successfully\n", nodeID, target.Address)
+	return nil
+}
+
+// Members return all servers in the latest raft configuration, with the replication progress known by this node.
+// The leader know the progress of the follower it replicated to in its term from the AppendEntries responses,
+// otherwise progress of other server is reported through gossip, so it is empty when gossip is disabled.
+func (h handle) Members() ([]Member, error) {
 	configFuture := h.raft.GetConfiguration()
 	if err := configFuture.Error(); err != nil {
-		fmt.Printf("failed to get raft configuration: %v\n", err)
-		return err
+		return nil, err
+	}
+
+	stats := h.raft.Stats()
+	commitIndex, _ := strconv.ParseUint(stats["commit_index"], 10, 64)
+	term, _ := strconv.ParseUint(stats["term"], 10, 64)
+	isLeader := h.IsLeader()
+
+	gossipMembers := make(map[string]swim.Member)
+	if h.membership != nil {
+		for _, member := range h.membership.list.Members() {
+			gossipMembers[member.Name] = member
+		}
+	}
+
+	var health = make(map[string]ServerHealth)
+	if cluster, err := h.AutopilotHealth(); err == nil {
+		for _, sh := range cluster.Servers {
+			health[sh.ID] = sh
+		}
 	}
 
+	leader := h.raft.Leader()
+	members := make([]Member, 0)
 	for _, raftServer := range configFuture.Configuration().Servers {
-		// If a node already exists with either the joining node's ID or address,
-		// that node may need to be removed from the config first.
-		if raftServer.ID == raft.ServerID(nodeID) || raftServer.Address == raft.ServerAddress(addr) {
-			// However if both the ID and the address are the same,
-			// then nothing not even a join operation is needed.
-			if raftServer.Address == raft.ServerAddress(addr) && raftServer.ID == raft.ServerID(nodeID) {
-				fmt.Printf("node %s at %s already member of cluster, ignoring join request\n", nodeID, addr)
-				return nil
+		member := Member{
+			ID:       string(raftServer.ID),
+			Address:  string(raftServer.Address),
+			Suffrage: raftServer.Suffrage.String(),
+			Leader:   raftServer.Address == leader,
+		}
+
+		if gossipMember, ok := gossipMembers[member.ID]; ok {
+			member.HTTPAddress = gossipMember.Meta[MetaHTTPAddress]
+			member.Gossip = gossipMember.State.String()
+		}
+
+		var (
+			applied, match    uint64
+			lastContact       time.Time
+			known, knownMatch bool
+		)
+
+		switch {
+		case member.ID == h.nodeID:
+			applied, lastContact, known = h.raft.AppliedIndex(), time.Now(), true
+			if isLeader {
+				match, knownMatch = h.raft.LastIndex(), true
 			}
 
-			future := h.raft.RemoveServer(raftServer.ID, 0, 0)
-			if err := future.Error(); err != nil {
-				return fmt.Errorf("error removing existing node %s at %s: %s", nodeID, addr, err)
+		case h.membership != nil:
+			if progress, ok := h.membership.peerProgress(member.ID); ok {
+				applied, lastContact, known = progress.AppliedIndex, progress.LastAck, true
 			}
 		}
+
+		// the leader see the progress of the follower directly in the AppendEntries responses of its term
+		if isLeader && member.ID != h.nodeID {
+			if index, ok := h.trans.matchIndexOf(raftServer.ID, term); ok {
+				match, knownMatch = index, true
+				if contact, ok := h.trans.lastContactOf(raftServer.ID); ok {
+					lastContact = contact
+				}
+			}
+		}
+
+		// follower know when the leader contacted it last time, even without gossip
+		if member.Leader && !isLeader {
+			if contact := h.raft.LastContact(); !contact.IsZero() {
+				lastContact = contact
+			}
+		}
+
+		if !lastContact.IsZero() {
+			member.LastContact = &lastContact
+		}
+
+		if known {
+			member.AppliedIndex = &applied
+		}
+
+		if known || knownMatch {
+			progress := applied
+			if knownMatch {
+				progress = match
+				member.MatchIndex = &match
+			}
+
+			lag := uint64(0)
+			if commitIndex > progress {
+				lag = commitIndex - progress
+			}
+
+			member.Lag = &lag
+		}
+
+		if sh, ok := health[member.ID]; ok {
+			healthy := sh.Healthy
+			member.Healthy = &healthy
+		}
+
+		members = append(members, member)
 	}
 
-	// This must be run on the leader or it will fail.
-	f := h.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(addr), 0, 0)
-	if f.Error() != nil {
-		return f.Error()
+	return members, nil
+}
+
+// nodeIDOf return the id of the server with the raft address in the latest configuration.
+// It is called when the transport dial a peer, which is never done by the raft main loop itself.
+func (h handle) nodeIDOf(address raft.ServerAddress) (string, bool) {
+	configFuture := h.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return "", false
 	}
 
-	fmt.Printf("node %s at %s joined successfully\n", nodeID, addr)
-	return nil
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.Address == address {
+			return string(srv.ID), true
+		}
+	}
+
+	return "", false
+}
+
+// Node return the information of this node, used by other node to discover it before the cluster is bootstrapped.
+func (h handle) Node() NodeInfo {
+	info := NodeInfo{
+		ID:              h.nodeID,
+		Address:         h.raftAddr,
+		Leader:          string(h.raft.Leader()),
+		BootstrapExpect: h.expect,
+	}
+
+	configFuture := h.raft.GetConfiguration()
+	if err := configFuture.Error(); err == nil {
+		info.Bootstrapped = len(configFuture.Configuration().Servers) > 0
+	}
+
+	return info
 }
 
 func (h handle) Stats() map[string]string {
-	return h.raft.Stats()
+	stats := h.raft.Stats()
+	for k, v := range h.join.stats() {
+		stats[k] = v
+	}
+
+	stats["draining"] = fmt.Sprint(h.drain.isDraining())
+
+	if h.membership != nil {
+		for k, v := range h.membership.stats() {
+			stats[k] = v
+		}
+	}
+
+	return stats
+}
+
+// Config return the configuration of this node after the default is applied.
+func (h handle) Config() EffectiveConfig {
+	return EffectiveConfig{
+		NodeID:        h.nodeID,
+		RaftAddress:   h.raftAddr,
+		Suffrage:      suffrageName(h.suffrage != SuffrageNonvoter),
+		PromoteMaxLag: h.promoteMaxLag,
+		TLS:           h.tls,
+		Gossip:        h.membership != nil,
+		Autopilot:     h.autopilot != nil,
+		LogStore:      h.logStoreName,
+		Tuning:        h.tuning,
+	}
+}
+
+// IsLeader return true when this node is the raft leader.
+func (h handle) IsLeader() bool {
+	return h.raft.State() == raft.Leader
+}
+
+// Leader return the raft address of current leader, or empty string when there is no leader.
+func (h handle) Leader() string {
+	return string(h.raft.Leader())
+}
+
+// Subscribe return subscription of the events with the types, or every event when no type is given.
+// Buffer is the number of event kept while the subscriber is busy, 0 use the default.
+func (h handle) Subscribe(buffer int, types ...string) *Subscription {
+	return h.events.subscribe(buffer, types)
 }
 
 func (h handle) DoOperation(payload model.CommandPayload) (value interface{}, err error) {
 	if h.raft.State() != raft.Leader {
-		return nil, fmt.Errorf("not leader")
+		return nil, ErrNotLeader
+	}
+
+	// in-flight operation is waited by Drain before leadership is transferred
+	if !h.drain.begin() {
+		return nil, ErrDraining
+	}
+	defer h.drain.done()
+
+	if payload.Now == 0 {
+		payload.Now = time.Now().Unix()
 	}
 
 	cmd, err := json.Marshal(payload)
@@ -202,14 +496,84 @@ func (h handle) DoOperation(payload model.CommandPayload) (value interface{}, er
 
 	// This must be run on the leader or it will fail.
 	// https://github.com/hashicorp/raft/blob/v1.1.2/api.go#L669-L676
-	future := h.raft.Apply(cmd, 1*time.Second)
+	future := h.raft.Apply(cmd, h.tuning.ApplyTimeout)
 	if future.Error() != nil {
 		return nil, future.Error()
 	}
 
+	// FSM return error as response when the command is rejected
+	if err, ok := future.Response().(error); ok {
+		return nil, err
+	}
+
 	return future.Response(), nil
 }
 
 func (h handle) Shutdown() error {
-	return h.raft.Shutdown().Error()
+	if h.autopilot != nil {
+		h.autopilot.shutdown()
+	}
+
+	if h.membership != nil {
+		if err := h.membership.shutdown(); err != nil {
+			fmt.Printf("error shutdown gossip: %s\n", err.Error())
+		}
+	}
+
+	err := h.raft.Shutdown().Error()
+
+	h.observer.shutdown(h.raft)
+	h.events.close()
+
+	if err != nil {
+		return err
+	}
+
+	return h.logStore.Close()
+}
+
+// newTransport use the transport or the stream layer in the config, for example raft multiplexed on the HTTP port,
+// or listen TCP on the raft bind address. The stream is wrapped with mutual TLS when configured.
+func newTransport(conf Config) (raft.Transport, *raftstream.TLS, error) {
+	if conf.Transport != nil {
+		return conf.Transport, nil, nil
+	}
+
+	if conf.Stream == nil && conf.TLS == nil {
+		addr, err := net.ResolveTCPAddr("tcp", conf.RaftBindAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		transport, err := raft.NewTCPTransport(conf.RaftBindAddress, addr, conf.Tuning.TransportMaxPool, conf.Tuning.TransportTimeout, os.Stdout)
+		return transport, nil, err
+	}
+
+	stream := conf.Stream
+	if stream == nil {
+		addr, err := net.ResolveTCPAddr("tcp", conf.RaftBindAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		stream, err = raftstream.NewTCP(conf.RaftBindAddress, addr)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var tlsStream *raftstream.TLS
+	if conf.TLS != nil {
+		// log entries and snapshots is encrypted, and only peer with certificate signed by the CA can connect
+		var err error
+		tlsStream, err = raftstream.WrapTLS(stream, *conf.TLS)
+		if err != nil {
+			_ = stream.Close()
+			return nil, nil, err
+		}
+
+		stream = tlsStream
+	}
+
+	return raft.NewNetworkTransport(stream, conf.Tuning.TransportMaxPool, conf.Tuning.TransportTimeout, os.Stdout), tlsStream, nil
 }
@@ -0,0 +1,49 @@
+package gossip
+
+import (
+	"errors"
+	"ysf/canoe/model"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrLogCompacted is returned by ReadLog when the log entry is already removed by the snapshot.
+var ErrLogCompacted = errors.New("raft log is already compacted by snapshot")
+
+// ReadLog return at most max commands after the index, in raft index order, which is already applied by this node.
+// Last is the last index examined, it is after the last command when the entries after it is not a command.
+func (h handle) ReadLog(after uint64, max int) (commands []model.CommittedCommand, last uint64, err error) {
+	applied := h.raft.AppliedIndex()
+	if after >= applied {
+		return nil, after, nil
+	}
+
+	first, err := h.logStore.FirstIndex()
+	if err != nil {
+		return nil, after, err
+	}
+
+	if after+1 < first {
+		return nil, after, ErrLogCompacted
+	}
+
+	last = after
+	for index := after + 1; index <= applied && len(commands) < max; index++ {
+		var entry raft.Log
+		if err := h.logStore.GetLog(index, &entry); err != nil {
+			if err == raft.ErrLogNotFound {
+				return commands, last, ErrLogCompacted
+			}
+
+			return commands, last, err
+		}
+
+		if entry.Type == raft.LogCommand {
+			commands = append(commands, model.CommittedCommand{Index: entry.Index, Term: entry.Term, Data: entry.Data})
+		}
+
+		last = index
+	}
+
+	return commands, last, nil
+}
@@ -0,0 +1,252 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"ysf/canoe/pkg/raftbadger"
+
+	"github.com/boltdb/bolt"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+
+	"github.com/hashicorp/raft"
+)
+
+// PeersFile is the recovery file in the raft dir. When it exists on start, the raft configuration of the node is
+// replaced by the servers in it, then it is deleted. See recoverCluster.
+const PeersFile = "peers.json"
+
+// keyCurrentTerm is the key of the current term in the raft stable store
+var keyCurrentTerm = []byte("CurrentTerm")
+
+// PeerEntry is one server in PeersFile, it is the format read by raft.ReadConfigJSON.
+type PeerEntry struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	NonVoter bool   `json:"non_voter"`
+}
+
+// RaftState is the raft state saved in the raft dir of the node.
+// Configuration is the latest configuration in the snapshot or the log, which may not be committed.
+type RaftState struct {
+	CurrentTerm        uint64      `json:"current_term"`
+	LastIndex          uint64      `json:"last_index"`
+	LastTerm           uint64      `json:"last_term"`
+	SnapshotIndex      uint64      `json:"snapshot_index"`
+	ConfigurationIndex uint64      `json:"configuration_index"`
+	Configuration      []PeerEntry `json:"configuration"`
+}
+
+// HasState return true when the node has raft state, the same check as raft.HasExistingState.
+func (s RaftState) HasState() bool {
+	return s.CurrentTerm > 0 || s.LastIndex > 0
+}
+
+func peerEntries(configuration raft.Configuration) []PeerEntry {
+	peers := make([]PeerEntry, 0, len(configuration.Servers))
+	for _, s := range configuration.Servers {
+		peers = append(peers, PeerEntry{
+			ID:       string(s.ID),
+			Address:  string(s.Address),
+			NonVoter: s.Suffrage != raft.Voter,
+		})
+	}
+
+	return peers
+}
+
+// readRaftState read the state from the stores without starting raft.
+func readRaftState(logs raft.LogStore, stable raft.StableStore, snaps raft.SnapshotStore) (state RaftState, err error) {
+	state.CurrentTerm, err = stable.GetUint64(keyCurrentTerm)
+	if err != nil && err.Error() != "not found" {
+		return state, fmt.Errorf("read current term: %w", err)
+	}
+
+	var configuration raft.Configuration
+
+	snapshots, err := snaps.List()
+	if err != nil {
+		return state, fmt.Errorf("list snapshots: %w", err)
+	}
+
+	if len(snapshots) > 0 {
+		state.SnapshotIndex = snapshots[0].Index
+		state.LastIndex, state.LastTerm = snapshots[0].Index, snapshots[0].Term
+		state.ConfigurationIndex = snapshots[0].ConfigurationIndex
+		configuration = snapshots[0].Configuration
+	}
+
+	first, err := logs.FirstIndex()
+	if err != nil {
+		return state, err
+	}
+
+	last, err := logs.LastIndex()
+	if err != nil {
+		return state, err
+	}
+
+	if first == 0 {
+		state.Configuration = peerEntries(configuration)
+		return state, nil
+	}
+
+	if first <= state.ConfigurationIndex {
+		first = state.ConfigurationIndex + 1
+	}
+
+	for index := first; index <= last; index++ {
+		var entry raft.Log
+		if err := logs.GetLog(index, &entry); err != nil {
+			return state, fmt.Errorf("read log %d: %w", index, err)
+		}
+
+		if entry.Type == raft.LogConfiguration {
+			configuration = raft.DecodeConfiguration(entry.Data)
+			state.ConfigurationIndex = entry.Index
+		}
+
+		state.LastIndex, state.LastTerm = entry.Index, entry.Term
+	}
+
+	state.Configuration = peerEntries(configuration)
+	return state, nil
+}
+
+// recoverCluster replace the raft configuration of this node with PeersFile when it exists in the raft dir,
+// then delete the file. It is used when the quorum is lost for good: stop every surviving node, write the same file
+// in each raft dir and start them again. The file is kept when recovery fail, so it is retried on the next start.
+func recoverCluster(conf Config, raftConf *raft.Config, fsm raft.FSM, logs raft.LogStore, stable raft.StableStore,
+	snaps raft.SnapshotStore, trans raft.Transport) error {
+	path := filepath.Join(conf.RaftDir, PeersFile)
+	if !exists(path) {
+		return nil
+	}
+
+	logf := func(format string, args ...interface{}) {
+		fmt.Printf("[RECOVER] "+format+"\n", args...)
+	}
+
+	logf("found %s, recovering raft configuration of node %s", path, conf.NodeID)
+
+	configuration, err := raft.ReadConfigJSON(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	for _, s := range configuration.Servers {
+		logf("new configuration: %s at %s as %s", s.ID, s.Address, suffrageName(s.Suffrage == raft.Voter))
+	}
+
+	state, err := readRaftState(logs, stable, snaps)
+	if err != nil {
+		return err
+	}
+
+	if !state.HasState() {
+		return fmt.Errorf("node %s has no raft state to recover, delete %s and bootstrap or join instead", conf.NodeID, path)
+	}
+
+	logf("local state: current term %d, last index %d term %d, snapshot index %d",
+		state.CurrentTerm, state.LastIndex, state.LastTerm, state.SnapshotIndex)
+
+	for _, p := range state.Configuration {
+		logf("old configuration at index %d: %s at %s as %s",
+			state.ConfigurationIndex, p.ID, p.Address, suffrageName(!p.NonVoter))
+	}
+
+	var self *raft.Server
+	for i, s := range configuration.Servers {
+		if string(s.ID) == conf.NodeID {
+			self = &configuration.Servers[i]
+		}
+	}
+
+	if self == nil {
+		return fmt.Errorf("node %s is not in %s", conf.NodeID, path)
+	}
+
+	if self.Address != trans.LocalAddr() {
+		return fmt.Errorf("node %s address is %s in %s, but it listen on %s", conf.NodeID, self.Address, path, trans.LocalAddr())
+	}
+
+	logf("applying log after the last snapshot, then saving the new configuration in a snapshot")
+	if err := raft.RecoverCluster(raftConf, fsm, logs, stable, snaps, trans, configuration); err != nil {
+		return fmt.Errorf("recover cluster: %w", err)
+	}
+
+	logf("recovered, deleting %s", path)
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("recovered but failed to delete %s, delete it before the next start: %w", path, err)
+	}
+
+	logf("done, node %s start with %d servers", conf.NodeID, len(configuration.Servers))
+	return nil
+}
+
+// InspectRaftState read the raft state of the stopped node, storeName is the raft.log_store of the node.
+func InspectRaftState(raftDir, storeName string) (RaftState, error) {
+	var store logStore
+
+	switch storeName {
+	case LogStoreBadger:
+		s, err := raftbadger.Open(filepath.Join(raftDir, badgerLogDir))
+		if err != nil {
+			return RaftState{}, fmt.Errorf("open badger log store, is the node stopped? %w", err)
+		}
+		store = s
+
+	case "", LogStoreBolt:
+		path := filepath.Join(raftDir, boltLogFile)
+		if !exists(path) {
+			return RaftState{}, fmt.Errorf("bolt log store %s not found", path)
+		}
+
+		s, err := raftboltdb.New(raftboltdb.Options{
+			Path: path,
+			BoltOptions: &bolt.Options{
+				ReadOnly: true,
+				Timeout:  migrateOpenTimeout,
+			},
+		})
+		if err != nil {
+			return RaftState{}, fmt.Errorf("open bolt log store, is the node stopped? %w", err)
+		}
+		store = s
+
+	default:
+		return RaftState{}, validLogStore(storeName)
+	}
+
+	defer store.Close()
+
+	snaps, err := raft.NewFileSnapshotStore(raftDir, 1, ioutil.Discard)
+	if err != nil {
+		return RaftState{}, err
+	}
+
+	return readRaftState(store, store, snaps)
+}
+
+// WritePeersFile write PeersFile in the raft dir, it is read on the next start of the node.
+func WritePeersFile(raftDir string, peers []PeerEntry) error {
+	data, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(raftDir, PeersFile)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	// the file is read back by raft, so an invalid configuration is found now instead of on start
+	if _, err := raft.ReadConfigJSON(path); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package gossip_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ysf/canoe/gossip"
+	"ysf/canoe/internal/testcluster"
+	"ysf/canoe/model"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecoverCluster(t *testing.T) {
+	if testing.Short() {
+		t.Skip("start 3 nodes cluster")
+	}
+
+	convey.Convey("Surviving node recover the lost quorum using peers.json", t, func() {
+		c := testcluster.New(t, testcluster.Options{Nodes: 3})
+		leader := c.WaitLeader(5 * time.Second)
+
+		_, err := c.Apply(model.CommandPayload{Operation: "SET", Key: "foo", Value: "bar"})
+		convey.So(err, convey.ShouldBeNil)
+
+		survivor := c.Index(leader)
+		for i := range c.Nodes() {
+			if i != survivor {
+				c.Kill(i)
+			}
+		}
+		c.Kill(survivor)
+
+		node := c.Node(survivor)
+		state, err := gossip.InspectRaftState(node.Dir, gossip.LogStoreBadger)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(state.HasState(), convey.ShouldBeTrue)
+		convey.So(state.LastIndex, convey.ShouldBeGreaterThan, 0)
+		convey.So(len(state.Configuration), convey.ShouldEqual, 3)
+
+		convey.So(gossip.WritePeersFile(node.Dir, []gossip.PeerEntry{
+			{ID: node.ID, Address: string(node.Address)},
+		}), convey.ShouldBeNil)
+
+		c.Restart(survivor)
+		convey.So(c.WaitLeader(5*time.Second), convey.ShouldEqual, node)
+
+		_, err = os.Stat(filepath.Join(node.Dir, gossip.PeersFile))
+		convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+
+		members, err := node.Gossip().Members()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(members), convey.ShouldEqual, 1)
+
+		convey.So(node.Repo().Get("foo"), convey.ShouldEqual, "bar")
+
+		_, err = c.Apply(model.CommandPayload{Operation: "SET", Key: "after", Value: "recovery"})
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Invalid peers file is refused", func() {
+			convey.So(gossip.WritePeersFile(node.Dir, nil), convey.ShouldNotBeNil)
+
+			_, err = os.Stat(filepath.Join(node.Dir, gossip.PeersFile))
+			convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+		})
+	})
+}
@@ -1,12 +1,80 @@
 package gossip
 
 import (
+	"context"
+	"errors"
+	"io"
+	"time"
 	"ysf/canoe/model"
 )
 
+// ErrNotLeader is returned by operation which must be run on the leader.
+var ErrNotLeader = errors.New("not leader")
+
+// ErrDraining is returned by operation sent to the leader which is shutting down.
+var ErrDraining = errors.New("node is draining, retry to the new leader")
+
+// Member is a server in the raft configuration.
+// Field which is not known by this node is omitted, for example the progress of other server when gossip is disabled.
+// MatchIndex is the last log index the leader replicated to the server in its term, it is only known by the leader.
+// AppliedIndex is reported by the server itself, it is the lower bound of its match index seen by the leader.
+// Lag is the distance from the commit index of this node, measured from MatchIndex when it is known, else AppliedIndex.
+type Member struct {
+	ID           string     `json:"id"`
+	Address      string     `json:"address"`
+	Suffrage     string     `json:"suffrage"`
+	Leader       bool       `json:"leader"`
+	HTTPAddress  string     `json:"http_address,omitempty"`
+	Gossip       string     `json:"gossip,omitempty"`
+	LastContact  *time.Time `json:"last_contact,omitempty"`
+	MatchIndex   *uint64    `json:"match_index,omitempty"`
+	AppliedIndex *uint64    `json:"applied_index,omitempty"`
+	Lag          *uint64    `json:"lag,omitempty"`
+	Healthy      *bool      `json:"healthy,omitempty"`
+}
+
+// NodeInfo is the local node, Bootstrapped is true when it has a raft configuration.
+type NodeInfo struct {
+	ID              string `json:"id"`
+	Address         string `json:"address"`
+	Bootstrapped    bool   `json:"bootstrapped"`
+	Leader          string `json:"leader"`
+	BootstrapExpect int    `json:"bootstrap_expect"`
+}
+
+// EffectiveConfig is the configuration used by this node after the default is applied, file path of TLS is not included.
+type EffectiveConfig struct {
+	NodeID        string       `json:"node_id"`
+	RaftAddress   string       `json:"raft_address"`
+	Suffrage      string       `json:"suffrage"`
+	PromoteMaxLag uint64       `json:"promote_max_lag"`
+	TLS           bool         `json:"tls"`
+	Gossip        bool         `json:"gossip"`
+	Autopilot     bool         `json:"autopilot"`
+	LogStore      string       `json:"log_store"`
+	Tuning        TuningConfig `json:"tuning"`
+}
+
 type Service interface {
-	Join(nodeID, addr string) error
+	Join(nodeID, addr, suffrage string) error
+	AutoJoin(ctx context.Context, conf JoinConfig)
+	Remove(nodeID string, force bool) error
+	Promote(nodeID string, force bool) error
+	Demote(nodeID string, force bool) error
+	TransferLeadership(nodeID string) (string, error)
+	Drain(timeout time.Duration, leave bool) error
+	AutopilotHealth() (ClusterHealth, error)
+	Members() ([]Member, error)
+	Node() NodeInfo
+	Config() EffectiveConfig
 	Stats() map[string]string
+	IsLeader() bool
+	Leader() string
+	Subscribe(buffer int, types ...string) *Subscription
+	Snapshot() (SnapshotInfo, error)
+	Snapshots() ([]SnapshotInfo, error)
+	OpenSnapshot(id string) (SnapshotInfo, io.ReadCloser, error)
+	ReadLog(after uint64, max int) (commands []model.CommittedCommand, last uint64, err error)
 	DoOperation(payload model.CommandPayload) (value interface{}, err error)
 	Shutdown() error
 }
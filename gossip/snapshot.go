@@ -0,0 +1,94 @@
+package gossip
+
+import (
+	"errors"
+	"io"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrSnapshotNotFound is returned by OpenSnapshot when the snapshot is not retained by this node.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// SnapshotInfo is the snapshot retained in the raft dir of this node.
+// FirstLogIndex is the first raft log index still in the log store, the log before it is compacted by the snapshot.
+type SnapshotInfo struct {
+	ID            string `json:"id"`
+	Index         uint64 `json:"index"`
+	Term          uint64 `json:"term"`
+	Size          int64  `json:"size"`
+	FirstLogIndex uint64 `json:"first_log_index,omitempty"`
+}
+
+func snapshotInfo(meta *raft.SnapshotMeta) SnapshotInfo {
+	return SnapshotInfo{
+		ID:    meta.ID,
+		Index: meta.Index,
+		Term:  meta.Term,
+		Size:  meta.Size,
+	}
+}
+
+// Snapshot take the snapshot of this node now and compact its log, keeping tuning.trailing_logs entries.
+// It return raft.ErrNothingNewToSnapshot when nothing is applied since the last snapshot.
+func (h handle) Snapshot() (SnapshotInfo, error) {
+	future := h.raft.Snapshot()
+	if err := future.Error(); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	meta, source, err := future.Open()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	_ = source.Close()
+
+	info := snapshotInfo(meta)
+	info.FirstLogIndex, err = h.logStore.FirstIndex()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return info, nil
+}
+
+// Snapshots return the snapshots retained by this node, the newest first.
+func (h handle) Snapshots() ([]SnapshotInfo, error) {
+	metas, err := h.snapshots.List()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]SnapshotInfo, 0, len(metas))
+	for _, meta := range metas {
+		snapshots = append(snapshots, snapshotInfo(meta))
+	}
+
+	return snapshots, nil
+}
+
+// OpenSnapshot return the content of the retained snapshot, see fsm.SnapshotHeader for the format.
+// The caller must close it.
+func (h handle) OpenSnapshot(id string) (SnapshotInfo, io.ReadCloser, error) {
+	metas, err := h.snapshots.List()
+	if err != nil {
+		return SnapshotInfo{}, nil, err
+	}
+
+	// only the listed id is opened, so the id is never used to read other path in the raft dir
+	for _, meta := range metas {
+		if meta.ID != id {
+			continue
+		}
+
+		meta, source, err := h.snapshots.Open(id)
+		if err != nil {
+			return SnapshotInfo{}, nil, err
+		}
+
+		return snapshotInfo(meta), source, nil
+	}
+
+	return SnapshotInfo{}, nil, ErrSnapshotNotFound
+}
@@ -0,0 +1,123 @@
+package gossip_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/internal/testcluster"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnapshot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("start 3 nodes cluster")
+	}
+
+	convey.Convey("Snapshot on demand compact the log", t, func() {
+		c := testcluster.New(t, testcluster.Options{
+			Nodes: 3,
+			Tuning: gossip.TuningConfig{
+				HeartbeatTimeout:   100 * time.Millisecond,
+				ElectionTimeout:    100 * time.Millisecond,
+				LeaderLeaseTimeout: 100 * time.Millisecond,
+				CommitTimeout:      5 * time.Millisecond,
+				SnapshotInterval:   time.Hour,
+				SnapshotThreshold:  100000,
+				TrailingLogs:       2,
+			},
+		})
+		leader := c.WaitLeader(5 * time.Second)
+
+		for i := 0; i < 10; i++ {
+			_, err := c.Apply(model.CommandPayload{Operation: "SET", Key: fmt.Sprintf("key-%d", i), Value: i})
+			convey.So(err, convey.ShouldBeNil)
+		}
+
+		_, err := c.Apply(model.CommandPayload{Operation: fsm.OpZAdd, Key: "board", Member: "alice", Score: 3})
+		convey.So(err, convey.ShouldBeNil)
+
+		info, err := leader.Gossip().Snapshot()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(info.ID, convey.ShouldNotBeEmpty)
+		convey.So(info.Index, convey.ShouldBeGreaterThan, 10)
+		convey.So(info.Size, convey.ShouldBeGreaterThan, 0)
+		convey.So(info.FirstLogIndex, convey.ShouldEqual, info.Index-1)
+
+		snapshots, err := leader.Gossip().Snapshots()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(snapshots), convey.ShouldEqual, 1)
+		convey.So(snapshots[0].ID, convey.ShouldEqual, info.ID)
+
+		convey.Convey("Snapshot file is JSON lines of every key", func() {
+			_, source, err := leader.Gossip().OpenSnapshot(info.ID)
+			convey.So(err, convey.ShouldBeNil)
+			defer source.Close()
+
+			scanner := bufio.NewScanner(source)
+			convey.So(scanner.Scan(), convey.ShouldBeTrue)
+
+			var header fsm.SnapshotHeader
+			convey.So(json.Unmarshal(scanner.Bytes(), &header), convey.ShouldBeNil)
+			convey.So(header.Format, convey.ShouldEqual, fsm.SnapshotFormat)
+			convey.So(header.AppliedIndex, convey.ShouldBeGreaterThan, 10)
+
+			values := map[string]string{}
+			for scanner.Scan() {
+				var entry repo.SnapshotEntry
+				convey.So(json.Unmarshal(scanner.Bytes(), &entry), convey.ShouldBeNil)
+				values[string(entry.Key)] = string(entry.Value)
+			}
+
+			convey.So(values["key-3"], convey.ShouldEqual, "3")
+			convey.So(len(values), convey.ShouldBeGreaterThan, 10)
+
+			_, _, err = leader.Gossip().OpenSnapshot("../" + info.ID)
+			convey.So(err, convey.ShouldEqual, gossip.ErrSnapshotNotFound)
+		})
+
+		convey.Convey("Follower behind the compacted log is restored from the snapshot", func() {
+			i := (c.Index(leader) + 1) % 3
+			c.Kill(i)
+
+			_, err := c.Apply(model.CommandPayload{Operation: fsm.OpDel, Keys: []string{"key-0"}})
+			convey.So(err, convey.ShouldBeNil)
+			_, err = c.Apply(model.CommandPayload{Operation: "SET", Key: "late", Value: "value"})
+			convey.So(err, convey.ShouldBeNil)
+
+			_, err = leader.Gossip().Snapshot()
+			convey.So(err, convey.ShouldBeNil)
+
+			c.Restart(i)
+			c.WaitConverged(5 * time.Second)
+
+			follower := c.Node(i)
+			convey.So(follower.Repo().Get("late"), convey.ShouldEqual, "value")
+
+			has, err := follower.Repo().Has("key-0")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(has, convey.ShouldBeFalse)
+
+			score, ok, err := follower.Repo().ZScore("board", "alice")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(score, convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("Node restart with its own snapshot keep its data", func() {
+			i := c.Index(leader)
+			c.Kill(i)
+			c.Restart(i)
+			c.WaitLeader(5 * time.Second)
+			c.WaitConverged(5 * time.Second)
+
+			convey.So(c.Node(i).Repo().Get("key-9"), convey.ShouldEqual, json.Number("9"))
+		})
+	})
+}
@@ -0,0 +1,220 @@
+package gossip
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Suffrage requested when joining the cluster
+const (
+	SuffrageVoter    = "voter"
+	SuffrageNonvoter = "nonvoter"
+)
+
+const defaultPromoteMaxLag = 1000
+
+func isVoter(suffrage string) (bool, error) {
+	switch suffrage {
+	case "", SuffrageVoter:
+		return true, nil
+	case SuffrageNonvoter:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unknown suffrage %q, use %s or %s", suffrage, SuffrageVoter, SuffrageNonvoter)
+}
+
+func suffrageName(voter bool) string {
+	if voter {
+		return SuffrageVoter
+	}
+
+	return SuffrageNonvoter
+}
+
+// findServer return the server with the id in the latest configuration, and the configuration index.
+func (h handle) findServer(nodeID string) (target *raft.Server, index uint64, err error) {
+	configFuture := h.raft.GetConfiguration()
+	if err = configFuture.Error(); err != nil {
+		return
+	}
+
+	for _, raftServer := range configFuture.Configuration().Servers {
+		if raftServer.ID == raft.ServerID(nodeID) {
+			srv := raftServer
+			target = &srv
+		}
+	}
+
+	if target == nil {
+		err = fmt.Errorf("node %s is not member of cluster", nodeID)
+	}
+
+	return target, configFuture.Index(), err
+}
+
+// checkQuorumAfter return error when the healthy voters left after the voter is removed or demoted is less than
+// the quorum of the new configuration, (voters-1)/2+1. This leader is healthy, the other voters is healthy
+// in the autopilot health when autopilot is enabled, otherwise when it acknowledged the AppendEntries of this leader
+// within the leader lease timeout, like raft does to keep the leadership.
+func (h handle) checkQuorumAfter(action, nodeID string) error {
+	configFuture := h.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+
+	health := make(map[string]bool)
+	cluster, errHealth := h.AutopilotHealth()
+	if errHealth == nil {
+		for _, sh := range cluster.Servers {
+			health[sh.ID] = sh.Healthy
+		}
+	}
+
+	var voters, healthy int
+	for _, srv := range configFuture.Configuration().Servers {
+		id := string(srv.ID)
+		if srv.Suffrage != raft.Voter || id == nodeID {
+			continue
+		}
+
+		voters++
+		switch {
+		case id == h.nodeID:
+			healthy++
+		case errHealth == nil:
+			if health[id] {
+				healthy++
+			}
+		default:
+			last, ok := h.trans.lastContactOf(srv.ID)
+			if ok && time.Since(last) <= h.tuning.LeaderLeaseTimeout {
+				healthy++
+			}
+		}
+	}
+
+	quorum := voters/2 + 1
+	if healthy < quorum {
+		return fmt.Errorf("%s node %s leaves %d healthy voter of %d, less than quorum %d of the new configuration, use force to do it anyway",
+			action, nodeID, healthy, voters, quorum)
+	}
+
+	return nil
+}
+
+// lag return the distance of the node from the leader commit index.
+// It is measured from the match index seen by this leader in the AppendEntries responses of the node.
+// The applied index reported by the node through gossip is only used when this leader did not replicate
+// to the node in its term yet, it never exceeds the match index so the lag is not underestimated.
+func (h handle) lag(nodeID string) (uint64, error) {
+	commitIndex, err := strconv.ParseUint(h.raft.Stats()["commit_index"], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	term, err := strconv.ParseUint(h.raft.Stats()["term"], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	index, ok := h.trans.matchIndexOf(raft.ServerID(nodeID), term)
+	if !ok {
+		if h.membership == nil {
+			return 0, fmt.Errorf("progress of node %s is unknown, it is not replicated by this leader yet and gossip is disabled", nodeID)
+		}
+
+		progress, known := h.membership.peerProgress(nodeID)
+		if !known {
+			return 0, fmt.Errorf("progress of node %s is unknown, it is not replicated by this leader or acked through gossip yet", nodeID)
+		}
+
+		index = progress.AppliedIndex
+	}
+
+	if index >= commitIndex {
+		return 0, nil
+	}
+
+	return commitIndex - index, nil
+}
+
+// Promote make the non-voter a voter. It is refused when the node is lagging more than PromoteMaxLag
+// behind the leader, because it slows down the quorum until caught up. Use force to skip the check.
+func (h handle) Promote(nodeID string, force bool) error {
+	if h.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	target, index, err := h.findServer(nodeID)
+	if err != nil {
+		return err
+	}
+
+	if target.Suffrage == raft.Voter {
+		return fmt.Errorf("node %s is already a voter", nodeID)
+	}
+
+	if !force {
+		lag, err := h.lag(nodeID)
+		if err != nil {
+			return fmt.Errorf("%s, use force to promote it anyway", err.Error())
+		}
+
+		if lag > h.promoteMaxLag {
+			return fmt.Errorf("node %s is %d entries behind the leader, more than %d", nodeID, lag, h.promoteMaxLag)
+		}
+	}
+
+	// AddVoter on existing non-voter change its suffrage
+	f := h.raft.AddVoter(target.ID, target.Address, index, 0)
+	if f.Error() != nil {
+		return f.Error()
+	}
+
+	if h.membership != nil {
+		h.membership.setDemoted(nodeID, false)
+	}
+
+	fmt.Printf("node %s promoted to voter\n", nodeID)
+	return nil
+}
+
+// Demote make the voter a non-voter. Like Remove, demoting a voter which leaves less healthy voter than the quorum
+// of the new configuration is refused unless force is true.
+func (h handle) Demote(nodeID string, force bool) error {
+	if h.raft.State() != raft.Leader {
+		return ErrNotLeader
+	}
+
+	target, index, err := h.findServer(nodeID)
+	if err != nil {
+		return err
+	}
+
+	if target.Suffrage != raft.Voter {
+		return fmt.Errorf("node %s is not a voter", nodeID)
+	}
+
+	if !force {
+		if err := h.checkQuorumAfter("demoting", nodeID); err != nil {
+			return err
+		}
+	}
+
+	f := h.raft.DemoteVoter(target.ID, index, 0)
+	if f.Error() != nil {
+		return f.Error()
+	}
+
+	// autopilot does not promote it again, although its gossip meta still want to be a voter
+	if h.membership != nil {
+		h.membership.setDemoted(nodeID, true)
+	}
+
+	fmt.Printf("node %s demoted to non-voter\n", nodeID)
+	return nil
+}
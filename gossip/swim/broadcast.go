@@ -0,0 +1,82 @@
+package swim
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+type broadcast struct {
+	update    update
+	transmits int
+}
+
+// broadcastQueue keep the latest update of each member until it is piggybacked enough times.
+type broadcastQueue struct {
+	mu    sync.Mutex
+	items map[string]*broadcast
+}
+
+func newBroadcastQueue() *broadcastQueue {
+	return &broadcastQueue{
+		items: make(map[string]*broadcast),
+	}
+}
+
+// queue replace older update of the same member
+func (q *broadcastQueue) queue(u update) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items[u.Name] = &broadcast{update: u}
+}
+
+// get return at most max update, the least transmitted first.
+// Update is dropped after transmitted retransmitMult * log10(members+1) times.
+func (q *broadcastQueue) get(max, retransmitMult, members int) []update {
+	if max <= 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	limit := retransmitMult * int(math.Ceil(math.Log10(float64(members+1))))
+	if limit < 1 {
+		limit = 1
+	}
+
+	list := make([]*broadcast, 0, len(q.items))
+	for _, b := range q.items {
+		list = append(list, b)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].transmits != list[j].transmits {
+			return list[i].transmits < list[j].transmits
+		}
+		return list[i].update.Name < list[j].update.Name
+	})
+
+	if len(list) > max {
+		list = list[:max]
+	}
+
+	out := make([]update, 0, len(list))
+	for _, b := range list {
+		out = append(out, b.update)
+		b.transmits++
+		if b.transmits >= limit {
+			delete(q.items, b.update.Name)
+		}
+	}
+
+	return out
+}
+
+func (q *broadcastQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
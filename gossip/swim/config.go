@@ -0,0 +1,95 @@
+package swim
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventDelegate is notified when membership changed. It is called from a single goroutine in the order of the change.
+type EventDelegate interface {
+	NotifyJoin(member Member)
+	NotifyUpdate(member Member)
+	NotifyLeave(member Member)
+}
+
+// PingDelegate attach payload to the ack of a ping, and receive the payload from the probed member.
+type PingDelegate interface {
+	AckPayload() []byte
+	NotifyPingComplete(member Member, rtt time.Duration, payload []byte)
+}
+
+// Config is used by Create.
+type Config struct {
+	// Name is the unique name of this node in the cluster
+	Name string
+
+	// Meta is disseminated to every member, use UpdateMeta to change it later
+	Meta map[string]string
+
+	// Transport is used to send and receive message, use NewUDPTransport or InmemNetwork.
+	Transport Transport
+
+	// ProbeInterval is the interval between probing random member.
+	// ProbeTimeout is the time to wait ack of direct ping before asking IndirectChecks other members to ping it.
+	// When no ack is received until the end of ProbeInterval, the member is suspected.
+	ProbeInterval  time.Duration
+	ProbeTimeout   time.Duration
+	IndirectChecks int
+
+	// SuspicionTimeout is the time a suspected member has to refute the suspicion before it is declared dead.
+	SuspicionTimeout time.Duration
+
+	// PushPullInterval is the interval between exchanging the whole member list with a random member,
+	// including dead member, so partitioned member see each other again after the network is healed.
+	PushPullInterval time.Duration
+
+	// DeadReclaimTime is the time a dead member is kept in the member list before removed.
+	DeadReclaimTime time.Duration
+
+	// RetransmitMult multiplied by log10(members+1) is the number of times each update is piggybacked.
+	// MaxPiggyback is the maximum number of update in one message.
+	RetransmitMult int
+	MaxPiggyback   int
+
+	Events EventDelegate
+	Ping   PingDelegate
+}
+
+// DefaultConfig return config for local network, Name and Transport must still be set.
+func DefaultConfig() *Config {
+	return &Config{
+		Meta:             map[string]string{},
+		ProbeInterval:    1 * time.Second,
+		ProbeTimeout:     500 * time.Millisecond,
+		IndirectChecks:   3,
+		SuspicionTimeout: 5 * time.Second,
+		PushPullInterval: 15 * time.Second,
+		DeadReclaimTime:  30 * time.Second,
+		RetransmitMult:   4,
+		MaxPiggyback:     16,
+	}
+}
+
+func (c *Config) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("swim: empty node name")
+	}
+
+	if c.Transport == nil {
+		return fmt.Errorf("swim: transport is not set")
+	}
+
+	if c.ProbeTimeout <= 0 || c.ProbeInterval <= c.ProbeTimeout {
+		return fmt.Errorf("swim: probe interval %s must be greater than probe timeout %s", c.ProbeInterval, c.ProbeTimeout)
+	}
+
+	if c.PushPullInterval <= 0 {
+		return fmt.Errorf("swim: push pull interval must be positive")
+	}
+
+	if c.SuspicionTimeout <= 0 {
+		return fmt.Errorf("swim: suspicion timeout must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package swim
+
+import (
+	"sync"
+)
+
+// InmemNetwork connect InmemTransport in the same process, used for testing.
+// Link between two address can be cut to simulate network partition.
+type InmemNetwork struct {
+	mu         sync.RWMutex
+	transports map[string]*InmemTransport
+	blocked    map[string]map[string]bool
+}
+
+// NewInmemNetwork return empty network.
+func NewInmemNetwork() *InmemNetwork {
+	return &InmemNetwork{
+		transports: make(map[string]*InmemTransport),
+		blocked:    make(map[string]map[string]bool),
+	}
+}
+
+// NewTransport create transport with the address in this network.
+func (n *InmemNetwork) NewTransport(addr string) *InmemTransport {
+	t := &InmemTransport{
+		network:  n,
+		addr:     addr,
+		packetCh: make(chan Packet, 1024),
+	}
+
+	n.mu.Lock()
+	n.transports[addr] = t
+	n.mu.Unlock()
+
+	return t
+}
+
+// Block drop every packet sent from one address to the other.
+func (n *InmemNetwork) Block(from, to string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.blocked[from] == nil {
+		n.blocked[from] = make(map[string]bool)
+	}
+	n.blocked[from][to] = true
+}
+
+// Unblock restore the link blocked by Block.
+func (n *InmemNetwork) Unblock(from, to string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.blocked[from], to)
+}
+
+// Isolate block every packet from and to the address.
+func (n *InmemNetwork) Isolate(addr string) {
+	n.mu.RLock()
+	addrs := make([]string, 0, len(n.transports))
+	for other := range n.transports {
+		addrs = append(addrs, other)
+	}
+	n.mu.RUnlock()
+
+	for _, other := range addrs {
+		if other == addr {
+			continue
+		}
+		n.Block(addr, other)
+		n.Block(other, addr)
+	}
+}
+
+// Heal remove every blocked link.
+func (n *InmemNetwork) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.blocked = make(map[string]map[string]bool)
+}
+
+func (n *InmemNetwork) deliver(from, to string, data []byte) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.blocked[from][to] {
+		return
+	}
+
+	t, ok := n.transports[to]
+	if !ok || t.isShutdown() {
+		return
+	}
+
+	buf := make([]byte, len(data))
+	copy(buf, data)
+
+	select {
+	case t.packetCh <- Packet{From: from, Data: buf}:
+	default:
+	}
+}
+
+// InmemTransport is Transport in InmemNetwork.
+type InmemTransport struct {
+	network  *InmemNetwork
+	addr     string
+	packetCh chan Packet
+
+	mu       sync.RWMutex
+	shutdown bool
+}
+
+func (t *InmemTransport) LocalAddr() string {
+	return t.addr
+}
+
+func (t *InmemTransport) WriteTo(data []byte, addr string) error {
+	t.network.deliver(t.addr, addr, data)
+	return nil
+}
+
+func (t *InmemTransport) PacketCh() <-chan Packet {
+	return t.packetCh
+}
+
+func (t *InmemTransport) Shutdown() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.shutdown = true
+	return nil
+}
+
+func (t *InmemTransport) isShutdown() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.shutdown
+}
@@ -0,0 +1,64 @@
+package swim
+
+import (
+	"time"
+)
+
+// State is the state of member seen by this node.
+type State uint8
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+	StateLeft
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+
+	return "unknown"
+}
+
+// Member is a node in the gossip cluster.
+// Incarnation is increased only by the member itself, to refute suspicion or to update its meta.
+type Member struct {
+	Name        string
+	Address     string
+	Meta        map[string]string
+	Incarnation uint64
+	State       State
+	StateChange time.Time
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	out := make(map[string]string, len(meta))
+	for k, v := range meta {
+		out[k] = v
+	}
+
+	return out
+}
+
+func sameMeta(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+package swim
+
+import (
+	"encoding/json"
+)
+
+type messageType uint8
+
+const (
+	pingMsg messageType = iota
+	ackMsg
+	pingReqMsg
+)
+
+// message is sent as one JSON packet, every message piggyback the latest membership updates.
+type message struct {
+	Type     messageType `json:"t"`
+	Seq      uint32      `json:"s"`
+	From     string      `json:"f"`
+	FromAddr string      `json:"fa"`
+
+	// Target is the name of probed member, ping is ignored when it is received by other member on the same address.
+	// TargetAddr is used in ping-req, so the member asked can reach the target.
+	Target     string `json:"tg,omitempty"`
+	TargetAddr string `json:"ta,omitempty"`
+
+	// PushPull carry the whole member list of the sender and ask the receiver to reply with its whole member list,
+	// used to join and to repair state which is missed, for example after partition is healed.
+	PushPull bool `json:"pp,omitempty"`
+
+	Payload []byte   `json:"p,omitempty"`
+	Updates []update `json:"u,omitempty"`
+}
+
+// update is the state of one member as gossiped
+type update struct {
+	Name        string            `json:"n"`
+	Address     string            `json:"a"`
+	Meta        map[string]string `json:"m,omitempty"`
+	Incarnation uint64            `json:"i"`
+	State       State             `json:"st"`
+}
+
+func encodeMessage(msg message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func decodeMessage(data []byte) (msg message, err error) {
+	err = json.Unmarshal(data, &msg)
+	return
+}
@@ -0,0 +1,735 @@
+// Package swim implement SWIM style membership and failure detection.
+//
+// Every ProbeInterval a member is pinged directly, when no ack is received in ProbeTimeout,
+// IndirectChecks other members is asked to ping it (ping-req). Member which is not acked by any of them is suspected,
+// and declared dead when it does not refute the suspicion in SuspicionTimeout.
+// Membership updates is piggybacked on ping and ack, so no extra message is needed to disseminate them.
+// https://www.cs.cornell.edu/projects/Quicksilver/public_pdfs/SWIM.pdf
+package swim
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type eventType uint8
+
+const (
+	eventJoin eventType = iota
+	eventUpdate
+	eventLeave
+)
+
+type event struct {
+	typ    eventType
+	member Member
+}
+
+type ackResult struct {
+	payload []byte
+}
+
+// Memberlist is one node of the gossip cluster.
+type Memberlist struct {
+	conf      *Config
+	transport Transport
+
+	mu         sync.RWMutex
+	members    map[string]*Member
+	suspicions map[string]*time.Timer
+	probeOrder []string
+	probeIndex int
+	leaving    bool
+
+	seq   uint32
+	ackMu sync.Mutex
+	acks  map[uint32]chan ackResult
+
+	broadcasts *broadcastQueue
+
+	eventMu     sync.Mutex
+	events      []event
+	eventSignal chan struct{}
+
+	shutdownOnce sync.Once
+	shutdownCh   chan struct{}
+	wg           sync.WaitGroup
+}
+
+// Create start the gossip of this node, use Join to contact the other members.
+func Create(conf *Config) (*Memberlist, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &Memberlist{
+		conf:        conf,
+		transport:   conf.Transport,
+		members:     make(map[string]*Member),
+		suspicions:  make(map[string]*time.Timer),
+		acks:        make(map[uint32]chan ackResult),
+		broadcasts:  newBroadcastQueue(),
+		eventSignal: make(chan struct{}, 1),
+		shutdownCh:  make(chan struct{}),
+	}
+
+	self := &Member{
+		Name:        conf.Name,
+		Address:     m.transport.LocalAddr(),
+		Meta:        copyMeta(conf.Meta),
+		State:       StateAlive,
+		StateChange: time.Now(),
+	}
+
+	m.members[self.Name] = self
+	m.broadcasts.queue(toUpdate(self))
+
+	m.wg.Add(3)
+	go m.receiveLoop()
+	go m.probeLoop()
+	go m.eventLoop()
+
+	return m, nil
+}
+
+// Join contact the members on the addresses and fetch their member list.
+// It return the number of address which replied, and error when none of them replied.
+func (m *Memberlist) Join(addrs []string) (int, error) {
+	var (
+		joined int
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+	)
+
+	for _, addr := range addrs {
+		if addr == m.transport.LocalAddr() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			seq := m.nextSeq()
+			ackCh := m.registerAck(seq)
+			defer m.deregisterAck(seq)
+
+			m.send(addr, message{
+				Type:     pingMsg,
+				Seq:      seq,
+				PushPull: true,
+				Updates:  m.fullState(),
+			})
+
+			select {
+			case <-ackCh:
+				mu.Lock()
+				joined++
+				mu.Unlock()
+			case <-time.After(m.conf.ProbeInterval):
+			case <-m.shutdownCh:
+			}
+		}(addr)
+	}
+
+	wg.Wait()
+
+	if joined == 0 && len(addrs) > 0 {
+		return 0, fmt.Errorf("swim: no reply from %v", addrs)
+	}
+
+	return joined, nil
+}
+
+// Leave broadcast that this node is leaving, and wait until it is disseminated or timeout.
+// Member which left is not suspected, it is removed right away by the others.
+func (m *Memberlist) Leave(timeout time.Duration) {
+	m.mu.Lock()
+	m.leaving = true
+	self := m.members[m.conf.Name]
+	self.Incarnation++
+	self.State = StateLeft
+	self.StateChange = time.Now()
+	m.broadcasts.queue(toUpdate(self))
+	m.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for m.broadcasts.len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// UpdateMeta replace the meta of this node and disseminate it.
+func (m *Memberlist) UpdateMeta(meta map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	self := m.members[m.conf.Name]
+	self.Meta = copyMeta(meta)
+	self.Incarnation++
+	m.broadcasts.queue(toUpdate(self))
+}
+
+// Members return every member known by this node including itself, ordered by name.
+func (m *Memberlist) Members() []Member {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]Member, 0, len(m.members))
+	for _, member := range m.members {
+		out = append(out, copyMember(member))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// LocalMember return this node.
+func (m *Memberlist) LocalMember() Member {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return copyMember(m.members[m.conf.Name])
+}
+
+// Shutdown stop gossip without notifying the others, use Leave before it to leave gracefully.
+func (m *Memberlist) Shutdown() (err error) {
+	m.shutdownOnce.Do(func() {
+		close(m.shutdownCh)
+		err = m.transport.Shutdown()
+		m.wg.Wait()
+
+		m.mu.Lock()
+		for _, timer := range m.suspicions {
+			timer.Stop()
+		}
+		m.mu.Unlock()
+	})
+
+	return
+}
+
+func (m *Memberlist) nextSeq() uint32 {
+	return atomic.AddUint32(&m.seq, 1)
+}
+
+func (m *Memberlist) registerAck(seq uint32) chan ackResult {
+	ch := make(chan ackResult, 1)
+
+	m.ackMu.Lock()
+	m.acks[seq] = ch
+	m.ackMu.Unlock()
+
+	return ch
+}
+
+func (m *Memberlist) deregisterAck(seq uint32) {
+	m.ackMu.Lock()
+	delete(m.acks, seq)
+	m.ackMu.Unlock()
+}
+
+// send piggyback the pending updates into the message, it must not be called while holding m.mu
+func (m *Memberlist) send(addr string, msg message) {
+	msg.From = m.conf.Name
+	msg.FromAddr = m.transport.LocalAddr()
+
+	m.mu.RLock()
+	numMembers := len(m.members)
+	m.mu.RUnlock()
+
+	msg.Updates = append(msg.Updates, m.broadcasts.get(m.conf.MaxPiggyback-len(msg.Updates), m.conf.RetransmitMult, numMembers)...)
+
+	data, err := encodeMessage(msg)
+	if err != nil {
+		return
+	}
+
+	_ = m.transport.WriteTo(data, addr)
+}
+
+func (m *Memberlist) receiveLoop() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.shutdownCh:
+			return
+		case packet := <-m.transport.PacketCh():
+			msg, err := decodeMessage(packet.Data)
+			if err != nil {
+				continue
+			}
+
+			m.handle(msg)
+		}
+	}
+}
+
+func (m *Memberlist) handle(msg message) {
+	for _, u := range msg.Updates {
+		m.merge(u)
+	}
+
+	switch msg.Type {
+	case pingMsg:
+		if msg.Target != "" && msg.Target != m.conf.Name {
+			return
+		}
+
+		reply := message{
+			Type: ackMsg,
+			Seq:  msg.Seq,
+		}
+
+		if m.conf.Ping != nil {
+			reply.Payload = m.conf.Ping.AckPayload()
+		}
+
+		if msg.PushPull {
+			reply.Updates = m.fullState()
+		}
+
+		m.send(msg.FromAddr, reply)
+
+	case ackMsg:
+		m.ackMu.Lock()
+		ch, ok := m.acks[msg.Seq]
+		m.ackMu.Unlock()
+
+		if ok {
+			select {
+			case ch <- ackResult{payload: msg.Payload}:
+			default:
+			}
+		}
+
+	case pingReqMsg:
+		seq := m.nextSeq()
+		ackCh := m.registerAck(seq)
+
+		m.send(msg.TargetAddr, message{
+			Type:   pingMsg,
+			Seq:    seq,
+			Target: msg.Target,
+		})
+
+		go func() {
+			defer m.deregisterAck(seq)
+
+			select {
+			case result := <-ackCh:
+				// forward the ack using the sequence of the requester
+				m.send(msg.FromAddr, message{
+					Type:    ackMsg,
+					Seq:     msg.Seq,
+					Payload: result.payload,
+				})
+			case <-time.After(m.conf.ProbeTimeout):
+			case <-m.shutdownCh:
+			}
+		}()
+	}
+}
+
+func (m *Memberlist) fullState() []update {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]update, 0, len(m.members))
+	for _, member := range m.members {
+		out = append(out, toUpdate(member))
+	}
+
+	return out
+}
+
+func (m *Memberlist) probeLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.conf.ProbeInterval)
+	defer ticker.Stop()
+
+	pushPullTicker := time.NewTicker(m.conf.PushPullInterval)
+	defer pushPullTicker.Stop()
+
+	for {
+		select {
+		case <-m.shutdownCh:
+			return
+		case <-ticker.C:
+			m.probe()
+			m.reclaim()
+		case <-pushPullTicker.C:
+			m.pushPull()
+		}
+	}
+}
+
+// pushPull exchange the whole member list with a random member which has not left
+func (m *Memberlist) pushPull() {
+	m.mu.RLock()
+	candidates := make([]string, 0, len(m.members))
+	for name, member := range m.members {
+		if name != m.conf.Name && member.State != StateLeft {
+			candidates = append(candidates, member.Address)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return
+	}
+
+	m.send(candidates[rand.Intn(len(candidates))], message{
+		Type:     pingMsg,
+		Seq:      m.nextSeq(),
+		PushPull: true,
+		Updates:  m.fullState(),
+	})
+}
+
+// nextTarget return the next member in the probe order, the order is shuffled every round
+// so each member is probed once per round in random order.
+func (m *Memberlist) nextTarget() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for attempt := 0; attempt <= len(m.members); attempt++ {
+		if m.probeIndex >= len(m.probeOrder) {
+			m.probeOrder = m.probeOrder[:0]
+			for name := range m.members {
+				if name != m.conf.Name {
+					m.probeOrder = append(m.probeOrder, name)
+				}
+			}
+
+			rand.Shuffle(len(m.probeOrder), func(i, j int) {
+				m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+			})
+			m.probeIndex = 0
+
+			if len(m.probeOrder) == 0 {
+				return Member{}, false
+			}
+		}
+
+		name := m.probeOrder[m.probeIndex]
+		m.probeIndex++
+
+		member, ok := m.members[name]
+		if !ok || member.State == StateDead || member.State == StateLeft {
+			continue
+		}
+
+		return copyMember(member), true
+	}
+
+	return Member{}, false
+}
+
+func (m *Memberlist) probe() {
+	target, ok := m.nextTarget()
+	if !ok {
+		return
+	}
+
+	seq := m.nextSeq()
+	ackCh := m.registerAck(seq)
+	defer m.deregisterAck(seq)
+
+	start := time.Now()
+	m.send(target.Address, message{
+		Type:   pingMsg,
+		Seq:    seq,
+		Target: target.Name,
+	})
+
+	select {
+	case result := <-ackCh:
+		m.pingComplete(target, time.Since(start), result.payload)
+		return
+	case <-time.After(m.conf.ProbeTimeout):
+	case <-m.shutdownCh:
+		return
+	}
+
+	// ask other members to ping the target, the target may be reachable from them
+	for _, peer := range m.randomMembers(m.conf.IndirectChecks, target.Name) {
+		m.send(peer.Address, message{
+			Type:       pingReqMsg,
+			Seq:        seq,
+			Target:     target.Name,
+			TargetAddr: target.Address,
+		})
+	}
+
+	select {
+	case result := <-ackCh:
+		m.pingComplete(target, time.Since(start), result.payload)
+		return
+	case <-time.After(m.conf.ProbeInterval - m.conf.ProbeTimeout):
+	case <-m.shutdownCh:
+		return
+	}
+
+	m.merge(update{
+		Name:        target.Name,
+		Address:     target.Address,
+		Incarnation: target.Incarnation,
+		State:       StateSuspect,
+	})
+}
+
+func (m *Memberlist) pingComplete(target Member, rtt time.Duration, payload []byte) {
+	if m.conf.Ping != nil {
+		m.conf.Ping.NotifyPingComplete(target, rtt, payload)
+	}
+}
+
+// randomMembers return at most k alive members other than this node and the excluded one
+func (m *Memberlist) randomMembers(k int, exclude string) []Member {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Member, 0, len(m.members))
+	for name, member := range m.members {
+		if name == m.conf.Name || name == exclude || member.State != StateAlive {
+			continue
+		}
+		list = append(list, copyMember(member))
+	}
+
+	rand.Shuffle(len(list), func(i, j int) {
+		list[i], list[j] = list[j], list[i]
+	})
+
+	if len(list) > k {
+		list = list[:k]
+	}
+
+	return list
+}
+
+// reclaim remove member which is dead or left longer than DeadReclaimTime
+func (m *Memberlist) reclaim() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, member := range m.members {
+		if name == m.conf.Name {
+			continue
+		}
+
+		if (member.State == StateDead || member.State == StateLeft) && time.Since(member.StateChange) > m.conf.DeadReclaimTime {
+			delete(m.members, name)
+		}
+	}
+}
+
+func (m *Memberlist) merge(u update) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch u.State {
+	case StateAlive:
+		m.aliveLocked(u)
+	case StateSuspect:
+		m.suspectLocked(u)
+	case StateDead, StateLeft:
+		m.deadLocked(u)
+	}
+}
+
+func (m *Memberlist) aliveLocked(u update) {
+	if u.Name == m.conf.Name {
+		self := m.members[m.conf.Name]
+		if u.Incarnation > self.Incarnation && !m.leaving {
+			m.refuteLocked(u.Incarnation)
+		}
+		return
+	}
+
+	cur, ok := m.members[u.Name]
+	if !ok {
+		member := &Member{
+			Name:        u.Name,
+			Address:     u.Address,
+			Meta:        copyMeta(u.Meta),
+			Incarnation: u.Incarnation,
+			State:       StateAlive,
+			StateChange: time.Now(),
+		}
+
+		m.members[u.Name] = member
+		m.broadcasts.queue(u)
+		m.emitLocked(eventJoin, member)
+		return
+	}
+
+	if u.Incarnation <= cur.Incarnation {
+		return
+	}
+
+	prev := cur.State
+	changed := cur.Address != u.Address || !sameMeta(cur.Meta, u.Meta)
+
+	m.stopSuspicionLocked(u.Name)
+	cur.Address = u.Address
+	cur.Meta = copyMeta(u.Meta)
+	cur.Incarnation = u.Incarnation
+	cur.State = StateAlive
+	if prev != StateAlive {
+		cur.StateChange = time.Now()
+	}
+
+	m.broadcasts.queue(u)
+
+	switch {
+	case prev == StateDead || prev == StateLeft:
+		m.emitLocked(eventJoin, cur)
+	case prev == StateSuspect || changed:
+		m.emitLocked(eventUpdate, cur)
+	}
+}
+
+func (m *Memberlist) suspectLocked(u update) {
+	cur, ok := m.members[u.Name]
+	if !ok || u.Incarnation < cur.Incarnation || cur.State != StateAlive {
+		return
+	}
+
+	if u.Name == m.conf.Name {
+		if !m.leaving {
+			m.refuteLocked(u.Incarnation)
+		}
+		return
+	}
+
+	cur.Incarnation = u.Incarnation
+	cur.State = StateSuspect
+	cur.StateChange = time.Now()
+	m.broadcasts.queue(toUpdate(cur))
+	m.emitLocked(eventUpdate, cur)
+
+	name, incarnation := u.Name, u.Incarnation
+	m.suspicions[name] = time.AfterFunc(m.conf.SuspicionTimeout, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		member, ok := m.members[name]
+		if !ok || member.State != StateSuspect || member.Incarnation != incarnation {
+			return
+		}
+
+		m.deadLocked(update{
+			Name:        name,
+			Address:     member.Address,
+			Incarnation: incarnation,
+			State:       StateDead,
+		})
+	})
+}
+
+func (m *Memberlist) deadLocked(u update) {
+	cur, ok := m.members[u.Name]
+	if !ok || u.Incarnation < cur.Incarnation || cur.State == StateDead || cur.State == StateLeft {
+		return
+	}
+
+	if u.Name == m.conf.Name && !m.leaving {
+		m.refuteLocked(u.Incarnation)
+		return
+	}
+
+	m.stopSuspicionLocked(u.Name)
+	cur.Incarnation = u.Incarnation
+	cur.State = u.State
+	cur.StateChange = time.Now()
+	m.broadcasts.queue(toUpdate(cur))
+	m.emitLocked(eventLeave, cur)
+}
+
+// refuteLocked disseminate that this node is alive with incarnation greater than the suspicion
+func (m *Memberlist) refuteLocked(incarnation uint64) {
+	self := m.members[m.conf.Name]
+	if incarnation > self.Incarnation {
+		self.Incarnation = incarnation
+	}
+	self.Incarnation++
+	m.broadcasts.queue(toUpdate(self))
+}
+
+func (m *Memberlist) stopSuspicionLocked(name string) {
+	if timer, ok := m.suspicions[name]; ok {
+		timer.Stop()
+		delete(m.suspicions, name)
+	}
+}
+
+func (m *Memberlist) emitLocked(typ eventType, member *Member) {
+	if m.conf.Events == nil {
+		return
+	}
+
+	m.eventMu.Lock()
+	m.events = append(m.events, event{typ: typ, member: copyMember(member)})
+	m.eventMu.Unlock()
+
+	select {
+	case m.eventSignal <- struct{}{}:
+	default:
+	}
+}
+
+// eventLoop call the EventDelegate outside of the lock, so the delegate can call Members
+func (m *Memberlist) eventLoop() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.shutdownCh:
+			return
+		case <-m.eventSignal:
+		}
+
+		m.eventMu.Lock()
+		events := m.events
+		m.events = nil
+		m.eventMu.Unlock()
+
+		for _, e := range events {
+			switch e.typ {
+			case eventJoin:
+				m.conf.Events.NotifyJoin(e.member)
+			case eventUpdate:
+				m.conf.Events.NotifyUpdate(e.member)
+			case eventLeave:
+				m.conf.Events.NotifyLeave(e.member)
+			}
+		}
+	}
+}
+
+func toUpdate(member *Member) update {
+	return update{
+		Name:        member.Name,
+		Address:     member.Address,
+		Meta:        copyMeta(member.Meta),
+		Incarnation: member.Incarnation,
+		State:       member.State,
+	}
+}
+
+func copyMember(member *Member) Member {
+	out := *member
+	out.Meta = copyMeta(member.Meta)
+	return out
+}
@@ -0,0 +1,239 @@
+package swim
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type recordEvents struct {
+	mu     sync.Mutex
+	joined map[string]int
+	left   map[string]int
+}
+
+func (r *recordEvents) NotifyJoin(member Member) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.joined[member.Name]++
+}
+
+func (r *recordEvents) NotifyUpdate(member Member) {}
+
+func (r *recordEvents) NotifyLeave(member Member) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.left[member.Name]++
+}
+
+func (r *recordEvents) count(name string) (joined, left int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.joined[name], r.left[name]
+}
+
+func newTestCluster(t *testing.T, network *InmemNetwork, n int, events EventDelegate) []*Memberlist {
+	nodes := make([]*Memberlist, 0, n)
+	for i := 0; i < n; i++ {
+		conf := DefaultConfig()
+		conf.Name = fmt.Sprintf("node_%d", i)
+		conf.Meta = map[string]string{"index": fmt.Sprint(i)}
+		conf.Transport = network.NewTransport(fmt.Sprintf("addr_%d", i))
+		conf.ProbeInterval = 50 * time.Millisecond
+		conf.ProbeTimeout = 20 * time.Millisecond
+		conf.SuspicionTimeout = 200 * time.Millisecond
+		conf.PushPullInterval = 200 * time.Millisecond
+		conf.DeadReclaimTime = time.Minute
+		if i == 0 {
+			conf.Events = events
+		}
+
+		m, err := Create(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nodes = append(nodes, m)
+	}
+
+	for _, m := range nodes[1:] {
+		if _, err := m.Join([]string{"addr_0"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for _, m := range nodes {
+			_ = m.Shutdown()
+		}
+	})
+
+	return nodes
+}
+
+// waitState wait until every node see the member in the state
+func waitState(nodes []*Memberlist, name string, state State, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		converged := true
+		for _, m := range nodes {
+			found := false
+			for _, member := range m.Members() {
+				if member.Name == name && member.State == state {
+					found = true
+				}
+			}
+			converged = converged && found
+		}
+
+		if converged {
+			return true
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestMemberlist_Join(t *testing.T) {
+	convey.Convey("Join", t, func() {
+		network := NewInmemNetwork()
+		nodes := newTestCluster(t, network, 4, nil)
+
+		convey.Convey("Every node should know every member and its meta", func() {
+			for i := 0; i < 4; i++ {
+				convey.So(waitState(nodes, fmt.Sprintf("node_%d", i), StateAlive, 2*time.Second), convey.ShouldBeTrue)
+			}
+
+			for _, member := range nodes[3].Members() {
+				convey.So(member.Meta["index"], convey.ShouldEqual, member.Name[len("node_"):])
+			}
+		})
+
+		convey.Convey("Join to unknown address should return error", func() {
+			conf := DefaultConfig()
+			conf.Name = "lonely"
+			conf.Transport = network.NewTransport("addr_lonely")
+			conf.ProbeInterval = 50 * time.Millisecond
+			conf.ProbeTimeout = 20 * time.Millisecond
+
+			m, err := Create(conf)
+			convey.So(err, convey.ShouldBeNil)
+			defer m.Shutdown()
+
+			n, err := m.Join([]string{"addr_nowhere"})
+			convey.So(n, convey.ShouldEqual, 0)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMemberlist_FailureDetection(t *testing.T) {
+	convey.Convey("Failure detection", t, func() {
+		network := NewInmemNetwork()
+		nodes := newTestCluster(t, network, 4, nil)
+		convey.So(waitState(nodes, "node_3", StateAlive, 2*time.Second), convey.ShouldBeTrue)
+
+		convey.Convey("Isolated node should be declared dead, then alive again after healed", func() {
+			network.Isolate("addr_3")
+			convey.So(waitState(nodes[:3], "node_3", StateDead, 3*time.Second), convey.ShouldBeTrue)
+
+			network.Heal()
+			convey.So(waitState(nodes, "node_3", StateAlive, 3*time.Second), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Node reachable through other member should not be suspected", func() {
+			network.Block("addr_0", "addr_1")
+			network.Block("addr_1", "addr_0")
+
+			time.Sleep(time.Second)
+			for _, member := range nodes[0].Members() {
+				convey.So(member.State, convey.ShouldEqual, StateAlive)
+			}
+		})
+
+		convey.Convey("Suspected node should refute the suspicion", func() {
+			nodes[1].merge(update{Name: "node_2", Address: "addr_2", Incarnation: nodes[2].LocalMember().Incarnation, State: StateSuspect})
+
+			convey.So(waitState(nodes, "node_2", StateAlive, 2*time.Second), convey.ShouldBeTrue)
+			convey.So(nodes[2].LocalMember().Incarnation, convey.ShouldBeGreaterThan, 0)
+		})
+	})
+}
+
+func TestMemberlist_LeaveAndMeta(t *testing.T) {
+	convey.Convey("Leave and meta update", t, func() {
+		network := NewInmemNetwork()
+		events := &recordEvents{joined: map[string]int{}, left: map[string]int{}}
+
+		nodes := newTestCluster(t, network, 3, events)
+		convey.So(waitState(nodes, "node_2", StateAlive, 2*time.Second), convey.ShouldBeTrue)
+
+		convey.Convey("Meta update should be disseminated", func() {
+			nodes[2].UpdateMeta(map[string]string{"role": "voter"})
+
+			deadline := time.Now().Add(2 * time.Second)
+			var meta map[string]string
+			for time.Now().Before(deadline) {
+				for _, member := range nodes[0].Members() {
+					if member.Name == "node_2" {
+						meta = member.Meta
+					}
+				}
+
+				if meta["role"] == "voter" {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			convey.So(meta["role"], convey.ShouldEqual, "voter")
+		})
+
+		convey.Convey("Left node should be marked left without suspicion", func() {
+			nodes[2].Leave(time.Second)
+			_ = nodes[2].Shutdown()
+
+			convey.So(waitState(nodes[:2], "node_2", StateLeft, 2*time.Second), convey.ShouldBeTrue)
+			time.Sleep(100 * time.Millisecond)
+			_, left := events.count("node_2")
+			convey.So(left, convey.ShouldEqual, 1)
+		})
+	})
+}
+
+func TestUDPTransport(t *testing.T) {
+	convey.Convey("Message is sent as UDP packet, or over TCP when it exceeds the packet budget", t, func() {
+		a, err := NewUDPTransport("127.0.0.1:0")
+		convey.So(err, convey.ShouldBeNil)
+		defer a.Shutdown()
+
+		b, err := NewUDPTransport("127.0.0.1:0")
+		convey.So(err, convey.ShouldBeNil)
+		defer b.Shutdown()
+
+		receive := func() []byte {
+			select {
+			case packet := <-b.PacketCh():
+				return packet.Data
+			case <-time.After(2 * time.Second):
+				return nil
+			}
+		}
+
+		small := []byte("ping")
+		convey.So(a.WriteTo(small, b.LocalAddr()), convey.ShouldBeNil)
+		convey.So(string(receive()), convey.ShouldEqual, "ping")
+
+		large := make([]byte, 3*udpPacketSize)
+		for i := range large {
+			large[i] = byte('a' + i%26)
+		}
+		convey.So(a.WriteTo(large, b.LocalAddr()), convey.ShouldBeNil)
+		convey.So(string(receive()), convey.ShouldEqual, string(large))
+	})
+}
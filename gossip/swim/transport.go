@@ -0,0 +1,206 @@
+package swim
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// udpPacketSize is the maximum size of a packet read from UDP
+	udpPacketSize = 65536
+
+	// udpPacketBudget is the largest message sent as one UDP packet, so it is not fragmented by the network.
+	// Larger message, such as the whole member list of push pull, is sent over TCP on the same port.
+	udpPacketBudget = 1400
+
+	// streamMaxSize is the maximum size of a message read from TCP
+	streamMaxSize = 16 << 20
+
+	// streamTimeout is the deadline of sending or reading one message over TCP
+	streamTimeout = 5 * time.Second
+)
+
+// Packet is the message received by Transport.
+type Packet struct {
+	From string
+	Data []byte
+}
+
+// Transport send and receive packet between nodes, delivery is not guaranteed.
+type Transport interface {
+	// LocalAddr is the address other node use to reach this node
+	LocalAddr() string
+	WriteTo(data []byte, addr string) error
+	PacketCh() <-chan Packet
+	Shutdown() error
+}
+
+// udpTransport send message as UDP packet, and over TCP when it is larger than udpPacketBudget.
+// Both are bound on the same address, a TCP connection carry exactly one message.
+type udpTransport struct {
+	conn     net.PacketConn
+	listener net.Listener
+	packetCh chan Packet
+
+	shutdownOnce sync.Once
+	shutdownCh   chan struct{}
+}
+
+// NewUDPTransport listen UDP and TCP on bindAddress. When port 0 is used, the chosen port is returned by LocalAddr.
+func NewUDPTransport(bindAddress string) (Transport, error) {
+	conn, listener, err := listen(bindAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error listen gossip on %s: %w", bindAddress, err)
+	}
+
+	t := &udpTransport{
+		conn:       conn,
+		listener:   listener,
+		packetCh:   make(chan Packet, 1024),
+		shutdownCh: make(chan struct{}),
+	}
+
+	go t.listen()
+	go t.accept()
+	return t, nil
+}
+
+// listen bind UDP then TCP on the same port. Port 0 is retried, the port chosen for UDP may be used by TCP already.
+func listen(bindAddress string) (net.PacketConn, net.Listener, error) {
+	_, port, err := net.SplitHostPort(bindAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempts := 1
+	if port == "0" {
+		attempts = 10
+	}
+
+	for i := 0; ; i++ {
+		conn, err := net.ListenPacket("udp", bindAddress)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		listener, err := net.Listen("tcp", conn.LocalAddr().String())
+		if err == nil {
+			return conn, listener, nil
+		}
+
+		_ = conn.Close()
+		if i+1 >= attempts {
+			return nil, nil, err
+		}
+	}
+}
+
+func (t *udpTransport) listen() {
+	buf := make([]byte, udpPacketSize)
+	for {
+		n, addr, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-t.shutdownCh:
+				return
+			default:
+				continue
+			}
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		t.deliver(Packet{From: addr.String(), Data: data})
+	}
+}
+
+func (t *udpTransport) accept() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.shutdownCh:
+				return
+			default:
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+		}
+
+		go t.readStream(conn)
+	}
+}
+
+// readStream read one message until the sender close the connection, message larger than streamMaxSize is dropped.
+func (t *udpTransport) readStream(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(streamTimeout))
+	data, err := ioutil.ReadAll(io.LimitReader(conn, streamMaxSize+1))
+	if err != nil || len(data) == 0 || len(data) > streamMaxSize {
+		return
+	}
+
+	t.deliver(Packet{From: conn.RemoteAddr().String(), Data: data})
+}
+
+func (t *udpTransport) deliver(packet Packet) {
+	select {
+	case t.packetCh <- packet:
+	default:
+		// drop the packet when the receiver is slow, the same as the network drop it
+	}
+}
+
+func (t *udpTransport) LocalAddr() string {
+	return t.conn.LocalAddr().String()
+}
+
+func (t *udpTransport) WriteTo(data []byte, addr string) error {
+	if len(data) > udpPacketBudget {
+		// sent in background, so the caller such as the receive loop is not blocked by the connection
+		go t.writeStream(data, addr)
+		return nil
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.conn.WriteTo(data, udpAddr)
+	return err
+}
+
+// writeStream send one message over TCP, error is ignored as the lost UDP packet.
+func (t *udpTransport) writeStream(data []byte, addr string) {
+	conn, err := net.DialTimeout("tcp", addr, streamTimeout)
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	_ = conn.SetWriteDeadline(time.Now().Add(streamTimeout))
+	_, _ = conn.Write(data)
+}
+
+func (t *udpTransport) PacketCh() <-chan Packet {
+	return t.packetCh
+}
+
+func (t *udpTransport) Shutdown() (err error) {
+	t.shutdownOnce.Do(func() {
+		close(t.shutdownCh)
+		err = t.conn.Close()
+		if lerr := t.listener.Close(); err == nil {
+			err = lerr
+		}
+	})
+
+	return
+}
@@ -0,0 +1,186 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Default of TuningConfig which is not taken from raft.DefaultConfig
+const (
+	defaultSnapshotThreshold = 1024
+	defaultSnapshotRetain    = 2
+	defaultLogCacheSize      = 512
+	defaultApplyTimeout      = time.Second
+	defaultTransportMaxPool  = 3
+
+	// The timeout is used to apply I/O deadlines. For InstallSnapshot, we multiply
+	// the timeout by (SnapshotSize / TimeoutScale).
+	// https://github.com/hashicorp/raft/blob/v1.1.2/net_transport.go#L177-L181
+	defaultTransportTimeout = 10 * time.Second
+)
+
+// TuningConfig is raft timing and sizing, zero value is replaced by the default.
+type TuningConfig struct {
+	// HeartbeatTimeout is the time in follower state without contact from the leader before election is started
+	HeartbeatTimeout time.Duration
+
+	// ElectionTimeout is the time in candidate state without winning before new election is started
+	ElectionTimeout time.Duration
+
+	// LeaderLeaseTimeout is the time the leader stay leader without contact from the quorum
+	LeaderLeaseTimeout time.Duration
+
+	// CommitTimeout is the maximum time without AppendEntries before heartbeat is sent
+	CommitTimeout time.Duration
+
+	// SnapshotInterval is the interval to check whether snapshot is needed,
+	// SnapshotThreshold is the number of logs since the last snapshot before taking new snapshot
+	SnapshotInterval  time.Duration
+	SnapshotThreshold uint64
+
+	// SnapshotRetain is the number of snapshot kept on disk
+	SnapshotRetain int
+
+	// TrailingLogs is the number of logs kept after snapshot, so slow follower can catch up without snapshot
+	TrailingLogs uint64
+
+	// MaxAppendEntries is the maximum number of logs sent in one AppendEntries request
+	MaxAppendEntries int
+
+	// LogCacheSize is the number of recent logs cached in memory
+	LogCacheSize int
+
+	// ApplyTimeout is the maximum time to wait the command is enqueued by the leader
+	ApplyTimeout time.Duration
+
+	// TransportMaxPool is the number of connection pooled to each peer,
+	// TransportTimeout is the I/O deadline of each request
+	TransportMaxPool int
+	TransportTimeout time.Duration
+}
+
+// withDefaults return the config with zero value replaced by the default
+func (t TuningConfig) withDefaults() TuningConfig {
+	def := raft.DefaultConfig()
+
+	if t.HeartbeatTimeout <= 0 {
+		t.HeartbeatTimeout = def.HeartbeatTimeout
+	}
+
+	if t.ElectionTimeout <= 0 {
+		t.ElectionTimeout = def.ElectionTimeout
+	}
+
+	if t.LeaderLeaseTimeout <= 0 {
+		t.LeaderLeaseTimeout = def.LeaderLeaseTimeout
+	}
+
+	if t.CommitTimeout <= 0 {
+		t.CommitTimeout = def.CommitTimeout
+	}
+
+	if t.SnapshotInterval <= 0 {
+		t.SnapshotInterval = def.SnapshotInterval
+	}
+
+	if t.SnapshotThreshold == 0 {
+		t.SnapshotThreshold = defaultSnapshotThreshold
+	}
+
+	if t.SnapshotRetain <= 0 {
+		t.SnapshotRetain = defaultSnapshotRetain
+	}
+
+	if t.TrailingLogs == 0 {
+		t.TrailingLogs = def.TrailingLogs
+	}
+
+	if t.MaxAppendEntries <= 0 {
+		t.MaxAppendEntries = def.MaxAppendEntries
+	}
+
+	if t.LogCacheSize <= 0 {
+		t.LogCacheSize = defaultLogCacheSize
+	}
+
+	if t.ApplyTimeout <= 0 {
+		t.ApplyTimeout = defaultApplyTimeout
+	}
+
+	if t.TransportMaxPool <= 0 {
+		t.TransportMaxPool = defaultTransportMaxPool
+	}
+
+	if t.TransportTimeout <= 0 {
+		t.TransportTimeout = defaultTransportTimeout
+	}
+
+	return t
+}
+
+// validate follow raft.ValidateConfig, so the error mention the config name instead of failing in raft.NewRaft
+func (t TuningConfig) validate() error {
+	if t.HeartbeatTimeout < 5*time.Millisecond {
+		return fmt.Errorf("heartbeat_timeout must be at least 5ms")
+	}
+
+	if t.ElectionTimeout < t.HeartbeatTimeout {
+		return fmt.Errorf("election_timeout must be equal or greater than heartbeat_timeout")
+	}
+
+	if t.LeaderLeaseTimeout < 5*time.Millisecond {
+		return fmt.Errorf("leader_lease_timeout must be at least 5ms")
+	}
+
+	if t.LeaderLeaseTimeout > t.HeartbeatTimeout {
+		return fmt.Errorf("leader_lease_timeout must not be greater than heartbeat_timeout")
+	}
+
+	if t.CommitTimeout < time.Millisecond {
+		return fmt.Errorf("commit_timeout must be at least 1ms")
+	}
+
+	if t.SnapshotInterval < 5*time.Millisecond {
+		return fmt.Errorf("snapshot_interval must be at least 5ms")
+	}
+
+	if t.MaxAppendEntries > 1024 {
+		return fmt.Errorf("max_append_entries must be at most 1024")
+	}
+
+	return nil
+}
+
+// raftConfig apply the tuning into raft config
+func (t TuningConfig) raftConfig(conf *raft.Config) {
+	conf.HeartbeatTimeout = t.HeartbeatTimeout
+	conf.ElectionTimeout = t.ElectionTimeout
+	conf.LeaderLeaseTimeout = t.LeaderLeaseTimeout
+	conf.CommitTimeout = t.CommitTimeout
+	conf.SnapshotInterval = t.SnapshotInterval
+	conf.SnapshotThreshold = t.SnapshotThreshold
+	conf.TrailingLogs = t.TrailingLogs
+	conf.MaxAppendEntries = t.MaxAppendEntries
+}
+
+// MarshalJSON write the duration as string like 1s, the same format as config.yaml
+func (t TuningConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"heartbeat_timeout":    t.HeartbeatTimeout.String(),
+		"election_timeout":     t.ElectionTimeout.String(),
+		"leader_lease_timeout": t.LeaderLeaseTimeout.String(),
+		"commit_timeout":       t.CommitTimeout.String(),
+		"snapshot_interval":    t.SnapshotInterval.String(),
+		"snapshot_threshold":   t.SnapshotThreshold,
+		"snapshot_retain":      t.SnapshotRetain,
+		"trailing_logs":        t.TrailingLogs,
+		"max_append_entries":   t.MaxAppendEntries,
+		"log_cache_size":       t.LogCacheSize,
+		"apply_timeout":        t.ApplyTimeout.String(),
+		"transport_max_pool":   t.TransportMaxPool,
+		"transport_timeout":    t.TransportTimeout.String(),
+	})
+}
@@ -0,0 +1,54 @@
+package gossip
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestTuningConfig(t *testing.T) {
+	convey.Convey("Zero value use the default", t, func() {
+		tuning := TuningConfig{}.withDefaults()
+		convey.So(tuning.HeartbeatTimeout, convey.ShouldEqual, time.Second)
+		convey.So(tuning.LeaderLeaseTimeout, convey.ShouldEqual, 500*time.Millisecond)
+		convey.So(tuning.SnapshotThreshold, convey.ShouldEqual, defaultSnapshotThreshold)
+		convey.So(tuning.ApplyTimeout, convey.ShouldEqual, defaultApplyTimeout)
+		convey.So(tuning.TransportMaxPool, convey.ShouldEqual, defaultTransportMaxPool)
+		convey.So(tuning.validate(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Configured value is kept", t, func() {
+		tuning := TuningConfig{
+			HeartbeatTimeout:   200 * time.Millisecond,
+			ElectionTimeout:    400 * time.Millisecond,
+			LeaderLeaseTimeout: 100 * time.Millisecond,
+			ApplyTimeout:       3 * time.Second,
+		}.withDefaults()
+
+		convey.So(tuning.HeartbeatTimeout, convey.ShouldEqual, 200*time.Millisecond)
+		convey.So(tuning.ApplyTimeout, convey.ShouldEqual, 3*time.Second)
+		convey.So(tuning.validate(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Invalid combination is refused", t, func() {
+		convey.So(TuningConfig{HeartbeatTimeout: time.Millisecond}.withDefaults().validate(), convey.ShouldNotBeNil)
+		convey.So(TuningConfig{ElectionTimeout: 100 * time.Millisecond}.withDefaults().validate(), convey.ShouldNotBeNil)
+		convey.So(TuningConfig{LeaderLeaseTimeout: 2 * time.Second}.withDefaults().validate(), convey.ShouldNotBeNil)
+		convey.So(TuningConfig{MaxAppendEntries: 2048}.withDefaults().validate(), convey.ShouldNotBeNil)
+
+		conf := Config{NodeID: "node_1", Tuning: TuningConfig{LeaderLeaseTimeout: 2 * time.Second}}
+		convey.So(conf.validate(), convey.ShouldNotBeNil)
+	})
+
+	convey.Convey("Duration is written as string", t, func() {
+		b, err := json.Marshal(TuningConfig{}.withDefaults())
+		convey.So(err, convey.ShouldBeNil)
+
+		var dump map[string]interface{}
+		convey.So(json.Unmarshal(b, &dump), convey.ShouldBeNil)
+		convey.So(dump["heartbeat_timeout"], convey.ShouldEqual, "1s")
+		convey.So(dump["snapshot_threshold"], convey.ShouldEqual, 1024)
+	})
+}
@@ -0,0 +1,32 @@
+package adminctrl
+
+import (
+	"ysf/canoe/dependency"
+	"ysf/canoe/server"
+)
+
+func Routes(dep *dependency.Dep) []*server.Route {
+	h := &handler{
+		dep: dep,
+	}
+	return []*server.Route{
+		{
+			Path:       "/admin/snapshot",
+			Method:     "POST",
+			Handler:    h.snapshot,
+			Middleware: nil,
+		},
+		{
+			Path:       "/admin/snapshots",
+			Method:     "GET",
+			Handler:    h.snapshots,
+			Middleware: nil,
+		},
+		{
+			Path:       "/admin/snapshots/:id",
+			Method:     "GET",
+			Handler:    h.download,
+			Middleware: nil,
+		},
+	}
+}
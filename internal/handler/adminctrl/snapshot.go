@@ -0,0 +1,67 @@
+package adminctrl
+
+import (
+	"context"
+	"io"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+// ContentTypeSnapshot is the content type of the downloaded snapshot, it is JSON lines, see fsm.SnapshotHeader.
+const ContentTypeSnapshot = "application/x-ndjson"
+
+// snapshot handle POST /admin/snapshot, taking the snapshot of this node and compacting its log.
+func (h handler) snapshot(ctx context.Context, req server.Request) server.Response {
+	info, err := h.dep.GetGossip().Snapshot()
+	if err != nil {
+		return replyError("Error take snapshot", err)
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "Snapshot",
+		Data: info,
+	})
+}
+
+// snapshots handle GET /admin/snapshots, the snapshots retained by this node, the newest first.
+func (h handler) snapshots(ctx context.Context, req server.Request) server.Response {
+	snapshots, err := h.dep.GetGossip().Snapshots()
+	if err != nil {
+		return replyError("Error list snapshots", err)
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "Snapshots",
+		Data: snapshots,
+	})
+}
+
+// download handle GET /admin/snapshots/:id, streaming the snapshot file retained by this node.
+func (h handler) download(ctx context.Context, req server.Request) server.Response {
+	_, source, err := h.dep.GetGossip().OpenSnapshot(req.GetParam("id"))
+	if err != nil {
+		return replyError("Error open snapshot", err)
+	}
+
+	return reply.Stream(ContentTypeSnapshot, func(ctx context.Context, w io.Writer, flush func() error) error {
+		defer source.Close()
+
+		if _, err := io.Copy(w, source); err != nil {
+			return err
+		}
+
+		return flush()
+	})
+}
+
+func replyError(title string, err error) server.Response {
+	return reply.Error(server.ReplyStructure{
+		Error: &server.ReplyErrorStructure{
+			Code:    "",
+			Title:   title,
+			Message: err.Error(),
+		},
+		Type: server.ReplyError,
+		Data: nil,
+	})
+}
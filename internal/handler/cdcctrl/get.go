@@ -0,0 +1,72 @@
+package cdcctrl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"ysf/canoe/reply"
+	"ysf/canoe/repo"
+	"ysf/canoe/server"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 10000
+)
+
+type responseChanges struct {
+	Changes     []repo.Change `json:"changes"`
+	FirstOffset uint64        `json:"first_offset"`
+	LastOffset  uint64        `json:"last_offset"`
+	NextOffset  uint64        `json:"next_offset"`
+}
+
+// changes handle GET /cdc/changes?offset=1&limit=100.
+// Consumer resume by sending next_offset of the previous response as the offset.
+// The change log is read from the local node, so follower may return fewer changes than the leader.
+func (h handler) changes(ctx context.Context, req server.Request) server.Response {
+	var (
+		offset uint64 = 1
+		limit         = defaultLimit
+		err    error
+	)
+
+	if v := req.GetQueryParam("offset"); v != "" {
+		offset, err = strconv.ParseUint(v, 10, 64)
+		if err != nil || offset == 0 {
+			return reply.Error("offset must be a positive integer")
+		}
+	}
+
+	if v := req.GetQueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return reply.Error("limit must be a positive integer")
+		}
+	}
+
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	changes, first, last, err := h.dep.GetRepo().Changes(offset, limit)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	if first > 0 && offset < first {
+		return reply.Error(fmt.Sprintf("offset %d is already deleted from change log, the oldest offset is %d", offset, first))
+	}
+
+	next := offset
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Offset + 1
+	}
+
+	return reply.Success(responseChanges{
+		Changes:     changes,
+		FirstOffset: first,
+		LastOffset:  last,
+		NextOffset:  next,
+	})
+}
@@ -0,0 +1,9 @@
+package cdcctrl
+
+import (
+	"ysf/canoe/dependency"
+)
+
+type handler struct {
+	dep *dependency.Dep
+}
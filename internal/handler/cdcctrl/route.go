@@ -0,0 +1,20 @@
+package cdcctrl
+
+import (
+	"ysf/canoe/dependency"
+	"ysf/canoe/server"
+)
+
+func Routes(dep *dependency.Dep) []*server.Route {
+	h := &handler{
+		dep: dep,
+	}
+	return []*server.Route{
+		{
+			Path:       "/cdc/changes",
+			Method:     "GET",
+			Handler:    h.changes,
+			Middleware: nil,
+		},
+	}
+}
@@ -0,0 +1,27 @@
+package raftctrl
+
+import (
+	"context"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+func (h handler) autopilotHealth(ctx context.Context, req server.Request) server.Response {
+	health, err := h.dep.GetGossip().AutopilotHealth()
+	if err != nil {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   "Error get autopilot health",
+				Message: err.Error(),
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "AutopilotHealth",
+		Data: health,
+	})
+}
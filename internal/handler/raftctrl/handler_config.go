@@ -0,0 +1,15 @@
+package raftctrl
+
+import (
+	"context"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+// config return the configuration used by this node, including raft tuning after the default is applied.
+func (h handler) config(ctx context.Context, req server.Request) server.Response {
+	return reply.Success(server.ReplyStructure{
+		Type: "Config",
+		Data: h.dep.GetGossip().Config(),
+	})
+}
@@ -0,0 +1,78 @@
+package raftctrl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"ysf/canoe/gossip"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+// keepAliveInterval is how often a comment is sent while there is no event, so proxy does not close idle stream.
+const keepAliveInterval = 15 * time.Second
+
+// events handle GET /raft/events?types=leader_change,peer_added as server-sent events.
+// Each event is sent with its type as the SSE event name and the JSON as data, until the client disconnect.
+// Events is observed by this node only, so connect to every node to see peer and heartbeat events from any leader.
+func (h handler) events(ctx context.Context, req server.Request) server.Response {
+	var types []string
+	if v := req.GetQueryParam("types"); v != "" {
+		types = strings.Split(v, ",")
+	}
+
+	if err := gossip.ValidateEventTypes(types); err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Stream(reply.ContentTypeEventStream, func(ctx context.Context, w io.Writer, flush func() error) error {
+		sub := h.dep.GetGossip().Subscribe(0, types...)
+		defer sub.Close()
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+
+		// the first comment tell the client the subscription is ready
+		if _, err := io.WriteString(w, ": subscribed\n\n"); err != nil {
+			return err
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+
+			case <-keepAlive.C:
+				if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+					return err
+				}
+
+			case e, ok := <-sub.Events():
+				if !ok {
+					// node is shutting down
+					return nil
+				}
+
+				data, err := json.Marshal(e)
+				if err != nil {
+					return err
+				}
+
+				if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+					return err
+				}
+			}
+
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -10,6 +10,7 @@ import (
 type requestJoin struct {
 	NodeId      string `json:"node_id"`
 	RaftAddress string `json:"raft_address"`
+	Suffrage    string `json:"suffrage"`
 }
 
 func (h handler) join(ctx context.Context, req server.Request) server.Response {
@@ -40,7 +41,7 @@ func (h handler) join(ctx context.Context, req server.Request) server.Response {
 		})
 	}
 
-	err := h.dep.GetGossip().Join(form.NodeId, form.RaftAddress)
+	err := h.dep.GetGossip().Join(form.NodeId, form.RaftAddress, form.Suffrage)
 	if err != nil {
 		return reply.Error(server.ReplyStructure{
 			Error: &server.ReplyErrorStructure{
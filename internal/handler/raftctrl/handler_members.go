@@ -0,0 +1,27 @@
+package raftctrl
+
+import (
+	"context"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+func (h handler) members(ctx context.Context, req server.Request) server.Response {
+	members, err := h.dep.GetGossip().Members()
+	if err != nil {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   "Error get cluster members",
+				Message: err.Error(),
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "Members",
+		Data: members,
+	})
+}
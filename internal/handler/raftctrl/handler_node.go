@@ -0,0 +1,15 @@
+package raftctrl
+
+import (
+	"context"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+// node return this node information, used by other node to discover it before the cluster is bootstrapped.
+func (h handler) node(ctx context.Context, req server.Request) server.Response {
+	return reply.Success(server.ReplyStructure{
+		Type: "Node",
+		Data: h.dep.GetGossip().Node(),
+	})
+}
@@ -0,0 +1,48 @@
+package raftctrl
+
+import (
+	"context"
+	"fmt"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+type requestRemove struct {
+	NodeId string `json:"node_id"`
+	Force  bool   `json:"force"`
+}
+
+func (h handler) remove(ctx context.Context, req server.Request) server.Response {
+	form := &requestRemove{}
+	_ = req.Bind(form)
+
+	if form.NodeId == "" {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   "Error remove from cluster",
+				Message: "empty node id",
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	err := h.dep.GetGossip().Remove(form.NodeId, form.Force)
+	if err != nil {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   "Error remove from cluster",
+				Message: fmt.Sprintf("%s", err.Error()),
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "Remove",
+		Data: map[string]interface{}{},
+	})
+}
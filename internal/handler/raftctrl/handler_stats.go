@@ -9,6 +9,6 @@ import (
 func (h handler) stats(ctx context.Context, req server.Request) server.Response {
 	return reply.Success(server.ReplyStructure{
 		Type: "Join",
-		Data: h.dep.GetGossip().Stats(),
+		Data: h.dep.Stats(),
 	})
 }
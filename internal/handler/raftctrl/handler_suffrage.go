@@ -0,0 +1,54 @@
+package raftctrl
+
+import (
+	"context"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+type requestSuffrage struct {
+	NodeId string `json:"node_id"`
+	Force  bool   `json:"force"`
+}
+
+func (h handler) promote(ctx context.Context, req server.Request) server.Response {
+	return h.changeSuffrage(req, "Promote", "Error promote to voter", h.dep.GetGossip().Promote)
+}
+
+func (h handler) demote(ctx context.Context, req server.Request) server.Response {
+	return h.changeSuffrage(req, "Demote", "Error demote to non-voter", h.dep.GetGossip().Demote)
+}
+
+func (h handler) changeSuffrage(req server.Request, typ server.ReplyType, title string, change func(nodeID string, force bool) error) server.Response {
+	form := &requestSuffrage{}
+	_ = req.Bind(form)
+
+	if form.NodeId == "" {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   title,
+				Message: "empty node id",
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	if err := change(form.NodeId, form.Force); err != nil {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   title,
+				Message: err.Error(),
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: typ,
+		Data: map[string]interface{}{},
+	})
+}
@@ -0,0 +1,37 @@
+package raftctrl
+
+import (
+	"context"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+type requestTransfer struct {
+	NodeId string `json:"node_id"`
+}
+
+// transfer move the leadership to node_id, or to the most caught up voter when node_id is empty
+func (h handler) transfer(ctx context.Context, req server.Request) server.Response {
+	form := &requestTransfer{}
+	_ = req.Bind(form)
+
+	leader, err := h.dep.GetGossip().TransferLeadership(form.NodeId)
+	if err != nil {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   "Error transfer leadership",
+				Message: err.Error(),
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "Transfer",
+		Data: map[string]interface{}{
+			"leader": leader,
+		},
+	})
+}
@@ -16,6 +16,60 @@ func Routes(dep *dependency.Dep) []*server.Route {
 			Handler:    h.join,
 			Middleware: nil,
 		},
+		{
+			Path:       "/raft/remove",
+			Method:     "POST",
+			Handler:    h.remove,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/promote",
+			Method:     "POST",
+			Handler:    h.promote,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/demote",
+			Method:     "POST",
+			Handler:    h.demote,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/transfer",
+			Method:     "POST",
+			Handler:    h.transfer,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/members",
+			Method:     "GET",
+			Handler:    h.members,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/node",
+			Method:     "GET",
+			Handler:    h.node,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/config",
+			Method:     "GET",
+			Handler:    h.config,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/autopilot/health",
+			Method:     "GET",
+			Handler:    h.autopilotHealth,
+			Middleware: nil,
+		},
+		{
+			Path:       "/raft/events",
+			Method:     "GET",
+			Handler:    h.events,
+			Middleware: nil,
+		},
 		{
 			Path:       "/raft/stats",
 			Method:     "GET",
@@ -0,0 +1,28 @@
+package replctrl
+
+import (
+	"context"
+	"ysf/canoe/replication"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+// status handle GET /replication/status, the role and applied primary index read from this node,
+// and the shipper progress when this cluster ship to a standby.
+// The primary read it to know where to continue shipping.
+func (h handler) status(ctx context.Context, req server.Request) server.Response {
+	state, err := h.dep.GetRepo().ReplicaState()
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	status := replication.Status{
+		ReplicaState: state,
+	}
+
+	if h.shipper != nil {
+		status.Shipper = h.shipper.Stats()
+	}
+
+	return reply.Success(status)
+}
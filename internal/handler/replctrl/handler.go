@@ -0,0 +1,11 @@
+package replctrl
+
+import (
+	"ysf/canoe/dependency"
+	"ysf/canoe/replication"
+)
+
+type handler struct {
+	dep     *dependency.Dep
+	shipper *replication.Shipper
+}
@@ -0,0 +1,93 @@
+package replctrl
+
+import (
+	"context"
+	"encoding/json"
+	"ysf/canoe/fsm"
+	"ysf/canoe/model"
+	"ysf/canoe/reply"
+	"ysf/canoe/repo"
+	"ysf/canoe/server"
+)
+
+// apply handle POST /replication/apply, the batch of operations shipped by the primary cluster leader.
+// It must be sent to the standby leader, the reply is the replication state after the batch is applied.
+func (h handler) apply(ctx context.Context, req server.Request) server.Response {
+	batch := fsm.ReplicateBatch{}
+	if err := req.Bind(&batch); err != nil {
+		return reply.Error(err.Error())
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	state, err := h.dep.GetGossip().DoOperation(model.CommandPayload{
+		Operation: fsm.OpReplicate,
+		Data:      data,
+	})
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(state)
+}
+
+// seed handle POST /replication/seed, the copy of the primary data shipped when the log the standby need is
+// already compacted. It must be sent to the standby leader, the reply is the replication state after the batch.
+func (h handler) seed(ctx context.Context, req server.Request) server.Response {
+	batch := fsm.SeedBatch{}
+	if err := req.Bind(&batch); err != nil {
+		return reply.Error(err.Error())
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	result, err := h.dep.GetGossip().DoOperation(model.CommandPayload{
+		Operation: fsm.OpReplicaSeed,
+		Data:      data,
+	})
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(result)
+}
+
+// standby handle POST /replication/standby, making this empty cluster a read-only standby.
+func (h handler) standby(ctx context.Context, req server.Request) server.Response {
+	return h.setRole("Error make standby", repo.RoleStandby)
+}
+
+// promote handle POST /replication/promote, making the standby a primary which accept write.
+// Stop the shipper of the old primary first, otherwise it keep failing with not standby error.
+func (h handler) promote(ctx context.Context, req server.Request) server.Response {
+	return h.setRole("Error promote standby", repo.RolePrimary)
+}
+
+func (h handler) setRole(title, role string) server.Response {
+	state, err := h.dep.GetGossip().DoOperation(model.CommandPayload{
+		Operation: fsm.OpReplicaRole,
+		Value:     role,
+	})
+	if err != nil {
+		return reply.Error(server.ReplyStructure{
+			Error: &server.ReplyErrorStructure{
+				Code:    "",
+				Title:   title,
+				Message: err.Error(),
+			},
+			Type: server.ReplyError,
+			Data: nil,
+		})
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "Replication",
+		Data: state,
+	})
+}
@@ -0,0 +1,47 @@
+package replctrl
+
+import (
+	"ysf/canoe/dependency"
+	"ysf/canoe/replication"
+	"ysf/canoe/server"
+)
+
+// Routes of the cross-cluster replication, shipper is nil when this cluster does not ship to a standby.
+func Routes(dep *dependency.Dep, shipper *replication.Shipper) []*server.Route {
+	h := &handler{
+		dep:     dep,
+		shipper: shipper,
+	}
+	return []*server.Route{
+		{
+			Path:       replication.PathStatus,
+			Method:     "GET",
+			Handler:    h.status,
+			Middleware: nil,
+		},
+		{
+			Path:       replication.PathApply,
+			Method:     "POST",
+			Handler:    h.apply,
+			Middleware: nil,
+		},
+		{
+			Path:       replication.PathSeed,
+			Method:     "POST",
+			Handler:    h.seed,
+			Middleware: nil,
+		},
+		{
+			Path:       replication.PathStandby,
+			Method:     "POST",
+			Handler:    h.standby,
+			Middleware: nil,
+		},
+		{
+			Path:       replication.PathPromote,
+			Method:     "POST",
+			Handler:    h.promote,
+			Middleware: nil,
+		},
+	}
+}
@@ -0,0 +1,23 @@
+package seqctrl
+
+import (
+	"context"
+	"ysf/canoe/fsm"
+	"ysf/canoe/model"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+func (h handler) info(ctx context.Context, req server.Request) server.Response {
+	cmd := model.CommandPayload{
+		Operation: fsm.OpSeqInfo,
+		Key:       req.GetParam("name"),
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
@@ -0,0 +1,9 @@
+package seqctrl
+
+import (
+	"ysf/canoe/dependency"
+)
+
+type handler struct {
+	dep *dependency.Dep
+}
@@ -0,0 +1,59 @@
+package seqctrl
+
+import (
+	"context"
+	"ysf/canoe/fsm"
+	"ysf/canoe/model"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+type requestCreate struct {
+	Name  string `json:"name"`
+	Start int64  `json:"start"`
+}
+
+type requestReserve struct {
+	Count int64 `json:"count"`
+}
+
+func (h handler) create(ctx context.Context, req server.Request) server.Response {
+	form := &requestCreate{}
+	_ = req.Bind(form)
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpSeqCreate,
+		Key:       form.Name,
+		Start:     form.Start,
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
+
+// reserve handle POST /sequence/:name/reserve, reserving one ID when count is empty.
+func (h handler) reserve(ctx context.Context, req server.Request) server.Response {
+	form := &requestReserve{}
+	_ = req.Bind(form)
+
+	if form.Count == 0 {
+		form.Count = 1
+	}
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpSeqReserve,
+		Key:       req.GetParam("name"),
+		Count:     form.Count,
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
@@ -0,0 +1,32 @@
+package seqctrl
+
+import (
+	"ysf/canoe/dependency"
+	"ysf/canoe/server"
+)
+
+func Routes(dep *dependency.Dep) []*server.Route {
+	h := &handler{
+		dep: dep,
+	}
+	return []*server.Route{
+		{
+			Path:       "/sequence",
+			Method:     "POST",
+			Handler:    h.create,
+			Middleware: nil,
+		},
+		{
+			Path:       "/sequence/:name/reserve",
+			Method:     "POST",
+			Handler:    h.reserve,
+			Middleware: nil,
+		},
+		{
+			Path:       "/sequence/:name",
+			Method:     "GET",
+			Handler:    h.info,
+			Middleware: nil,
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package shardctrl
+
+import (
+	"context"
+	"ysf/canoe/multiraft"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+	"ysf/canoe/shard"
+)
+
+type responseShards struct {
+	Initialized bool                    `json:"initialized"`
+	Map         *shard.Map              `json:"map"`
+	Groups      []multiraft.GroupStatus `json:"groups"`
+}
+
+// shards handle GET /shards, the shard map replicated to this node and the state of its groups.
+func (h handler) shards(ctx context.Context, req server.Request) server.Response {
+	m, ok, err := h.host.Map()
+	if err != nil {
+		return replyError("Error get shard map", err)
+	}
+
+	resp := responseShards{
+		Initialized: ok,
+		Groups:      h.host.Status(),
+	}
+
+	if ok {
+		resp.Map = &m
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "Shards",
+		Data: resp,
+	})
+}
+
+func replyError(title string, err error) server.Response {
+	return reply.Error(server.ReplyStructure{
+		Error: &server.ReplyErrorStructure{
+			Code:    "",
+			Title:   title,
+			Message: err.Error(),
+		},
+		Type: server.ReplyError,
+		Data: nil,
+	})
+}
@@ -0,0 +1,9 @@
+package shardctrl
+
+import (
+	"ysf/canoe/multiraft"
+)
+
+type handler struct {
+	host *multiraft.Host
+}
@@ -0,0 +1,71 @@
+package shardctrl
+
+import (
+	"context"
+	"ysf/canoe/model"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+	"ysf/canoe/shard"
+)
+
+type requestInit struct {
+	Strategy string `json:"strategy"`
+}
+
+type requestGroup struct {
+	ID     string            `json:"id"`
+	Slots  []shard.SlotRange `json:"slots"`
+	Ranges []shard.KeyRange  `json:"ranges"`
+}
+
+// init handle POST /shards/init, creating the shard map with hash strategy when strategy is empty.
+func (h handler) init(ctx context.Context, req server.Request) server.Response {
+	form := &requestInit{}
+	_ = req.Bind(form)
+
+	if form.Strategy == "" {
+		form.Strategy = shard.StrategyHash
+	}
+
+	m, err := h.host.Init(form.Strategy)
+	if err != nil {
+		return replyError("Error init shard map", err)
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "ShardMap",
+		Data: m,
+	})
+}
+
+// addGroup handle POST /shards/groups, the new group owns the slots or ranges which must have no key yet.
+func (h handler) addGroup(ctx context.Context, req server.Request) server.Response {
+	form := &requestGroup{}
+	_ = req.Bind(form)
+
+	m, err := h.host.AddGroup(form.ID, shard.Part{Slots: form.Slots, Ranges: form.Ranges})
+	if err != nil {
+		return replyError("Error add shard group", err)
+	}
+
+	return reply.Success(server.ReplyStructure{
+		Type: "ShardMap",
+		Data: m,
+	})
+}
+
+// apply handle POST /shards/:group/apply, the operation forwarded by other node to this group leader.
+// The reply is the same as the store API, so the forwarding node return it as is.
+func (h handler) apply(ctx context.Context, req server.Request) server.Response {
+	cmd := model.CommandPayload{}
+	if err := req.Bind(&cmd); err != nil {
+		return reply.Error(err.Error())
+	}
+
+	data, err := h.host.ApplyLocal(req.GetParam("group"), cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
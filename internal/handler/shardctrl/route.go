@@ -0,0 +1,38 @@
+package shardctrl
+
+import (
+	"ysf/canoe/multiraft"
+	"ysf/canoe/server"
+)
+
+func Routes(host *multiraft.Host) []*server.Route {
+	h := &handler{
+		host: host,
+	}
+	return []*server.Route{
+		{
+			Path:       "/shards",
+			Method:     "GET",
+			Handler:    h.shards,
+			Middleware: nil,
+		},
+		{
+			Path:       "/shards/init",
+			Method:     "POST",
+			Handler:    h.init,
+			Middleware: nil,
+		},
+		{
+			Path:       "/shards/groups",
+			Method:     "POST",
+			Handler:    h.addGroup,
+			Middleware: nil,
+		},
+		{
+			Path:       "/shards/:group/apply",
+			Method:     "POST",
+			Handler:    h.apply,
+			Middleware: nil,
+		},
+	}
+}
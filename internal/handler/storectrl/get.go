@@ -7,16 +7,29 @@ import (
 	"ysf/canoe/server"
 )
 
+// consistencyStale read from the local store without going through raft,
+// so it can be served by follower and non-voter, but may return value which is not the latest.
+const consistencyStale = "stale"
+
 func (h handler) get(ctx context.Context, req server.Request) server.Response {
 	key := req.GetParam("key")
 
+	if req.GetQueryParam("consistency") == consistencyStale {
+		store, err := h.dep.RepoFor(key)
+		if err != nil {
+			return reply.Error(err.Error())
+		}
+
+		return reply.Success(store.Get(key))
+	}
+
 	cmd := model.CommandPayload{
 		Operation: "GET",
 		Key:       key,
 		Value:     nil,
 	}
 
-	data, err := h.dep.GetGossip().DoOperation(cmd)
+	data, err := h.dep.Do(cmd)
 	if err != nil {
 		return reply.Error(err.Error())
 	}
@@ -0,0 +1,66 @@
+package storectrl
+
+import (
+	"context"
+	"math"
+	"ysf/canoe/fsm"
+	"ysf/canoe/model"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+type requestIncr struct {
+	Delta *int64 `json:"delta"`
+	Min   *int64 `json:"min"`
+	Max   *int64 `json:"max"`
+}
+
+// incr handle POST /store/:key/incr. Without delta the counter is incremented by one.
+func (h handler) incr(ctx context.Context, req server.Request) server.Response {
+	return h.counter(req, fsm.OpIncr)
+}
+
+// decr handle POST /store/:key/decr. Without delta the counter is decremented by one.
+func (h handler) decr(ctx context.Context, req server.Request) server.Response {
+	return h.counter(req, fsm.OpDecr)
+}
+
+func (h handler) counter(req server.Request, op string) server.Response {
+	form := &requestIncr{}
+	_ = req.Bind(form)
+
+	cmd := model.CommandPayload{
+		Operation: op,
+		Key:       req.GetParam("key"),
+		Min:       form.Min,
+		Max:       form.Max,
+	}
+
+	if form.Delta != nil {
+		cmd.Operation = fsm.OpIncrBy
+		cmd.Delta = *form.Delta
+		if op == fsm.OpDecr {
+			// -math.MinInt64 overflow back to math.MinInt64
+			if cmd.Delta == math.MinInt64 {
+				return reply.Error(server.ReplyStructure{
+					Error: &server.ReplyErrorStructure{
+						Code:    "",
+						Title:   "Error decrement counter",
+						Message: "delta is out of range",
+					},
+					Type: server.ReplyError,
+					Data: nil,
+				})
+			}
+
+			cmd.Delta = -cmd.Delta
+		}
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
@@ -22,7 +22,7 @@ func (h handler) post(ctx context.Context, req server.Request) server.Response {
 		Value:     dataToSave.Value,
 	}
 
-	data, err := h.dep.GetGossip().DoOperation(cmd)
+	data, err := h.dep.Do(cmd)
 	if err != nil {
 		return reply.Error(err.Error())
 	}
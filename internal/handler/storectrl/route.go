@@ -22,5 +22,17 @@ func Routes(dep *dependency.Dep) []*server.Route {
 			Handler:    h.post,
 			Middleware: nil,
 		},
+		{
+			Path:       "/store/:key/incr",
+			Method:     "POST",
+			Handler:    h.incr,
+			Middleware: nil,
+		},
+		{
+			Path:       "/store/:key/decr",
+			Method:     "POST",
+			Handler:    h.decr,
+			Middleware: nil,
+		},
 	}
 }
@@ -0,0 +1,109 @@
+package zsetctrl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"ysf/canoe/fsm"
+	"ysf/canoe/model"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+// rangeByRank handle GET /zset/:key/range?start=0&stop=-1
+func (h handler) rangeByRank(ctx context.Context, req server.Request) server.Response {
+	var (
+		start int64 = 0
+		stop  int64 = -1
+		err   error
+	)
+
+	if v := req.GetQueryParam("start"); v != "" {
+		start, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return reply.Error(fmt.Sprintf("invalid start: %s", err.Error()))
+		}
+	}
+
+	if v := req.GetQueryParam("stop"); v != "" {
+		stop, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return reply.Error(fmt.Sprintf("invalid stop: %s", err.Error()))
+		}
+	}
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpZRange,
+		Key:       req.GetParam("key"),
+		Start:     start,
+		Stop:      stop,
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
+
+// rangeByScore handle GET /zset/:key/range_by_score?min=1&max=10, missing min or max means unbounded.
+func (h handler) rangeByScore(ctx context.Context, req server.Request) server.Response {
+	cmd := model.CommandPayload{
+		Operation: fsm.OpZRangeByScore,
+		Key:       req.GetParam("key"),
+	}
+
+	if v := req.GetQueryParam("min"); v != "" {
+		min, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return reply.Error(fmt.Sprintf("invalid min: %s", err.Error()))
+		}
+		cmd.ScoreMin = &min
+	}
+
+	if v := req.GetQueryParam("max"); v != "" {
+		max, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return reply.Error(fmt.Sprintf("invalid max: %s", err.Error()))
+		}
+		cmd.ScoreMax = &max
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
+
+func (h handler) rank(ctx context.Context, req server.Request) server.Response {
+	cmd := model.CommandPayload{
+		Operation: fsm.OpZRank,
+		Key:       req.GetParam("key"),
+		Member:    req.GetParam("member"),
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
+
+func (h handler) score(ctx context.Context, req server.Request) server.Response {
+	cmd := model.CommandPayload{
+		Operation: fsm.OpZScore,
+		Key:       req.GetParam("key"),
+		Member:    req.GetParam("member"),
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
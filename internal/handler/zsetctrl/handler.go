@@ -0,0 +1,9 @@
+package zsetctrl
+
+import (
+	"ysf/canoe/dependency"
+)
+
+type handler struct {
+	dep *dependency.Dep
+}
@@ -0,0 +1,75 @@
+package zsetctrl
+
+import (
+	"context"
+	"ysf/canoe/fsm"
+	"ysf/canoe/model"
+	"ysf/canoe/reply"
+	"ysf/canoe/server"
+)
+
+type requestMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+type requestIncr struct {
+	Member string  `json:"member"`
+	Delta  float64 `json:"delta"`
+}
+
+func (h handler) add(ctx context.Context, req server.Request) server.Response {
+	form := &requestMember{}
+	_ = req.Bind(form)
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpZAdd,
+		Key:       req.GetParam("key"),
+		Member:    form.Member,
+		Score:     form.Score,
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
+
+func (h handler) incr(ctx context.Context, req server.Request) server.Response {
+	form := &requestIncr{}
+	_ = req.Bind(form)
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpZIncrBy,
+		Key:       req.GetParam("key"),
+		Member:    form.Member,
+		Score:     form.Delta,
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
+
+func (h handler) rem(ctx context.Context, req server.Request) server.Response {
+	form := &requestMember{}
+	_ = req.Bind(form)
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpZRem,
+		Key:       req.GetParam("key"),
+		Member:    form.Member,
+	}
+
+	data, err := h.dep.Do(cmd)
+	if err != nil {
+		return reply.Error(err.Error())
+	}
+
+	return reply.Success(data)
+}
@@ -0,0 +1,56 @@
+package zsetctrl
+
+import (
+	"ysf/canoe/dependency"
+	"ysf/canoe/server"
+)
+
+func Routes(dep *dependency.Dep) []*server.Route {
+	h := &handler{
+		dep: dep,
+	}
+	return []*server.Route{
+		{
+			Path:       "/zset/:key/add",
+			Method:     "POST",
+			Handler:    h.add,
+			Middleware: nil,
+		},
+		{
+			Path:       "/zset/:key/incr",
+			Method:     "POST",
+			Handler:    h.incr,
+			Middleware: nil,
+		},
+		{
+			Path:       "/zset/:key/rem",
+			Method:     "POST",
+			Handler:    h.rem,
+			Middleware: nil,
+		},
+		{
+			Path:       "/zset/:key/range",
+			Method:     "GET",
+			Handler:    h.rangeByRank,
+			Middleware: nil,
+		},
+		{
+			Path:       "/zset/:key/range_by_score",
+			Method:     "GET",
+			Handler:    h.rangeByScore,
+			Middleware: nil,
+		},
+		{
+			Path:       "/zset/:key/rank/:member",
+			Method:     "GET",
+			Handler:    h.rank,
+			Middleware: nil,
+		},
+		{
+			Path:       "/zset/:key/score/:member",
+			Method:     "GET",
+			Handler:    h.score,
+			Middleware: nil,
+		},
+	}
+}
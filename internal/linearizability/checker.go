@@ -0,0 +1,201 @@
+package linearizability
+
+import (
+	"sort"
+)
+
+// Result is returned by Check, Failed is the part of history which is not linearizable.
+type Result struct {
+	OK     bool
+	Failed []Operation
+}
+
+// Check return OK when there is an order of the operations, consistent with their real time order,
+// which is valid in the model.
+func Check(model Model, history []Operation) Result {
+	partitions := [][]Operation{history}
+	if model.Partition != nil {
+		partitions = model.Partition(history)
+	}
+
+	for _, part := range partitions {
+		if !checkSingle(model, part) {
+			return Result{OK: false, Failed: part}
+		}
+	}
+
+	return Result{OK: true}
+}
+
+// entry is the call or the return event, the call is linked to its return by match
+type entry struct {
+	id    int
+	call  bool
+	time  int64
+	op    *Operation
+	match *entry
+
+	prev, next *entry
+}
+
+// makeEntries build double linked list of events ordered by time, headed by sentinel
+func makeEntries(history []Operation) *entry {
+	events := make([]*entry, 0, len(history)*2)
+	for i := range history {
+		op := &history[i]
+		ret := &entry{id: i, time: op.Return}
+		call := &entry{id: i, call: true, time: op.Call, op: op, match: ret}
+		events = append(events, call, ret)
+	}
+
+	// return before call at the same time, so the operations is not considered concurrent
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+
+		return !events[i].call && events[j].call
+	})
+
+	head := &entry{id: -1}
+	last := head
+	for _, e := range events {
+		last.next = e
+		e.prev = last
+		last = e
+	}
+
+	return head
+}
+
+// lift remove the call and its return from the list
+func lift(e *entry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+
+	ret := e.match
+	ret.prev.next = ret.next
+	if ret.next != nil {
+		ret.next.prev = ret.prev
+	}
+}
+
+// unlift put back the call and its return removed by lift
+func unlift(e *entry) {
+	ret := e.match
+	ret.prev.next = ret
+	if ret.next != nil {
+		ret.next.prev = ret
+	}
+
+	e.prev.next = e
+	e.next.prev = e
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) clone() bitset {
+	return append(bitset{}, b...)
+}
+
+func (b bitset) set(i int) bitset {
+	b[i/64] |= 1 << uint(i%64)
+	return b
+}
+
+func (b bitset) clear(i int) bitset {
+	b[i/64] &^= 1 << uint(i%64)
+	return b
+}
+
+func (b bitset) equal(o bitset) bool {
+	for i := range b {
+		if b[i] != o[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b bitset) hash() uint64 {
+	var h uint64 = 14695981039346656037
+	for _, v := range b {
+		h ^= v
+		h *= 1099511628211
+	}
+
+	return h
+}
+
+type cacheEntry struct {
+	linearized bitset
+	state      interface{}
+}
+
+type frame struct {
+	entry *entry
+	state interface{}
+}
+
+// checkSingle search the linearization using backtracking. The pair of linearized operations and state
+// which is already explored is cached, so the same sub problem is not searched again.
+func checkSingle(model Model, history []Operation) bool {
+	head := makeEntries(history)
+	linearized := newBitset(len(history))
+	cache := make(map[uint64][]cacheEntry)
+	calls := make([]frame, 0)
+
+	seen := func(b bitset, state interface{}) bool {
+		for _, c := range cache[b.hash()] {
+			if c.linearized.equal(b) && model.Equal(c.state, state) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	state := model.Init()
+	e := head.next
+	for head.next != nil {
+		if e.call {
+			ok, next := model.Step(state, *e.op)
+			if ok {
+				candidate := linearized.clone().set(e.id)
+				if !seen(candidate, next) {
+					h := candidate.hash()
+					cache[h] = append(cache[h], cacheEntry{linearized: candidate, state: next})
+
+					calls = append(calls, frame{entry: e, state: state})
+					state = next
+					linearized.set(e.id)
+					lift(e)
+					e = head.next
+					continue
+				}
+			}
+
+			e = e.next
+			continue
+		}
+
+		// return of operation which is not linearized yet, backtrack
+		if len(calls) == 0 {
+			return false
+		}
+
+		top := calls[len(calls)-1]
+		calls = calls[:len(calls)-1]
+		state = top.state
+		linearized.clear(top.entry.id)
+		unlift(top.entry)
+		e = top.entry.next
+	}
+
+	return true
+}
@@ -0,0 +1,128 @@
+package linearizability
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func put(client int, key, value string, call, ret int64) Operation {
+	return Operation{ClientID: client, Kind: OpPut, Key: key, Value: value, Call: call, Return: ret}
+}
+
+func get(client int, key, output string, call, ret int64) Operation {
+	return Operation{ClientID: client, Kind: OpGet, Key: key, Output: output, Call: call, Return: ret}
+}
+
+func TestCheck(t *testing.T) {
+	convey.Convey("Sequential history", t, func() {
+		history := []Operation{
+			put(0, "x", "1", 1, 2),
+			get(0, "x", "1", 3, 4),
+			put(0, "x", "2", 5, 6),
+			get(0, "x", "2", 7, 8),
+		}
+		convey.So(Check(KVModel, history).OK, convey.ShouldBeTrue)
+
+		history[3].Output = "1"
+		convey.So(Check(KVModel, history).OK, convey.ShouldBeFalse)
+	})
+
+	convey.Convey("Concurrent read may see the old or the new value", t, func() {
+		for _, output := range []string{"", "1"} {
+			history := []Operation{
+				put(0, "x", "1", 1, 4),
+				get(1, "x", output, 2, 3),
+			}
+			convey.So(Check(KVModel, history).OK, convey.ShouldBeTrue)
+		}
+	})
+
+	convey.Convey("Stale read after the write returned is not linearizable", t, func() {
+		history := []Operation{
+			put(0, "x", "1", 1, 2),
+			get(1, "x", "1", 3, 6),
+			get(2, "x", "", 4, 5),
+		}
+
+		result := Check(KVModel, history)
+		convey.So(result.OK, convey.ShouldBeFalse)
+		convey.So(len(result.Failed), convey.ShouldEqual, 3)
+	})
+
+	convey.Convey("Read which go back in time is not linearizable", t, func() {
+		history := []Operation{
+			put(0, "x", "1", 1, 10),
+			get(1, "x", "1", 2, 3),
+			get(1, "x", "", 4, 5),
+		}
+		convey.So(Check(KVModel, history).OK, convey.ShouldBeFalse)
+	})
+
+	convey.Convey("Unknown write may take effect any time after it is called, or never", t, func() {
+		history := []Operation{
+			put(0, "x", "1", 1, Unknown),
+			get(1, "x", "", 2, 3),
+			get(1, "x", "1", 10, 11),
+		}
+		convey.So(Check(KVModel, history).OK, convey.ShouldBeTrue)
+
+		history = []Operation{
+			put(0, "x", "1", 1, Unknown),
+			get(1, "x", "", 2, 3),
+		}
+		convey.So(Check(KVModel, history).OK, convey.ShouldBeTrue)
+	})
+
+	convey.Convey("Each key is checked separately", t, func() {
+		history := []Operation{
+			put(0, "x", "1", 1, 2),
+			put(0, "y", "2", 3, 4),
+			get(1, "y", "2", 5, 6),
+			get(1, "x", "", 7, 8),
+		}
+
+		result := Check(KVModel, history)
+		convey.So(result.OK, convey.ShouldBeFalse)
+		convey.So(result.Failed[0].Key, convey.ShouldEqual, "x")
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	convey.Convey("Recorder drop failed operation and unknown read", t, func() {
+		r := NewRecorder()
+
+		id := r.Invoke(0, OpPut, "x", "1")
+		r.Return(id, "")
+
+		id = r.Invoke(0, OpPut, "x", "2")
+		r.Fail(id)
+
+		id = r.Invoke(1, OpPut, "x", "3")
+		r.Unknown(id)
+
+		id = r.Invoke(1, OpGet, "x", "")
+		r.Unknown(id)
+
+		history := r.History()
+		convey.So(len(history), convey.ShouldEqual, 2)
+		convey.So(history[0].Return, convey.ShouldBeLessThan, Unknown)
+		convey.So(history[1].Return, convey.ShouldEqual, Unknown)
+
+		convey.Convey("History can be saved and loaded", func() {
+			dir, err := ioutil.TempDir("", "linearizability")
+			convey.So(err, convey.ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "history.json")
+			convey.So(Save(path, history), convey.ShouldBeNil)
+
+			loaded, err := Load(path)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(loaded, convey.ShouldResemble, history)
+		})
+	})
+}
@@ -0,0 +1,266 @@
+package linearizability_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"ysf/canoe/gossip"
+	"ysf/canoe/internal/linearizability"
+	"ysf/canoe/internal/testcluster"
+	"ysf/canoe/model"
+
+	"github.com/hashicorp/raft"
+)
+
+// Environment to reproduce the failure: the seed of the faults, and the history dumped by the failing test
+const (
+	envSeed    = "CANOE_LINEARIZABILITY_SEED"
+	envHistory = "CANOE_HISTORY"
+)
+
+var keys = []string{"x", "y", "z"}
+
+// definite error is returned before the command is appended to the log, so it never take effect
+func definite(err error) bool {
+	switch err {
+	case gossip.ErrNotLeader, gossip.ErrDraining, raft.ErrNotLeader, raft.ErrEnqueueTimeout:
+		return true
+	}
+
+	return false
+}
+
+// output convert the value returned by GET, missing key is returned as empty map
+func output(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return ""
+		}
+	}
+
+	return fmt.Sprint(value)
+}
+
+// errNoResponse is the operation which is not answered in callTimeout, like a client giving up on the request
+var errNoResponse = errors.New("no response")
+
+const callTimeout = 3 * time.Second
+
+// doOperation return errNoResponse when the operation is not answered in time. The future of raft 1.1.2 is
+// occasionally never answered after the leader lost its leadership, so the client must not wait forever.
+func doOperation(g gossip.Service, payload model.CommandPayload) (interface{}, error) {
+	type result struct {
+		value interface{}
+		err   error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		value, err := g.DoOperation(payload)
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-time.After(callTimeout):
+		return nil, errNoResponse
+	}
+}
+
+// runClient send get and put to the leader, or random node when there is no leader, until stop is closed
+func runClient(c *testcluster.Cluster, recorder *linearizability.Recorder, client int, seed int64, stop <-chan struct{}) {
+	r := rand.New(rand.NewSource(seed))
+	for seq := 0; ; seq++ {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		node := c.Leader()
+		if node == nil || r.Intn(5) == 0 {
+			node = c.Node(r.Intn(len(c.Nodes())))
+		}
+
+		g := node.Gossip()
+		if g == nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		key := keys[r.Intn(len(keys))]
+		payload := model.CommandPayload{Operation: "GET", Key: key}
+		kind, value := linearizability.OpGet, ""
+		if r.Intn(2) == 0 {
+			kind, value = linearizability.OpPut, fmt.Sprintf("%d-%d", client, seq)
+			payload = model.CommandPayload{Operation: "SET", Key: key, Value: value}
+		}
+
+		id := recorder.Invoke(client, kind, key, value)
+		resp, err := doOperation(g, payload)
+
+		switch {
+		case err == nil && kind == linearizability.OpGet:
+			recorder.Return(id, output(resp))
+		case err == nil:
+			recorder.Return(id, "")
+		case definite(err):
+			recorder.Fail(id)
+			time.Sleep(5 * time.Millisecond)
+		default:
+			recorder.Unknown(id)
+		}
+	}
+}
+
+// nemesis inject random fault until the duration is over, then restore the cluster
+func nemesis(t *testing.T, c *testcluster.Cluster, r *rand.Rand, duration time.Duration) {
+	nodes := len(c.Nodes())
+	killed := make(map[int]bool)
+
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Duration(100+r.Intn(300)) * time.Millisecond)
+
+		switch r.Intn(7) {
+		case 0:
+			i := r.Intn(nodes)
+			t.Logf("isolate node %d", i)
+			c.Isolate(i)
+
+		case 1:
+			if leader := c.Leader(); leader != nil {
+				t.Logf("isolate leader %s", leader.ID)
+				c.Isolate(c.Index(leader))
+			}
+
+		case 2:
+			t.Log("heal")
+			c.Heal()
+
+		case 3:
+			delay := time.Duration(r.Intn(40)) * time.Millisecond
+			t.Logf("delay up to %s", delay)
+			c.SetDelay(delay)
+
+		case 4:
+			t.Log("no delay")
+			c.SetDelay(0)
+
+		case 5:
+			// keep the quorum possible, so the test make progress
+			if leader := c.Leader(); leader != nil && len(killed) == 0 {
+				t.Logf("kill leader %s", leader.ID)
+				killed[c.Index(leader)] = true
+				c.Kill(c.Index(leader))
+			}
+
+		case 6:
+			for i := range killed {
+				t.Logf("restart node %d", i)
+				c.Restart(i)
+				delete(killed, i)
+			}
+		}
+	}
+
+	c.Heal()
+	c.SetDelay(0)
+	for i := range killed {
+		c.Restart(i)
+	}
+}
+
+func TestClusterLinearizable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fault injection test is skipped in short mode")
+	}
+
+	seed := time.Now().UnixNano()
+	if s, err := strconv.ParseInt(os.Getenv(envSeed), 10, 64); err == nil {
+		seed = s
+	}
+
+	t.Logf("seed %d, rerun using %s=%d", seed, envSeed, seed)
+
+	c := testcluster.New(t, testcluster.Options{Nodes: 3, Seed: seed})
+	c.WaitLeader(5 * time.Second)
+
+	recorder := linearizability.NewRecorder()
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for client := 0; client < 4; client++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			runClient(c, recorder, client, seed+int64(client), stop)
+		}(client)
+	}
+
+	nemesis(t, c, rand.New(rand.NewSource(seed)), 4*time.Second)
+
+	// let the clients run on the healthy cluster for a while, so the last writes is read
+	c.WaitLeader(10 * time.Second)
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	history := recorder.History()
+	completed := 0
+	for _, op := range history {
+		if op.Return != linearizability.Unknown {
+			completed++
+		}
+	}
+
+	t.Logf("%d operations, %d completed", len(history), completed)
+	if completed == 0 {
+		t.Fatal("no operation completed")
+	}
+
+	result := linearizability.Check(linearizability.KVModel, history)
+	if !result.OK {
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("canoe-history-%d.json", seed))
+		if err := linearizability.Save(path, history); err != nil {
+			t.Logf("failed dump history: %s", err.Error())
+		}
+
+		t.Fatalf("history is not linearizable on key %s, dumped to %s, check it again using %s=%s",
+			result.Failed[0].Key, path, envHistory, path)
+	}
+
+	c.WaitConverged(10 * time.Second)
+}
+
+// TestReplayHistory check the history dumped by failing TestClusterLinearizable
+func TestReplayHistory(t *testing.T) {
+	path := os.Getenv(envHistory)
+	if path == "" {
+		t.Skipf("set %s to the dumped history", envHistory)
+	}
+
+	history, err := linearizability.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := linearizability.Check(linearizability.KVModel, history)
+	if !result.OK {
+		for _, op := range result.Failed {
+			t.Logf("%+v", op)
+		}
+
+		t.Fatalf("history is not linearizable on key %s", result.Failed[0].Key)
+	}
+}
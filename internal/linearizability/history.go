@@ -0,0 +1,154 @@
+// Package linearizability record the history of client operations and check it against a model,
+// using the algorithm of Porcupine (https://github.com/anishathalye/porcupine).
+package linearizability
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Kind of operation in KVModel
+const (
+	OpGet = "get"
+	OpPut = "put"
+)
+
+// Unknown is the return time of operation which may or may not take effect, for example write timed out.
+// It can be linearized at any point after it is called.
+const Unknown int64 = math.MaxInt64
+
+// Operation is one client call. Call and Return is the logical time, Output is the value read by get.
+type Operation struct {
+	ClientID int    `json:"client_id"`
+	Kind     string `json:"kind"`
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Call     int64  `json:"call"`
+	Return   int64  `json:"return"`
+}
+
+// Recorder is safe for concurrent use by the clients.
+type Recorder struct {
+	mu      sync.Mutex
+	clock   int64
+	ops     []Operation
+	dropped map[int]bool
+}
+
+// NewRecorder return empty history.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		dropped: make(map[int]bool),
+	}
+}
+
+// Invoke record the call and return the id used to record its result.
+func (r *Recorder) Invoke(clientID int, kind, key, value string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clock++
+	r.ops = append(r.ops, Operation{
+		ClientID: clientID,
+		Kind:     kind,
+		Key:      key,
+		Value:    value,
+		Call:     r.clock,
+		Return:   Unknown,
+	})
+
+	return len(r.ops) - 1
+}
+
+// Return record the successful result.
+func (r *Recorder) Return(id int, output string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clock++
+	r.ops[id].Output = output
+	r.ops[id].Return = r.clock
+}
+
+// Unknown record that the operation may or may not take effect, its return time stay Unknown.
+// Read with unknown result has no effect, so it is removed instead.
+func (r *Recorder) Unknown(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ops[id].Kind == OpGet {
+		r.dropped[id] = true
+	}
+}
+
+// Fail record that the operation definitely did not take effect, so it is removed from the history.
+func (r *Recorder) Fail(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropped[id] = true
+}
+
+// History return the recorded operations, without the failed one.
+// Operation which is still running is treated as unknown.
+func (r *Recorder) History() []Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	history := make([]Operation, 0, len(r.ops))
+	for id, op := range r.ops {
+		if r.dropped[id] || (op.Kind == OpGet && op.Return == Unknown) {
+			continue
+		}
+
+		history = append(history, op)
+	}
+
+	return history
+}
+
+// Save write the history as JSON, so failing history can be checked again using Load.
+func Save(path string, history []Operation) error {
+	b, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Load read the history written by Save.
+func Load(path string) ([]Operation, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []Operation
+	err = json.Unmarshal(b, &history)
+	return history, err
+}
+
+// partitionByKey split the history, because operation on different key never affect each other
+func partitionByKey(history []Operation) [][]Operation {
+	byKey := make(map[string][]Operation)
+	keys := make([]string, 0)
+	for _, op := range history {
+		if _, ok := byKey[op.Key]; !ok {
+			keys = append(keys, op.Key)
+		}
+
+		byKey[op.Key] = append(byKey[op.Key], op)
+	}
+
+	sort.Strings(keys)
+	partitions := make([][]Operation, 0, len(keys))
+	for _, key := range keys {
+		partitions = append(partitions, byKey[key])
+	}
+
+	return partitions
+}
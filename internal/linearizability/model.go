@@ -0,0 +1,38 @@
+package linearizability
+
+// Model is the sequential specification of the system.
+type Model struct {
+	// Partition split the history into independent parts which is checked separately, nil means no partition
+	Partition func(history []Operation) [][]Operation
+
+	// Init return the initial state
+	Init func() interface{}
+
+	// Step return true and the next state when the operation is valid in the state
+	Step func(state interface{}, op Operation) (bool, interface{})
+
+	// Equal compare two states
+	Equal func(a, b interface{}) bool
+}
+
+// KVModel is register per key. Get of missing key return empty string, put replace the value.
+var KVModel = Model{
+	Partition: partitionByKey,
+	Init: func() interface{} {
+		return ""
+	},
+	Step: func(state interface{}, op Operation) (bool, interface{}) {
+		value := state.(string)
+		switch op.Kind {
+		case OpGet:
+			return op.Output == value, value
+		case OpPut:
+			return true, op.Value
+		default:
+			return false, value
+		}
+	},
+	Equal: func(a, b interface{}) bool {
+		return a.(string) == b.(string)
+	},
+}
@@ -0,0 +1,486 @@
+// Package testcluster run several canoe nodes in one process for test, connected by raft.InmemTransport.
+// Each node has its own temporary Badger directory for both the data and the raft log,
+// so it can be killed and restarted with its state.
+package testcluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/hashicorp/raft"
+)
+
+// transportTimeout is the timeout of each RPC between nodes
+const transportTimeout = 5 * time.Second
+
+// Options is used by New.
+type Options struct {
+	// Nodes is the number of voter, default is 3
+	Nodes int
+
+	// Tuning default to short timeouts, so the leader is elected in less than a second
+	Tuning gossip.TuningConfig
+
+	FSM fsm.Options
+
+	// Seed of the random message delay, default is the current time
+	Seed int64
+}
+
+// Node is one canoe node in the cluster.
+type Node struct {
+	ID      string
+	Address raft.ServerAddress
+	Dir     string
+
+	// mu guard the fields which is replaced by kill and restart, so client can run concurrently with the faults
+	mu        sync.RWMutex
+	service   gossip.Service
+	store     repo.Service
+	db        *badger.DB
+	transport *raft.InmemTransport
+}
+
+// Running return true when the node is not killed.
+func (n *Node) Running() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.service != nil
+}
+
+// Gossip return the service of the node, nil while the node is killed.
+// Service taken before the node is killed return raft.ErrRaftShutdown.
+func (n *Node) Gossip() gossip.Service {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.service
+}
+
+// Repo return the local store of the node, nil while the node is killed.
+func (n *Node) Repo() repo.Service {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.store
+}
+
+func (n *Node) inmemTransport() *raft.InmemTransport {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.transport
+}
+
+// Cluster is the nodes and the connectivity between them.
+type Cluster struct {
+	t    testing.TB
+	opt  Options
+	root string
+
+	mu    sync.Mutex
+	nodes []*Node
+
+	// cut is the blocked pairs, keyed by the lower index first
+	cut map[[2]int]bool
+
+	faults *faults
+}
+
+// New start the nodes, the first node bootstrap the cluster and the others join to it.
+// It fail the test when the cluster can not be formed, Shutdown is registered as test cleanup.
+func New(t testing.TB, opt Options) *Cluster {
+	if opt.Nodes <= 0 {
+		opt.Nodes = 3
+	}
+
+	if opt.Tuning == (gossip.TuningConfig{}) {
+		opt.Tuning = gossip.TuningConfig{
+			HeartbeatTimeout:   100 * time.Millisecond,
+			ElectionTimeout:    100 * time.Millisecond,
+			LeaderLeaseTimeout: 100 * time.Millisecond,
+			CommitTimeout:      5 * time.Millisecond,
+		}
+	}
+
+	root, err := ioutil.TempDir("", "testcluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opt.Seed == 0 {
+		opt.Seed = time.Now().UnixNano()
+	}
+
+	c := &Cluster{
+		t:      t,
+		opt:    opt,
+		root:   root,
+		cut:    make(map[[2]int]bool),
+		faults: newFaults(opt.Seed),
+	}
+
+	t.Cleanup(c.Shutdown)
+
+	for i := 0; i < opt.Nodes; i++ {
+		node := &Node{
+			ID:      fmt.Sprintf("node_%d", i+1),
+			Address: raft.ServerAddress(fmt.Sprintf("node_%d", i+1)),
+			Dir:     filepath.Join(root, fmt.Sprintf("node_%d", i+1)),
+		}
+
+		c.nodes = append(c.nodes, node)
+		if err := c.start(i, i == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	leader := c.WaitLeader(5 * time.Second)
+	for _, node := range c.nodes[1:] {
+		if err := leader.Gossip().Join(node.ID, string(node.Address), gossip.SuffrageVoter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return c
+}
+
+func (c *Cluster) start(i int, bootstrap bool) error {
+	node := c.nodes[i]
+
+	if err := os.MkdirAll(node.Dir, 0700); err != nil {
+		return err
+	}
+
+	opt := badger.DefaultOptions(node.Dir)
+	opt.Logger = nil
+
+	db, err := badger.Open(opt)
+	if err != nil {
+		return err
+	}
+
+	dataRepo, err := repo.NewBadger(db)
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	// follower which respond after the timeout block forever on the unbuffered response channel of InmemTransport,
+	// so the timeout is much longer than the default 50ms to tolerate slow fsync
+	_, transport := raft.NewInmemTransportWithTimeout(node.Address, transportTimeout)
+	g, err := gossip.New(gossip.Config{
+		NodeID:    node.ID,
+		RaftDir:   node.Dir,
+		Bootstrap: bootstrap,
+		Transport: &faultTransport{InmemTransport: transport, faults: c.faults},
+		LogStore:  gossip.LogStoreBadger,
+		Tuning:    c.opt.Tuning,
+		FSM:       c.opt.FSM,
+	}, dataRepo)
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	node.mu.Lock()
+	node.db = db
+	node.transport = transport
+	node.service = g
+	node.store = dataRepo
+	node.mu.Unlock()
+
+	c.reconnect()
+	return nil
+}
+
+// reconnect apply the connectivity to every running node
+func (c *Cluster) reconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, a := range c.nodes {
+		from := a.inmemTransport()
+		for j, b := range c.nodes {
+			if i == j || from == nil {
+				continue
+			}
+
+			to := b.inmemTransport()
+			if to == nil || c.cut[pair(i, j)] {
+				from.Disconnect(b.Address)
+				continue
+			}
+
+			from.Connect(b.Address, to)
+		}
+	}
+}
+
+func pair(i, j int) [2]int {
+	if i > j {
+		i, j = j, i
+	}
+
+	return [2]int{i, j}
+}
+
+// Node return the node by index, starting from 0.
+func (c *Cluster) Node(i int) *Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nodes[i]
+}
+
+// Nodes return all nodes, including the killed one.
+func (c *Cluster) Nodes() []*Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Node{}, c.nodes...)
+}
+
+// Index return the index of the node, or -1 when it is not in the cluster.
+func (c *Cluster) Index(node *Node) int {
+	for i, n := range c.Nodes() {
+		if n == node {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Leader return the running node which is the leader, nil when there is none.
+// When more than one node think it is the leader (old leader in minority partition), the first one is returned.
+func (c *Cluster) Leader() *Node {
+	for _, node := range c.Nodes() {
+		if g := node.Gossip(); g != nil && g.IsLeader() {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// WaitLeader wait until exactly one running node is the leader, it fail the test on timeout.
+func (c *Cluster) WaitLeader(timeout time.Duration) *Node {
+	var leader *Node
+	err := c.waitFor(timeout, func() error {
+		leaders := make([]string, 0)
+		for _, node := range c.Nodes() {
+			if g := node.Gossip(); g != nil && g.IsLeader() {
+				leader = node
+				leaders = append(leaders, node.ID)
+			}
+		}
+
+		if len(leaders) != 1 {
+			return fmt.Errorf("leaders: %v", leaders)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		c.t.Fatalf("no single leader in %s: %s", timeout, err.Error())
+	}
+
+	return leader
+}
+
+// Apply send the command to the current leader.
+func (c *Cluster) Apply(payload model.CommandPayload) (interface{}, error) {
+	leader := c.Leader()
+	if leader == nil {
+		return nil, gossip.ErrNotLeader
+	}
+
+	return leader.Gossip().DoOperation(payload)
+}
+
+// Partition cut the connection between the nodes in the group and the others.
+func (c *Cluster) Partition(group ...int) {
+	in := make(map[int]bool)
+	for _, i := range group {
+		in[i] = true
+	}
+
+	c.mu.Lock()
+	for i := range c.nodes {
+		for j := range c.nodes {
+			if i != j && in[i] && !in[j] {
+				c.cut[pair(i, j)] = true
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	c.reconnect()
+}
+
+// Isolate cut the node from every other node.
+func (c *Cluster) Isolate(i int) {
+	c.Partition(i)
+}
+
+// Heal restore the connection between all nodes.
+func (c *Cluster) Heal() {
+	c.mu.Lock()
+	c.cut = make(map[[2]int]bool)
+	c.mu.Unlock()
+
+	c.reconnect()
+}
+
+// SetDelay delay every RPC between nodes by random duration up to max, zero disable the delay.
+func (c *Cluster) SetDelay(max time.Duration) {
+	c.faults.setDelay(max)
+}
+
+// Kill shutdown the node, its directory is kept so it can be restarted.
+// The node is disconnected first, so other nodes do not wait for the RPC timeout while it is shutting down.
+func (c *Cluster) Kill(i int) {
+	node := c.Node(i)
+
+	node.mu.Lock()
+	g, db := node.service, node.db
+	if g == nil {
+		node.mu.Unlock()
+		return
+	}
+
+	node.service = nil
+	node.store = nil
+	node.db = nil
+	node.transport = nil
+	node.mu.Unlock()
+
+	c.reconnect()
+
+	if err := g.Shutdown(); err != nil {
+		c.t.Logf("shutdown %s: %s", node.ID, err.Error())
+	}
+
+	if err := db.Close(); err != nil {
+		c.t.Logf("close db %s: %s", node.ID, err.Error())
+	}
+}
+
+// Restart start the killed node using its raft state and data.
+func (c *Cluster) Restart(i int) {
+	if c.Node(i).Running() {
+		return
+	}
+
+	if err := c.start(i, false); err != nil {
+		c.t.Fatalf("restart %s: %s", c.Node(i).ID, err.Error())
+	}
+}
+
+// WaitConverged wait until every running node has the same applied index and the same keys and items,
+// it fail the test on timeout.
+func (c *Cluster) WaitConverged(timeout time.Duration) {
+	err := c.waitFor(timeout, func() error {
+		var (
+			first     *Node
+			firstDump dump
+		)
+
+		for _, node := range c.Nodes() {
+			store := node.Repo()
+			if store == nil {
+				continue
+			}
+
+			d, err := dumpRepo(store)
+			if err != nil {
+				return err
+			}
+
+			if first == nil {
+				first, firstDump = node, d
+				continue
+			}
+
+			if d.appliedIndex != firstDump.appliedIndex {
+				return fmt.Errorf("applied index %s=%d %s=%d", first.ID, firstDump.appliedIndex, node.ID, d.appliedIndex)
+			}
+
+			if !reflect.DeepEqual(d.items, firstDump.items) {
+				return fmt.Errorf("content of %s and %s is different", first.ID, node.ID)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		c.t.Fatalf("not converged in %s: %s", timeout, err.Error())
+	}
+}
+
+type dump struct {
+	appliedIndex uint64
+	items        map[string]repo.Item
+}
+
+func dumpRepo(r repo.Service) (d dump, err error) {
+	d.items = make(map[string]repo.Item)
+	if d.appliedIndex, err = r.AppliedIndex(); err != nil {
+		return
+	}
+
+	var offset uint64
+	for {
+		keys, next, err := r.Scan(offset, 1000, "")
+		if err != nil {
+			return d, err
+		}
+
+		items, err := r.GetItems(keys...)
+		if err != nil {
+			return d, err
+		}
+
+		for _, item := range items {
+			if item != nil {
+				d.items[item.Key] = *item
+			}
+		}
+
+		if next == 0 {
+			return d, nil
+		}
+
+		offset = next
+	}
+}
+
+func (c *Cluster) waitFor(timeout time.Duration, fn func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := fn()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Shutdown kill every node and remove the directories.
+func (c *Cluster) Shutdown() {
+	for i := range c.Nodes() {
+		c.Kill(i)
+	}
+
+	_ = os.RemoveAll(c.root)
+}
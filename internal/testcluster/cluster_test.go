@@ -0,0 +1,85 @@
+package testcluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"ysf/canoe/model"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func set(c *Cluster, key string, value interface{}) error {
+	_, err := c.Apply(model.CommandPayload{
+		Operation: "SET",
+		Key:       key,
+		Value:     value,
+	})
+
+	return err
+}
+
+func TestCluster(t *testing.T) {
+	convey.Convey("Write to the leader is replicated to every node", t, func() {
+		c := New(t, Options{Nodes: 3})
+		c.WaitLeader(5 * time.Second)
+
+		for i := 0; i < 20; i++ {
+			convey.So(set(c, fmt.Sprintf("key_%d", i), fmt.Sprintf("value_%d", i)), convey.ShouldBeNil)
+		}
+
+		c.WaitConverged(5 * time.Second)
+		for _, node := range c.Nodes() {
+			convey.So(node.Repo().Get("key_19"), convey.ShouldEqual, "value_19")
+		}
+	})
+
+	convey.Convey("Isolated leader is replaced, and catch up after heal", t, func() {
+		c := New(t, Options{Nodes: 3})
+		old := c.WaitLeader(5 * time.Second)
+		oldIndex := c.Index(old)
+
+		c.Isolate(oldIndex)
+
+		var leader *Node
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			for _, node := range c.Nodes() {
+				if node != old && node.Gossip().IsLeader() {
+					leader = node
+				}
+			}
+
+			if leader != nil {
+				break
+			}
+
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		convey.So(leader, convey.ShouldNotBeNil)
+
+		_, err := leader.Gossip().DoOperation(model.CommandPayload{Operation: "SET", Key: "foo", Value: "bar"})
+		convey.So(err, convey.ShouldBeNil)
+
+		c.Heal()
+		c.WaitLeader(5 * time.Second)
+		c.WaitConverged(5 * time.Second)
+		convey.So(old.Repo().Get("foo"), convey.ShouldEqual, "bar")
+	})
+
+	convey.Convey("Killed node catch up after restart", t, func() {
+		c := New(t, Options{Nodes: 3})
+		leader := c.WaitLeader(5 * time.Second)
+
+		follower := (c.Index(leader) + 1) % 3
+		c.Kill(follower)
+		convey.So(c.Node(follower).Running(), convey.ShouldBeFalse)
+
+		convey.So(set(c, "foo", "bar"), convey.ShouldBeNil)
+
+		c.Restart(follower)
+		c.WaitConverged(5 * time.Second)
+		convey.So(c.Node(follower).Repo().Get("foo"), convey.ShouldEqual, "bar")
+	})
+}
@@ -0,0 +1,66 @@
+package testcluster
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// faults is the message delay injected into every RPC between nodes
+type faults struct {
+	mu       sync.Mutex
+	maxDelay time.Duration
+	rand     *rand.Rand
+}
+
+func newFaults(seed int64) *faults {
+	return &faults{
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (f *faults) setDelay(max time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maxDelay = max
+}
+
+// delay sleep random duration up to the max delay before the RPC is sent
+func (f *faults) delay() {
+	f.mu.Lock()
+	var d time.Duration
+	if f.maxDelay > 0 {
+		d = time.Duration(f.rand.Int63n(int64(f.maxDelay)))
+	}
+	f.mu.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// faultTransport delay the RPC of raft.InmemTransport. Pipeline replication is disabled,
+// so every AppendEntries go through the delay.
+type faultTransport struct {
+	*raft.InmemTransport
+	faults *faults
+}
+
+// AppendEntriesPipeline implements the raft.Transport interface.
+func (t *faultTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	return nil, raft.ErrPipelineReplicationNotSupported
+}
+
+// AppendEntries implements the raft.Transport interface.
+func (t *faultTransport) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+	t.faults.delay()
+	return t.InmemTransport.AppendEntries(id, target, args, resp)
+}
+
+// RequestVote implements the raft.Transport interface.
+func (t *faultTransport) RequestVote(id raft.ServerID, target raft.ServerAddress, args *raft.RequestVoteRequest, resp *raft.RequestVoteResponse) error {
+	t.faults.delay()
+	return t.InmemTransport.RequestVote(id, target, args, resp)
+}
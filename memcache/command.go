@@ -0,0 +1,296 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"ysf/canoe/dependency"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+)
+
+// version is returned by version command.
+const version = "1.6.0-canoe"
+
+// execute run one command, it returns true when the connection must be closed.
+func (s *server) execute(r *bufio.Reader, w *bufio.Writer, line string) (quit bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		_, _ = w.WriteString("ERROR\r\n")
+		return false
+	}
+
+	switch fields[0] {
+	case "get", "gets":
+		s.cmdGet(w, fields)
+	case "set", "add", "replace", "cas":
+		return s.cmdStore(r, w, fields)
+	case "delete":
+		s.cmdDelete(w, fields)
+	case "incr", "decr":
+		s.cmdIncr(w, fields)
+	case "touch":
+		s.cmdTouch(w, fields)
+	case "version":
+		_, _ = w.WriteString("VERSION " + version + "\r\n")
+	case "quit":
+		return true
+	default:
+		_, _ = w.WriteString("ERROR\r\n")
+	}
+
+	return false
+}
+
+// do send the command to the leader through raft, in the shard group owning the keys when sharding is enabled.
+func (s *server) do(w *bufio.Writer, cmd model.CommandPayload) (interface{}, error) {
+	resp, err := s.dep.Do(cmd)
+	if err != nil && errors.Is(err, gossip.ErrNotLeader) {
+		msg := "SERVER_ERROR not leader"
+		if leader := s.conf.LeaderAddress(); leader != "" {
+			msg += ", leader is " + leader
+		}
+
+		_, _ = w.WriteString(msg + "\r\n")
+	}
+
+	return resp, err
+}
+
+// reply write the message unless noreply is set.
+func reply(w *bufio.Writer, noreply bool, msg string) {
+	if !noreply {
+		_, _ = w.WriteString(msg + "\r\n")
+	}
+}
+
+// replyError write the error which is not already written by do.
+func replyError(w *bufio.Writer, noreply bool, err error) {
+	if errors.Is(err, gossip.ErrNotLeader) {
+		return
+	}
+
+	reply(w, noreply, "SERVER_ERROR "+strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error()))
+}
+
+// cmdGet handle "get <key>*" and "gets <key>*", gets also return the key revision as cas unique.
+func (s *server) cmdGet(w *bufio.Writer, fields []string) {
+	if len(fields) < 2 {
+		_, _ = w.WriteString("ERROR\r\n")
+		return
+	}
+
+	for _, key := range fields[1:] {
+		if !validKey(key) {
+			_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+	}
+
+	resp, err := s.do(w, model.CommandPayload{
+		Operation: fsm.OpGetItems,
+		Keys:      fields[1:],
+	})
+
+	if err != nil {
+		replyError(w, false, err)
+		return
+	}
+
+	var items []*repo.Item
+	_ = dependency.DecodeResult(resp, &items)
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+
+		value := decodeValue(item)
+		header := "VALUE " + item.Key + " " + strconv.FormatUint(uint64(item.Flags), 10) + " " + strconv.Itoa(len(value))
+		if fields[0] == "gets" {
+			header += " " + strconv.FormatUint(item.Revision, 10)
+		}
+
+		_, _ = w.WriteString(header + "\r\n")
+		_, _ = w.Write(value)
+		_, _ = w.WriteString("\r\n")
+	}
+
+	_, _ = w.WriteString("END\r\n")
+}
+
+// cmdStore handle set, add, replace and cas. The data block is read even when the command line is invalid,
+// so the next command can be parsed.
+func (s *server) cmdStore(r *bufio.Reader, w *bufio.Writer, fields []string) (quit bool) {
+	c, ok := parseStorageCommand(fields, fields[0] == "cas")
+	if !ok {
+		_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return false
+	}
+
+	if c.bytes > s.conf.MaxItemSize {
+		_, _ = w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		// swallow the data block, so the connection stays in sync
+		_, err := io.CopyN(ioutil.Discard, r, int64(c.bytes)+2)
+		return err != nil
+	}
+
+	data := make([]byte, c.bytes+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return true
+	}
+
+	if data[c.bytes] != '\r' || data[c.bytes+1] != '\n' {
+		_, _ = w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return false
+	}
+
+	value, raw := encodeValue(data[:c.bytes])
+	cmd := model.CommandPayload{
+		Operation: strings.ToUpper(fields[0]),
+		Key:       c.key,
+		ExpireAt:  expireAt(c.exptime, time.Now()),
+		Data:      value,
+		Raw:       raw,
+		Flags:     c.flags,
+		Revision:  c.cas,
+	}
+
+	if cmd.Operation == fsm.OpCAS && cmd.Revision == 0 {
+		// revision start from 1, so zero cas unique never match
+		reply(w, c.noreply, "EXISTS")
+		return false
+	}
+
+	_, err := s.do(w, cmd)
+	switch {
+	case err == nil:
+		reply(w, c.noreply, "STORED")
+	case errors.Is(err, repo.ErrKeyExists):
+		reply(w, c.noreply, "NOT_STORED")
+	case errors.Is(err, repo.ErrKeyNotFound) && cmd.Operation == fsm.OpCAS:
+		reply(w, c.noreply, "NOT_FOUND")
+	case errors.Is(err, repo.ErrKeyNotFound):
+		reply(w, c.noreply, "NOT_STORED")
+	case errors.Is(err, repo.ErrRevisionMismatch):
+		reply(w, c.noreply, "EXISTS")
+	default:
+		replyError(w, c.noreply, err)
+	}
+
+	return false
+}
+
+// cmdDelete handle "delete <key> [noreply]"
+func (s *server) cmdDelete(w *bufio.Writer, fields []string) {
+	noreply := len(fields) == 3 && fields[2] == "noreply"
+	if len(fields) != 2 && !noreply {
+		_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	resp, err := s.do(w, model.CommandPayload{
+		Operation: fsm.OpDel,
+		Keys:      fields[1:2],
+	})
+
+	if err != nil {
+		replyError(w, noreply, err)
+		return
+	}
+
+	var r fsm.CountResult
+	_ = dependency.DecodeResult(resp, &r)
+	if r.Count > 0 {
+		reply(w, noreply, "DELETED")
+		return
+	}
+
+	reply(w, noreply, "NOT_FOUND")
+}
+
+// cmdIncr handle "incr|decr <key> <value> [noreply]". Decrement below zero is saturated to zero like in memcached.
+func (s *server) cmdIncr(w *bufio.Writer, fields []string) {
+	noreply := len(fields) == 4 && fields[3] == "noreply"
+	if len(fields) != 3 && !noreply {
+		_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	delta, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil || delta > math.MaxInt64 {
+		_, _ = w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return
+	}
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpIncrBy,
+		Key:       fields[1],
+		Delta:     int64(delta),
+		MustExist: true,
+	}
+
+	if fields[0] == "decr" {
+		var zero int64
+		cmd.Delta = -cmd.Delta
+		cmd.Min = &zero
+		cmd.Clamp = true
+	}
+
+	resp, err := s.do(w, cmd)
+	switch {
+	case err == nil:
+		var r fsm.CounterResult
+		_ = dependency.DecodeResult(resp, &r)
+		reply(w, noreply, strconv.FormatInt(r.Value, 10))
+	case errors.Is(err, repo.ErrKeyNotFound):
+		reply(w, noreply, "NOT_FOUND")
+	case errors.Is(err, repo.ErrNotInteger):
+		reply(w, noreply, "CLIENT_ERROR cannot increment or decrement non-numeric value")
+	case errors.Is(err, repo.ErrOverflow):
+		reply(w, noreply, "CLIENT_ERROR increment would overflow")
+	default:
+		replyError(w, noreply, err)
+	}
+}
+
+// cmdTouch handle "touch <key> <exptime> [noreply]"
+func (s *server) cmdTouch(w *bufio.Writer, fields []string) {
+	noreply := len(fields) == 4 && fields[3] == "noreply"
+	if len(fields) != 3 && !noreply {
+		_, _ = w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	exptime, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		_, _ = w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+
+	resp, err := s.do(w, model.CommandPayload{
+		Operation: fsm.OpTouch,
+		Key:       fields[1],
+		ExpireAt:  expireAt(exptime, time.Now()),
+	})
+
+	if err != nil {
+		replyError(w, noreply, err)
+		return
+	}
+
+	var r fsm.CountResult
+	_ = dependency.DecodeResult(resp, &r)
+	if r.Count > 0 {
+		reply(w, noreply, "TOUCHED")
+		return
+	}
+
+	reply(w, noreply, "NOT_FOUND")
+}
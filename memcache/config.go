@@ -0,0 +1,19 @@
+package memcache
+
+import (
+	"time"
+)
+
+type Config struct {
+	ListenAddress string
+
+	// IdleTimeout close connection which send no command within this duration, zero means never.
+	IdleTimeout time.Duration
+
+	// MaxItemSize is the maximum size of value accepted by storage command, default is 1MB like memcached.
+	MaxItemSize int
+
+	// LeaderAddress return the memcached address of the current leader.
+	// Memcached protocol has no redirect, so it is only written in the SERVER_ERROR message.
+	LeaderAddress func() string
+}
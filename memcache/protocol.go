@@ -0,0 +1,155 @@
+package memcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"ysf/canoe/repo"
+)
+
+const (
+	// maxKeyLength is the longest key accepted, same as memcached.
+	maxKeyLength = 250
+
+	// relativeExpireLimit is the biggest exptime treated as relative seconds,
+	// bigger value is treated as absolute unix time like in memcached.
+	relativeExpireLimit = 60 * 60 * 24 * 30
+)
+
+// storageCommand is the parsed header line of set, add, replace and cas.
+type storageCommand struct {
+	key     string
+	flags   uint32
+	exptime int64
+	bytes   int
+	cas     uint64
+	noreply bool
+}
+
+// parseStorageCommand parse "<cmd> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]", fields[0] is the command.
+func parseStorageCommand(fields []string, withCAS bool) (c storageCommand, ok bool) {
+	n := 5
+	if withCAS {
+		n = 6
+	}
+
+	if len(fields) != n && len(fields) != n+1 {
+		return c, false
+	}
+
+	if !validKey(fields[1]) {
+		return c, false
+	}
+
+	flags, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return c, false
+	}
+
+	exptime, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return c, false
+	}
+
+	size, err := strconv.Atoi(fields[4])
+	if err != nil || size < 0 {
+		return c, false
+	}
+
+	c = storageCommand{
+		key:     fields[1],
+		flags:   uint32(flags),
+		exptime: exptime,
+		bytes:   size,
+	}
+
+	if withCAS {
+		c.cas, err = strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			return c, false
+		}
+	}
+
+	if len(fields) == n+1 {
+		if fields[n] != "noreply" {
+			return c, false
+		}
+		c.noreply = true
+	}
+
+	return c, true
+}
+
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expireAt convert memcached exptime into absolute unix second.
+// Zero means never expire, already expired time is returned as 1 (the key is hidden as soon as it is written).
+func expireAt(exptime int64, now time.Time) int64 {
+	switch {
+	case exptime == 0:
+		return 0
+	case exptime < 0:
+		return 1
+	case exptime <= relativeExpireLimit:
+		return now.Unix() + exptime
+	case exptime <= now.Unix():
+		return 1
+	default:
+		return exptime
+	}
+}
+
+// readLine read the command line terminated by CRLF (LF is also accepted).
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// encodeValue convert the bytes sent by memcached client into the stored value.
+// Valid UTF-8 is saved as JSON string, so it is readable from the HTTP API, other bytes is saved as is.
+func encodeValue(data []byte) (value []byte, raw bool) {
+	if !utf8.Valid(data) {
+		return data, true
+	}
+
+	value, err := json.Marshal(string(data))
+	if err != nil {
+		return data, true
+	}
+
+	return value, false
+}
+
+// decodeValue is the reverse of encodeValue.
+// Value written by other API which is not JSON string, such as counter, is returned as its JSON text.
+func decodeValue(item *repo.Item) []byte {
+	if item.Raw {
+		return item.Value
+	}
+
+	var str string
+	if err := json.Unmarshal(item.Value, &str); err == nil {
+		return []byte(str)
+	}
+
+	return item.Value
+}
@@ -0,0 +1,69 @@
+package memcache
+
+import (
+	"testing"
+	"time"
+	"ysf/canoe/repo"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseStorageCommand(t *testing.T) {
+	convey.Convey("Parse storage command", t, func() {
+		convey.Convey("Set command", func() {
+			c, ok := parseStorageCommand([]string{"set", "foo", "5", "0", "3"}, false)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(c, convey.ShouldResemble, storageCommand{key: "foo", flags: 5, exptime: 0, bytes: 3})
+		})
+
+		convey.Convey("Cas command with noreply", func() {
+			c, ok := parseStorageCommand([]string{"cas", "foo", "0", "10", "3", "42", "noreply"}, true)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(c.cas, convey.ShouldEqual, 42)
+			convey.So(c.noreply, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Invalid command", func() {
+			_, ok := parseStorageCommand([]string{"set", "foo", "x", "0", "3"}, false)
+			convey.So(ok, convey.ShouldBeFalse)
+
+			_, ok = parseStorageCommand([]string{"cas", "foo", "0", "0", "3"}, true)
+			convey.So(ok, convey.ShouldBeFalse)
+
+			_, ok = parseStorageCommand([]string{"set", "foo", "0", "0", "3", "yes"}, false)
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
+
+func TestExpireAt(t *testing.T) {
+	convey.Convey("Convert exptime", t, func() {
+		now := time.Unix(1600000000, 0)
+
+		convey.So(expireAt(0, now), convey.ShouldEqual, 0)
+		convey.So(expireAt(60, now), convey.ShouldEqual, 1600000060)
+		convey.So(expireAt(1700000000, now), convey.ShouldEqual, 1700000000)
+		convey.So(expireAt(-1, now), convey.ShouldEqual, 1)
+		convey.So(expireAt(1500000000, now), convey.ShouldEqual, 1)
+	})
+}
+
+func TestValueEncoding(t *testing.T) {
+	convey.Convey("Encode value", t, func() {
+		convey.Convey("Text is saved as JSON string", func() {
+			value, raw := encodeValue([]byte("hello <world>"))
+			convey.So(raw, convey.ShouldBeFalse)
+			convey.So(string(decodeValue(&repo.Item{Value: value})), convey.ShouldEqual, "hello <world>")
+		})
+
+		convey.Convey("Binary is saved as is", func() {
+			value, raw := encodeValue([]byte{0xff, 0x00, 0xfe})
+			convey.So(raw, convey.ShouldBeTrue)
+			convey.So(decodeValue(&repo.Item{Value: value, Raw: raw}), convey.ShouldResemble, []byte{0xff, 0x00, 0xfe})
+		})
+
+		convey.Convey("Counter is returned as number text", func() {
+			convey.So(string(decodeValue(&repo.Item{Value: []byte("42")})), convey.ShouldEqual, "42")
+		})
+	})
+}
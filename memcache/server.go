@@ -0,0 +1,83 @@
+package memcache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"time"
+	"ysf/canoe/dependency"
+	"ysf/canoe/pkg/tcpserver"
+)
+
+const defaultMaxItemSize = 1024 * 1024
+
+// server is TCP server speaking memcached ASCII protocol on top of the replicated store.
+type server struct {
+	dep  *dependency.Dep
+	conf Config
+	tcp  *tcpserver.Server
+}
+
+// Start listen and serve connection until Shutdown is called.
+func (s *server) Start() error {
+	l, err := net.Listen("tcp", s.conf.ListenAddress)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "Starting memcached server at %s\n", l.Addr().String())
+	return s.tcp.Serve(l)
+}
+
+// Shutdown stop accepting connection, close all connection and wait the running command to finish.
+func (s *server) Shutdown() {
+	s.tcp.Shutdown()
+}
+
+func (s *server) serveConn(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		if s.conf.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.conf.IdleTimeout))
+		}
+
+		line, err := readLine(r)
+		if err != nil {
+			return
+		}
+
+		if quit := s.execute(r, w, line); quit {
+			_ = w.Flush()
+			return
+		}
+
+		// flush only when there is no pipelined command waiting in buffer
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// NewServer return memcached server using the same gossip.Service as the HTTP API.
+func NewServer(conf Config, dep *dependency.Dep) *server {
+	if conf.MaxItemSize <= 0 {
+		conf.MaxItemSize = defaultMaxItemSize
+	}
+
+	if conf.LeaderAddress == nil {
+		conf.LeaderAddress = func() string { return "" }
+	}
+
+	s := &server{
+		dep:  dep,
+		conf: conf,
+	}
+
+	s.tcp = tcpserver.New(s.serveConn)
+	return s
+}
@@ -5,4 +5,53 @@ type CommandPayload struct {
 	Operation string
 	Key       string
 	Value     interface{}
+
+	// ExpireAt is the unix second when the key expires, used by SET and EXPIRE.
+	// It is computed by the leader before replicated, so every replica expire the key at the same time.
+	ExpireAt int64 `json:",omitempty"`
+
+	// Now is the unix second when the leader proposed the command, it is set by DoOperation.
+	// The FSM decide whether a key is expired at this time instead of its own clock, so a replica applying
+	// the log later see the same keys as the leader.
+	Now int64 `json:",omitempty"`
+
+	// Keys and Values is used by multi-key operation (DEL, EXISTS, MGET, MSET, PURGEEXPIRED).
+	Keys   []string      `json:",omitempty"`
+	Values []interface{} `json:",omitempty"`
+
+	// Member and Score is used by sorted set operation (ZADD, ZINCRBY, ZREM, ZRANK, ZSCORE).
+	// In ZINCRBY, Score is the increment.
+	Member string  `json:",omitempty"`
+	Score  float64 `json:",omitempty"`
+
+	// Start and Stop is the rank range used by ZRANGE.
+	// Start is also the first value of the sequence in SEQCREATE.
+	Start int64 `json:",omitempty"`
+	Stop  int64 `json:",omitempty"`
+
+	// ScoreMin and ScoreMax is the score range used by ZRANGEBYSCORE, nil means unbounded.
+	ScoreMin *float64 `json:",omitempty"`
+	ScoreMax *float64 `json:",omitempty"`
+
+	// Delta is the increment used by INCRBY, Min and Max is the optional inclusive bounds of the counter.
+	// Clamp saturate the counter to the bounds instead of rejecting the update,
+	// MustExist reject the update on missing key instead of starting from zero.
+	Delta     int64  `json:",omitempty"`
+	Min       *int64 `json:",omitempty"`
+	Max       *int64 `json:",omitempty"`
+	Clamp     bool   `json:",omitempty"`
+	MustExist bool   `json:",omitempty"`
+
+	// Count is the number of ID reserved by SEQRESERVE.
+	Count int64 `json:",omitempty"`
+
+	// Data, Raw, Flags and Revision is used by item operation (SET with Data, ADD, REPLACE, CAS, TOUCH, GETITEMS), see repo.Item.
+	// Data is written as is, Raw is true when it is not JSON.
+	Data     []byte `json:",omitempty"`
+	Raw      bool   `json:",omitempty"`
+	Flags    uint32 `json:",omitempty"`
+	Revision uint64 `json:",omitempty"`
+
+	// Offset is the last exported change used by CDCEXPORTED.
+	Offset uint64 `json:",omitempty"`
 }
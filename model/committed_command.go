@@ -0,0 +1,8 @@
+package model
+
+// CommittedCommand is a command in the raft log which is applied by the node, Data is the JSON CommandPayload.
+type CommittedCommand struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data"`
+}
@@ -0,0 +1,84 @@
+package multiraft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+	"ysf/canoe/shard"
+)
+
+// PathApply is the HTTP path of the group leader receiving forwarded operation, %s is the group id.
+const PathApply = "/shards/%s/apply"
+
+// knownErrors is returned as the same error value after forwarded, so the caller can still compare it
+var knownErrors = []error{
+	gossip.ErrNotLeader,
+	gossip.ErrDraining,
+	fsm.ErrKeyMoved,
+	fsm.ErrPartNotEmpty,
+	fsm.ErrShardMapVersion,
+	shard.ErrCrossShard,
+	fsm.ErrReadOnly,
+	repo.ErrKeyExists,
+	repo.ErrKeyNotFound,
+	repo.ErrRevisionMismatch,
+	repo.ErrNotInteger,
+	repo.ErrOverflow,
+}
+
+// forward send the operation to the group leader. The raft address is the HTTP address, because raft is multiplexed.
+// The response is the JSON value returned by the leader, number is decoded as json.Number.
+func (h *Host) forward(leader, id string, payload model.CommandPayload) (interface{}, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	url := "http://" + leader + fmt.Sprintf(PathApply, id)
+	resp, err := h.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("forward to shard group %s leader %s: %w", id, leader, err)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var msg string
+		if err := json.Unmarshal(data, &msg); err != nil {
+			msg = fmt.Sprintf("shard group %s leader %s return status %d", id, leader, resp.StatusCode)
+		}
+
+		return nil, errorOf(msg)
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func errorOf(msg string) error {
+	for _, err := range knownErrors {
+		if err.Error() == msg {
+			return err
+		}
+	}
+
+	return errors.New(msg)
+}
@@ -0,0 +1,727 @@
+// Package multiraft run the shard groups of the keyspace next to the default raft group.
+// The default group (the one started by the node itself) replicate the shard map, every node host every group,
+// and each group has its own raft log, FSM and Badger keyspace prefix in the shared Badger instance.
+package multiraft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"ysf/canoe/expiry"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/pkg/raftstream"
+	"ysf/canoe/repo"
+	"ysf/canoe/shard"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/hashicorp/raft"
+)
+
+const defaultInterval = 2 * time.Second
+
+var (
+	// ErrNotInitialized is returned when the shard map is not created yet, see Host.Init.
+	ErrNotInitialized = errors.New("sharding is not initialized")
+
+	// ErrHashNotEmpty is returned by Host.Init with hash strategy when the default group already has key.
+	// Every slot likely has key once data is written, so no slot could be given to a new group.
+	ErrHashNotEmpty = errors.New("hash sharding must be initialized before data is written, use range strategy")
+)
+
+// Config is used by New.
+type Config struct {
+	NodeID string
+
+	// RaftDir is the raft directory of the default group, group raft state is saved in RaftDir/groups/<id>
+	RaftDir string
+
+	// DB is shared by every group, each group save its data under its own prefix
+	DB *badger.DB
+
+	// Mux carry the raft traffic of every group on the same port as the default group and the HTTP API,
+	// so the raft address of the group is the HTTP address used to forward operation to its leader.
+	Mux *raftstream.Mux
+
+	// TLS, Tuning, LogStore and FSM is the same as the default group
+	TLS      *raftstream.TLSConfig
+	Tuning   gossip.TuningConfig
+	LogStore string
+	FSM      fsm.Options
+
+	// Expiry is used by the reaper of every group, see expiry.Reaper
+	Expiry expiry.Config
+
+	// Interval is how often the groups is reconciled with the shard map and the default group membership, default 2s
+	Interval time.Duration
+
+	// ForwardTimeout is the timeout of operation forwarded to the group leader, default 5s
+	ForwardTimeout time.Duration
+}
+
+// GroupStatus is the state of the group on this node.
+type GroupStatus struct {
+	ID           string `json:"id"`
+	Running      bool   `json:"running"`
+	State        string `json:"state,omitempty"`
+	Leader       string `json:"leader,omitempty"`
+	AppliedIndex string `json:"applied_index,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+}
+
+type group struct {
+	id      string
+	service gossip.Service
+	store   repo.Service
+	reaper  *expiry.Reaper
+}
+
+// Host run the shard groups of this node and route operation to the group owning the key.
+type Host struct {
+	conf     Config
+	meta     gossip.Service
+	metaRepo repo.Service
+	client   *http.Client
+
+	mu     sync.RWMutex
+	groups map[string]*group
+	errs   map[string]string
+
+	// cache of the last decoded shard map
+	cacheMu  sync.Mutex
+	cacheRaw []byte
+	cacheMap shard.Map
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New return Host using meta as the default group, metaRepo is its local repo which has the replicated shard map.
+func New(conf Config, meta gossip.Service, metaRepo repo.Service) (*Host, error) {
+	if conf.NodeID == "" {
+		return nil, fmt.Errorf("empty node id")
+	}
+
+	if conf.DB == nil || conf.Mux == nil {
+		return nil, fmt.Errorf("sharding need the badger instance and raft multiplexed on the HTTP port")
+	}
+
+	if conf.Interval <= 0 {
+		conf.Interval = defaultInterval
+	}
+
+	if conf.ForwardTimeout <= 0 {
+		conf.ForwardTimeout = 5 * time.Second
+	}
+
+	return &Host{
+		conf:     conf,
+		meta:     meta,
+		metaRepo: metaRepo,
+		client:   &http.Client{Timeout: conf.ForwardTimeout},
+		groups:   make(map[string]*group),
+		errs:     make(map[string]string),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start run the reconcile loop in background.
+func (h *Host) Start() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(h.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			h.reconcile()
+
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the reconcile loop and shut down every group.
+func (h *Host) Stop() {
+	close(h.stop)
+	h.wg.Wait()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, g := range h.groups {
+		g.reaper.Stop()
+		if err := g.service.Shutdown(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error shutdown shard group %s: %s\n", id, err.Error())
+		}
+		delete(h.groups, id)
+	}
+}
+
+// Map return the shard map replicated to this node, false when sharding is not initialized.
+func (h *Host) Map() (shard.Map, bool, error) {
+	data, err := h.metaRepo.ShardMap()
+	if err != nil || data == nil {
+		return shard.Map{}, false, err
+	}
+
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+
+	if string(data) == string(h.cacheRaw) {
+		return h.cacheMap, true, nil
+	}
+
+	var m shard.Map
+	if err := json.Unmarshal(data, &m); err != nil {
+		return shard.Map{}, false, fmt.Errorf("invalid shard map: %w", err)
+	}
+
+	h.cacheRaw, h.cacheMap = data, m
+	return m, true, nil
+}
+
+// Status return the state of every group known by this node, including the default group.
+func (h *Host) Status() []GroupStatus {
+	status := []GroupStatus{groupStatus(shard.DefaultGroup, h.meta)}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ids := make(map[string]bool)
+	for id := range h.groups {
+		ids[id] = true
+	}
+	for id := range h.errs {
+		ids[id] = true
+	}
+
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		s := GroupStatus{ID: id}
+		if g, ok := h.groups[id]; ok {
+			s = groupStatus(id, g.service)
+		}
+
+		s.LastError = h.errs[id]
+		status = append(status, s)
+	}
+
+	return status
+}
+
+func groupStatus(id string, service gossip.Service) GroupStatus {
+	stats := service.Stats()
+	return GroupStatus{
+		ID:           id,
+		Running:      true,
+		State:        stats["state"],
+		Leader:       service.Leader(),
+		AppliedIndex: stats["applied_index"],
+	}
+}
+
+// service return the raft of the group on this node, nil when it is not started.
+func (h *Host) service(id string) gossip.Service {
+	if id == shard.DefaultGroup {
+		return h.meta
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if g, ok := h.groups[id]; ok {
+		return g.service
+	}
+
+	return nil
+}
+
+// store return the local repo of the group.
+func (h *Host) store(id string) (repo.Service, error) {
+	if id == shard.DefaultGroup {
+		return h.metaRepo, nil
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if g, ok := h.groups[id]; ok {
+		return g.store, nil
+	}
+
+	return nil, fmt.Errorf("shard group %s is not running on this node", id)
+}
+
+// RepoFor return the local repo of the group owning the key, used by stale read.
+func (h *Host) RepoFor(key string) (repo.Service, error) {
+	m, ok, err := h.Map()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return h.metaRepo, nil
+	}
+
+	return h.store(m.Owner(key))
+}
+
+// reconcile start the group in the shard map which is not running yet,
+// and on the group leader, mirror the membership of the default group.
+func (h *Host) reconcile() {
+	m, ok, err := h.Map()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "error read shard map: %s\n", err.Error())
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	for _, g := range m.Groups {
+		if g.ID == shard.DefaultGroup {
+			continue
+		}
+
+		if h.service(g.ID) == nil {
+			h.startGroup(g)
+		}
+	}
+
+	members, err := h.meta.Members()
+	if err != nil {
+		return
+	}
+
+	h.mu.RLock()
+	running := make([]*group, 0, len(h.groups))
+	for _, g := range h.groups {
+		running = append(running, g)
+	}
+	h.mu.RUnlock()
+
+	for _, g := range running {
+		if g.service.IsLeader() {
+			h.syncMembers(g, members)
+		}
+	}
+}
+
+func (h *Host) setError(id string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err == nil {
+		delete(h.errs, id)
+		return
+	}
+
+	h.errs[id] = err.Error()
+}
+
+func (h *Host) startGroup(g shard.Group) {
+	dir := filepath.Join(h.conf.RaftDir, "groups", g.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		h.setError(g.ID, err)
+		return
+	}
+
+	store, err := repo.NewBadgerKeyspace(h.conf.DB, groupPrefix(g.ID))
+	if err != nil {
+		h.setError(g.ID, err)
+		return
+	}
+
+	layer, err := h.conf.Mux.GroupLayer(g.ID)
+	if err != nil {
+		h.setError(g.ID, err)
+		return
+	}
+
+	// the members listed in the map bootstrap the group, the other nodes is added later by the group leader
+	var servers []raft.Server
+	for _, member := range g.Members {
+		if member.ID == h.conf.NodeID {
+			servers = make([]raft.Server, 0, len(g.Members))
+			for _, m := range g.Members {
+				servers = append(servers, raft.Server{ID: raft.ServerID(m.ID), Address: raft.ServerAddress(m.Address)})
+			}
+			break
+		}
+	}
+
+	service, err := gossip.New(gossip.Config{
+		NodeID:         h.conf.NodeID,
+		RaftDir:        dir,
+		InitialServers: servers,
+		TLS:            h.conf.TLS,
+		Stream:         layer,
+		LogStore:       h.conf.LogStore,
+		FSM:            h.conf.FSM,
+		Tuning:         h.conf.Tuning,
+	}, store)
+	if err != nil {
+		_ = layer.Close()
+		h.setError(g.ID, err)
+		_, _ = fmt.Fprintf(os.Stderr, "error start shard group %s: %s\n", g.ID, err.Error())
+		return
+	}
+
+	reaper := expiry.NewReaper(h.conf.Expiry, service, store)
+	reaper.Start()
+
+	h.mu.Lock()
+	h.groups[g.ID] = &group{id: g.ID, service: service, store: store, reaper: reaper}
+	delete(h.errs, g.ID)
+	h.mu.Unlock()
+
+	fmt.Printf("shard group %s started in %s\n", g.ID, dir)
+}
+
+// syncMembers add the node of the default group which is not in the group, and remove the node which left it.
+// The suffrage follows the default group, so the group has the same fault tolerance.
+func (h *Host) syncMembers(g *group, metaMembers []gossip.Member) {
+	current, err := g.service.Members()
+	if err != nil {
+		return
+	}
+
+	known := make(map[string]gossip.Member)
+	for _, m := range current {
+		known[m.ID] = m
+	}
+
+	wanted := make(map[string]bool)
+	for _, m := range metaMembers {
+		wanted[m.ID] = true
+		suffrage := gossip.SuffrageNonvoter
+		if m.Suffrage == raft.Voter.String() {
+			suffrage = gossip.SuffrageVoter
+		}
+
+		existing, ok := known[m.ID]
+		switch {
+		case !ok:
+			err = g.service.Join(m.ID, m.Address, suffrage)
+		case existing.Suffrage != m.Suffrage && suffrage == gossip.SuffrageVoter:
+			err = g.service.Promote(m.ID, false)
+		case existing.Suffrage != m.Suffrage:
+			err = g.service.Demote(m.ID, false)
+		}
+
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error sync node %s to shard group %s: %s\n", m.ID, g.id, err.Error())
+			err = nil
+		}
+	}
+
+	for _, m := range current {
+		if !wanted[m.ID] {
+			if err := g.service.Remove(m.ID, false); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error remove node %s from shard group %s: %s\n", m.ID, g.id, err.Error())
+			}
+		}
+	}
+}
+
+// groupPrefix is the keyspace of the group in the shared Badger instance
+func groupPrefix(id string) string {
+	return repo.KeyspacePrefix + id + "/"
+}
+
+// Init create the first shard map, the default group owns the whole keyspace. It must be run on the leader.
+// Hash strategy is refused when the default group has key, see ErrHashNotEmpty.
+func (h *Host) Init(strategy string) (shard.Map, error) {
+	if _, ok, err := h.Map(); err != nil || ok {
+		if err == nil {
+			err = fmt.Errorf("sharding is already initialized")
+		}
+		return shard.Map{}, err
+	}
+
+	if strategy == shard.StrategyHash {
+		if err := checkEmpty(h.metaRepo, shard.Part{Slots: []shard.SlotRange{{Start: 0, End: shard.Slots - 1}}}); err != nil {
+			if err == fsm.ErrPartNotEmpty {
+				err = ErrHashNotEmpty
+			}
+			return shard.Map{}, err
+		}
+	}
+
+	m, err := shard.NewMap(strategy)
+	if err != nil {
+		return shard.Map{}, err
+	}
+
+	if err := h.updateMap(0, m); err != nil {
+		return shard.Map{}, err
+	}
+
+	return m, nil
+}
+
+// AddGroup create the group owning the part, the members is the voters of the default group.
+// The part must have no key yet. It is checked in the local replica of each previous owner before the part is fenced,
+// and again once the replica applied the fence, when no key can be added anymore. The part is unfenced when it has key.
+// It must be run on the leader.
+func (h *Host) AddGroup(id string, part shard.Part) (shard.Map, error) {
+	if !h.meta.IsLeader() {
+		return shard.Map{}, gossip.ErrNotLeader
+	}
+
+	m, ok, err := h.Map()
+	if err != nil {
+		return shard.Map{}, err
+	}
+
+	if !ok {
+		return shard.Map{}, ErrNotInitialized
+	}
+
+	metaMembers, err := h.meta.Members()
+	if err != nil {
+		return shard.Map{}, err
+	}
+
+	members := make([]shard.Member, 0, len(metaMembers))
+	for _, member := range metaMembers {
+		if member.Suffrage == raft.Voter.String() {
+			members = append(members, shard.Member{ID: member.ID, Address: member.Address})
+		}
+	}
+
+	next, released, err := m.AddGroup(id, members, part)
+	if err != nil {
+		return shard.Map{}, err
+	}
+
+	for owner, p := range released {
+		store, err := h.store(owner)
+		if err != nil {
+			return shard.Map{}, err
+		}
+
+		if err := checkEmpty(store, p); err != nil {
+			return shard.Map{}, fmt.Errorf("group %s: %w", owner, err)
+		}
+	}
+
+	fenced := make([]string, 0, len(released))
+	unfence := func() {
+		for _, owner := range fenced {
+			if _, err := h.fence(owner, fsm.OpShardUnfence, released[owner]); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "error unfence shard group %s: %s\n", owner, err.Error())
+			}
+		}
+	}
+
+	for owner, p := range released {
+		resp, err := h.fence(owner, fsm.OpShardFence, p)
+		if err != nil {
+			unfence()
+			return shard.Map{}, fmt.Errorf("group %s: %w", owner, err)
+		}
+
+		fenced = append(fenced, owner)
+		if err := h.checkFenced(owner, p, resp); err != nil {
+			unfence()
+			return shard.Map{}, fmt.Errorf("group %s: %w", owner, err)
+		}
+	}
+
+	if err := h.updateMap(m.Version, next); err != nil {
+		unfence()
+		return shard.Map{}, err
+	}
+
+	return next, nil
+}
+
+func (h *Host) fence(owner, op string, part shard.Part) (interface{}, error) {
+	data, err := json.Marshal(part)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.DoGroup(owner, model.CommandPayload{Operation: op, Data: data})
+}
+
+// checkFenced wait for the local replica of the owner to apply the fence, then check the part has no key.
+func (h *Host) checkFenced(owner string, part shard.Part, resp interface{}) error {
+	var result fsm.FenceResult
+	if err := decodeResult(resp, &result); err != nil {
+		return err
+	}
+
+	store, err := h.store(owner)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(h.conf.ForwardTimeout)
+	for {
+		applied, err := store.AppliedIndex()
+		if err != nil {
+			return err
+		}
+
+		if applied >= result.Index {
+			return checkEmpty(store, part)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for the fence at index %d, applied %d", result.Index, applied)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// checkEmpty return fsm.ErrPartNotEmpty when the store has key in the part. It scans the store outside of raft apply.
+func checkEmpty(store repo.Service, part shard.Part) error {
+	var found bool
+	err := store.ForEachKey(func(key string) bool {
+		found = part.Contains(key)
+		return !found
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return fsm.ErrPartNotEmpty
+	}
+
+	return nil
+}
+
+// decodeResult convert the response of the operation, which is a JSON value when it is forwarded, to out.
+func decodeResult(result, out interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func (h *Host) updateMap(version uint64, next shard.Map) error {
+	if !h.meta.IsLeader() {
+		return gossip.ErrNotLeader
+	}
+
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.meta.DoOperation(model.CommandPayload{
+		Operation: fsm.OpShardMap,
+		Data:      data,
+		Revision:  version,
+	})
+
+	return err
+}
+
+// keysOf return the keys used by the operation
+func keysOf(payload model.CommandPayload) []string {
+	if len(payload.Keys) > 0 {
+		return payload.Keys
+	}
+
+	return []string{payload.Key}
+}
+
+// Route return the group owning every key used by the operation.
+func (h *Host) Route(payload model.CommandPayload) (string, error) {
+	m, ok, err := h.Map()
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return shard.DefaultGroup, nil
+	}
+
+	return m.OwnerOf(keysOf(payload)...)
+}
+
+// DoOperation run the operation in the group owning the keys, on this node when it is the group leader,
+// otherwise it is forwarded to the group leader.
+func (h *Host) DoOperation(payload model.CommandPayload) (interface{}, error) {
+	id, err := h.Route(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.DoGroup(id, payload)
+}
+
+// DoGroup run the operation in the group, forwarding it to the leader when this node is not the group leader.
+func (h *Host) DoGroup(id string, payload model.CommandPayload) (interface{}, error) {
+	service := h.service(id)
+	if service != nil && service.IsLeader() {
+		return service.DoOperation(payload)
+	}
+
+	leader := ""
+	if service != nil {
+		leader = service.Leader()
+	}
+
+	if leader == "" {
+		return nil, fmt.Errorf("shard group %s has no leader on this node", id)
+	}
+
+	return h.forward(leader, id, payload)
+}
+
+// ApplyLocal run the operation forwarded by other node, it is never forwarded again.
+// Data operation is refused when the key is not owned by the group in the shard map of this node.
+func (h *Host) ApplyLocal(id string, payload model.CommandPayload) (interface{}, error) {
+	service := h.service(id)
+	if service == nil {
+		return nil, fmt.Errorf("shard group %s is not running on this node", id)
+	}
+
+	if !service.IsLeader() {
+		return nil, gossip.ErrNotLeader
+	}
+
+	switch strings.ToUpper(payload.Operation) {
+	case fsm.OpShardMap, fsm.OpShardFence, fsm.OpShardUnfence:
+	default:
+		owner, err := h.Route(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if owner != id {
+			return nil, fsm.ErrKeyMoved
+		}
+	}
+
+	return service.DoOperation(payload)
+}
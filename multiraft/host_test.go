@@ -0,0 +1,186 @@
+package multiraft_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/multiraft"
+	"ysf/canoe/pkg/raftstream"
+	"ysf/canoe/repo"
+	"ysf/canoe/shard"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var tuning = gossip.TuningConfig{
+	HeartbeatTimeout:   100 * time.Millisecond,
+	ElectionTimeout:    100 * time.Millisecond,
+	LeaderLeaseTimeout: 100 * time.Millisecond,
+	CommitTimeout:      5 * time.Millisecond,
+}
+
+// newHost start single node with the default group bootstrapped, raft is multiplexed on one listener
+func newHost(t *testing.T) (*multiraft.Host, gossip.Service, repo.Service) {
+	dir, err := ioutil.TempDir("", "multiraft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := raftstream.NewMux(ln, nil, time.Second)
+	go func() {
+		_ = mux.Serve()
+	}()
+	t.Cleanup(func() { _ = mux.Close() })
+
+	metaRepo, _ := repo.NewBadger(db)
+	meta, err := gossip.New(gossip.Config{
+		NodeID:    "node_1",
+		RaftDir:   dir,
+		Bootstrap: true,
+		Stream:    mux.RaftLayer(),
+		Tuning:    tuning,
+		LogStore:  gossip.LogStoreBadger,
+	}, metaRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = meta.Shutdown() })
+
+	host, err := multiraft.New(multiraft.Config{
+		NodeID:   "node_1",
+		RaftDir:  dir,
+		DB:       db,
+		Mux:      mux,
+		Tuning:   tuning,
+		LogStore: gossip.LogStoreBadger,
+		Interval: 50 * time.Millisecond,
+	}, meta, metaRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host.Start()
+	t.Cleanup(host.Stop)
+
+	waitFor(t, meta.IsLeader)
+	return host, meta, metaRepo
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the condition")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestHost(t *testing.T) {
+	host, meta, metaRepo := newHost(t)
+
+	set := func(key string) error {
+		_, err := host.DoOperation(model.CommandPayload{Operation: "SET", Key: key, Value: key})
+		return err
+	}
+
+	convey.Convey("Sharding the keyspace by range", t, func() {
+		convey.Convey("Before init every key is in the default group", func() {
+			convey.So(set("apple"), convey.ShouldBeNil)
+			convey.So(metaRepo.Get("apple"), convey.ShouldEqual, "apple")
+
+			_, err := host.AddGroup("users", shard.Part{})
+			convey.So(err, convey.ShouldEqual, multiraft.ErrNotInitialized)
+		})
+
+		convey.Convey("Hash strategy is refused once data is written", func() {
+			_, err := host.Init(shard.StrategyHash)
+			convey.So(err, convey.ShouldEqual, multiraft.ErrHashNotEmpty)
+
+			_, ok, _ := host.Map()
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("Init create the first map", func() {
+			m, err := host.Init(shard.StrategyRange)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(m.Version, convey.ShouldEqual, 1)
+
+			_, err = host.Init(shard.StrategyRange)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("New group own the empty range and start", func() {
+			m, err := host.AddGroup("users", shard.Part{Ranges: []shard.KeyRange{{Start: "user:", End: "user;"}}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(m.Version, convey.ShouldEqual, 2)
+
+			waitFor(t, func() bool {
+				for _, s := range host.Status() {
+					if s.ID == "users" && s.State == "Leader" {
+						return true
+					}
+				}
+				return false
+			})
+		})
+
+		convey.Convey("Key is written to the owning group", func() {
+			convey.So(set("user:1"), convey.ShouldBeNil)
+
+			users, err := host.RepoFor("user:1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(users.Get("user:1"), convey.ShouldEqual, "user:1")
+
+			has, _ := metaRepo.Has("user:1")
+			convey.So(has, convey.ShouldBeFalse)
+
+			// existing data in the default group is not disturbed
+			convey.So(metaRepo.Get("apple"), convey.ShouldEqual, "apple")
+		})
+
+		convey.Convey("Default group refuse the moved key", func() {
+			_, err := meta.DoOperation(model.CommandPayload{Operation: "SET", Key: "user:2", Value: "x"})
+			convey.So(err, convey.ShouldEqual, fsm.ErrKeyMoved)
+		})
+
+		convey.Convey("Range with existing key can not be moved", func() {
+			_, err := host.AddGroup("fruits", shard.Part{Ranges: []shard.KeyRange{{Start: "a", End: "b"}}})
+			convey.So(errors.Is(err, fsm.ErrPartNotEmpty), convey.ShouldBeTrue)
+
+			m, _, _ := host.Map()
+			convey.So(m.Version, convey.ShouldEqual, 2)
+
+			// the range is served again after the failed move
+			convey.So(set("avocado"), convey.ShouldBeNil)
+		})
+
+		convey.Convey("Multi key operation across groups is refused", func() {
+			_, err := host.DoOperation(model.CommandPayload{
+				Operation: fsm.OpMSet,
+				Keys:      []string{"apple", "user:1"},
+				Values:    []interface{}{"a", "b"},
+			})
+			convey.So(err, convey.ShouldEqual, shard.ErrCrossShard)
+		})
+	})
+}
@@ -0,0 +1,54 @@
+package raftbadger
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// logHeaderSize is index, term, type, and the length of data and extensions
+const logHeaderSize = 8 + 8 + 1 + 4 + 4
+
+// encodeLog write the log as fixed size header followed by data and extensions
+func encodeLog(log *raft.Log) []byte {
+	b := make([]byte, logHeaderSize+len(log.Data)+len(log.Extensions))
+	binary.BigEndian.PutUint64(b[0:8], log.Index)
+	binary.BigEndian.PutUint64(b[8:16], log.Term)
+	b[16] = byte(log.Type)
+	binary.BigEndian.PutUint32(b[17:21], uint32(len(log.Data)))
+	binary.BigEndian.PutUint32(b[21:25], uint32(len(log.Extensions)))
+
+	n := copy(b[logHeaderSize:], log.Data)
+	copy(b[logHeaderSize+n:], log.Extensions)
+	return b
+}
+
+// decodeLog copy the value into log, because the value is only valid inside the transaction
+func decodeLog(b []byte, log *raft.Log) error {
+	if len(b) < logHeaderSize {
+		return fmt.Errorf("invalid log: %d bytes", len(b))
+	}
+
+	dataLen := int(binary.BigEndian.Uint32(b[17:21]))
+	extLen := int(binary.BigEndian.Uint32(b[21:25]))
+	if len(b) != logHeaderSize+dataLen+extLen {
+		return fmt.Errorf("invalid log: %d bytes, expected %d", len(b), logHeaderSize+dataLen+extLen)
+	}
+
+	log.Index = binary.BigEndian.Uint64(b[0:8])
+	log.Term = binary.BigEndian.Uint64(b[8:16])
+	log.Type = raft.LogType(b[16])
+	log.Data = nil
+	log.Extensions = nil
+
+	if dataLen > 0 {
+		log.Data = append([]byte{}, b[logHeaderSize:logHeaderSize+dataLen]...)
+	}
+
+	if extLen > 0 {
+		log.Extensions = append([]byte{}, b[logHeaderSize+dataLen:]...)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package raftbadger
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// migrateBatch is the number of logs copied in one StoreLogs
+const migrateBatch = 1024
+
+// The keys saved by raft in the StableStore, raft does not export them
+// https://github.com/hashicorp/raft/blob/v1.1.2/raft.go#L21-L25
+var (
+	stableUint64Keys = [][]byte{[]byte("CurrentTerm"), []byte("LastVoteTerm")}
+	stableBytesKeys  = [][]byte{[]byte("LastVoteCand")}
+)
+
+// Source is the store to be migrated, for example raftboltdb.BoltStore.
+type Source interface {
+	raft.LogStore
+	raft.StableStore
+}
+
+// MigrateResult is the number of logs and stable keys copied.
+type MigrateResult struct {
+	FirstIndex uint64
+	LastIndex  uint64
+	Logs       int
+	StableKeys int
+}
+
+// Migrate copy the raft stable keys and the logs from src into dst, dst must be empty.
+// The node must be stopped, so src is not changed while copying. The stable keys is copied first, so dst never has
+// log without the current term, but interrupted migration still leave partial logs, see gossip.MigrateLogStore.
+func Migrate(src Source, dst *Store) (result MigrateResult, err error) {
+	dstLast, err := dst.LastIndex()
+	if err != nil {
+		return result, err
+	}
+
+	if dstLast != 0 {
+		return result, fmt.Errorf("destination already has log until index %d", dstLast)
+	}
+
+	if result.FirstIndex, err = src.FirstIndex(); err != nil {
+		return result, err
+	}
+
+	if result.LastIndex, err = src.LastIndex(); err != nil {
+		return result, err
+	}
+
+	for _, key := range stableUint64Keys {
+		val, err := src.GetUint64(key)
+		if isNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		if err = dst.SetUint64(key, val); err != nil {
+			return result, err
+		}
+
+		result.StableKeys++
+	}
+
+	for _, key := range stableBytesKeys {
+		val, err := src.Get(key)
+		if isNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		if err = dst.Set(key, val); err != nil {
+			return result, err
+		}
+
+		result.StableKeys++
+	}
+
+	batch := make([]*raft.Log, 0, migrateBatch)
+	for index := result.FirstIndex; index != 0 && index <= result.LastIndex; index++ {
+		log := new(raft.Log)
+		if err = src.GetLog(index, log); err != nil {
+			return result, fmt.Errorf("get log %d: %w", index, err)
+		}
+
+		batch = append(batch, log)
+		if len(batch) < migrateBatch && index < result.LastIndex {
+			continue
+		}
+
+		if err = dst.StoreLogs(batch); err != nil {
+			return result, err
+		}
+
+		result.Logs += len(batch)
+		batch = batch[:0]
+	}
+
+	return result, nil
+}
+
+// isNotFound compare the message, because each store has its own error value
+func isNotFound(err error) bool {
+	return err != nil && err.Error() == ErrKeyNotFound.Error()
+}
@@ -0,0 +1,304 @@
+// Package raftbadger implement raft.LogStore and raft.StableStore on top of BadgerDB.
+package raftbadger
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/hashicorp/raft"
+)
+
+// ErrKeyNotFound is returned by Get of StableStore, raft check the "not found" message when the node start first time.
+var ErrKeyNotFound = errors.New("not found")
+
+var (
+	prefixLog    = []byte("l/")
+	prefixStable = []byte("s/")
+)
+
+// gcInterval is the interval of value log garbage collection of the store opened by Open
+const gcInterval = 5 * time.Minute
+
+// Store is raft.LogStore and raft.StableStore. The log key is the big endian index,
+// so the logs is iterated in order and removed by range without reading the value.
+type Store struct {
+	db     *badger.DB
+	prefix []byte
+
+	// owned is true when the db is opened by Open, so it is closed by Close
+	owned     bool
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+var _ raft.LogStore = (*Store)(nil)
+var _ raft.StableStore = (*Store)(nil)
+
+// Open the BadgerDB in dir used only by this store.
+func Open(dir string) (*Store, error) {
+	opt := badger.DefaultOptions(dir)
+	opt.SyncWrites = true
+	opt.Logger = nil
+
+	db, err := badger.Open(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newStore(db, nil)
+	s.owned = true
+
+	s.wg.Add(1)
+	go s.gcLoop()
+
+	return s, nil
+}
+
+// New use the keyspace prefix of the db, so the raft log can be saved next to other data.
+// The db is not closed by Close.
+func New(db *badger.DB, prefix []byte) *Store {
+	return newStore(db, prefix)
+}
+
+func newStore(db *badger.DB, prefix []byte) *Store {
+	return &Store{
+		db:      db,
+		prefix:  append([]byte{}, prefix...),
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Close the db when it is opened by Open.
+func (s *Store) Close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+		s.wg.Wait()
+
+		if s.owned {
+			err = s.db.Close()
+		}
+	})
+
+	return
+}
+
+// gcLoop reclaim the value log space of deleted logs
+func (s *Store) gcLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		for s.db.RunValueLogGC(0.5) == nil {
+		}
+	}
+}
+
+func (s *Store) logPrefix() []byte {
+	return append(append([]byte{}, s.prefix...), prefixLog...)
+}
+
+func (s *Store) logKey(index uint64) []byte {
+	key := s.logPrefix()
+	return append(key, uint64ToBytes(index)...)
+}
+
+func (s *Store) stableKey(key []byte) []byte {
+	k := append(append([]byte{}, s.prefix...), prefixStable...)
+	return append(k, key...)
+}
+
+// FirstIndex implements the raft.LogStore interface, it return 0 when there is no log.
+func (s *Store) FirstIndex() (uint64, error) {
+	return s.edgeIndex(false)
+}
+
+// LastIndex implements the raft.LogStore interface, it return 0 when there is no log.
+func (s *Store) LastIndex() (uint64, error) {
+	return s.edgeIndex(true)
+}
+
+func (s *Store) edgeIndex(reverse bool) (index uint64, err error) {
+	prefix := s.logPrefix()
+
+	err = s.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Reverse = reverse
+		opt.Prefix = prefix
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		seek := prefix
+		if reverse {
+			// seek to the last key having the prefix
+			seek = append(s.logKey(math.MaxUint64), 0xFF)
+		}
+
+		it.Seek(seek)
+		if !it.ValidForPrefix(prefix) {
+			return nil
+		}
+
+		index = bytesToUint64(it.Item().Key()[len(prefix):])
+		return nil
+	})
+
+	return
+}
+
+// GetLog implements the raft.LogStore interface.
+func (s *Store) GetLog(index uint64, log *raft.Log) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(s.logKey(index))
+		if err == badger.ErrKeyNotFound {
+			return raft.ErrLogNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return decodeLog(val, log)
+		})
+	})
+}
+
+// StoreLog implements the raft.LogStore interface.
+func (s *Store) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs implements the raft.LogStore interface. Large batch is split into several transaction.
+func (s *Store) StoreLogs(logs []*raft.Log) error {
+	txn := s.db.NewTransaction(true)
+	defer func() {
+		txn.Discard()
+	}()
+
+	for _, log := range logs {
+		key, val := s.logKey(log.Index), encodeLog(log)
+
+		err := txn.Set(key, val)
+		if err == badger.ErrTxnTooBig {
+			if err = txn.Commit(); err != nil {
+				return err
+			}
+
+			txn = s.db.NewTransaction(true)
+			err = txn.Set(key, val)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+// DeleteRange implements the raft.LogStore interface, min and max is inclusive.
+// Only the keys is iterated, the value is never read.
+func (s *Store) DeleteRange(min, max uint64) error {
+	prefix := s.logPrefix()
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Prefix = prefix
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		for it.Seek(s.logKey(min)); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if bytesToUint64(key[len(prefix):]) > max {
+				break
+			}
+
+			if err := wb.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return wb.Flush()
+}
+
+// Set implements the raft.StableStore interface.
+func (s *Store) Set(key []byte, val []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(s.stableKey(key), val)
+	})
+}
+
+// Get implements the raft.StableStore interface, it return ErrKeyNotFound when the key is not set.
+func (s *Store) Get(key []byte) (val []byte, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(s.stableKey(key))
+		if err == badger.ErrKeyNotFound {
+			return ErrKeyNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+
+	return
+}
+
+// SetUint64 implements the raft.StableStore interface.
+func (s *Store) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, uint64ToBytes(val))
+}
+
+// GetUint64 implements the raft.StableStore interface.
+func (s *Store) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(val) != 8 {
+		return 0, fmt.Errorf("invalid uint64 value of key %s", string(key))
+	}
+
+	return bytesToUint64(val), nil
+}
+
+func uint64ToBytes(u uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, u)
+	return b
+}
+
+func bytesToUint64(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,169 @@
+package raftbadger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "raftbadger")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store, func() {
+		_ = store.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func testLogs(first, last uint64) []*raft.Log {
+	logs := make([]*raft.Log, 0)
+	for i := first; i <= last; i++ {
+		logs = append(logs, &raft.Log{
+			Index: i,
+			Term:  1,
+			Type:  raft.LogCommand,
+			Data:  []byte{byte(i)},
+		})
+	}
+
+	return logs
+}
+
+func TestStore(t *testing.T) {
+	convey.Convey("Log store", t, func() {
+		store, cleanup := newTestStore(t)
+		defer cleanup()
+
+		first, err := store.FirstIndex()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(first, convey.ShouldEqual, 0)
+
+		convey.So(store.StoreLogs(testLogs(1, 300)), convey.ShouldBeNil)
+
+		convey.Convey("First and last index should follow the stored logs", func() {
+			first, _ := store.FirstIndex()
+			last, _ := store.LastIndex()
+			convey.So(first, convey.ShouldEqual, 1)
+			convey.So(last, convey.ShouldEqual, 300)
+
+			var log raft.Log
+			convey.So(store.GetLog(256, &log), convey.ShouldBeNil)
+			convey.So(log.Index, convey.ShouldEqual, 256)
+			convey.So(log.Type, convey.ShouldEqual, raft.LogCommand)
+			convey.So(log.Data, convey.ShouldResemble, []byte{0})
+
+			convey.So(store.GetLog(301, &log), convey.ShouldEqual, raft.ErrLogNotFound)
+		})
+
+		convey.Convey("Delete range should remove inclusive range", func() {
+			convey.So(store.DeleteRange(1, 100), convey.ShouldBeNil)
+
+			first, _ := store.FirstIndex()
+			last, _ := store.LastIndex()
+			convey.So(first, convey.ShouldEqual, 101)
+			convey.So(last, convey.ShouldEqual, 300)
+
+			var log raft.Log
+			convey.So(store.GetLog(100, &log), convey.ShouldEqual, raft.ErrLogNotFound)
+
+			// conflicting suffix is removed by the follower
+			convey.So(store.DeleteRange(250, 300), convey.ShouldBeNil)
+			last, _ = store.LastIndex()
+			convey.So(last, convey.ShouldEqual, 249)
+		})
+	})
+
+	convey.Convey("Stable store", t, func() {
+		store, cleanup := newTestStore(t)
+		defer cleanup()
+
+		_, err := store.GetUint64([]byte("CurrentTerm"))
+		convey.So(err, convey.ShouldEqual, ErrKeyNotFound)
+
+		convey.So(store.SetUint64([]byte("CurrentTerm"), 7), convey.ShouldBeNil)
+		term, err := store.GetUint64([]byte("CurrentTerm"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(term, convey.ShouldEqual, 7)
+
+		convey.So(store.Set([]byte("LastVoteCand"), []byte("node_1")), convey.ShouldBeNil)
+		val, err := store.Get([]byte("LastVoteCand"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(string(val), convey.ShouldEqual, "node_1")
+
+		// stable key does not collide with log
+		first, _ := store.FirstIndex()
+		convey.So(first, convey.ShouldEqual, 0)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	convey.Convey("Migrate copy logs and stable keys", t, func() {
+		src := raft.NewInmemStore()
+		_ = src.StoreLogs(testLogs(5, 2100))
+		_ = src.SetUint64([]byte("CurrentTerm"), 3)
+		_ = src.SetUint64([]byte("LastVoteTerm"), 3)
+		_ = src.Set([]byte("LastVoteCand"), []byte("node_2"))
+
+		dst, cleanup := newTestStore(t)
+		defer cleanup()
+
+		result, err := Migrate(src, dst)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(result.Logs, convey.ShouldEqual, 2096)
+		convey.So(result.StableKeys, convey.ShouldEqual, 3)
+
+		first, _ := dst.FirstIndex()
+		last, _ := dst.LastIndex()
+		convey.So(first, convey.ShouldEqual, 5)
+		convey.So(last, convey.ShouldEqual, 2100)
+
+		term, _ := dst.GetUint64([]byte("CurrentTerm"))
+		convey.So(term, convey.ShouldEqual, 3)
+
+		convey.Convey("Destination which has log is refused", func() {
+			_, err := Migrate(src, dst)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+
+	convey.Convey("Stable keys is copied before the logs", t, func() {
+		src := raft.NewInmemStore()
+		_ = src.StoreLogs(testLogs(1, 10))
+		_ = src.SetUint64([]byte("CurrentTerm"), 3)
+
+		dst, cleanup := newTestStore(t)
+		defer cleanup()
+
+		_, err := Migrate(failingSource{InmemStore: src, failAt: 5}, dst)
+		convey.So(err, convey.ShouldNotBeNil)
+
+		term, _ := dst.GetUint64([]byte("CurrentTerm"))
+		convey.So(term, convey.ShouldEqual, 3)
+	})
+}
+
+// failingSource fail to read the log at failAt, like the migration interrupted in the middle
+type failingSource struct {
+	*raft.InmemStore
+	failAt uint64
+}
+
+func (s failingSource) GetLog(index uint64, log *raft.Log) error {
+	if index == s.failAt {
+		return fmt.Errorf("read log %d failed", index)
+	}
+
+	return s.InmemStore.GetLog(index, log)
+}
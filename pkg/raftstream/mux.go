@@ -0,0 +1,298 @@
+package raftstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// RaftHeader is the first byte written by raft connection dialed through Mux.
+// It is not a valid first byte of HTTP request (method name) nor TLS handshake.
+const RaftHeader byte = 0xCA
+
+// RaftGroupHeader is the first byte written by connection of the raft group dialed through Mux,
+// it is followed by the length of the group id and the id itself.
+const RaftGroupHeader byte = 0xCB
+
+// ErrMuxClosed is returned by Accept of closed listener.
+var ErrMuxClosed = errors.New("mux listener is closed")
+
+// Mux split the connections of one listener by the first byte, so raft and HTTP can share the same port.
+// Connection starting with RaftHeader is raft, the others is HTTP.
+type Mux struct {
+	listener  net.Listener
+	advertise net.Addr
+	timeout   time.Duration
+
+	http *muxListener
+	raft *muxListener
+
+	mu     sync.Mutex
+	groups map[string]*muxListener
+	closed bool
+}
+
+// NewMux use the listener for both raft and HTTP. When advertise is nil, the listener address is advertised.
+// Timeout is the maximum time to wait the first byte of new connection, default is 30 seconds.
+func NewMux(ln net.Listener, advertise net.Addr, timeout time.Duration) *Mux {
+	if advertise == nil {
+		advertise = ln.Addr()
+	}
+
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &Mux{
+		listener:  ln,
+		advertise: advertise,
+		timeout:   timeout,
+		http:      newMuxListener(advertise),
+		raft:      newMuxListener(advertise),
+		groups:    make(map[string]*muxListener),
+	}
+}
+
+// HTTPListener return listener of connection which is not raft, pass it to the HTTP server.
+func (m *Mux) HTTPListener() net.Listener {
+	return m.http
+}
+
+// RaftLayer return raft.StreamLayer of raft connection.
+func (m *Mux) RaftLayer() raft.StreamLayer {
+	return &muxRaftLayer{muxListener: m.raft}
+}
+
+// GroupLayer return raft.StreamLayer of the raft group with the id, so several raft groups share the port.
+// The layer is removed from the Mux when it is closed.
+func (m *Mux) GroupLayer(id string) (raft.StreamLayer, error) {
+	if id == "" || len(id) > 255 {
+		return nil, fmt.Errorf("invalid raft group id %q", id)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrMuxClosed
+	}
+
+	if _, ok := m.groups[id]; ok {
+		return nil, fmt.Errorf("raft group %s is already registered", id)
+	}
+
+	ln := newMuxListener(m.advertise)
+	m.groups[id] = ln
+
+	return &muxGroupLayer{muxListener: ln, mux: m, id: id}, nil
+}
+
+// Serve accept connection until the listener is closed.
+func (m *Mux) Serve() error {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			_ = m.http.Close()
+			_ = m.raft.Close()
+
+			m.mu.Lock()
+			m.closed = true
+			for _, ln := range m.groups {
+				_ = ln.Close()
+			}
+			m.mu.Unlock()
+
+			return err
+		}
+
+		go m.route(conn)
+	}
+}
+
+// Close stop accepting new connection, both raft and HTTP.
+func (m *Mux) Close() error {
+	return m.listener.Close()
+}
+
+func (m *Mux) route(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(m.timeout))
+
+	first := make([]byte, 1)
+	if _, err := conn.Read(first); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	if first[0] == RaftGroupHeader {
+		m.routeGroup(conn)
+		return
+	}
+
+	_ = conn.SetReadDeadline(time.Time{})
+
+	if first[0] == RaftHeader {
+		m.raft.deliver(conn)
+		return
+	}
+
+	m.http.deliver(&peekedConn{Conn: conn, peeked: first})
+}
+
+// routeGroup read the group id and deliver the connection to its layer, connection of unknown group is closed.
+func (m *Mux) routeGroup(conn net.Conn) {
+	size := make([]byte, 1)
+	if _, err := io.ReadFull(conn, size); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	id := make([]byte, size[0])
+	if _, err := io.ReadFull(conn, id); err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	_ = conn.SetReadDeadline(time.Time{})
+
+	m.mu.Lock()
+	ln, ok := m.groups[string(id)]
+	m.mu.Unlock()
+
+	if !ok {
+		_ = conn.Close()
+		return
+	}
+
+	ln.deliver(conn)
+}
+
+// peekedConn return the peeked byte before reading the connection
+type peekedConn struct {
+	net.Conn
+	peeked []byte
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(b, c.peeked)
+		c.peeked = c.peeked[n:]
+		return n, nil
+	}
+
+	return c.Conn.Read(b)
+}
+
+type muxListener struct {
+	addr   net.Addr
+	connCh chan net.Conn
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+func newMuxListener(addr net.Addr) *muxListener {
+	return &muxListener{
+		addr:    addr,
+		connCh:  make(chan net.Conn),
+		closeCh: make(chan struct{}),
+	}
+}
+
+func (l *muxListener) deliver(conn net.Conn) {
+	select {
+	case l.connCh <- conn:
+	case <-l.closeCh:
+		_ = conn.Close()
+	}
+}
+
+// Accept implements the net.Listener interface.
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case <-l.closeCh:
+		return nil, ErrMuxClosed
+	}
+}
+
+// Close implements the net.Listener interface, it does not close the shared listener.
+func (l *muxListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closeCh)
+	})
+
+	return nil
+}
+
+// Addr implements the net.Listener interface.
+func (l *muxListener) Addr() net.Addr {
+	return l.addr
+}
+
+type muxRaftLayer struct {
+	*muxListener
+}
+
+// Dial implements the raft.StreamLayer interface, it write RaftHeader so the peer Mux route it to raft.
+func (l *muxRaftLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", string(address), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte{RaftHeader}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+
+	return conn, nil
+}
+
+type muxGroupLayer struct {
+	*muxListener
+	mux *Mux
+	id  string
+}
+
+// Dial implements the raft.StreamLayer interface, it write RaftGroupHeader and the group id.
+func (l *muxGroupLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", string(address), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{RaftGroupHeader, byte(len(l.id))}, l.id...)
+
+	_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(header); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// Close implements the net.Listener interface, the group can be registered again after it is closed.
+func (l *muxGroupLayer) Close() error {
+	l.mux.mu.Lock()
+	if l.mux.groups[l.id] == l.muxListener {
+		delete(l.mux.groups, l.id)
+	}
+	l.mux.mu.Unlock()
+
+	return l.muxListener.Close()
+}
@@ -0,0 +1,184 @@
+package raftstream
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestMux(t *testing.T) {
+	convey.Convey("Multiplex raft and HTTP on one port", t, func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		convey.So(err, convey.ShouldBeNil)
+
+		mux := NewMux(ln, nil, time.Second)
+		go func() {
+			_ = mux.Serve()
+		}()
+		defer mux.Close()
+
+		httpSrv := &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = fmt.Fprint(w, "http")
+			}),
+		}
+		go func() {
+			_ = httpSrv.Serve(mux.HTTPListener())
+		}()
+		defer httpSrv.Close()
+
+		raftLayer := mux.RaftLayer()
+		go func() {
+			for {
+				conn, err := raftLayer.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer conn.Close()
+					buf := make([]byte, 4)
+					if _, err := conn.Read(buf); err == nil {
+						_, _ = conn.Write(buf)
+					}
+				}()
+			}
+		}()
+
+		convey.Convey("HTTP request should be served by the HTTP server", func() {
+			resp, err := http.Get(fmt.Sprintf("http://%s/", ln.Addr().String()))
+			convey.So(err, convey.ShouldBeNil)
+			defer resp.Body.Close()
+
+			body, _ := ioutil.ReadAll(resp.Body)
+			convey.So(string(body), convey.ShouldEqual, "http")
+		})
+
+		convey.Convey("Raft connection should be routed to the raft layer", func() {
+			conn, err := raftLayer.Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(roundTrip(conn), convey.ShouldBeNil)
+			convey.So(raftLayer.Addr().String(), convey.ShouldEqual, ln.Addr().String())
+		})
+	})
+}
+
+func TestMuxTLS(t *testing.T) {
+	convey.Convey("Mutual TLS on top of the multiplexed raft layer", t, func() {
+		dir, err := ioutil.TempDir("", "raftstream")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		convey.So(err, convey.ShouldBeNil)
+
+		mux := NewMux(ln, nil, time.Second)
+		go func() {
+			_ = mux.Serve()
+		}()
+		defer mux.Close()
+
+		ca := newTestCA(t)
+		server, err := WrapTLS(mux.RaftLayer(), ca.writeNodeCert(t, dir, "node_1", 30))
+		convey.So(err, convey.ShouldBeNil)
+		defer server.Close()
+
+		go func() {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+			buf := make([]byte, 4)
+			if _, err := conn.Read(buf); err == nil {
+				_, _ = conn.Write(buf)
+			}
+		}()
+
+		client, err := WrapTLS(NewMux(ln, nil, time.Second).RaftLayer(), ca.writeNodeCert(t, dir, "node_2", 31))
+		convey.So(err, convey.ShouldBeNil)
+
+		conn, err := client.Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(roundTrip(conn), convey.ShouldBeNil)
+	})
+}
+
+func TestMuxGroupLayer(t *testing.T) {
+	convey.Convey("Raft groups sharing the multiplexed port", t, func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		convey.So(err, convey.ShouldBeNil)
+
+		mux := NewMux(ln, nil, time.Second)
+		go func() {
+			_ = mux.Serve()
+		}()
+		defer mux.Close()
+
+		echo := func(layer raft.StreamLayer, reply string) {
+			go func() {
+				for {
+					conn, err := layer.Accept()
+					if err != nil {
+						return
+					}
+
+					go func() {
+						defer conn.Close()
+						buf := make([]byte, 4)
+						if _, err := conn.Read(buf); err == nil {
+							_, _ = conn.Write([]byte(reply))
+						}
+					}()
+				}
+			}()
+		}
+
+		orders, err := mux.GroupLayer("orders")
+		convey.So(err, convey.ShouldBeNil)
+		echo(orders, "ordr")
+		echo(mux.RaftLayer(), "meta")
+
+		read := func(conn net.Conn) string {
+			defer conn.Close()
+			_, _ = conn.Write([]byte("ping"))
+			buf := make([]byte, 4)
+			_, _ = io.ReadFull(conn, buf)
+			return string(buf)
+		}
+
+		convey.Convey("Connection should be routed to its group", func() {
+			conn, err := orders.Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(read(conn), convey.ShouldEqual, "ordr")
+
+			conn, err = mux.RaftLayer().Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(read(conn), convey.ShouldEqual, "meta")
+		})
+
+		convey.Convey("Group can not be registered twice", func() {
+			_, err := mux.GroupLayer("orders")
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Connection of unknown group should be closed", func() {
+			users, err := mux.GroupLayer("users")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(users.Close(), convey.ShouldBeNil)
+
+			conn, err := users.Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(read(conn), convey.ShouldEqual, "\x00\x00\x00\x00")
+		})
+	})
+}
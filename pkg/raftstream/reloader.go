@@ -0,0 +1,112 @@
+package raftstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader keep the certificate and CA pool loaded from files,
+// and load them again when one of the files is modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime map[string]time.Time
+}
+
+func newCertReloader(certFile, keyFile, caFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		modTime:  make(map[string]time.Time),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error load certificate %s: %w", r.certFile, err)
+	}
+
+	caPEM, err := ioutil.ReadFile(r.caFile)
+	if err != nil {
+		return fmt.Errorf("error read ca %s: %w", r.caFile, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificate found in ca %s", r.caFile)
+	}
+
+	modTime := make(map[string]time.Time)
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTime[file] = info.ModTime()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = modTime
+	return nil
+}
+
+// reloadIfModified load the files again when any of them is modified since the last load.
+// The old certificate is kept when the new one is invalid, for example the file is still being written.
+func (r *certReloader) reloadIfModified() (bool, error) {
+	r.mu.RLock()
+	modified := false
+	for file, last := range r.modTime {
+		info, err := os.Stat(file)
+		if err != nil {
+			r.mu.RUnlock()
+			return false, err
+		}
+
+		if !info.ModTime().Equal(last) {
+			modified = true
+		}
+	}
+	r.mu.RUnlock()
+
+	if !modified {
+		return false, nil
+	}
+
+	return true, r.load()
+}
+
+func (r *certReloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert
+}
+
+func (r *certReloader) caPool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.pool
+}
@@ -0,0 +1,57 @@
+package raftstream
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// TCP is plain raft.StreamLayer, the same as used by raft.NewTCPTransport, so it can be wrapped by WrapTLS.
+type TCP struct {
+	listener  net.Listener
+	advertise net.Addr
+}
+
+// NewTCP listen on bindAddress. When advertise is nil, the listener address is advertised.
+func NewTCP(bindAddress string, advertise net.Addr) (*TCP, error) {
+	ln, err := net.Listen("tcp", bindAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if advertise == nil {
+		advertise = ln.Addr()
+	}
+
+	if tcpAddr, ok := advertise.(*net.TCPAddr); ok && tcpAddr.IP.IsUnspecified() {
+		_ = ln.Close()
+		return nil, fmt.Errorf("%s is not advertisable address", advertise.String())
+	}
+
+	return &TCP{
+		listener:  ln,
+		advertise: advertise,
+	}, nil
+}
+
+// Dial implements the raft.StreamLayer interface.
+func (t *TCP) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", string(address), timeout)
+}
+
+// Accept implements the net.Listener interface.
+func (t *TCP) Accept() (net.Conn, error) {
+	return t.listener.Accept()
+}
+
+// Close implements the net.Listener interface.
+func (t *TCP) Close() error {
+	return t.listener.Close()
+}
+
+// Addr implements the net.Listener interface.
+func (t *TCP) Addr() net.Addr {
+	return t.advertise
+}
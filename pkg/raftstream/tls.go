@@ -0,0 +1,264 @@
+// Package raftstream implement raft.StreamLayer, so raft traffic can be encrypted or carried by other listener.
+package raftstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	// ErrNodeIDMismatch is returned when the peer certificate is not issued for the expected node id.
+	ErrNodeIDMismatch = errors.New("peer certificate does not match the expected node id")
+
+	// ErrNodeIDUnknown is returned by Dial with VerifyNodeID when the node id of the address is not resolved,
+	// the peer is not dialed, otherwise any certificate signed by the CA would be accepted.
+	ErrNodeIDUnknown = errors.New("node id of the peer address is unknown, its certificate can not be verified")
+)
+
+// NodeIDResolver return the node id of the raft address, false when the address is not known yet.
+type NodeIDResolver func(address raft.ServerAddress) (nodeID string, ok bool)
+
+// TLSConfig is used by NewTLS. Every node use certificate signed by the CA, both as server and as client,
+// so the certificate must have both the serverAuth and clientAuth extended key usage.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	// VerifyNodeID check that the certificate of the dialed peer has the node id as DNS or URI SAN.
+	// The dial fails with ErrNodeIDUnknown when the resolver does not know the node id of the address.
+	VerifyNodeID bool
+
+	// ReloadInterval is the interval to check the files modification, the new certificate is used for new connection.
+	// Zero disables reloading.
+	ReloadInterval time.Duration
+}
+
+// TLS is raft.StreamLayer using mutual TLS on top of other stream layer.
+type TLS struct {
+	inner    raft.StreamLayer
+	conf     TLSConfig
+	reloader *certReloader
+
+	mu       sync.RWMutex
+	resolver NodeIDResolver
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+// NewTLS listen TCP on bindAddress. When advertise is nil, the listener address is advertised.
+func NewTLS(bindAddress string, advertise net.Addr, conf TLSConfig) (*TLS, error) {
+	reloader, err := newCertReloader(conf.CertFile, conf.KeyFile, conf.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := NewTCP(bindAddress, advertise)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapTLS(inner, conf, reloader), nil
+}
+
+// WrapTLS encrypt the connection of the stream layer, for example raft connection multiplexed by Mux.
+func WrapTLS(inner raft.StreamLayer, conf TLSConfig) (*TLS, error) {
+	reloader, err := newCertReloader(conf.CertFile, conf.KeyFile, conf.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapTLS(inner, conf, reloader), nil
+}
+
+func wrapTLS(inner raft.StreamLayer, conf TLSConfig, reloader *certReloader) *TLS {
+	t := &TLS{
+		inner:    inner,
+		conf:     conf,
+		reloader: reloader,
+		closeCh:  make(chan struct{}),
+	}
+
+	if conf.ReloadInterval > 0 {
+		go t.reloadLoop()
+	}
+
+	return t
+}
+
+// SetNodeIDResolver set the resolver used to verify the node id of dialed peer.
+func (t *TLS) SetNodeIDResolver(resolver NodeIDResolver) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resolver = resolver
+}
+
+func (t *TLS) reloadLoop() {
+	ticker := time.NewTicker(t.conf.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := t.reloader.reloadIfModified()
+		if err != nil {
+			fmt.Printf("error reload raft tls certificate: %s\n", err.Error())
+			continue
+		}
+
+		if reloaded {
+			fmt.Printf("raft tls certificate reloaded\n")
+		}
+	}
+}
+
+// serverConfig require client certificate signed by the CA.
+// The certificate and the CA is read from the reloader on each connection.
+func (t *TLS) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*t.reloader.certificate()},
+		ClientCAs:    t.reloader.caPool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+// clientConfig verify the chain against the CA without host name, because peers are addressed by IP,
+// and the node id instead when it is known.
+func (t *TLS) clientConfig(nodeID string) *tls.Config {
+	pool := t.reloader.caPool()
+	cert := t.reloader.certificate()
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		Certificates:       []tls.Certificate{*cert},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPeer(rawCerts, pool, nodeID)
+		},
+	}
+}
+
+func verifyPeer(rawCerts [][]byte, pool *x509.CertPool, nodeID string) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("peer does not send certificate")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return err
+	}
+
+	if nodeID == "" || matchNodeID(certs[0], nodeID) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrNodeIDMismatch, nodeID)
+}
+
+// matchNodeID return true when the node id is one of the DNS SAN, or the host of URI SAN (for example node://node_1)
+func matchNodeID(cert *x509.Certificate, nodeID string) bool {
+	for _, name := range cert.DNSNames {
+		if name == nodeID {
+			return true
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		if uri.Host == nodeID || uri.Opaque == nodeID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Dial implements the raft.StreamLayer interface.
+func (t *TLS) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	var nodeID string
+	if t.conf.VerifyNodeID {
+		t.mu.RLock()
+		resolver := t.resolver
+		t.mu.RUnlock()
+
+		var ok bool
+		if resolver != nil {
+			nodeID, ok = resolver(address)
+		}
+
+		if !ok || nodeID == "" {
+			return nil, fmt.Errorf("%w: %s", ErrNodeIDUnknown, address)
+		}
+	}
+
+	conn, err := t.inner.Dial(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, t.clientConfig(nodeID))
+	_ = tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// Accept implements the net.Listener interface. The handshake is done on the first read,
+// so slow peer does not block accepting other connection.
+func (t *TLS) Accept() (net.Conn, error) {
+	conn, err := t.inner.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.Server(conn, t.serverConfig()), nil
+}
+
+// Close implements the net.Listener interface.
+func (t *TLS) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closeCh)
+	})
+
+	return t.inner.Close()
+}
+
+// Addr implements the net.Listener interface.
+func (t *TLS) Addr() net.Addr {
+	return t.inner.Addr()
+}
@@ -0,0 +1,248 @@
+package raftstream
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "canoe test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// writeNodeCert write certificate for the node id into dir, usable both as server and client
+func (ca *testCA) writeNodeCert(t *testing.T, dir, nodeID string, serial int64) TLSConfig {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: nodeID},
+		DNSNames:     []string{nodeID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	conf := TLSConfig{
+		CertFile: filepath.Join(dir, nodeID+".crt"),
+		KeyFile:  filepath.Join(dir, nodeID+".key"),
+		CAFile:   filepath.Join(dir, nodeID+"-ca.crt"),
+	}
+
+	// write the key first, so the reloader never see new certificate with old key
+	write := func(file string, data []byte) {
+		tmp := file + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(conf.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	write(conf.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	write(conf.CAFile, ca.pem)
+	return conf
+}
+
+func newTestLayer(t *testing.T, conf TLSConfig) *TLS {
+	layer, err := NewTLS("127.0.0.1:0", nil, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = layer.Close()
+	})
+
+	// echo server, the handshake is done on the first read
+	go func() {
+		for {
+			conn, err := layer.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4)
+				if _, err := conn.Read(buf); err != nil {
+					return
+				}
+				_, _ = conn.Write(buf)
+			}()
+		}
+	}()
+
+	return layer
+}
+
+func roundTrip(conn net.Conn) error {
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4)
+	_, err := conn.Read(buf)
+	return err
+}
+
+func TestTLS_Dial(t *testing.T) {
+	convey.Convey("Mutual TLS stream layer", t, func() {
+		dir, err := ioutil.TempDir("", "raftstream")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ca := newTestCA(t)
+		server := newTestLayer(t, ca.writeNodeCert(t, dir, "node_1", 10))
+
+		convey.Convey("Peer with certificate from the same CA should connect", func() {
+			client := newTestLayer(t, ca.writeNodeCert(t, dir, "node_2", 11))
+
+			conn, err := client.Dial(raft.ServerAddress(server.Addr().String()), time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(roundTrip(conn), convey.ShouldBeNil)
+		})
+
+		convey.Convey("Peer with certificate from other CA should be rejected", func() {
+			other := newTestCA(t)
+			client := newTestLayer(t, other.writeNodeCert(t, dir, "node_3", 12))
+
+			conn, err := client.Dial(raft.ServerAddress(server.Addr().String()), time.Second)
+			if err == nil {
+				err = roundTrip(conn)
+			}
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Dialed peer should match the expected node id", func() {
+			conf := ca.writeNodeCert(t, dir, "node_2", 13)
+			conf.VerifyNodeID = true
+			client := newTestLayer(t, conf)
+
+			_, err := client.Dial(raft.ServerAddress(server.Addr().String()), time.Second)
+			convey.So(errors.Is(err, ErrNodeIDUnknown), convey.ShouldBeTrue)
+
+			client.SetNodeIDResolver(func(address raft.ServerAddress) (string, bool) {
+				return "", false
+			})
+
+			_, err = client.Dial(raft.ServerAddress(server.Addr().String()), time.Second)
+			convey.So(errors.Is(err, ErrNodeIDUnknown), convey.ShouldBeTrue)
+
+			client.SetNodeIDResolver(func(address raft.ServerAddress) (string, bool) {
+				return "node_9", true
+			})
+
+			_, err = client.Dial(raft.ServerAddress(server.Addr().String()), time.Second)
+			convey.So(errors.Is(err, ErrNodeIDMismatch), convey.ShouldBeTrue)
+
+			client.SetNodeIDResolver(func(address raft.ServerAddress) (string, bool) {
+				return "node_1", true
+			})
+
+			conn, err := client.Dial(raft.ServerAddress(server.Addr().String()), time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(roundTrip(conn), convey.ShouldBeNil)
+		})
+	})
+}
+
+func TestTLS_Reload(t *testing.T) {
+	convey.Convey("Certificate reload", t, func() {
+		dir, err := ioutil.TempDir("", "raftstream")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ca := newTestCA(t)
+		conf := ca.writeNodeCert(t, dir, "node_1", 20)
+		conf.ReloadInterval = 20 * time.Millisecond
+		server := newTestLayer(t, conf)
+		client := newTestLayer(t, ca.writeNodeCert(t, dir, "node_2", 21))
+
+		serial := func() int64 {
+			conn, err := client.Dial(raft.ServerAddress(server.Addr().String()), time.Second)
+			if err != nil {
+				return 0
+			}
+			defer conn.Close()
+
+			return conn.(*tls.Conn).ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+		}
+
+		convey.So(serial(), convey.ShouldEqual, 20)
+
+		convey.Convey("New connection should use the rewritten certificate without restart", func() {
+			// modification time may have coarse resolution
+			time.Sleep(10 * time.Millisecond)
+			ca.writeNodeCert(t, dir, "node_1", 22)
+
+			deadline := time.Now().Add(2 * time.Second)
+			for serial() != 22 && time.Now().Before(deadline) {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			convey.So(serial(), convey.ShouldEqual, 22)
+		})
+	})
+}
@@ -0,0 +1,118 @@
+package tcpserver
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler serve one connection. The connection is closed by the Server after Handler returns.
+type Handler func(conn net.Conn)
+
+// Server accept TCP connection and serve each of them in its own goroutine.
+type Server struct {
+	handler Handler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// Serve accept connection from the listener until Shutdown is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return l.Close()
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isStopped() {
+				return nil
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			return err
+		}
+
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+
+		_ = conn.Close()
+		s.wg.Done()
+	}()
+
+	s.handler(conn)
+}
+
+func (s *Server) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// Shutdown stop accepting connection, close all open connection and wait all Handler to return.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	s.stopped = true
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// IsClosedError return true when the error is caused by closing connection or read deadline,
+// which is the normal way a connection is ended.
+func IsClosedError(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
+
+func New(handler Handler) *Server {
+	return &Server{
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
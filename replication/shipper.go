@@ -0,0 +1,447 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/repo"
+)
+
+// HTTP path of the standby cluster
+const (
+	PathStatus  = "/replication/status"
+	PathApply   = "/replication/apply"
+	PathSeed    = "/replication/seed"
+	PathStandby = "/replication/standby"
+	PathPromote = "/replication/promote"
+)
+
+// Config of the Shipper
+type Config struct {
+	// Targets is the HTTP address of the standby cluster nodes, for example http://dr-1:2222.
+	// The batch is sent to the first node which accept it, which is the standby leader.
+	Targets []string
+
+	// Interval is how often new committed operation is shipped.
+	Interval time.Duration
+
+	// BatchSize is the maximum number of raft log entry examined in one request.
+	BatchSize int
+
+	// Timeout of one HTTP request to the standby.
+	Timeout time.Duration
+}
+
+// Status is the replication state reported by the standby in GET /replication/status.
+type Status struct {
+	repo.ReplicaState
+	Shipper map[string]string `json:"shipper,omitempty"`
+}
+
+// Shipper send the committed operations of this cluster to the standby cluster in raft index order,
+// only when this node is the leader.
+//
+// The progress is checkpointed in the standby: the operations of a batch and the last primary raft index
+// are committed in one transaction by the raft command which applies the batch, so a batch is applied completely
+// or not at all, and a new leader on either side continue from the standby applied index.
+// Operation rejected by the primary is rejected again by the standby, and the state of the primary cluster itself,
+// such as the shard map, is not shipped. A batch too big for one transaction is shipped again in smaller batches.
+//
+// When the log after the standby applied index is already compacted, for example for a new standby, the standby is
+// seeded first: the data of one point-in-time snapshot of this node is copied, then the log after the snapshot
+// applied index is shipped. See fsm.SeedBatch.
+type Shipper struct {
+	conf   Config
+	raft   gossip.Service
+	repo   repo.Service
+	client *http.Client
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	closed sync.Once
+
+	mu          sync.Mutex
+	target      int
+	known       bool
+	applied     uint64
+	lastError   string
+	lastShipped time.Time
+}
+
+// Start run the shipping loop in background until Stop is called.
+func (s *Shipper) Start() error {
+	if len(s.conf.Targets) == 0 {
+		return errors.New("replication target is empty")
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if !s.raft.IsLeader() {
+				s.reset("")
+				continue
+			}
+
+			if err := s.ship(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "[REPLICATION] error ship to %s: %s\n", s.currentTarget(), err.Error())
+				s.reset(err.Error())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop the shipping loop.
+func (s *Shipper) Stop() {
+	s.closed.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+}
+
+// Stats return the progress of the standby as seen by this node, lag is the number of raft index not applied yet
+// by the standby, it is only known in the leader.
+func (s *Shipper) Stats() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := map[string]string{
+		"replication_target":     s.conf.Targets[s.target],
+		"replication_last_error": s.lastError,
+	}
+
+	if !s.lastShipped.IsZero() {
+		stats["replication_last_shipped_at"] = s.lastShipped.Format(time.RFC3339)
+	}
+
+	if s.known {
+		applied, _ := strconv.ParseUint(s.raft.Stats()["applied_index"], 10, 64)
+
+		var lag uint64
+		if applied > s.applied {
+			lag = applied - s.applied
+		}
+
+		stats["replication_applied_index"] = fmt.Sprint(s.applied)
+		stats["replication_lag"] = fmt.Sprint(lag)
+	}
+
+	return stats
+}
+
+// ship send every committed operation which is not applied yet by the standby.
+func (s *Shipper) ship() error {
+	state, err := s.repo.ReplicaState()
+	if err != nil {
+		return err
+	}
+
+	if state.Role == repo.RoleStandby {
+		return errors.New("this cluster is a standby, promote it before shipping")
+	}
+
+	if !s.hasApplied() {
+		status, err := s.status()
+		if err != nil {
+			return err
+		}
+
+		if status.Role != repo.RoleStandby {
+			return fmt.Errorf("target role is %q, make it standby using POST %s", status.Role, PathStandby)
+		}
+
+		// a seed stopped in the middle is started again
+		if status.SeedIndex != 0 {
+			return s.seed()
+		}
+
+		s.setApplied(status.AppliedIndex)
+	}
+
+	size := s.conf.BatchSize
+	for {
+		after := s.appliedIndex()
+		commands, last, err := s.raft.ReadLog(after, size)
+		if err == gossip.ErrLogCompacted {
+			return s.seed()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if last == after {
+			return nil
+		}
+
+		var state repo.ReplicaState
+		err = s.post(PathApply, fsm.ReplicateBatch{
+			From:     after + 1,
+			Last:     last,
+			Time:     time.Now().UnixNano(),
+			Commands: commands,
+		}, &state)
+		if err == fsm.ErrBatchTooBig && len(commands) > 1 {
+			size = len(commands) / 2
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		s.shipped(state.AppliedIndex)
+		if state.AppliedIndex < last {
+			return fmt.Errorf("standby applied index is %d after shipping until %d", state.AppliedIndex, last)
+		}
+	}
+}
+
+// status read the replication state of the standby, trying the other target when the current one is down.
+func (s *Shipper) status() (Status, error) {
+	var (
+		status Status
+		err    error
+	)
+
+	for range s.conf.Targets {
+		var resp *http.Response
+		resp, err = s.client.Get(s.currentTarget() + PathStatus)
+		if err != nil {
+			s.nextTarget()
+			continue
+		}
+
+		err = decode(resp, &status)
+		_ = resp.Body.Close()
+		return status, err
+	}
+
+	return status, err
+}
+
+// seed copy the data of the snapshot of this node to the standby, then continue from the snapshot applied index.
+func (s *Shipper) seed() error {
+	snap := s.repo.Snapshot()
+	defer snap.Release()
+
+	index, err := snap.AppliedIndex()
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "[REPLICATION] seed standby with the data at index %d\n", index)
+
+	for {
+		var result fsm.SeedResult
+		if err := s.post(PathSeed, fsm.SeedBatch{Index: index, Clear: s.conf.BatchSize}, &result); err != nil {
+			return err
+		}
+
+		if result.Cleared == 0 {
+			break
+		}
+	}
+
+	entries := make([]repo.SnapshotEntry, 0, s.conf.BatchSize)
+	err = snap.ForEachData(func(entry repo.SnapshotEntry) error {
+		entries = append(entries, entry)
+		if len(entries) < s.conf.BatchSize {
+			return nil
+		}
+
+		err := s.sendSeed(fsm.SeedBatch{Index: index, Entries: entries})
+		entries = entries[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.sendSeed(fsm.SeedBatch{Index: index, Time: time.Now().UnixNano(), Entries: entries, Done: true}); err != nil {
+		return err
+	}
+
+	s.shipped(index)
+	return nil
+}
+
+// sendSeed send the seed batch, splitting it in two when it is too big for one transaction.
+func (s *Shipper) sendSeed(batch fsm.SeedBatch) error {
+	var result fsm.SeedResult
+	err := s.post(PathSeed, batch, &result)
+	if err != fsm.ErrBatchTooBig || len(batch.Entries) < 2 {
+		return err
+	}
+
+	half := len(batch.Entries) / 2
+	first := fsm.SeedBatch{Index: batch.Index, Entries: batch.Entries[:half]}
+	if err := s.sendSeed(first); err != nil {
+		return err
+	}
+
+	batch.Entries = batch.Entries[half:]
+	return s.sendSeed(batch)
+}
+
+// post send the batch to the standby leader, trying the other target when the current one is not the leader.
+func (s *Shipper) post(path string, batch interface{}, out interface{}) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	for range s.conf.Targets {
+		resp, err := s.client.Post(s.currentTarget()+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			s.nextTarget()
+			continue
+		}
+
+		err = decode(resp, out)
+		_ = resp.Body.Close()
+
+		if err == gossip.ErrNotLeader {
+			s.nextTarget()
+			continue
+		}
+
+		return err
+	}
+
+	return errors.New("no standby leader found in replication target")
+}
+
+// decode read the JSON response, the error message is returned as error
+func decode(resp *http.Response, v interface{}) error {
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var msg string
+		if err := json.Unmarshal(data, &msg); err != nil {
+			msg = fmt.Sprintf("standby return status %d", resp.StatusCode)
+		}
+
+		switch msg {
+		case gossip.ErrNotLeader.Error():
+			return gossip.ErrNotLeader
+		case fsm.ErrBatchTooBig.Error():
+			return fsm.ErrBatchTooBig
+		}
+
+		return errors.New(msg)
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// reset forget the standby applied index, it is read again before the next batch.
+func (s *Shipper) reset(lastError string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.known = false
+	if lastError != "" {
+		s.lastError = lastError
+	}
+}
+
+func (s *Shipper) hasApplied() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.known
+}
+
+func (s *Shipper) appliedIndex() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applied
+}
+
+// shipped save the standby applied index after it accept a batch.
+func (s *Shipper) shipped(index uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applied = index
+	s.known = true
+	s.lastError = ""
+	s.lastShipped = time.Now()
+}
+
+func (s *Shipper) setApplied(index uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applied = index
+	s.known = true
+}
+
+func (s *Shipper) currentTarget() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conf.Targets[s.target]
+}
+
+func (s *Shipper) nextTarget() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.target = (s.target + 1) % len(s.conf.Targets)
+}
+
+// NewShipper create the shipper of this cluster committed operations, target without scheme is using http.
+func NewShipper(conf Config, raft gossip.Service, repo repo.Service) *Shipper {
+	if conf.Interval <= 0 {
+		conf.Interval = time.Second
+	}
+
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 500
+	}
+
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+
+	targets := make([]string, 0, len(conf.Targets))
+	for _, t := range conf.Targets {
+		t = strings.TrimRight(t, "/")
+		if !strings.Contains(t, "://") {
+			t = "http://" + t
+		}
+
+		targets = append(targets, t)
+	}
+
+	conf.Targets = targets
+
+	return &Shipper{
+		conf:   conf,
+		raft:   raft,
+		repo:   repo,
+		client: &http.Client{Timeout: conf.Timeout},
+		stop:   make(chan struct{}),
+	}
+}
@@ -0,0 +1,241 @@
+package replication_test
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+	"ysf/canoe/dependency"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/internal/handler/replctrl"
+	"ysf/canoe/internal/testcluster"
+	"ysf/canoe/model"
+	"ysf/canoe/replication"
+	"ysf/canoe/repo"
+	"ysf/canoe/server"
+
+	"github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+// serve start the replication API of every node in the cluster, return their HTTP address
+func serve(t *testing.T, c *testcluster.Cluster) []string {
+	var targets []string
+	for _, node := range c.Nodes() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = ln.Close() })
+
+		srv := server.NewServer(server.Config{
+			Listener:  ln,
+			ZapLogger: zap.NewNop(),
+		})
+		srv.RegisterRoutes(replctrl.Routes(dependency.NewDep(node.Gossip(), node.Repo()), nil))
+
+		go func() {
+			_ = srv.Start()
+		}()
+
+		targets = append(targets, ln.Addr().String())
+	}
+
+	return targets
+}
+
+func waitFor(timeout time.Duration, fn func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if fn() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return fn()
+}
+
+func TestShipper(t *testing.T) {
+	if testing.Short() {
+		t.Skip("start two clusters")
+	}
+
+	primary := testcluster.New(t, testcluster.Options{Nodes: 1})
+	standby := testcluster.New(t, testcluster.Options{Nodes: 3})
+	primary.WaitLeader(5 * time.Second)
+	standbyLeader := standby.WaitLeader(5 * time.Second)
+
+	_, err := primary.Apply(model.CommandPayload{Operation: "SET", Key: "foo", Value: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shipper := replication.NewShipper(replication.Config{
+		Targets:  serve(t, standby),
+		Interval: 50 * time.Millisecond,
+		// small batch, so the log is shipped in several requests
+		BatchSize: 2,
+	}, primary.Leader().Gossip(), primary.Leader().Repo())
+
+	if err := shipper.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(shipper.Stop)
+
+	convey.Convey("Committed operations is shipped to the standby cluster", t, func() {
+		convey.So(waitFor(2*time.Second, func() bool {
+			return shipper.Stats()["replication_last_error"] != ""
+		}), convey.ShouldBeTrue)
+		convey.So(shipper.Stats()["replication_last_error"], convey.ShouldContainSubstring, "make it standby")
+
+		_, err := standbyLeader.Gossip().DoOperation(model.CommandPayload{Operation: fsm.OpReplicaRole, Value: repo.RoleStandby})
+		convey.So(err, convey.ShouldBeNil)
+
+		for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+			_, err := primary.Apply(model.CommandPayload{Operation: "SET", Key: key, Value: key})
+			convey.So(err, convey.ShouldBeNil)
+		}
+
+		_, err = primary.Apply(model.CommandPayload{Operation: fsm.OpDel, Keys: []string{"k1"}})
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.So(waitFor(5*time.Second, func() bool {
+			return shipper.Stats()["replication_lag"] == "0"
+		}), convey.ShouldBeTrue)
+
+		state, err := standbyLeader.Repo().ReplicaState()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(state.Role, convey.ShouldEqual, repo.RoleStandby)
+		convey.So(state.AppliedIndex, convey.ShouldBeGreaterThan, 0)
+
+		for _, node := range standby.Nodes() {
+			convey.So(waitFor(2*time.Second, func() bool {
+				s, _ := node.Repo().ReplicaState()
+				return s.AppliedIndex == state.AppliedIndex
+			}), convey.ShouldBeTrue)
+
+			has, err := node.Repo().Has("k1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(has, convey.ShouldBeFalse)
+
+			convey.So(node.Repo().Get("foo"), convey.ShouldEqual, "bar")
+			convey.So(node.Repo().Get("k5"), convey.ShouldEqual, "k5")
+		}
+
+		// standby is read-only
+		_, err = standby.Apply(model.CommandPayload{Operation: "SET", Key: "foo", Value: "baz"})
+		convey.So(err, convey.ShouldEqual, fsm.ErrReadOnly)
+
+		value, err := standby.Apply(model.CommandPayload{Operation: "GET", Key: "foo"})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(value, convey.ShouldEqual, "bar")
+
+		// shipping the same batch twice is ignored
+		_, err = standbyLeader.Gossip().DoOperation(model.CommandPayload{Operation: fsm.OpReplicate, Data: []byte(`{"from":1,"last":2}`)})
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.So(waitFor(time.Second, func() bool {
+			return shipper.Stats()["replication_last_error"] == ""
+		}), convey.ShouldBeTrue)
+
+		// promoted standby accept write and refuse the batch of the old primary
+		_, err = standbyLeader.Gossip().DoOperation(model.CommandPayload{Operation: fsm.OpReplicaRole, Value: repo.RolePrimary})
+		convey.So(err, convey.ShouldBeNil)
+
+		_, err = standby.Apply(model.CommandPayload{Operation: "SET", Key: "foo", Value: "baz"})
+		convey.So(err, convey.ShouldBeNil)
+
+		_, err = primary.Apply(model.CommandPayload{Operation: "SET", Key: "k6", Value: "k6"})
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.So(waitFor(2*time.Second, func() bool {
+			return shipper.Stats()["replication_last_error"] != ""
+		}), convey.ShouldBeTrue)
+		convey.So(shipper.Stats()["replication_last_error"], convey.ShouldContainSubstring, "standby")
+
+		_, err = standbyLeader.Gossip().DoOperation(model.CommandPayload{Operation: fsm.OpReplicaRole, Value: repo.RoleStandby})
+		convey.So(err, convey.ShouldEqual, fsm.ErrStandbyNotEmpty)
+	})
+}
+
+func TestShipper_Seed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("start two clusters")
+	}
+
+	primary := testcluster.New(t, testcluster.Options{
+		Nodes: 1,
+		Tuning: gossip.TuningConfig{
+			HeartbeatTimeout:   100 * time.Millisecond,
+			ElectionTimeout:    100 * time.Millisecond,
+			LeaderLeaseTimeout: 100 * time.Millisecond,
+			CommitTimeout:      5 * time.Millisecond,
+			SnapshotInterval:   50 * time.Millisecond,
+			SnapshotThreshold:  1,
+			TrailingLogs:       1,
+		},
+	})
+	standby := testcluster.New(t, testcluster.Options{Nodes: 1})
+	primary.WaitLeader(5 * time.Second)
+	standbyLeader := standby.WaitLeader(5 * time.Second)
+
+	convey.Convey("New standby is seeded when the primary log is already compacted", t, func() {
+		for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+			_, err := primary.Apply(model.CommandPayload{Operation: "SET", Key: key, Value: key})
+			convey.So(err, convey.ShouldBeNil)
+		}
+
+		_, err := primary.Apply(model.CommandPayload{Operation: fsm.OpZAdd, Key: "board", Member: "alice", Score: 3})
+		convey.So(err, convey.ShouldBeNil)
+
+		// raft compact the log once the snapshot include every write
+		applied, err := primary.Leader().Repo().AppliedIndex()
+		convey.So(err, convey.ShouldBeNil)
+
+		var snapshotIndex uint64
+		convey.So(waitFor(5*time.Second, func() bool {
+			snapshotIndex, _ = strconv.ParseUint(primary.Leader().Gossip().Stats()["last_snapshot_index"], 10, 64)
+			return snapshotIndex >= applied
+		}), convey.ShouldBeTrue)
+
+		_, err = standbyLeader.Gossip().DoOperation(model.CommandPayload{Operation: fsm.OpReplicaRole, Value: repo.RoleStandby})
+		convey.So(err, convey.ShouldBeNil)
+
+		shipper := replication.NewShipper(replication.Config{
+			Targets:  serve(t, standby),
+			Interval: 50 * time.Millisecond,
+			// small batch, so the data is seeded in several requests
+			BatchSize: 2,
+		}, primary.Leader().Gossip(), primary.Leader().Repo())
+
+		convey.So(shipper.Start(), convey.ShouldBeNil)
+		defer shipper.Stop()
+
+		_, err = primary.Apply(model.CommandPayload{Operation: fsm.OpDel, Keys: []string{"k1"}})
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.So(waitFor(5*time.Second, func() bool {
+			return shipper.Stats()["replication_lag"] == "0"
+		}), convey.ShouldBeTrue)
+
+		state, err := standbyLeader.Repo().ReplicaState()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(state.SeedIndex, convey.ShouldEqual, 0)
+		convey.So(state.AppliedIndex, convey.ShouldBeGreaterThanOrEqualTo, snapshotIndex)
+
+		has, _ := standbyLeader.Repo().Has("k1")
+		convey.So(has, convey.ShouldBeFalse)
+		convey.So(standbyLeader.Repo().Get("k5"), convey.ShouldEqual, "k5")
+
+		score, ok, _ := standbyLeader.Repo().ZScore("board", "alice")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(score, convey.ShouldEqual, 3)
+
+		// the primary state is not copied
+		applied, _ = standbyLeader.Repo().AppliedIndex()
+		convey.So(state.Role, convey.ShouldEqual, repo.RoleStandby)
+		convey.So(applied, convey.ShouldBeGreaterThan, 0)
+	})
+}
@@ -0,0 +1,45 @@
+package reply
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"ysf/canoe/server"
+)
+
+// ContentTypeEventStream is the content type of server-sent events.
+const ContentTypeEventStream = "text/event-stream"
+
+type stream struct {
+	contentType string
+	write       func(ctx context.Context, w io.Writer, flush func() error) error
+}
+
+func (s stream) StatusCode() int {
+	return http.StatusOK
+}
+
+func (s stream) Body() (data []byte, err error) {
+	return nil, errors.New("stream response has no body")
+}
+
+func (s stream) Header() http.Header {
+	return http.Header{}
+}
+
+func (s stream) ContentType() string {
+	return s.contentType
+}
+
+func (s stream) WriteStream(ctx context.Context, w io.Writer, flush func() error) error {
+	return s.write(ctx, w, flush)
+}
+
+// Stream return response which is written by write until the client disconnect or write return.
+func Stream(contentType string, write func(ctx context.Context, w io.Writer, flush func() error) error) server.Response {
+	return &stream{
+		contentType: contentType,
+		write:       write,
+	}
+}
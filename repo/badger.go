@@ -1,34 +1,49 @@
 package repo
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 
 	"github.com/dgraph-io/badger/v2"
 )
 
+// ErrTxnTooBig is returned by Atomic when the writes do not fit in one transaction.
+var ErrTxnTooBig = badger.ErrTxnTooBig
+
 type badgerDB struct {
 	db *badger.DB
+
+	// prefix is written before every key, so several repo can share one badger instance
+	prefix []byte
+
+	// txn is set for the repo given by Atomic, every call then read and write in this transaction
+	txn    *badger.Txn
+	failed *error
+
+	// now is the unix second used to decide whether a key is expired when fixed is true, see Clock
+	now   int64
+	fixed bool
 }
 
 func (b badgerDB) Get(key string) interface{} {
-	var keyByte = []byte(key)
 	var data interface{}
+	var value = make([]byte, 0)
 
-	txn := b.db.NewTransaction(false)
-	defer func() {
-		_ = txn.Commit()
-	}()
+	err := b.view(func(txn *prefixTxn) error {
+		item, _, err := lookup(txn, []byte(key))
+		if err != nil {
+			return err
+		}
 
-	item, err := txn.Get(keyByte)
-	if err != nil {
-		data = map[string]interface{}{}
-		return data
-	}
+		if item == nil {
+			return badger.ErrKeyNotFound
+		}
 
-	var value = make([]byte, 0)
-	err = item.Value(func(val []byte) error {
-		value = append(value, val...)
-		return nil
+		return item.Value(func(val []byte) error {
+			value = append(value, val...)
+			return nil
+		})
 	})
 
 	if err != nil {
@@ -37,7 +52,10 @@ func (b badgerDB) Get(key string) interface{} {
 	}
 
 	if value != nil && len(value) > 0 {
-		err = json.Unmarshal(value, &data)
+		// decode number as json.Number, so integer bigger than 2^53 is not rounded to float64
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		err = decoder.Decode(&data)
 	}
 
 	if err != nil {
@@ -58,14 +76,10 @@ func (b badgerDB) Set(key string, value interface{}) (err error) {
 		return
 	}
 
-	txn := b.db.NewTransaction(true)
-	err = txn.Set([]byte(key), data)
-	if err != nil {
-		txn.Discard()
-		return
-	}
-
-	return txn.Commit()
+	return b.update(func(txn *prefixTxn) error {
+		_, err := putValue(txn, []byte(key), data, 0, 0, false)
+		return err
+	})
 }
 
 func NewBadger(db *badger.DB) (Service, error) {
@@ -73,3 +87,67 @@ func NewBadger(db *badger.DB) (Service, error) {
 		db: db,
 	}, nil
 }
+
+// NewBadgerKeyspace return repo which save every key under the prefix, including the internal keys.
+// Prefix must start with NUL byte, so it is never visible to the repo without prefix sharing the same badger instance.
+func NewBadgerKeyspace(db *badger.DB, prefix string) (Service, error) {
+	if len(prefix) == 0 || prefix[:1] != internalPrefix {
+		return nil, fmt.Errorf("keyspace prefix %q must start with NUL byte", prefix)
+	}
+
+	return &badgerDB{
+		db:     db,
+		prefix: []byte(prefix),
+	}, nil
+}
+
+func (b badgerDB) AppliedIndex() (index uint64, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		index, err = getUint64(txn, keyAppliedIndex)
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) SetAppliedIndex(index uint64) error {
+	return b.update(func(txn *prefixTxn) error {
+		return setUint64(txn, keyAppliedIndex, index)
+	})
+}
+
+// Atomic run fn with repo bound to one read-write transaction, then save index as the applied index in it.
+// Either every write done by fn is committed together with the applied index, or nothing is committed
+// when fn return error or any write inside it failed, for example because the transaction is too big.
+// Snapshot and Restore must not be called on the repo given to fn.
+func (b badgerDB) Atomic(index uint64, fn func(tx Service) error) error {
+	if b.txn != nil {
+		if err := fn(b); err != nil {
+			return err
+		}
+
+		return b.SetAppliedIndex(index)
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		var failed error
+		tx := &badgerDB{
+			db:     b.db,
+			prefix: b.prefix,
+			txn:    txn,
+			failed: &failed,
+			now:    b.now,
+			fixed:  b.fixed,
+		}
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if failed != nil {
+			return failed
+		}
+
+		return tx.SetAppliedIndex(index)
+	})
+}
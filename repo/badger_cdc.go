@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// Change is one committed mutation of a key, recorded by the FSM for change data capture.
+// Offset is dense and starts from 1, so consumer can detect gap and resume from the next offset.
+// OldValue and NewValue is null when the key does not exist before or after the mutation.
+// For sorted set, Member is the changed member and the value is its score.
+type Change struct {
+	Offset    uint64          `json:"offset"`
+	Index     uint64          `json:"index"`
+	Term      uint64          `json:"term"`
+	Operation string          `json:"operation"`
+	Key       string          `json:"key"`
+	Member    string          `json:"member,omitempty"`
+	OldValue  json.RawMessage `json:"old_value"`
+	NewValue  json.RawMessage `json:"new_value"`
+}
+
+func changeKey(offset uint64) []byte {
+	out := make([]byte, len(prefixChange)+8)
+	copy(out, prefixChange)
+	binary.BigEndian.PutUint64(out[len(prefixChange):], offset)
+	return out
+}
+
+func changeAt(txn *prefixTxn, offset uint64) (c Change, err error) {
+	item, err := txn.Get(changeKey(offset))
+	if err != nil {
+		return c, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &c)
+	})
+
+	return
+}
+
+func getUint64(txn *prefixTxn, key []byte) (n uint64, err error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		if len(val) == 8 {
+			n = binary.BigEndian.Uint64(val)
+		}
+		return nil
+	})
+
+	return
+}
+
+func setUint64(txn *prefixTxn, key []byte, n uint64) error {
+	val := make([]byte, 8)
+	binary.BigEndian.PutUint64(val, n)
+	return txn.Set(key, val)
+}
+
+// AppendChanges assign the next offset to each change and save it.
+// Change older than the newest retention changes is deleted, zero retention keep everything.
+// Changes of one raft entry is appended together, they are skipped when the last change is already recorded
+// from this entry or a later one, so a replayed entry is never recorded twice.
+func (b badgerDB) AppendChanges(changes []Change, retention uint64) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return b.update(func(txn *prefixTxn) error {
+		last, err := getUint64(txn, keyChangeLast)
+		if err != nil {
+			return err
+		}
+
+		if last > 0 && changes[0].Index > 0 {
+			recorded, err := changeAt(txn, last)
+			if err != nil {
+				return err
+			}
+
+			if recorded.Index >= changes[0].Index {
+				return nil
+			}
+		}
+
+		for i := range changes {
+			last++
+			changes[i].Offset = last
+
+			data, err := json.Marshal(changes[i])
+			if err != nil {
+				return err
+			}
+
+			if err = txn.Set(changeKey(last), data); err != nil {
+				return err
+			}
+
+			// offset is dense, so exactly one change is out of retention for each appended change
+			if retention > 0 && last > retention {
+				if err = txn.Delete(changeKey(last - retention)); err != nil {
+					return err
+				}
+			}
+		}
+
+		return setUint64(txn, keyChangeLast, last)
+	})
+}
+
+// Changes return at most limit changes starting from offset.
+// first and last is the oldest and newest offset still kept in the change log, both zero when it is empty.
+func (b badgerDB) Changes(offset uint64, limit int) (changes []Change, first, last uint64, err error) {
+	changes = make([]Change, 0)
+	err = b.view(func(txn *prefixTxn) error {
+		last, err = getUint64(txn, keyChangeLast)
+		if err != nil || last == 0 {
+			return err
+		}
+
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = prefixChange
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		it.Rewind()
+		if !it.ValidForPrefix(prefixChange) {
+			return nil
+		}
+
+		first = binary.BigEndian.Uint64(it.Item().Key()[len(prefixChange):])
+		for it.Seek(changeKey(offset)); it.ValidForPrefix(prefixChange) && len(changes) < limit; it.Next() {
+			var c Change
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &c)
+			})
+
+			if err != nil {
+				return err
+			}
+
+			changes = append(changes, c)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// ChangesExported return the offset of the last change exported to file, see cdc.Exporter.
+func (b badgerDB) ChangesExported() (offset uint64, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		offset, err = getUint64(txn, keyChangeExported)
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) SetChangesExported(offset uint64) error {
+	return b.update(func(txn *prefixTxn) error {
+		return setUint64(txn, keyChangeExported, offset)
+	})
+}
@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_Changes(t *testing.T) {
+	convey.Convey("Change log", t, func() {
+		s, _ := NewBadger(newInMemoryBadger(t))
+
+		convey.Convey("Empty change log", func() {
+			changes, first, last, err := s.Changes(1, 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(changes, convey.ShouldBeEmpty)
+			convey.So(first, convey.ShouldEqual, 0)
+			convey.So(last, convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("Offset is dense across append", func() {
+			_ = s.AppendChanges([]Change{{Index: 3, Key: "a"}, {Index: 3, Key: "b"}}, 0)
+			_ = s.AppendChanges([]Change{{Index: 5, Key: "c"}}, 0)
+
+			changes, first, last, err := s.Changes(2, 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(first, convey.ShouldEqual, 1)
+			convey.So(last, convey.ShouldEqual, 3)
+			convey.So(len(changes), convey.ShouldEqual, 2)
+			convey.So(changes[0].Offset, convey.ShouldEqual, 2)
+			convey.So(changes[0].Key, convey.ShouldEqual, "b")
+			convey.So(changes[1].Index, convey.ShouldEqual, 5)
+		})
+
+		convey.Convey("Change of an entry already recorded is skipped", func() {
+			_ = s.AppendChanges([]Change{{Index: 3, Key: "a"}, {Index: 3, Key: "b"}}, 0)
+			_ = s.AppendChanges([]Change{{Index: 3, Key: "a"}, {Index: 3, Key: "b"}}, 0)
+			_ = s.AppendChanges([]Change{{Index: 2, Key: "c"}}, 0)
+
+			_, _, last, err := s.Changes(1, 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(last, convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Old change is deleted by retention", func() {
+			for i := 0; i < 5; i++ {
+				_ = s.AppendChanges([]Change{{Key: "k"}}, 2)
+			}
+
+			changes, first, last, _ := s.Changes(1, 10)
+			convey.So(first, convey.ShouldEqual, 4)
+			convey.So(last, convey.ShouldEqual, 5)
+			convey.So(len(changes), convey.ShouldEqual, 2)
+		})
+	})
+}
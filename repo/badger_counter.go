@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+	ErrOutOfRange = errors.New("value would be out of the counter bounds")
+)
+
+// CounterOptions is used by IncrBy.
+// Min and Max is the inclusive bounds of the counter, update outside the bounds is rejected with ErrOutOfRange,
+// or saturated to the bound when Clamp is true.
+// When MustExist is true, missing key is not created but rejected with ErrKeyNotFound.
+type CounterOptions struct {
+	Min       *int64
+	Max       *int64
+	Clamp     bool
+	MustExist bool
+}
+
+// IncrBy save the counter as decimal text, so it is still a valid JSON number when read using Get,
+// but parsed using strconv instead of json to keep all 64 bit precision.
+func (b badgerDB) IncrBy(key string, delta int64, opt CounterOptions) (value int64, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		var current int64
+
+		item, err := getItem(txn, key)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case item == nil && opt.MustExist:
+			return ErrKeyNotFound
+
+		case item == nil:
+			// counter keep the expiry time and flags of the key
+			item = &Item{}
+
+		default:
+			val := bytes.TrimSpace(item.Value)
+
+			// integer saved as JSON string, for example by SET command in RESP
+			var str string
+			if !item.Raw && len(val) > 0 && val[0] == '"' && json.Unmarshal(val, &str) == nil {
+				val = []byte(str)
+			}
+
+			current, err = strconv.ParseInt(string(val), 10, 64)
+			if err != nil {
+				return ErrNotInteger
+			}
+		}
+
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			return ErrOverflow
+		}
+
+		value = current + delta
+		if opt.Min != nil && value < *opt.Min {
+			if !opt.Clamp {
+				return fmt.Errorf("%w: %d is less than %d", ErrOutOfRange, value, *opt.Min)
+			}
+			value = *opt.Min
+		}
+
+		if opt.Max != nil && value > *opt.Max {
+			if !opt.Clamp {
+				return fmt.Errorf("%w: %d is greater than %d", ErrOutOfRange, value, *opt.Max)
+			}
+			value = *opt.Max
+		}
+
+		_, err = putValue(txn, []byte(key), []byte(strconv.FormatInt(value, 10)), item.ExpireAt, item.Flags, false)
+		return err
+	})
+
+	return
+}
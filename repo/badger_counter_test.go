@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_IncrBy(t *testing.T) {
+	convey.Convey("Counter", t, func() {
+		s, _ := NewBadger(newInMemoryBadger(t))
+
+		convey.Convey("Missing key start from zero", func() {
+			v, err := s.IncrBy("hits", 1, CounterOptions{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, 1)
+
+			v, _ = s.IncrBy("hits", -3, CounterOptions{})
+			convey.So(v, convey.ShouldEqual, -2)
+		})
+
+		convey.Convey("Keep int64 precision", func() {
+			var big int64 = 1<<62 + 1
+			v, err := s.IncrBy("big", big, CounterOptions{})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, big)
+
+			v, _ = s.IncrBy("big", 1, CounterOptions{})
+			convey.So(v, convey.ShouldEqual, big+1)
+
+			_, err = s.IncrBy("big", math.MaxInt64, CounterOptions{})
+			convey.So(err, convey.ShouldEqual, ErrOverflow)
+		})
+
+		convey.Convey("Reject update out of bounds", func() {
+			min, max := int64(0), int64(2)
+			_, _ = s.IncrBy("stock", 2, CounterOptions{Min: &min, Max: &max})
+
+			_, err := s.IncrBy("stock", 1, CounterOptions{Min: &min, Max: &max})
+			convey.So(errors.Is(err, ErrOutOfRange), convey.ShouldBeTrue)
+
+			_, err = s.IncrBy("stock", -3, CounterOptions{Min: &min, Max: &max})
+			convey.So(errors.Is(err, ErrOutOfRange), convey.ShouldBeTrue)
+
+			v, _ := s.IncrBy("stock", -2, CounterOptions{Min: &min, Max: &max})
+			convey.So(v, convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("Clamp update out of bounds", func() {
+			min := int64(0)
+			_, _ = s.IncrBy("stock", 2, CounterOptions{})
+
+			v, err := s.IncrBy("stock", -5, CounterOptions{Min: &min, Clamp: true})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("Reject missing key when must exist", func() {
+			_, err := s.IncrBy("missing", 1, CounterOptions{MustExist: true})
+			convey.So(err, convey.ShouldEqual, ErrKeyNotFound)
+		})
+
+		convey.Convey("Reject non integer value", func() {
+			_ = s.Set("name", "canoe")
+			_, err := s.IncrBy("name", 1, CounterOptions{})
+			convey.So(err, convey.ShouldEqual, ErrNotInteger)
+		})
+	})
+}
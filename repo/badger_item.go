@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+var (
+	ErrKeyExists        = errors.New("key already exists")
+	ErrKeyNotFound      = errors.New("key not found")
+	ErrRevisionMismatch = errors.New("key is modified since the given revision")
+)
+
+// SetMode is the condition checked before the value is written by SetItem.
+type SetMode int
+
+const (
+	SetAlways    SetMode = iota
+	SetIfAbsent          // fail with ErrKeyExists when the key exists
+	SetIfPresent         // fail with ErrKeyNotFound when the key does not exist
+)
+
+// Item is the value of a key with its metadata.
+// Value is the stored bytes, it is JSON unless Raw is true.
+// Revision is changed every time the key is written, it is the same in every replica.
+type Item struct {
+	Key      string `json:"key"`
+	Value    []byte `json:"value"`
+	Raw      bool   `json:"raw"`
+	Flags    uint32 `json:"flags"`
+	Revision uint64 `json:"revision"`
+	ExpireAt int64  `json:"expire_at"`
+}
+
+// SetOptions is used by SetItem.
+// When Revision is not zero, the value is only written when current revision of the key is equal to it.
+type SetOptions struct {
+	Mode     SetMode
+	Revision uint64
+	ExpireAt int64
+	Flags    uint32
+	Raw      bool
+}
+
+// itemMeta is saved in prefixMeta + key next to the value.
+// expireAt is kept here instead of badger expiry time, which is checked against the local clock of each replica.
+type itemMeta struct {
+	revision uint64
+	flags    uint32
+	raw      bool
+	expireAt int64
+}
+
+func (m itemMeta) encode() []byte {
+	out := make([]byte, 21)
+	binary.BigEndian.PutUint64(out, m.revision)
+	binary.BigEndian.PutUint32(out[8:], m.flags)
+	if m.raw {
+		out[12] = 1
+	}
+	binary.BigEndian.PutUint64(out[13:], uint64(m.expireAt))
+
+	return out
+}
+
+// decodeItemMeta also read the metadata written before revision is added to it, which only has expireAt.
+func decodeItemMeta(b []byte) (m itemMeta) {
+	if len(b) == 8 {
+		m.expireAt = int64(binary.BigEndian.Uint64(b))
+		return
+	}
+
+	if len(b) != 21 {
+		return
+	}
+
+	m.revision = binary.BigEndian.Uint64(b)
+	m.flags = binary.BigEndian.Uint32(b[8:])
+	m.raw = b[12] == 1
+	m.expireAt = int64(binary.BigEndian.Uint64(b[13:]))
+	return
+}
+
+func metaKey(key []byte) []byte {
+	return append(append([]byte{}, prefixMeta...), key...)
+}
+
+// nextRevision increment the global revision counter.
+// The FSM apply command sequentially, so the same command get the same revision in every replica.
+func nextRevision(txn *prefixTxn) (uint64, error) {
+	var rev uint64
+	item, err := txn.Get(keyRevision)
+	switch {
+	case err == badger.ErrKeyNotFound:
+	case err != nil:
+		return 0, err
+	default:
+		err = item.Value(func(val []byte) error {
+			if len(val) == 8 {
+				rev = binary.BigEndian.Uint64(val)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	rev++
+	val := make([]byte, 8)
+	binary.BigEndian.PutUint64(val, rev)
+	return rev, txn.Set(keyRevision, val)
+}
+
+// putValue write user value and its metadata with a new revision.
+// All write to user key must go through this function, so the revision is always changed.
+func putValue(txn *prefixTxn, key, value []byte, expireAt int64, flags uint32, raw bool) (uint64, error) {
+	rev, err := nextRevision(txn)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = txn.Set(key, value); err != nil {
+		return 0, err
+	}
+
+	meta := itemMeta{revision: rev, flags: flags, raw: raw, expireAt: expireAt}
+	return rev, txn.Set(metaKey(key), meta.encode())
+}
+
+// deleteValue delete user value and its metadata.
+func deleteValue(txn *prefixTxn, key []byte) error {
+	if err := txn.Delete(key); err != nil {
+		return err
+	}
+
+	return txn.Delete(metaKey(key))
+}
+
+// readItem return the value and metadata of user key even when it is expired, nil item when it does not exist.
+func readItem(txn *prefixTxn, key []byte) (*badger.Item, itemMeta, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, itemMeta{}, nil
+	}
+
+	if err != nil {
+		return nil, itemMeta{}, err
+	}
+
+	var meta itemMeta
+	metaItem, err := txn.Get(metaKey(key))
+	switch {
+	case err == badger.ErrKeyNotFound:
+		// written before the metadata is introduced, it never expire
+	case err != nil:
+		return nil, itemMeta{}, err
+	default:
+		err = metaItem.Value(func(val []byte) error {
+			meta = decodeItemMeta(val)
+			return nil
+		})
+
+		if err != nil {
+			return nil, itemMeta{}, err
+		}
+	}
+
+	return item, meta, nil
+}
+
+// lookup is like readItem, but expired key does not exist.
+func lookup(txn *prefixTxn, key []byte) (*badger.Item, itemMeta, error) {
+	item, meta, err := readItem(txn, key)
+	if err != nil || item == nil || txn.expired(meta.expireAt) {
+		return nil, itemMeta{}, err
+	}
+
+	return item, meta, nil
+}
+
+// getItem return nil item when the key does not exist or expired.
+func getItem(txn *prefixTxn, key string) (*Item, error) {
+	item, meta, err := lookup(txn, []byte(key))
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Item{
+		Key:      key,
+		Value:    value,
+		Raw:      meta.raw,
+		Flags:    meta.flags,
+		Revision: meta.revision,
+		ExpireAt: meta.expireAt,
+	}, nil
+}
+
+// GetItems return the item of each key, nil for the key which does not exist.
+func (b badgerDB) GetItems(keys ...string) (items []*Item, err error) {
+	items = make([]*Item, len(keys))
+	err = b.view(func(txn *prefixTxn) error {
+		for i, key := range keys {
+			items[i], err = getItem(txn, key)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// SetItem write the value as is after checking the condition in opt. It returns the new revision of the key.
+func (b badgerDB) SetItem(key string, value []byte, opt SetOptions) (rev uint64, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		current, err := getItem(txn, key)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case opt.Mode == SetIfAbsent && current != nil:
+			return ErrKeyExists
+		case opt.Mode == SetIfPresent && current == nil:
+			return ErrKeyNotFound
+		case opt.Revision != 0 && current == nil:
+			return ErrKeyNotFound
+		case opt.Revision != 0 && current.Revision != opt.Revision:
+			return ErrRevisionMismatch
+		}
+
+		rev, err = putValue(txn, []byte(key), value, opt.ExpireAt, opt.Flags, opt.Raw)
+		return err
+	})
+
+	return
+}
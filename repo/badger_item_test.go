@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_SetItem(t *testing.T) {
+	convey.Convey("Item with revision", t, func() {
+		s, _ := NewBadger(newInMemoryBadger(t))
+
+		rev, err := s.SetItem("foo", []byte(`"bar"`), SetOptions{Flags: 7})
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Get return metadata", func() {
+			items, err := s.GetItems("foo", "missing")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(items[1], convey.ShouldBeNil)
+			convey.So(items[0].Revision, convey.ShouldEqual, rev)
+			convey.So(items[0].Flags, convey.ShouldEqual, 7)
+			convey.So(s.Get("foo"), convey.ShouldEqual, "bar")
+		})
+
+		convey.Convey("Every write change the revision", func() {
+			_ = s.Set("foo", "baz")
+			items, _ := s.GetItems("foo")
+			convey.So(items[0].Revision, convey.ShouldBeGreaterThan, rev)
+		})
+
+		convey.Convey("Conditional write", func() {
+			_, err := s.SetItem("foo", []byte(`1`), SetOptions{Mode: SetIfAbsent})
+			convey.So(err, convey.ShouldEqual, ErrKeyExists)
+
+			_, err = s.SetItem("other", []byte(`1`), SetOptions{Mode: SetIfPresent})
+			convey.So(err, convey.ShouldEqual, ErrKeyNotFound)
+
+			_, err = s.SetItem("foo", []byte(`1`), SetOptions{Revision: rev + 100})
+			convey.So(err, convey.ShouldEqual, ErrRevisionMismatch)
+
+			newRev, err := s.SetItem("foo", []byte(`1`), SetOptions{Revision: rev})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(newRev, convey.ShouldBeGreaterThan, rev)
+		})
+
+		convey.Convey("Delete remove metadata", func() {
+			n, _ := s.Delete("foo")
+			convey.So(n, convey.ShouldEqual, 1)
+
+			items, _ := s.GetItems("foo")
+			convey.So(items[0], convey.ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,227 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// SetExpireAt is like Set, but the key is expired at expireAt (unix second).
+// The expiry time is absolute and checked against the clock of the repo, see Clock.
+func (b badgerDB) SetExpireAt(key string, value interface{}, expireAt int64) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return b.update(func(txn *prefixTxn) error {
+		_, err := putValue(txn, []byte(key), data, expireAt, 0, false)
+		return err
+	})
+}
+
+func (b badgerDB) Has(key string) (exist bool, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		item, _, err := lookup(txn, []byte(key))
+		exist = item != nil
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) Delete(keys ...string) (deleted int, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		deleted = 0
+		for _, key := range keys {
+			item, meta, err := readItem(txn, []byte(key))
+			if err != nil {
+				return err
+			}
+
+			if item == nil {
+				continue
+			}
+
+			// expired key is removed too, but it is not counted
+			if err = deleteValue(txn, []byte(key)); err != nil {
+				return err
+			}
+
+			if !txn.expired(meta.expireAt) {
+				deleted++
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (b badgerDB) MSet(keys []string, values []interface{}) error {
+	if len(keys) != len(values) {
+		return fmt.Errorf("got %d keys but %d values", len(keys), len(values))
+	}
+
+	return b.update(func(txn *prefixTxn) error {
+		for i, key := range keys {
+			data, err := json.Marshal(values[i])
+			if err != nil {
+				return err
+			}
+
+			if _, err = putValue(txn, []byte(key), data, 0, 0, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Expire set the expiry time of existing key, expireAt <= 0 remove the expiry time.
+// The revision of the key is not changed.
+func (b badgerDB) Expire(key string, expireAt int64) (exist bool, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		item, err := getItem(txn, key)
+		if err != nil || item == nil {
+			return err
+		}
+
+		exist = true
+		if expireAt < 0 {
+			expireAt = 0
+		}
+
+		meta := itemMeta{revision: item.Revision, flags: item.Flags, raw: item.Raw, expireAt: expireAt}
+		return txn.Set(metaKey([]byte(key)), meta.encode())
+	})
+
+	return
+}
+
+// Scan iterate user keys in lexical order, skipping offset keys from the first one.
+// At most count keys are examined, the returned keys is the examined keys matching the glob pattern (empty match all).
+// next is the offset for the next call, 0 means the iteration is complete.
+func (b badgerDB) Scan(offset uint64, count int, match string) (keys []string, next uint64, err error) {
+	keys = make([]string, 0)
+	if count <= 0 {
+		count = 10
+	}
+
+	err = b.view(func(txn *prefixTxn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		var pos uint64
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			if bytes.HasPrefix(key, []byte(internalPrefix)) {
+				continue
+			}
+
+			ok, err := live(txn, key)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				continue
+			}
+
+			pos++
+			if pos <= offset {
+				continue
+			}
+
+			if match == "" {
+				keys = append(keys, string(key))
+			} else if ok, _ := path.Match(match, string(key)); ok {
+				keys = append(keys, string(key))
+			}
+
+			if pos-offset >= uint64(count) {
+				next = pos
+				return nil
+			}
+		}
+
+		next = 0
+		return nil
+	})
+
+	return
+}
+
+// live return true when the user key is not expired.
+func live(txn *prefixTxn, key []byte) (bool, error) {
+	item, _, err := lookup(txn, key)
+	return item != nil, err
+}
+
+// ExpiredKeys return at most limit user keys which are expired at now, they are still saved until PurgeExpired.
+func (b badgerDB) ExpiredKeys(now int64, limit int) (keys []string, err error) {
+	keys = make([]string, 0)
+	err = b.view(func(txn *prefixTxn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = prefixMeta
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid() && len(keys) < limit; it.Next() {
+			item := it.Item()
+			var meta itemMeta
+			err := item.Value(func(val []byte) error {
+				meta = decodeItemMeta(val)
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if meta.expireAt > 0 && meta.expireAt <= now {
+				keys = append(keys, string(item.Key()[len(prefixMeta):]))
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// PurgeExpired delete the keys which are expired at the clock of the repo, other keys are kept.
+func (b badgerDB) PurgeExpired(keys ...string) (purged int, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		purged = 0
+		for _, key := range keys {
+			item, meta, err := readItem(txn, []byte(key))
+			if err != nil {
+				return err
+			}
+
+			if item == nil || !txn.expired(meta.expireAt) {
+				continue
+			}
+
+			if err = deleteValue(txn, []byte(key)); err != nil {
+				return err
+			}
+
+			purged++
+		}
+
+		return nil
+	})
+
+	return
+}
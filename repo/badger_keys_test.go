@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_Expiry(t *testing.T) {
+	convey.Convey("Key expiry is decided by the clock of the repo", t, func() {
+		s, _ := NewBadger(newInMemoryBadger(t))
+
+		convey.So(s.SetExpireAt("session", "abc", 1000), convey.ShouldBeNil)
+		convey.So(s.Set("forever", "x"), convey.ShouldBeNil)
+
+		convey.Convey("Key is visible before the expiry time", func() {
+			before := s.Clock(999)
+			ok, _ := before.Has("session")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(before.Get("session"), convey.ShouldEqual, "abc")
+
+			items, _ := before.GetItems("session")
+			convey.So(items[0].ExpireAt, convey.ShouldEqual, 1000)
+		})
+
+		convey.Convey("Key is hidden at the expiry time", func() {
+			after := s.Clock(1000)
+			ok, _ := after.Has("session")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			items, _ := after.GetItems("session")
+			convey.So(items[0], convey.ShouldBeNil)
+
+			keys, _, _ := after.Scan(0, 10, "")
+			convey.So(keys, convey.ShouldResemble, []string{"forever"})
+
+			n, _ := after.IncrBy("session", 1, CounterOptions{})
+			convey.So(n, convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("Zero clock never expire a key", func() {
+			ok, _ := s.Clock(0).Has("session")
+			convey.So(ok, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Expire change only the expiry time", func() {
+			items, _ := s.Clock(999).GetItems("session")
+			ok, err := s.Clock(999).Expire("session", 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ok, convey.ShouldBeTrue)
+
+			after, _ := s.Clock(2000).GetItems("session")
+			convey.So(after[0], convey.ShouldNotBeNil)
+			convey.So(after[0].Revision, convey.ShouldEqual, items[0].Revision)
+		})
+
+		convey.Convey("Expired key is purged only when it is expired at the clock", func() {
+			keys, err := s.ExpiredKeys(1000, 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"session"})
+
+			n, _ := s.Clock(999).PurgeExpired(keys...)
+			convey.So(n, convey.ShouldEqual, 0)
+
+			n, _ = s.Clock(1000).PurgeExpired(append(keys, "forever")...)
+			convey.So(n, convey.ShouldEqual, 1)
+
+			ok, _ := s.Clock(0).Has("session")
+			convey.So(ok, convey.ShouldBeFalse)
+			keys, _ = s.ExpiredKeys(1000, 10)
+			convey.So(keys, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("Deleted expired key is not counted", func() {
+			n, _ := s.Clock(1000).Delete("session", "forever")
+			convey.So(n, convey.ShouldEqual, 1)
+
+			ok, _ := s.Clock(0).Has("session")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
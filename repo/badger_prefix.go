@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// prefixTxn is badger transaction inside the keyspace of the repo.
+// Key given to it and returned by its iterator is without the prefix, so the repo code is the same for every keyspace.
+type prefixTxn struct {
+	*badger.Txn
+	prefix []byte
+
+	// failed keep the first write error when the transaction is shared by several repo call, see Atomic
+	failed *error
+
+	// now is the unix second when the transaction run, key expired at or before it is hidden
+	now int64
+}
+
+func (t *prefixTxn) expired(expireAt int64) bool {
+	return expireAt > 0 && expireAt <= t.now
+}
+
+func (t *prefixTxn) fail(err error) error {
+	if err != nil && t.failed != nil && *t.failed == nil {
+		*t.failed = err
+	}
+
+	return err
+}
+
+func (t *prefixTxn) key(key []byte) []byte {
+	if len(t.prefix) == 0 {
+		return key
+	}
+
+	return append(append(make([]byte, 0, len(t.prefix)+len(key)), t.prefix...), key...)
+}
+
+func (t *prefixTxn) Get(key []byte) (*badger.Item, error) {
+	return t.Txn.Get(t.key(key))
+}
+
+func (t *prefixTxn) Set(key, val []byte) error {
+	return t.fail(t.Txn.Set(t.key(key), val))
+}
+
+func (t *prefixTxn) SetEntry(e *badger.Entry) error {
+	e.Key = t.key(e.Key)
+	return t.fail(t.Txn.SetEntry(e))
+}
+
+func (t *prefixTxn) Delete(key []byte) error {
+	return t.fail(t.Txn.Delete(t.key(key)))
+}
+
+// NewIterator iterate only the keys in the keyspace, even when opt.Prefix is empty.
+func (t *prefixTxn) NewIterator(opt badger.IteratorOptions) *prefixIterator {
+	opt.Prefix = t.key(opt.Prefix)
+	return &prefixIterator{
+		Iterator: t.Txn.NewIterator(opt),
+		prefix:   t.prefix,
+	}
+}
+
+type prefixIterator struct {
+	*badger.Iterator
+	prefix []byte
+}
+
+func (it *prefixIterator) Seek(key []byte) {
+	it.Iterator.Seek(append(append(make([]byte, 0, len(it.prefix)+len(key)), it.prefix...), key...))
+}
+
+func (it *prefixIterator) Valid() bool {
+	return it.Iterator.ValidForPrefix(it.prefix)
+}
+
+func (it *prefixIterator) ValidForPrefix(prefix []byte) bool {
+	return it.Iterator.ValidForPrefix(append(append(make([]byte, 0, len(it.prefix)+len(prefix)), it.prefix...), prefix...))
+}
+
+// Item return the item with the key without the prefix, the value is read from badger item.
+func (it *prefixIterator) Item() *prefixItem {
+	return &prefixItem{Item: it.Iterator.Item(), prefix: it.prefix}
+}
+
+type prefixItem struct {
+	*badger.Item
+	prefix []byte
+}
+
+func (i *prefixItem) Key() []byte {
+	return i.Item.Key()[len(i.prefix):]
+}
+
+func (i *prefixItem) KeyCopy(dst []byte) []byte {
+	return append(dst[:0], i.Key()...)
+}
+
+// Clock return the repo which decide whether a key is expired at now instead of the local clock.
+// The FSM use the time stamped in the log entry by the leader, so every replica see the same keys expired.
+// Zero now never expire a key.
+func (b badgerDB) Clock(now int64) Service {
+	b.now, b.fixed = now, true
+	return b
+}
+
+func (b badgerDB) clock() int64 {
+	if b.fixed {
+		return b.now
+	}
+
+	return time.Now().Unix()
+}
+
+// view and update run fn in read-only and read-write transaction of the keyspace.
+// Repo given by Atomic run fn in its transaction instead.
+func (b badgerDB) view(fn func(txn *prefixTxn) error) error {
+	if b.txn != nil {
+		return fn(b.shared())
+	}
+
+	return b.db.View(func(txn *badger.Txn) error {
+		return fn(&prefixTxn{Txn: txn, prefix: b.prefix, now: b.clock()})
+	})
+}
+
+func (b badgerDB) update(fn func(txn *prefixTxn) error) error {
+	if b.txn != nil {
+		return fn(b.shared())
+	}
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		return fn(&prefixTxn{Txn: txn, prefix: b.prefix, now: b.clock()})
+	})
+}
+
+func (b badgerDB) shared() *prefixTxn {
+	return &prefixTxn{Txn: b.txn, prefix: b.prefix, failed: b.failed, now: b.clock()}
+}
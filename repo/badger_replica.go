@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// Replication role of the cluster, empty role means replication is never configured.
+const (
+	RoleStandby = "standby"
+	RolePrimary = "primary"
+)
+
+// ReplicaState is the cross-cluster replication state of this cluster.
+// AppliedIndex is the raft index of the primary cluster which is applied by this standby,
+// it is saved by the same command which apply the operations, so it is the checkpoint to resume from.
+// UpdatedAt is the unix nano time of the primary when the last batch is shipped.
+// SeedIndex is the primary index of the data copied by the seed in progress, the data of the standby is incomplete
+// until the seed is done, see SeedData.
+type ReplicaState struct {
+	Role         string `json:"role"`
+	AppliedIndex uint64 `json:"applied_index"`
+	UpdatedAt    int64  `json:"updated_at"`
+	SeedIndex    uint64 `json:"seed_index,omitempty"`
+}
+
+func (b badgerDB) ReplicaState() (state ReplicaState, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		item, err := txn.Get(keyReplicaState)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &state)
+		})
+	})
+
+	return
+}
+
+func (b badgerDB) SetReplicaState(state ReplicaState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return b.update(func(txn *prefixTxn) error {
+		return txn.Set(keyReplicaState, data)
+	})
+}
+
+// ClearData delete at most limit keys of data, it return the number of deleted keys, 0 when no data is left.
+// It is called until nothing is deleted before the standby is seeded, so every transaction stay small.
+func (b badgerDB) ClearData(limit int) (deleted int, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		keys := make([][]byte, 0, limit)
+
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+
+		it := txn.NewIterator(opt)
+		for it.Rewind(); it.Valid() && len(keys) < limit; it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if b.owns(key) && isDataKey(key) {
+				keys = append(keys, key)
+			}
+		}
+		it.Close()
+
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		deleted = len(keys)
+		return nil
+	})
+
+	return
+}
+
+// SeedData write the data copied from the snapshot of the primary cluster as is, see Snapshot.ForEachData.
+// Entry which is not data is refused, so the seed never change the state of the standby cluster itself.
+func (b badgerDB) SeedData(entries []SnapshotEntry) error {
+	return b.update(func(txn *prefixTxn) error {
+		for _, entry := range entries {
+			if !isDataKey(entry.Key) {
+				return fmt.Errorf("seed entry %q is not data", entry.Key)
+			}
+
+			e := badger.NewEntry(entry.Key, entry.Value)
+			e.ExpiresAt = entry.ExpireAt
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+var (
+	ErrSequenceExists    = errors.New("sequence already exists")
+	ErrSequenceNotFound  = errors.New("sequence not found")
+	ErrSequenceExhausted = errors.New("sequence exhausted")
+)
+
+// Sequence is a named, strictly increasing ID generator.
+// Next is the first ID which is not reserved yet.
+type Sequence struct {
+	Name     string `json:"name"`
+	Next     int64  `json:"next"`
+	Reserved int64  `json:"reserved"`
+}
+
+// Reservation is a block of ID from First to Last (inclusive) owned by the caller.
+// The IDs which are not used by the caller is never given to others, so the sequence may have gap.
+type Reservation struct {
+	Name  string `json:"name"`
+	First int64  `json:"first"`
+	Last  int64  `json:"last"`
+}
+
+func getSequence(txn *prefixTxn, name string) (seq Sequence, err error) {
+	item, err := txn.Get(append(prefixSequence, name...))
+	if err == badger.ErrKeyNotFound {
+		return seq, fmt.Errorf("%w: %s", ErrSequenceNotFound, name)
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &seq)
+	})
+	return
+}
+
+func putSequence(txn *prefixTxn, seq Sequence) error {
+	data, err := json.Marshal(seq)
+	if err != nil {
+		return err
+	}
+
+	return txn.Set(append(prefixSequence, seq.Name...), data)
+}
+
+func (b badgerDB) SeqCreate(name string, start int64) (seq Sequence, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		_, err := getSequence(txn, name)
+		if err == nil {
+			return fmt.Errorf("%w: %s", ErrSequenceExists, name)
+		}
+
+		if !errors.Is(err, ErrSequenceNotFound) {
+			return err
+		}
+
+		seq = Sequence{Name: name, Next: start}
+		return putSequence(txn, seq)
+	})
+
+	return
+}
+
+func (b badgerDB) SeqReserve(name string, count int64) (r Reservation, err error) {
+	if count <= 0 {
+		return r, fmt.Errorf("count must be positive")
+	}
+
+	err = b.update(func(txn *prefixTxn) error {
+		seq, err := getSequence(txn, name)
+		if err != nil {
+			return err
+		}
+
+		if seq.Next > math.MaxInt64-count {
+			return fmt.Errorf("%w: %s", ErrSequenceExhausted, name)
+		}
+
+		r = Reservation{Name: name, First: seq.Next, Last: seq.Next + count - 1}
+		seq.Next += count
+		seq.Reserved += count
+		return putSequence(txn, seq)
+	})
+
+	return
+}
+
+func (b badgerDB) SeqInfo(name string) (seq Sequence, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		seq, err = getSequence(txn, name)
+		return err
+	})
+
+	return
+}
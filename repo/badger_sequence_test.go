@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_Sequence(t *testing.T) {
+	convey.Convey("Sequence", t, func() {
+		s, _ := NewBadger(newInMemoryBadger(t))
+
+		_, err := s.SeqCreate("orders", 100)
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("Create twice is rejected", func() {
+			_, err := s.SeqCreate("orders", 1)
+			convey.So(errors.Is(err, ErrSequenceExists), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Reserve consecutive block", func() {
+			r, err := s.SeqReserve("orders", 1000)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(r.First, convey.ShouldEqual, 100)
+			convey.So(r.Last, convey.ShouldEqual, 1099)
+
+			r, _ = s.SeqReserve("orders", 1)
+			convey.So(r.First, convey.ShouldEqual, 1100)
+			convey.So(r.Last, convey.ShouldEqual, 1100)
+
+			seq, _ := s.SeqInfo("orders")
+			convey.So(seq.Next, convey.ShouldEqual, 1101)
+			convey.So(seq.Reserved, convey.ShouldEqual, 1001)
+		})
+
+		convey.Convey("Unknown sequence", func() {
+			_, err := s.SeqReserve("invoices", 1)
+			convey.So(errors.Is(err, ErrSequenceNotFound), convey.ShouldBeTrue)
+		})
+	})
+}
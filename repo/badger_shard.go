@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+func getBytes(txn *prefixTxn, key []byte) (val []byte, err error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+// ShardMap return the encoded shard map replicated by this keyspace, nil when sharding is not initialized.
+func (b badgerDB) ShardMap() (data []byte, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		data, err = getBytes(txn, keyShardMap)
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) SetShardMap(data []byte) error {
+	return b.update(func(txn *prefixTxn) error {
+		return txn.Set(keyShardMap, data)
+	})
+}
+
+// ShardFence return the encoded part of the keyspace which is moved out of this keyspace, nil when nothing is moved.
+func (b badgerDB) ShardFence() (data []byte, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		data, err = getBytes(txn, keyShardFence)
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) SetShardFence(data []byte) error {
+	return b.update(func(txn *prefixTxn) error {
+		return txn.Set(keyShardFence, data)
+	})
+}
+
+// ForEachKey call fn with every key which has data: user key, sorted set and sequence.
+// Sorted set is reported once for each member, iteration stops when fn return false.
+func (b badgerDB) ForEachKey(fn func(key string) bool) error {
+	return b.view(func(txn *prefixTxn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()
+
+			var name string
+			switch {
+			case !bytes.HasPrefix(key, []byte(internalPrefix)):
+				ok, err := live(txn, key)
+				if err != nil {
+					return err
+				}
+
+				if !ok {
+					continue
+				}
+				name = string(key)
+
+			case bytes.HasPrefix(key, prefixZSetMember):
+				rest := key[len(prefixZSetMember):]
+				if len(rest) < 4 {
+					continue
+				}
+
+				n := binary.BigEndian.Uint32(rest)
+				if uint32(len(rest)-4) < n {
+					continue
+				}
+				name = string(rest[4 : 4+n])
+
+			case bytes.HasPrefix(key, prefixSequence):
+				name = string(key[len(prefixSequence):])
+
+			default:
+				continue
+			}
+
+			if !fn(name) {
+				return nil
+			}
+		}
+
+		return nil
+	})
+}
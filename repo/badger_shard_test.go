@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_Keyspace(t *testing.T) {
+	convey.Convey("Keyspace sharing one badger instance", t, func() {
+		db := newInMemoryBadger(t)
+		def, _ := NewBadger(db)
+		orders, err := NewBadgerKeyspace(db, "\x00g/orders/")
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.So(def.Set("foo", "default"), convey.ShouldBeNil)
+		convey.So(orders.Set("foo", "orders"), convey.ShouldBeNil)
+		_, err = orders.ZAdd("board", "alice", 1)
+		convey.So(err, convey.ShouldBeNil)
+		_, err = orders.SeqCreate("invoice", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(orders.SetAppliedIndex(7), convey.ShouldBeNil)
+
+		convey.Convey("Prefix must be internal", func() {
+			_, err := NewBadgerKeyspace(db, "orders/")
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Each keyspace see its own value", func() {
+			convey.So(def.Get("foo"), convey.ShouldEqual, "default")
+			convey.So(orders.Get("foo"), convey.ShouldEqual, "orders")
+
+			applied, _ := def.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 0)
+			applied, _ = orders.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 7)
+		})
+
+		convey.Convey("Scan does not see other keyspace", func() {
+			keys, _, err := def.Scan(0, 100, "")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"foo"})
+
+			keys, _, _ = orders.Scan(0, 100, "")
+			convey.So(keys, convey.ShouldResemble, []string{"foo"})
+		})
+
+		convey.Convey("ForEachKey report user key, sorted set and sequence", func() {
+			var keys []string
+			convey.So(orders.ForEachKey(func(key string) bool {
+				keys = append(keys, key)
+				return true
+			}), convey.ShouldBeNil)
+
+			sort.Strings(keys)
+			convey.So(keys, convey.ShouldResemble, []string{"board", "foo", "invoice"})
+
+			keys = nil
+			convey.So(def.ForEachKey(func(key string) bool {
+				keys = append(keys, key)
+				return true
+			}), convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"foo"})
+		})
+
+		convey.Convey("Shard map is saved in the keyspace", func() {
+			data, err := def.ShardMap()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(data, convey.ShouldBeNil)
+
+			convey.So(def.SetShardMap([]byte(`{"version":1}`)), convey.ShouldBeNil)
+			data, _ = def.ShardMap()
+			convey.So(string(data), convey.ShouldEqual, `{"version":1}`)
+
+			data, _ = orders.ShardMap()
+			convey.So(data, convey.ShouldBeNil)
+		})
+	})
+}
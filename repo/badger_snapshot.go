@@ -0,0 +1,182 @@
+package repo
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// KeyspacePrefix is the prefix of the keyspace of each shard group, see NewBadgerKeyspace.
+// The repository without prefix does not include it in its snapshot, each group has its own snapshot.
+const KeyspacePrefix = internalPrefix + "g/"
+
+// SnapshotEntry is one badger key of the repository, including the internal keys. Key is without the keyspace prefix
+// and ExpireAt is the unix second when the key is expired, 0 when it never expire.
+type SnapshotEntry struct {
+	Key      []byte `json:"key"`
+	Value    []byte `json:"value"`
+	ExpireAt uint64 `json:"expire_at,omitempty"`
+}
+
+// Snapshot is the point-in-time view of the repository. It is not changed by the write after it is taken,
+// until it is released.
+type Snapshot interface {
+	// ForEach call fn with every entry in key order, stopping at the first error.
+	ForEach(fn func(entry SnapshotEntry) error) error
+
+	// ForEachData is like ForEach, but only the data written by the commands is given to fn, see Service.SeedData.
+	ForEachData(fn func(entry SnapshotEntry) error) error
+
+	// AppliedIndex is the last raft index applied to the data in the snapshot.
+	AppliedIndex() (uint64, error)
+
+	Release()
+}
+
+type badgerSnapshot struct {
+	repo badgerDB
+	txn  *badger.Txn
+}
+
+func (s badgerSnapshot) ForEach(fn func(entry SnapshotEntry) error) error {
+	txn := &prefixTxn{Txn: s.txn, prefix: s.repo.prefix}
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if !s.repo.owns(item.Key()) {
+			continue
+		}
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(SnapshotEntry{Key: item.KeyCopy(nil), Value: value, ExpireAt: item.ExpiresAt()}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s badgerSnapshot) ForEachData(fn func(entry SnapshotEntry) error) error {
+	return s.ForEach(func(entry SnapshotEntry) error {
+		if !isDataKey(entry.Key) {
+			return nil
+		}
+
+		return fn(entry)
+	})
+}
+
+func (s badgerSnapshot) AppliedIndex() (uint64, error) {
+	return getUint64(&prefixTxn{Txn: s.txn, prefix: s.repo.prefix}, keyAppliedIndex)
+}
+
+func (s badgerSnapshot) Release() {
+	s.txn.Discard()
+}
+
+// owns return false for the key of the other keyspace, which is visible to the repository without prefix.
+func (b badgerDB) owns(key []byte) bool {
+	return len(b.prefix) > 0 || !bytes.HasPrefix(key, []byte(KeyspacePrefix))
+}
+
+func (b badgerDB) Snapshot() Snapshot {
+	return badgerSnapshot{
+		repo: b,
+		txn:  b.db.NewTransaction(false),
+	}
+}
+
+// Restore replace every key of the repository with the entries returned by next, until it return nil entry.
+// The keys is written in batches, so the repository is only consistent when it return without error.
+// The applied index is deleted first and saved only after every other key, so a restore stopped in the middle,
+// for example by a crash, leave the applied index behind the snapshot and the FSM restore it again.
+func (b badgerDB) Restore(next func() (*SnapshotEntry, error)) error {
+	err := b.update(func(txn *prefixTxn) error {
+		return txn.Delete(keyAppliedIndex)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.deleteAll(); err != nil {
+		return err
+	}
+
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var applied *SnapshotEntry
+	txn := &prefixTxn{prefix: b.prefix}
+	for {
+		entry, err := next()
+		if err != nil {
+			return err
+		}
+
+		if entry == nil {
+			break
+		}
+
+		if bytes.Equal(entry.Key, keyAppliedIndex) {
+			applied = entry
+			continue
+		}
+
+		e := badger.NewEntry(txn.key(entry.Key), entry.Value)
+		e.ExpiresAt = entry.ExpireAt
+		if err := wb.SetEntry(e); err != nil {
+			return err
+		}
+	}
+
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+
+	if applied == nil {
+		return nil
+	}
+
+	return b.update(func(txn *prefixTxn) error {
+		return txn.Set(keyAppliedIndex, applied.Value)
+	})
+}
+
+// deleteAll delete every key of the repository, including the internal keys.
+func (b badgerDB) deleteAll() error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := b.view(func(txn *prefixTxn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			// the key is only valid until Next, the write batch keep it until flushed
+			key := it.Item().KeyCopy(nil)
+			if !b.owns(key) {
+				continue
+			}
+
+			if err := wb.Delete(txn.key(key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return wb.Flush()
+}
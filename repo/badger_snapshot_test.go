@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_Snapshot(t *testing.T) {
+	convey.Convey("Snapshot and restore of the keyspace", t, func() {
+		db := newInMemoryBadger(t)
+		def, _ := NewBadger(db)
+		orders, _ := NewBadgerKeyspace(db, KeyspacePrefix+"orders/")
+
+		convey.So(def.Set("foo", "bar"), convey.ShouldBeNil)
+		convey.So(def.SetExpireAt("session", "abc", 4102444800), convey.ShouldBeNil)
+		_, err := def.ZAdd("board", "alice", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(def.SetAppliedIndex(5), convey.ShouldBeNil)
+		convey.So(orders.Set("order-1", "paid"), convey.ShouldBeNil)
+
+		snap := def.Snapshot()
+		defer snap.Release()
+
+		// write after the snapshot is not in it
+		convey.So(def.Set("late", "value"), convey.ShouldBeNil)
+
+		var entries []SnapshotEntry
+		convey.So(snap.ForEach(func(entry SnapshotEntry) error {
+			entries = append(entries, entry)
+			return nil
+		}), convey.ShouldBeNil)
+
+		keys := map[string]SnapshotEntry{}
+		for _, e := range entries {
+			keys[string(e.Key)] = e
+		}
+
+		convey.So(keys, convey.ShouldContainKey, "foo")
+		convey.So(keys, convey.ShouldContainKey, "session")
+		convey.So(keys, convey.ShouldNotContainKey, "late")
+		for k := range keys {
+			convey.So(k, convey.ShouldNotStartWith, KeyspacePrefix)
+		}
+
+		convey.Convey("Restore replace only the keys of the repository", func() {
+			convey.So(def.Set("foo", "changed"), convey.ShouldBeNil)
+			convey.So(def.SetAppliedIndex(9), convey.ShouldBeNil)
+
+			i := 0
+			convey.So(def.Restore(func() (*SnapshotEntry, error) {
+				if i == len(entries) {
+					return nil, nil
+				}
+				i++
+				return &entries[i-1], nil
+			}), convey.ShouldBeNil)
+
+			convey.So(def.Get("foo"), convey.ShouldEqual, "bar")
+			items, _ := def.GetItems("session")
+			convey.So(items[0].ExpireAt, convey.ShouldEqual, 4102444800)
+			has, _ := def.Has("late")
+			convey.So(has, convey.ShouldBeFalse)
+
+			score, ok, err := def.ZScore("board", "alice")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(score, convey.ShouldEqual, 1)
+
+			applied, _ := def.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 5)
+			convey.So(orders.Get("order-1"), convey.ShouldEqual, "paid")
+		})
+
+		convey.Convey("Restore killed halfway leave the applied index unset", func() {
+			// big value so the write batch is committed several times before the restore stop
+			var big []SnapshotEntry
+			for _, e := range entries {
+				if bytes.Equal(e.Key, keyAppliedIndex) {
+					big = append(big, e)
+				}
+			}
+
+			for i := 0; i < 16; i++ {
+				big = append(big, SnapshotEntry{Key: []byte(fmt.Sprintf("big-%02d", i)), Value: bytes.Repeat([]byte("x"), 1<<20)})
+			}
+
+			i := 0
+			err := def.Restore(func() (*SnapshotEntry, error) {
+				if i == 14 {
+					return nil, errors.New("killed")
+				}
+				i++
+				return &big[i-1], nil
+			})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			has, _ := def.Has("big-00")
+			convey.So(has, convey.ShouldBeTrue)
+
+			applied, _ := def.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBadgerDB_Atomic(t *testing.T) {
+	convey.Convey("Atomic commit the writes with the applied index", t, func() {
+		s, _ := NewBadger(newInMemoryBadger(t))
+
+		convey.Convey("Write and applied index is committed together", func() {
+			err := s.Atomic(7, func(tx Service) error {
+				if _, err := tx.ZIncrBy("z", "a", 2); err != nil {
+					return err
+				}
+
+				// read own write inside the transaction
+				_, err := tx.ZIncrBy("z", "a", 3)
+				return err
+			})
+			convey.So(err, convey.ShouldBeNil)
+
+			score, _, _ := s.ZScore("z", "a")
+			convey.So(score, convey.ShouldEqual, 5)
+
+			applied, _ := s.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 7)
+		})
+
+		convey.Convey("Nothing is committed when fn fail", func() {
+			_ = s.SetAppliedIndex(3)
+			err := s.Atomic(4, func(tx Service) error {
+				_, _ = tx.ZAdd("z", "a", 1)
+				return errors.New("rejected")
+			})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, ok, _ := s.ZScore("z", "a")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			applied, _ := s.AppliedIndex()
+			convey.So(applied, convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("Nothing is committed when a write fail even if the error is ignored", func() {
+			err := s.Atomic(4, func(tx Service) error {
+				_, _ = tx.ZAdd("z", "a", 1)
+				_ = tx.Set("", "1")
+				return nil
+			})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, ok, _ := s.ZScore("z", "a")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
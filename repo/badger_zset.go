@@ -0,0 +1,260 @@
+package repo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// ZMember is one member of a sorted set with its score.
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// A sorted set is saved as two index in badger:
+// * member index: prefixZSetMember + key + member -> encoded score, used for lookup the score of member
+// * score index: prefixZSetScore + key + encoded score + member -> empty, used for range query
+func zMemberKey(key, member string) []byte {
+	return append(namespaced(prefixZSetMember, key), member...)
+}
+
+func zScoreKey(key string, score float64, member string) []byte {
+	out := append(namespaced(prefixZSetScore, key), encodeScore(score)...)
+	return append(out, member...)
+}
+
+// zScoreOf return current score of the member within the transaction.
+func zScoreOf(txn *prefixTxn, key, member string) (score float64, ok bool, err error) {
+	item, err := txn.Get(zMemberKey(key, member))
+	if err == badger.ErrKeyNotFound {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		if len(val) != 8 {
+			return fmt.Errorf("corrupt score of member %s in sorted set %s", member, key)
+		}
+
+		score = decodeScore(val)
+		return nil
+	})
+
+	return score, err == nil, err
+}
+
+// zPut replace the score of member, removing the old entry in score index if exist.
+func zPut(txn *prefixTxn, key, member string, score float64) (existed bool, err error) {
+	if math.IsNaN(score) {
+		return false, fmt.Errorf("score is not a number")
+	}
+
+	old, existed, err := zScoreOf(txn, key, member)
+	if err != nil {
+		return false, err
+	}
+
+	if existed {
+		if err = txn.Delete(zScoreKey(key, old, member)); err != nil {
+			return false, err
+		}
+	}
+
+	if err = txn.Set(zMemberKey(key, member), encodeScore(score)); err != nil {
+		return false, err
+	}
+
+	return existed, txn.Set(zScoreKey(key, score, member), []byte{})
+}
+
+// zScan iterate the score index of the set in ascending order.
+// Iteration stop when fn return false.
+func zScan(txn *prefixTxn, key string, seek []byte, fn func(m ZMember) bool) {
+	prefix := namespaced(prefixZSetScore, key)
+
+	opt := badger.DefaultIteratorOptions
+	opt.PrefetchValues = false
+	opt.Prefix = prefix
+
+	it := txn.NewIterator(opt)
+	defer it.Close()
+
+	for it.Seek(append(prefix, seek...)); it.ValidForPrefix(prefix); it.Next() {
+		rest := it.Item().Key()[len(prefix):]
+		m := ZMember{
+			Member: string(rest[8:]),
+			Score:  decodeScore(rest[:8]),
+		}
+
+		if !fn(m) {
+			return
+		}
+	}
+}
+
+// zCard return number of member in sorted set.
+func zCard(txn *prefixTxn, key string) (n int64) {
+	prefix := namespaced(prefixZSetMember, key)
+
+	opt := badger.DefaultIteratorOptions
+	opt.PrefetchValues = false
+	opt.Prefix = prefix
+
+	it := txn.NewIterator(opt)
+	defer it.Close()
+
+	for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+		n++
+	}
+
+	return
+}
+
+func (b badgerDB) ZAdd(key, member string, score float64) (added bool, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		existed, err := zPut(txn, key, member, score)
+		added = !existed
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) ZIncrBy(key, member string, delta float64) (score float64, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		old, _, err := zScoreOf(txn, key, member)
+		if err != nil {
+			return err
+		}
+
+		score = old + delta
+		_, err = zPut(txn, key, member, score)
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) ZRem(key, member string) (removed bool, err error) {
+	err = b.update(func(txn *prefixTxn) error {
+		score, ok, err := zScoreOf(txn, key, member)
+		if err != nil || !ok {
+			return err
+		}
+
+		if err = txn.Delete(zMemberKey(key, member)); err != nil {
+			return err
+		}
+
+		removed = true
+		return txn.Delete(zScoreKey(key, score, member))
+	})
+
+	return
+}
+
+func (b badgerDB) ZScore(key, member string) (score float64, ok bool, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		score, ok, err = zScoreOf(txn, key, member)
+		return err
+	})
+
+	return
+}
+
+func (b badgerDB) ZRank(key, member string) (rank int64, ok bool, err error) {
+	err = b.view(func(txn *prefixTxn) error {
+		_, exist, err := zScoreOf(txn, key, member)
+		if err != nil || !exist {
+			return err
+		}
+
+		// every member before this member in score index is ranked lower
+		zScan(txn, key, nil, func(m ZMember) bool {
+			if m.Member == member {
+				ok = true
+				return false
+			}
+
+			rank++
+			return true
+		})
+
+		return nil
+	})
+
+	return
+}
+
+// ZRange return member ordered by score with rank between start and stop (inclusive).
+// Like redis, negative index count from the last member: -1 is the last member.
+func (b badgerDB) ZRange(key string, start, stop int64) (members []ZMember, err error) {
+	members = make([]ZMember, 0)
+	err = b.view(func(txn *prefixTxn) error {
+		if start < 0 || stop < 0 {
+			card := zCard(txn, key)
+			if start < 0 {
+				start += card
+			}
+
+			if stop < 0 {
+				stop += card
+			}
+		}
+
+		if start < 0 {
+			start = 0
+		}
+
+		if stop < start {
+			return nil
+		}
+
+		var rank int64
+		zScan(txn, key, nil, func(m ZMember) bool {
+			if rank > stop {
+				return false
+			}
+
+			if rank >= start {
+				members = append(members, m)
+			}
+
+			rank++
+			return true
+		})
+
+		return nil
+	})
+
+	return
+}
+
+// ZRangeByScore return member ordered by score with min <= score <= max.
+// Use math.Inf for unbounded range.
+func (b badgerDB) ZRangeByScore(key string, min, max float64) (members []ZMember, err error) {
+	members = make([]ZMember, 0)
+	if min > max {
+		return
+	}
+
+	err = b.view(func(txn *prefixTxn) error {
+		zScan(txn, key, encodeScore(min), func(m ZMember) bool {
+			if m.Score > max {
+				return false
+			}
+
+			members = append(members, m)
+			return true
+		})
+
+		return nil
+	})
+
+	return
+}
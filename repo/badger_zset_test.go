@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newInMemoryBadger(t *testing.T) *badger.DB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+func TestBadgerDB_ZSet(t *testing.T) {
+	convey.Convey("Sorted set", t, func() {
+		s, _ := NewBadger(newInMemoryBadger(t))
+
+		for member, score := range map[string]float64{"a": 10, "b": -5, "c": 7.5, "d": 100} {
+			added, err := s.ZAdd("board", member, score)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(added, convey.ShouldBeTrue)
+		}
+
+		// other set with similar key must not be visible
+		_, _ = s.ZAdd("board2", "x", 1)
+
+		convey.Convey("Range by rank", func() {
+			members, err := s.ZRange("board", 0, -1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(members, convey.ShouldResemble, []ZMember{
+				{Member: "b", Score: -5}, {Member: "c", Score: 7.5}, {Member: "a", Score: 10}, {Member: "d", Score: 100},
+			})
+
+			members, _ = s.ZRange("board", -2, -1)
+			convey.So(members, convey.ShouldResemble, []ZMember{{Member: "a", Score: 10}, {Member: "d", Score: 100}})
+		})
+
+		convey.Convey("Range by score", func() {
+			members, err := s.ZRangeByScore("board", 0, 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(members, convey.ShouldResemble, []ZMember{{Member: "c", Score: 7.5}, {Member: "a", Score: 10}})
+
+			members, _ = s.ZRangeByScore("board", math.Inf(-1), 0)
+			convey.So(members, convey.ShouldResemble, []ZMember{{Member: "b", Score: -5}})
+		})
+
+		convey.Convey("Update score move the member", func() {
+			added, _ := s.ZAdd("board", "b", 50)
+			convey.So(added, convey.ShouldBeFalse)
+
+			score, err := s.ZIncrBy("board", "b", 60)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(score, convey.ShouldEqual, 110)
+
+			rank, ok, _ := s.ZRank("board", "b")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(rank, convey.ShouldEqual, 3)
+
+			members, _ := s.ZRange("board", 0, -1)
+			convey.So(len(members), convey.ShouldEqual, 4)
+		})
+
+		convey.Convey("Remove member", func() {
+			removed, _ := s.ZRem("board", "a")
+			convey.So(removed, convey.ShouldBeTrue)
+
+			removed, _ = s.ZRem("board", "a")
+			convey.So(removed, convey.ShouldBeFalse)
+
+			_, ok, _ := s.ZRank("board", "a")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			_, ok, _ = s.ZScore("board", "a")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Every key used internally by canoe starts with a NUL byte,
+// so it never collides with the key sent by the user through the API.
+const internalPrefix = "\x00"
+
+var (
+	keyAppliedIndex = []byte(internalPrefix + "fsm/applied")
+	keyRevision     = []byte(internalPrefix + "fsm/revision")
+
+	prefixMeta = []byte(internalPrefix + "meta/")
+
+	prefixZSetMember = []byte(internalPrefix + "zm")
+	prefixZSetScore  = []byte(internalPrefix + "zs")
+
+	prefixSequence = []byte(internalPrefix + "seq/")
+
+	prefixChange      = []byte(internalPrefix + "cdc/log/")
+	keyChangeLast     = []byte(internalPrefix + "cdc/last")
+	keyChangeExported = []byte(internalPrefix + "cdc/exported")
+
+	keyShardMap   = []byte(internalPrefix + "shard/map")
+	keyShardFence = []byte(internalPrefix + "shard/fence")
+
+	keyReplicaState = []byte(internalPrefix + "replica/state")
+)
+
+// isDataKey return true for the key written by the commands: user key, its metadata, sorted set, sequence and
+// the revision counter. The state of the cluster itself, such as the applied index or the change log, is not data.
+func isDataKey(key []byte) bool {
+	if !bytes.HasPrefix(key, []byte(internalPrefix)) {
+		return true
+	}
+
+	for _, prefix := range [][]byte{prefixMeta, prefixZSetMember, prefixZSetScore, prefixSequence} {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return bytes.Equal(key, keyRevision)
+}
+
+// namespaced return prefix + len(key) + key.
+// The length is written before the key, so "foo" never shares the prefix of "foobar".
+func namespaced(prefix []byte, key string) []byte {
+	out := make([]byte, 0, len(prefix)+4+len(key))
+	out = append(out, prefix...)
+	out = append(out, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(out[len(prefix):], uint32(len(key)))
+	return append(out, key...)
+}
+
+// encodeScore return order-preserving representation of the float64.
+// Comparing two encoded score byte by byte give the same result as comparing the float value,
+// so the score index in badger can be scanned using iterator.
+// Positive number have the sign bit flipped, negative number have all bits flipped.
+func encodeScore(score float64) []byte {
+	if score == 0 {
+		// normalize negative zero
+		score = 0
+	}
+
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+
+	out := make([]byte, 8)
+	binary.BigEndian.PutUint64(out, bits)
+	return out
+}
+
+// decodeScore is the reverse of encodeScore.
+func decodeScore(b []byte) float64 {
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+
+	return math.Float64frombits(bits)
+}
@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncodeScore(t *testing.T) {
+	convey.Convey("Encode score", t, func() {
+		scores := []float64{math.Inf(-1), -1e300, -42.5, -1, -math.SmallestNonzeroFloat64, 0, math.SmallestNonzeroFloat64, 1, 3.14, 1e300, math.Inf(1)}
+
+		convey.Convey("Should preserve order", func() {
+			encoded := make([][]byte, 0, len(scores))
+			for _, s := range scores {
+				encoded = append(encoded, encodeScore(s))
+			}
+
+			convey.So(sort.SliceIsSorted(encoded, func(i, j int) bool {
+				return bytes.Compare(encoded[i], encoded[j]) < 0
+			}), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("Should decode to the same value", func() {
+			for _, s := range scores {
+				convey.So(decodeScore(encodeScore(s)), convey.ShouldEqual, s)
+			}
+		})
+
+		convey.Convey("Negative zero equal to zero", func() {
+			convey.So(encodeScore(math.Copysign(0, -1)), convey.ShouldResemble, encodeScore(0))
+		})
+	})
+}
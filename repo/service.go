@@ -3,4 +3,72 @@ package repo
 type Service interface {
 	Get(key string) interface{}
 	Set(key string, value interface{}) error
+	SetExpireAt(key string, value interface{}, expireAt int64) error
+	Has(key string) (bool, error)
+	Delete(keys ...string) (deleted int, err error)
+	MSet(keys []string, values []interface{}) error
+	Expire(key string, expireAt int64) (exist bool, err error)
+	Scan(offset uint64, count int, match string) (keys []string, next uint64, err error)
+
+	// IncrBy atomically add delta to the int64 counter saved in key, missing key is treated as 0.
+	// See CounterOptions for the bounds.
+	IncrBy(key string, delta int64, opt CounterOptions) (int64, error)
+
+	// GetItems and SetItem work with the stored bytes and its metadata, see Item.
+	GetItems(keys ...string) ([]*Item, error)
+	SetItem(key string, value []byte, opt SetOptions) (revision uint64, err error)
+
+	// Sequence operations, see Sequence.
+	SeqCreate(name string, start int64) (Sequence, error)
+	SeqReserve(name string, count int64) (Reservation, error)
+	SeqInfo(name string) (Sequence, error)
+
+	// Change log operations, see Change.
+	AppendChanges(changes []Change, retention uint64) error
+	Changes(offset uint64, limit int) (changes []Change, first, last uint64, err error)
+	ChangesExported() (uint64, error)
+	SetChangesExported(offset uint64) error
+
+	// AppliedIndex returns the last raft log index persisted by the FSM.
+	AppliedIndex() (uint64, error)
+	SetAppliedIndex(index uint64) error
+
+	// Atomic run fn in one transaction which also save the applied index, see badgerDB.Atomic.
+	Atomic(index uint64, fn func(tx Service) error) error
+
+	// Clock return the repo deciding key expiry at now (unix second) instead of the local clock, see badgerDB.Clock.
+	Clock(now int64) Service
+
+	// ExpiredKeys return at most limit user keys expired at now, PurgeExpired delete the given keys which are
+	// expired at the clock of the repo and return the number of deleted keys.
+	ExpiredKeys(now int64, limit int) ([]string, error)
+	PurgeExpired(keys ...string) (purged int, err error)
+
+	// Shard operations, the value is encoded by package shard. See ForEachKey for the keys checked before moving a part.
+	ShardMap() ([]byte, error)
+	SetShardMap(data []byte) error
+	ShardFence() ([]byte, error)
+	SetShardFence(data []byte) error
+	ForEachKey(fn func(key string) bool) error
+
+	// Snapshot and Restore copy every key of the repository, they are used by the FSM snapshot.
+	Snapshot() Snapshot
+	Restore(next func() (*SnapshotEntry, error)) error
+
+	// Cross-cluster replication state, see ReplicaState.
+	ReplicaState() (ReplicaState, error)
+	SetReplicaState(state ReplicaState) error
+
+	// ClearData and SeedData replace the data of the standby with the copy of the primary, see Snapshot.ForEachData.
+	ClearData(limit int) (deleted int, err error)
+	SeedData(entries []SnapshotEntry) error
+
+	// Sorted set operations, see ZMember.
+	ZAdd(key, member string, score float64) (added bool, err error)
+	ZIncrBy(key, member string, delta float64) (score float64, err error)
+	ZRem(key, member string) (removed bool, err error)
+	ZScore(key, member string) (score float64, ok bool, err error)
+	ZRank(key, member string) (rank int64, ok bool, err error)
+	ZRange(key string, start, stop int64) ([]ZMember, error)
+	ZRangeByScore(key string, min, max float64) ([]ZMember, error)
 }
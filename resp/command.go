@@ -0,0 +1,405 @@
+package resp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"ysf/canoe/dependency"
+	"ysf/canoe/fsm"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+	"ysf/canoe/shard"
+
+	"github.com/hashicorp/raft"
+)
+
+type commandFunc func(s *server, w *writer, args []string)
+
+// commands map the redis command name to handler.
+// arity is the number of argument including the command name, negative means at least -arity.
+var commands = map[string]struct {
+	arity int
+	fn    commandFunc
+}{
+	"PING":    {-1, cmdPing},
+	"ECHO":    {2, cmdEcho},
+	"SELECT":  {2, cmdSelect},
+	"COMMAND": {-1, cmdCommand},
+	"GET":     {2, cmdGet},
+	"SET":     {-3, cmdSet},
+	"DEL":     {-2, cmdDel},
+	"EXISTS":  {-2, cmdExists},
+	"INCR":    {2, cmdIncr},
+	"DECR":    {2, cmdIncr},
+	"INCRBY":  {3, cmdIncr},
+	"DECRBY":  {3, cmdIncr},
+	"EXPIRE":  {3, cmdExpire},
+	"SCAN":    {-2, cmdScan},
+	"MGET":    {-2, cmdMGet},
+	"MSET":    {-3, cmdMSet},
+}
+
+func (s *server) execute(w *writer, args []string) {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return
+	}
+
+	args[0] = name
+	cmd.fn(s, w, args)
+}
+
+// do send the command to the leader through raft, in the shard group owning the keys when sharding is enabled.
+func (s *server) do(w *writer, cmd model.CommandPayload) (interface{}, bool) {
+	resp, err := s.dep.Do(cmd)
+	if err != nil {
+		s.writeError(w, err)
+		return nil, false
+	}
+
+	return resp, true
+}
+
+// writeError convert error to redis error reply.
+// When this node is not the leader, client is redirected using MOVED error like in redis cluster.
+// When the leadership is lost or handed over while the command is applied, the result is unknown and client get TRYAGAIN.
+func (s *server) writeError(w *writer, err error) {
+	switch {
+	case errors.Is(err, raft.ErrLeadershipLost), errors.Is(err, gossip.ErrDraining):
+		w.error("TRYAGAIN " + err.Error())
+
+	case errors.Is(err, gossip.ErrNotLeader), errors.Is(err, raft.ErrNotLeader):
+		leader := s.conf.LeaderAddress()
+		if leader == "" {
+			w.error("CLUSTERDOWN no leader elected")
+			return
+		}
+
+		w.error("MOVED 0 " + leader)
+
+	case errors.Is(err, shard.ErrCrossShard):
+		w.error("CROSSSLOT " + err.Error())
+
+	case errors.Is(err, repo.ErrNotInteger):
+		w.error("ERR value is not an integer or out of range")
+
+	case errors.Is(err, repo.ErrOverflow):
+		w.error("ERR increment or decrement would overflow")
+
+	default:
+		w.error("ERR " + err.Error())
+	}
+}
+
+// writeValue write value decoded from JSON as bulk string.
+// String is written as is, other value is written in JSON.
+func writeValue(w *writer, v interface{}) {
+	switch val := v.(type) {
+	case nil:
+		w.null()
+	case string:
+		w.bulk(val)
+	case json.Number:
+		w.bulk(val.String())
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			w.error("ERR " + err.Error())
+			return
+		}
+		w.bulk(string(data))
+	}
+}
+
+func cmdPing(s *server, w *writer, args []string) {
+	if len(args) > 1 {
+		w.bulk(args[1])
+		return
+	}
+
+	w.simple("PONG")
+}
+
+func cmdEcho(s *server, w *writer, args []string) {
+	w.bulk(args[1])
+}
+
+// cmdSelect only accept database 0, there is only one keyspace in canoe.
+func cmdSelect(s *server, w *writer, args []string) {
+	if args[1] != "0" {
+		w.error("ERR DB index is out of range")
+		return
+	}
+
+	w.simple("OK")
+}
+
+// cmdCommand return empty command list, it is called by redis-cli on connect.
+func cmdCommand(s *server, w *writer, args []string) {
+	w.arrayHeader(0)
+}
+
+func cmdGet(s *server, w *writer, args []string) {
+	resp, ok := s.do(w, model.CommandPayload{
+		Operation: fsm.OpMGet,
+		Keys:      args[1:2],
+	})
+
+	if !ok {
+		return
+	}
+
+	values, _ := resp.([]interface{})
+	if len(values) != 1 {
+		w.null()
+		return
+	}
+
+	writeValue(w, values[0])
+}
+
+// cmdSet handle SET key value [EX seconds|PX milliseconds]
+func cmdSet(s *server, w *writer, args []string) {
+	cmd := model.CommandPayload{
+		Operation: "SET",
+		Key:       args[1],
+		Value:     args[2],
+	}
+
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		if (opt != "EX" && opt != "PX") || i+1 >= len(args) {
+			w.error("ERR syntax error")
+			return
+		}
+
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || n <= 0 {
+			w.error("ERR invalid expire time in 'set' command")
+			return
+		}
+
+		ttl := time.Duration(n) * time.Second
+		if opt == "PX" {
+			ttl = time.Duration(n) * time.Millisecond
+		}
+
+		cmd.ExpireAt = expireAt(ttl)
+		i++
+	}
+
+	if _, ok := s.do(w, cmd); ok {
+		w.simple("OK")
+	}
+}
+
+func cmdDel(s *server, w *writer, args []string) {
+	resp, ok := s.do(w, model.CommandPayload{
+		Operation: fsm.OpDel,
+		Keys:      args[1:],
+	})
+
+	if ok {
+		var r fsm.CountResult
+		_ = dependency.DecodeResult(resp, &r)
+		w.integer(int64(r.Count))
+	}
+}
+
+func cmdExists(s *server, w *writer, args []string) {
+	resp, ok := s.do(w, model.CommandPayload{
+		Operation: fsm.OpExists,
+		Keys:      args[1:],
+	})
+
+	if ok {
+		var r fsm.CountResult
+		_ = dependency.DecodeResult(resp, &r)
+		w.integer(int64(r.Count))
+	}
+}
+
+// cmdIncr handle INCR, DECR, INCRBY and DECRBY
+func cmdIncr(s *server, w *writer, args []string) {
+	cmd := model.CommandPayload{
+		Operation: fsm.OpIncrBy,
+		Key:       args[1],
+		Delta:     1,
+	}
+
+	if len(args) == 3 {
+		delta, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			w.error("ERR value is not an integer or out of range")
+			return
+		}
+		cmd.Delta = delta
+	}
+
+	if args[0] == "DECR" || args[0] == "DECRBY" {
+		if cmd.Delta == math.MinInt64 {
+			w.error("ERR decrement would overflow")
+			return
+		}
+
+		cmd.Delta = -cmd.Delta
+	}
+
+	resp, ok := s.do(w, cmd)
+	if ok {
+		var r fsm.CounterResult
+		_ = dependency.DecodeResult(resp, &r)
+		w.integer(r.Value)
+	}
+}
+
+// cmdExpire handle EXPIRE key seconds, non positive seconds delete the key like in redis.
+func cmdExpire(s *server, w *writer, args []string) {
+	seconds, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		w.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpExpire,
+		Key:       args[1],
+		ExpireAt:  expireAt(time.Duration(seconds) * time.Second),
+	}
+
+	if seconds <= 0 {
+		cmd = model.CommandPayload{
+			Operation: fsm.OpDel,
+			Keys:      args[1:2],
+		}
+	}
+
+	resp, ok := s.do(w, cmd)
+	if ok {
+		var r fsm.CountResult
+		_ = dependency.DecodeResult(resp, &r)
+		w.integer(int64(r.Count))
+	}
+}
+
+// cmdScan handle SCAN cursor [MATCH pattern] [COUNT count].
+// Scan read the local repo without going through raft, but it is only served by the leader
+// so the result is not older than the other commands. It is refused when sharding is enabled,
+// the keys of the other shard groups are not in the repo of the default group.
+func cmdScan(s *server, w *writer, args []string) {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		w.error("ERR invalid cursor")
+		return
+	}
+
+	var (
+		match string
+		count = 10
+	)
+
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			w.error("ERR syntax error")
+			return
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				w.error("ERR syntax error")
+				return
+			}
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	if s.dep.Sharded() {
+		w.error("ERR SCAN is not supported when sharding is enabled")
+		return
+	}
+
+	if !s.dep.GetGossip().IsLeader() {
+		s.writeError(w, gossip.ErrNotLeader)
+		return
+	}
+
+	keys, next, err := s.dep.GetRepo().Scan(cursor, count, match)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	w.arrayHeader(2)
+	w.bulk(strconv.FormatUint(next, 10))
+	w.arrayHeader(len(keys))
+	for _, key := range keys {
+		w.bulk(key)
+	}
+}
+
+func cmdMGet(s *server, w *writer, args []string) {
+	resp, ok := s.do(w, model.CommandPayload{
+		Operation: fsm.OpMGet,
+		Keys:      args[1:],
+	})
+
+	if !ok {
+		return
+	}
+
+	values, _ := resp.([]interface{})
+	w.arrayHeader(len(values))
+	for _, v := range values {
+		writeValue(w, v)
+	}
+}
+
+func cmdMSet(s *server, w *writer, args []string) {
+	if len(args)%2 != 1 {
+		w.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	cmd := model.CommandPayload{
+		Operation: fsm.OpMSet,
+		Keys:      make([]string, 0, len(args)/2),
+		Values:    make([]interface{}, 0, len(args)/2),
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		cmd.Keys = append(cmd.Keys, args[i])
+		cmd.Values = append(cmd.Values, args[i+1])
+	}
+
+	if _, ok := s.do(w, cmd); ok {
+		w.simple("OK")
+	}
+}
+
+// expireAt convert the relative ttl into absolute unix second, rounded up.
+func expireAt(ttl time.Duration) int64 {
+	at := time.Now().Add(ttl)
+	if at.Nanosecond() > 0 {
+		return at.Unix() + 1
+	}
+
+	return at.Unix()
+}
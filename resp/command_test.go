@@ -0,0 +1,65 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"testing"
+	"ysf/canoe/dependency"
+	"ysf/canoe/gossip"
+	"ysf/canoe/model"
+	"ysf/canoe/repo"
+	"ysf/canoe/shard"
+
+	"github.com/hashicorp/raft"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteError(t *testing.T) {
+	convey.Convey("Leadership error is mapped to redirect or retry", t, func() {
+		s := NewServer(Config{LeaderAddress: func() string { return "10.0.0.1:6379" }}, nil)
+
+		reply := func(err error) string {
+			var buf bytes.Buffer
+			w := &writer{w: bufio.NewWriter(&buf)}
+			s.writeError(w, err)
+			_ = w.flush()
+			return buf.String()
+		}
+
+		convey.So(reply(gossip.ErrNotLeader), convey.ShouldEqual, "-MOVED 0 10.0.0.1:6379\r\n")
+		convey.So(reply(raft.ErrNotLeader), convey.ShouldEqual, "-MOVED 0 10.0.0.1:6379\r\n")
+		convey.So(reply(fmt.Errorf("apply: %w", raft.ErrLeadershipLost)), convey.ShouldStartWith, "-TRYAGAIN ")
+		convey.So(reply(gossip.ErrDraining), convey.ShouldStartWith, "-TRYAGAIN ")
+		convey.So(reply(shard.ErrCrossShard), convey.ShouldStartWith, "-CROSSSLOT ")
+	})
+
+	convey.Convey("DECRBY of the minimum int64 is refused", t, func() {
+		s := NewServer(Config{}, nil)
+
+		var buf bytes.Buffer
+		w := &writer{w: bufio.NewWriter(&buf)}
+		cmdIncr(s, w, []string{"DECRBY", "counter", "-9223372036854775808"})
+		_ = w.flush()
+
+		convey.So(buf.String(), convey.ShouldEqual, "-ERR decrement would overflow\r\n")
+	})
+
+	convey.Convey("SCAN is refused when sharding is enabled", t, func() {
+		dep := dependency.NewDep(nil, nil)
+		dep.SetRouter(nopRouter{})
+		s := NewServer(Config{}, dep)
+
+		var buf bytes.Buffer
+		w := &writer{w: bufio.NewWriter(&buf)}
+		cmdScan(s, w, []string{"SCAN", "0"})
+		_ = w.flush()
+
+		convey.So(buf.String(), convey.ShouldStartWith, "-ERR SCAN is not supported")
+	})
+}
+
+type nopRouter struct{}
+
+func (nopRouter) DoOperation(model.CommandPayload) (interface{}, error) { return nil, nil }
+func (nopRouter) RepoFor(string) (repo.Service, error)                  { return nil, nil }
@@ -0,0 +1,16 @@
+package resp
+
+import (
+	"time"
+)
+
+type Config struct {
+	ListenAddress string
+
+	// IdleTimeout close connection which send no command within this duration, zero means never.
+	IdleTimeout time.Duration
+
+	// LeaderAddress return the RESP address of the current leader, it is used in MOVED error
+	// so the client can retry the command to the leader. Empty string means leader is unknown.
+	LeaderAddress func() string
+}
@@ -0,0 +1,131 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxBulkLength is the biggest bulk string accepted from client, same as redis proto-max-bulk-len default.
+	maxBulkLength = 512 * 1024 * 1024
+
+	// maxArrayLength is the maximum number of argument in one command.
+	maxArrayLength = 1024 * 1024
+)
+
+var errProtocol = errors.New("protocol error")
+
+// readCommand read one command from the client.
+// Command is sent as array of bulk string, but inline command (used when typing in telnet) is also accepted.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return []string{}, nil
+	}
+
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArrayLength {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLength {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+
+		// bulk string is followed by CRLF
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string is not terminated by CRLF", errProtocol)
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+// readLine read line terminated by CRLF (or LF for inline command) without the line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writer write RESP2 reply. Error while writing is kept and returned by flush.
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *writer) write(s string) {
+	if w.err != nil {
+		return
+	}
+
+	_, w.err = w.w.WriteString(s)
+}
+
+func (w *writer) simple(s string) {
+	w.write("+" + s + "\r\n")
+}
+
+func (w *writer) error(s string) {
+	// error message must be single line
+	s = strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+	w.write("-" + s + "\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.write(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.write("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *writer) null() {
+	w.write("$-1\r\n")
+}
+
+func (w *writer) arrayHeader(n int) {
+	w.write("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (w *writer) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.w.Flush()
+}
@@ -0,0 +1,64 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadCommand(t *testing.T) {
+	convey.Convey("Read command", t, func() {
+		convey.Convey("Multibulk command", func() {
+			r := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$8\r\nbar\r\nbaz\r\n"))
+			args, err := readCommand(r)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(args, convey.ShouldResemble, []string{"SET", "foo", "bar\r\nbaz"})
+		})
+
+		convey.Convey("Inline command", func() {
+			r := bufio.NewReader(strings.NewReader("GET  foo\n"))
+			args, err := readCommand(r)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(args, convey.ShouldResemble, []string{"GET", "foo"})
+		})
+
+		convey.Convey("Pipelined command", func() {
+			r := bufio.NewReader(strings.NewReader("*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\na\r\n"))
+			first, _ := readCommand(r)
+			second, err := readCommand(r)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(first, convey.ShouldResemble, []string{"PING"})
+			convey.So(second, convey.ShouldResemble, []string{"GET", "a"})
+		})
+
+		convey.Convey("Invalid bulk", func() {
+			r := bufio.NewReader(strings.NewReader("*1\r\n:3\r\n"))
+			_, err := readCommand(r)
+			convey.So(err, convey.ShouldNotBeNil)
+
+			r = bufio.NewReader(strings.NewReader("*1\r\n$3\r\nfoobar\r\n"))
+			_, err = readCommand(r)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestWriter(t *testing.T) {
+	convey.Convey("Write reply", t, func() {
+		buf := &bytes.Buffer{}
+		w := &writer{w: bufio.NewWriter(buf)}
+
+		w.simple("OK")
+		w.error("ERR multi\nline")
+		w.integer(-7)
+		w.arrayHeader(2)
+		w.bulk("foo")
+		w.null()
+
+		convey.So(w.flush(), convey.ShouldBeNil)
+		convey.So(buf.String(), convey.ShouldEqual, "+OK\r\n-ERR multi line\r\n:-7\r\n*2\r\n$3\r\nfoo\r\n$-1\r\n")
+	})
+}
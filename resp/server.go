@@ -0,0 +1,92 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+	"ysf/canoe/dependency"
+	"ysf/canoe/pkg/tcpserver"
+)
+
+// server is TCP server speaking redis protocol (RESP2) on top of the replicated store.
+type server struct {
+	dep  *dependency.Dep
+	conf Config
+	tcp  *tcpserver.Server
+}
+
+// Start listen and serve connection until Shutdown is called.
+func (s *server) Start() error {
+	l, err := net.Listen("tcp", s.conf.ListenAddress)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "Starting RESP server at %s\n", l.Addr().String())
+	return s.tcp.Serve(l)
+}
+
+// Shutdown stop accepting connection, close all connection and wait the running command to finish.
+func (s *server) Shutdown() {
+	s.tcp.Shutdown()
+}
+
+func (s *server) serveConn(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := &writer{w: bufio.NewWriter(conn)}
+
+	for {
+		if s.conf.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.conf.IdleTimeout))
+		}
+
+		args, err := readCommand(r)
+		if err != nil {
+			if !tcpserver.IsClosedError(err) {
+				w.error("ERR " + err.Error())
+				_ = w.flush()
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := strings.ToUpper(args[0]) == "QUIT"
+		if quit {
+			w.simple("OK")
+		} else {
+			s.execute(w, args)
+		}
+
+		// flush only when there is no pipelined command waiting in buffer
+		if r.Buffered() == 0 || quit {
+			if err := w.flush(); err != nil {
+				return
+			}
+		}
+
+		if quit {
+			return
+		}
+	}
+}
+
+// NewServer return RESP server using the same gossip.Service and repo.Service as the HTTP API.
+func NewServer(conf Config, dep *dependency.Dep) *server {
+	if conf.LeaderAddress == nil {
+		conf.LeaderAddress = func() string { return "" }
+	}
+
+	s := &server{
+		dep:  dep,
+		conf: conf,
+	}
+
+	s.tcp = tcpserver.New(s.serveConn)
+	return s
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"net"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
@@ -10,8 +11,12 @@ import (
 type Config struct {
 	EnableProfiling bool
 	ListenAddress   string
-	WriteTimeout    time.Duration
-	ReadTimeout     time.Duration
+
+	// Listener is optional, when set the server accept connection from it instead of listening on ListenAddress
+	Listener net.Listener
+
+	WriteTimeout time.Duration
+	ReadTimeout  time.Duration
 
 	ZapLogger   *zap.Logger
 	OpenTracing opentracing.Tracer
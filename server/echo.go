@@ -32,6 +32,10 @@ func wrapEcho(h Handler) echo.HandlerFunc {
 		var req = newEchoRequest(eCtx)
 		resp := h(opentracing.ContextWithSpan(ctx, span), req)
 
+		if stream, ok := resp.(StreamResponse); ok {
+			return writeStream(eCtx, stream, traceID)
+		}
+
 		// get the body first
 		body, err := resp.Body()
 		if err != nil {
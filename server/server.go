@@ -3,6 +3,7 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -25,6 +26,7 @@ type server struct {
 
 	enableProfiling bool
 	listenAddress   string
+	listener        net.Listener
 	writeTimeout    time.Duration
 	readTimeout     time.Duration
 
@@ -182,6 +184,11 @@ func (s *server) Start() error {
 		s.zapLogger.Info(route.Path, zap.String("method", route.Method))
 	}
 
+	// echo create the listener from Addr only when there is no listener
+	if s.listener != nil {
+		s.e.Listener = s.listener
+	}
+
 	_, _ = fmt.Fprintf(os.Stdout, "Starting server at %s\n", s.listenAddress)
 	return s.e.StartServer(&http.Server{
 		Addr:         s.listenAddress,
@@ -209,6 +216,7 @@ func NewServer(conf Config) *server {
 
 		enableProfiling: conf.EnableProfiling,
 		listenAddress:   conf.ListenAddress,
+		listener:        conf.Listener,
 		writeTimeout:    conf.WriteTimeout,
 		readTimeout:     conf.ReadTimeout,
 
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// StreamResponse is a response written incrementally until the client disconnect, for example server-sent events.
+// Body is never called. The connection is taken over from the HTTP server, so the write timeout does not end it.
+type StreamResponse interface {
+	Response
+
+	// WriteStream write the body to w, flush send the written data to the client.
+	// Ctx is done when the client close the connection, and WriteStream must return.
+	WriteStream(ctx context.Context, w io.Writer, flush func() error) error
+}
+
+// writeStream hijack the connection and write the response without content length, the end of body is the connection
+// closed by the server. The connection is never reused, so it works with every HTTP/1.x client.
+func writeStream(eCtx echo.Context, resp StreamResponse, traceID string) error {
+	conn, rw, err := eCtx.Response().Hijack()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// the deadline is set by the HTTP server from its read and write timeout
+	_ = conn.SetDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(eCtx.Request().Context())
+	defer cancel()
+
+	// client never send anything after the request, read return when it close the connection
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, rw.Reader)
+		cancel()
+	}()
+
+	header := http.Header{}
+	for k, v := range resp.Header() {
+		header[k] = v
+	}
+
+	header.Set("Content-Type", resp.ContentType())
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "close")
+	header.Set("X-Trace-ID", traceID)
+
+	eCtx.Response().Status = resp.StatusCode() // for echoLogger to log real value, we need pass this
+	eCtx.Response().Committed = true
+
+	// after the connection is hijacked echo can not write the error anymore, write error is the client disconnected
+	_, _ = fmt.Fprintf(rw, "HTTP/1.1 %d %s\r\n", resp.StatusCode(), http.StatusText(resp.StatusCode()))
+	_ = header.Write(rw)
+	_, _ = rw.WriteString("\r\n")
+	if err = rw.Flush(); err != nil {
+		return nil
+	}
+
+	_ = resp.WriteStream(ctx, rw.Writer, rw.Writer.Flush)
+	return nil
+}
@@ -0,0 +1,380 @@
+// Package shard is the partition of the keyspace between raft groups.
+// The map is replicated by the default raft group, and every other group is routed using it.
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"sort"
+)
+
+// Slots is the number of hash slot, key belongs to slot crc32(key) % Slots.
+const Slots = 1024
+
+// Strategy of partitioning the keyspace
+const (
+	// StrategyHash assign hash slot to group
+	StrategyHash = "hash"
+
+	// StrategyRange assign key range to group, so keys sharing a prefix can be placed in one group
+	StrategyRange = "range"
+)
+
+// DefaultGroup is the raft group started by the node itself, it owns the whole keyspace when the map is created.
+// It has no keyspace prefix, so the data written before sharding is enabled stays in it.
+const DefaultGroup = "default"
+
+var validGroupID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ErrCrossShard is returned by multi-key operation on keys owned by different groups.
+var ErrCrossShard = errors.New("keys belong to different shard groups")
+
+// SlotRange is the hash slots from Start to End, both inclusive.
+type SlotRange struct {
+	Start uint16 `json:"start"`
+	End   uint16 `json:"end"`
+}
+
+// KeyRange is the keys from Start (inclusive) to End (exclusive), empty End means no upper bound.
+type KeyRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func (r KeyRange) contains(key string) bool {
+	return key >= r.Start && (r.End == "" || key < r.End)
+}
+
+// Part is a set of keys, described by either slots or ranges depending on the strategy.
+type Part struct {
+	Slots  []SlotRange `json:"slots,omitempty"`
+	Ranges []KeyRange  `json:"ranges,omitempty"`
+}
+
+// Contains return true when the key is in one of the slots or ranges.
+func (p Part) Contains(key string) bool {
+	if len(p.Slots) > 0 {
+		slot := Slot(key)
+		for _, r := range p.Slots {
+			if slot >= r.Start && slot <= r.End {
+				return true
+			}
+		}
+	}
+
+	for _, r := range p.Ranges {
+		if r.contains(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Empty return true when the part has no key.
+func (p Part) Empty() bool {
+	return len(p.Slots) == 0 && len(p.Ranges) == 0
+}
+
+// Member is a node hosting the group, Address is its raft address which is shared by every group.
+type Member struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+// Group is a raft group and the part of the keyspace it owns.
+// Members is the servers which bootstrap the group, later members is added by the group leader.
+type Group struct {
+	ID      string   `json:"id"`
+	Members []Member `json:"members,omitempty"`
+	Part
+}
+
+// Map assign every key to exactly one group. Version is incremented on every change.
+type Map struct {
+	Version  uint64  `json:"version"`
+	Strategy string  `json:"strategy"`
+	Groups   []Group `json:"groups"`
+}
+
+// Slot return the hash slot of the key.
+func Slot(key string) uint16 {
+	return uint16(crc32.ChecksumIEEE([]byte(key)) % Slots)
+}
+
+// NewMap return the first version of the map, the default group owns the whole keyspace.
+func NewMap(strategy string) (Map, error) {
+	group := Group{ID: DefaultGroup}
+	switch strategy {
+	case StrategyHash:
+		group.Slots = []SlotRange{{Start: 0, End: Slots - 1}}
+	case StrategyRange:
+		group.Ranges = []KeyRange{{}}
+	default:
+		return Map{}, fmt.Errorf("unknown shard strategy %q, use %s or %s", strategy, StrategyHash, StrategyRange)
+	}
+
+	return Map{Version: 1, Strategy: strategy, Groups: []Group{group}}, nil
+}
+
+// Group return the group with the id.
+func (m Map) Group(id string) (Group, bool) {
+	for _, g := range m.Groups {
+		if g.ID == id {
+			return g, true
+		}
+	}
+
+	return Group{}, false
+}
+
+// Owner return the id of the group owning the key.
+func (m Map) Owner(key string) string {
+	for _, g := range m.Groups {
+		if g.Contains(key) {
+			return g.ID
+		}
+	}
+
+	return ""
+}
+
+// OwnerOf return the group owning all the keys, or ErrCrossShard.
+func (m Map) OwnerOf(keys ...string) (string, error) {
+	owner := ""
+	for i, key := range keys {
+		o := m.Owner(key)
+		if i > 0 && o != owner {
+			return "", ErrCrossShard
+		}
+
+		owner = o
+	}
+
+	return owner, nil
+}
+
+// Validate check every key is owned by exactly one group.
+func (m Map) Validate() error {
+	if m.Version == 0 {
+		return fmt.Errorf("shard map version must start from 1")
+	}
+
+	ids := make(map[string]bool)
+	for _, g := range m.Groups {
+		if !validGroupID.MatchString(g.ID) {
+			return fmt.Errorf("invalid group id %q, use lowercase letter, digit, - and _", g.ID)
+		}
+
+		if ids[g.ID] {
+			return fmt.Errorf("duplicate group id %q", g.ID)
+		}
+		ids[g.ID] = true
+	}
+
+	if !ids[DefaultGroup] {
+		return fmt.Errorf("shard map has no %s group", DefaultGroup)
+	}
+
+	switch m.Strategy {
+	case StrategyHash:
+		var owned [Slots]bool
+		for _, g := range m.Groups {
+			if len(g.Ranges) > 0 {
+				return fmt.Errorf("group %s has key range in hash strategy", g.ID)
+			}
+
+			for _, r := range g.Slots {
+				if r.Start > r.End || r.End >= Slots {
+					return fmt.Errorf("invalid slot range %d-%d of group %s", r.Start, r.End, g.ID)
+				}
+
+				for s := int(r.Start); s <= int(r.End); s++ {
+					if owned[s] {
+						return fmt.Errorf("slot %d is owned by more than one group", s)
+					}
+					owned[s] = true
+				}
+			}
+		}
+
+		for s, ok := range owned {
+			if !ok {
+				return fmt.Errorf("slot %d is not owned by any group", s)
+			}
+		}
+
+	case StrategyRange:
+		var ranges []KeyRange
+		for _, g := range m.Groups {
+			if len(g.Slots) > 0 {
+				return fmt.Errorf("group %s has hash slot in range strategy", g.ID)
+			}
+
+			ranges = append(ranges, g.Ranges...)
+		}
+
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+
+		// the ranges must cover the keyspace without gap nor overlap
+		next := ""
+		for i, r := range ranges {
+			if r.Start != next || (i > 0 && next == "") {
+				return fmt.Errorf("key ranges has gap or overlap at %q", r.Start)
+			}
+
+			if r.End != "" && r.End <= r.Start {
+				return fmt.Errorf("invalid key range %q-%q", r.Start, r.End)
+			}
+
+			next = r.End
+		}
+
+		if len(ranges) == 0 || next != "" {
+			return fmt.Errorf("key ranges does not cover the keyspace after %q", next)
+		}
+
+	default:
+		return fmt.Errorf("unknown shard strategy %q", m.Strategy)
+	}
+
+	return nil
+}
+
+// AddGroup return the next version of the map with the new group owning the part.
+// The part is taken from its current owners, released is the part taken from each of them.
+func (m Map) AddGroup(id string, members []Member, part Part) (next Map, released map[string]Part, err error) {
+	if _, ok := m.Group(id); ok {
+		return Map{}, nil, fmt.Errorf("group %s already exists", id)
+	}
+
+	next = Map{Version: m.Version + 1, Strategy: m.Strategy}
+	released = make(map[string]Part)
+
+	switch m.Strategy {
+	case StrategyHash:
+		if len(part.Ranges) > 0 {
+			return Map{}, nil, fmt.Errorf("hash strategy assign slots, not key ranges")
+		}
+
+		var taken [Slots]bool
+		for _, r := range part.Slots {
+			if r.Start > r.End || r.End >= Slots {
+				return Map{}, nil, fmt.Errorf("invalid slot range %d-%d", r.Start, r.End)
+			}
+
+			for s := int(r.Start); s <= int(r.End); s++ {
+				taken[s] = true
+			}
+		}
+
+		for _, g := range m.Groups {
+			var kept, moved []SlotRange
+			for _, r := range g.Slots {
+				for s := int(r.Start); s <= int(r.End); s++ {
+					if taken[s] {
+						moved = appendSlot(moved, uint16(s))
+					} else {
+						kept = appendSlot(kept, uint16(s))
+					}
+				}
+			}
+
+			if len(moved) > 0 {
+				released[g.ID] = Part{Slots: moved}
+			}
+
+			next.Groups = append(next.Groups, Group{ID: g.ID, Members: g.Members, Part: Part{Slots: kept}})
+		}
+
+	case StrategyRange:
+		if len(part.Slots) > 0 {
+			return Map{}, nil, fmt.Errorf("range strategy assign key ranges, not slots")
+		}
+
+		for _, g := range m.Groups {
+			kept := g.Ranges
+			var moved []KeyRange
+			for _, taken := range part.Ranges {
+				if taken.End != "" && taken.End <= taken.Start {
+					return Map{}, nil, fmt.Errorf("invalid key range %q-%q", taken.Start, taken.End)
+				}
+
+				var rest []KeyRange
+				for _, r := range kept {
+					inter, remain := splitRange(r, taken)
+					if inter != nil {
+						moved = append(moved, *inter)
+					}
+					rest = append(rest, remain...)
+				}
+				kept = rest
+			}
+
+			if len(moved) > 0 {
+				released[g.ID] = Part{Ranges: moved}
+			}
+
+			next.Groups = append(next.Groups, Group{ID: g.ID, Members: g.Members, Part: Part{Ranges: kept}})
+		}
+	}
+
+	next.Groups = append(next.Groups, Group{ID: id, Members: members, Part: part})
+	if err = next.Validate(); err != nil {
+		return Map{}, nil, err
+	}
+
+	return next, released, nil
+}
+
+// appendSlot add the slot to the sorted ranges, merging it with the last range when adjacent.
+func appendSlot(ranges []SlotRange, slot uint16) []SlotRange {
+	if n := len(ranges); n > 0 && ranges[n-1].End+1 == slot {
+		ranges[n-1].End = slot
+		return ranges
+	}
+
+	return append(ranges, SlotRange{Start: slot, End: slot})
+}
+
+// splitRange return the intersection of r and taken, and the remaining part of r.
+func splitRange(r, taken KeyRange) (inter *KeyRange, remain []KeyRange) {
+	start := maxKey(r.Start, taken.Start)
+	end := minEnd(r.End, taken.End)
+	if end != "" && end <= start {
+		return nil, []KeyRange{r}
+	}
+
+	inter = &KeyRange{Start: start, End: end}
+	if r.Start < start {
+		remain = append(remain, KeyRange{Start: r.Start, End: start})
+	}
+
+	if end != "" && (r.End == "" || end < r.End) {
+		remain = append(remain, KeyRange{Start: end, End: r.End})
+	}
+
+	return inter, remain
+}
+
+func maxKey(a, b string) string {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// minEnd return the smaller end, empty end is unbounded.
+func minEnd(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	case a < b:
+		return a
+	}
+	return b
+}
@@ -0,0 +1,103 @@
+package shard
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestMap_Hash(t *testing.T) {
+	convey.Convey("Hash strategy", t, func() {
+		m, err := NewMap(StrategyHash)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(m.Validate(), convey.ShouldBeNil)
+		convey.So(m.Owner("foo"), convey.ShouldEqual, DefaultGroup)
+
+		convey.Convey("New group take the slots from the default group", func() {
+			part := Part{Slots: []SlotRange{{Start: 0, End: 511}}}
+			next, released, err := m.AddGroup("orders", nil, part)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(next.Version, convey.ShouldEqual, 2)
+			convey.So(released[DefaultGroup], convey.ShouldResemble, part)
+
+			def, _ := next.Group(DefaultGroup)
+			convey.So(def.Slots, convey.ShouldResemble, []SlotRange{{Start: 512, End: Slots - 1}})
+
+			for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+				owner := DefaultGroup
+				if Slot(key) <= 511 {
+					owner = "orders"
+				}
+				convey.So(next.Owner(key), convey.ShouldEqual, owner)
+			}
+		})
+
+		convey.Convey("Taking slots in the middle split the owner range", func() {
+			next, _, err := m.AddGroup("orders", nil, Part{Slots: []SlotRange{{Start: 10, End: 19}}})
+			convey.So(err, convey.ShouldBeNil)
+
+			def, _ := next.Group(DefaultGroup)
+			convey.So(def.Slots, convey.ShouldResemble, []SlotRange{{Start: 0, End: 9}, {Start: 20, End: Slots - 1}})
+		})
+
+		convey.Convey("Invalid group is refused", func() {
+			_, _, err := m.AddGroup(DefaultGroup, nil, Part{Slots: []SlotRange{{Start: 0, End: 1}}})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, _, err = m.AddGroup("Orders!", nil, Part{Slots: []SlotRange{{Start: 0, End: 1}}})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, _, err = m.AddGroup("orders", nil, Part{Slots: []SlotRange{{Start: 0, End: Slots}}})
+			convey.So(err, convey.ShouldNotBeNil)
+
+			_, _, err = m.AddGroup("orders", nil, Part{Ranges: []KeyRange{{Start: "a"}}})
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMap_Range(t *testing.T) {
+	convey.Convey("Range strategy", t, func() {
+		m, err := NewMap(StrategyRange)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(m.Owner(""), convey.ShouldEqual, DefaultGroup)
+
+		next, released, err := m.AddGroup("users", nil, Part{Ranges: []KeyRange{{Start: "user:", End: "user;"}}})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(released[DefaultGroup].Ranges, convey.ShouldResemble, []KeyRange{{Start: "user:", End: "user;"}})
+
+		convey.Convey("Keys with the prefix is owned by the new group", func() {
+			convey.So(next.Owner("user:1"), convey.ShouldEqual, "users")
+			convey.So(next.Owner("user"), convey.ShouldEqual, DefaultGroup)
+			convey.So(next.Owner("zzz"), convey.ShouldEqual, DefaultGroup)
+
+			def, _ := next.Group(DefaultGroup)
+			convey.So(def.Ranges, convey.ShouldResemble, []KeyRange{{Start: "", End: "user:"}, {Start: "user;", End: ""}})
+		})
+
+		convey.Convey("Range taken from two groups", func() {
+			last, released, err := next.AddGroup("tail", nil, Part{Ranges: []KeyRange{{Start: "user:5"}}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(released["users"].Ranges, convey.ShouldResemble, []KeyRange{{Start: "user:5", End: "user;"}})
+			convey.So(released[DefaultGroup].Ranges, convey.ShouldResemble, []KeyRange{{Start: "user;", End: ""}})
+			convey.So(last.Owner("user:1"), convey.ShouldEqual, "users")
+			convey.So(last.Owner("user:7"), convey.ShouldEqual, "tail")
+			convey.So(last.Owner("zzz"), convey.ShouldEqual, "tail")
+		})
+
+		convey.Convey("Multi key operation must stay in one group", func() {
+			owner, err := next.OwnerOf("user:1", "user:2")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(owner, convey.ShouldEqual, "users")
+
+			_, err = next.OwnerOf("user:1", "foo")
+			convey.So(err, convey.ShouldEqual, ErrCrossShard)
+		})
+
+		convey.Convey("Map with gap is invalid", func() {
+			broken := next
+			broken.Groups = next.Groups[:1]
+			convey.So(broken.Validate(), convey.ShouldNotBeNil)
+		})
+	})
+}
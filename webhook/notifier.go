@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"ysf/canoe/gossip"
+)
+
+const (
+	// HeaderEvent is the type of the event in the request
+	HeaderEvent = "X-Canoe-Event"
+
+	// HeaderSignature is "sha256=" followed by hex HMAC-SHA256 of the body using the secret, only when secret is set
+	HeaderSignature = "X-Canoe-Signature"
+)
+
+// Config of the Notifier
+type Config struct {
+	// URL receive each event as JSON body of POST request
+	URL string
+
+	// Events is the event types sent to the URL, empty means every event
+	Events []string
+
+	// Secret sign the body, so the receiver can verify the request is sent by canoe
+	Secret string
+
+	// Timeout of each request
+	Timeout time.Duration
+
+	// MaxRetries is the number of retry after the first request fail, the event is dropped after that.
+	// Request fail when it can not be sent or the status code is not 2xx.
+	MaxRetries int
+
+	// RetryWait is the wait before the first retry, it is doubled on each retry
+	RetryWait time.Duration
+
+	// Buffer is the number of event waiting to be sent, newer event is dropped when it is full
+	Buffer int
+}
+
+// Notifier POST the events observed by this node to the URL, one at a time in the order they are observed.
+type Notifier struct {
+	conf   Config
+	raft   gossip.Service
+	client *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	sub    *gossip.Subscription
+}
+
+// Start subscribe the events and deliver them in background until Stop is called.
+func (n *Notifier) Start() error {
+	u, err := url.Parse(n.conf.URL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook url %q must be http or https", n.conf.URL)
+	}
+
+	if err = gossip.ValidateEventTypes(n.conf.Events); err != nil {
+		return err
+	}
+
+	n.sub = n.raft.Subscribe(n.conf.Buffer, n.conf.Events...)
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		for e := range n.sub.Events() {
+			if err := n.deliver(e); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "[WEBHOOK] drop event %s: %s\n", e.Type, err.Error())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop the delivery, the event which is not sent yet is dropped.
+func (n *Notifier) Stop() {
+	n.cancel()
+	if n.sub != nil {
+		n.sub.Close()
+	}
+	n.wg.Wait()
+}
+
+// deliver send the event, retrying until it is accepted, the retries is exhausted or the notifier is stopped.
+func (n *Notifier) deliver(e gossip.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	wait := n.conf.RetryWait
+	for attempt := 0; ; attempt++ {
+		err = n.send(e.Type, body)
+		if err == nil || attempt >= n.conf.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-n.ctx.Done():
+			return n.ctx.Err()
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+}
+
+func (n *Notifier) send(eventType string, body []byte) error {
+	ctx, cancel := context.WithTimeout(n.ctx, n.conf.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, n.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+
+	if n.conf.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(n.conf.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook respond status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign return the value of HeaderSignature for the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func NewNotifier(conf Config, raft gossip.Service) *Notifier {
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5 * time.Second
+	}
+
+	if conf.MaxRetries < 0 {
+		conf.MaxRetries = 0
+	}
+
+	if conf.RetryWait <= 0 {
+		conf.RetryWait = time.Second
+	}
+
+	if conf.Buffer <= 0 {
+		conf.Buffer = 256
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		conf:   conf,
+		raft:   raft,
+		client: &http.Client{},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
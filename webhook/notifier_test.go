@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"ysf/canoe/gossip"
+	"ysf/canoe/internal/testcluster"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestNotifier(t *testing.T) {
+	convey.Convey("Webhook delivery", t, func() {
+		var (
+			attempts int32
+			failFor  int32
+			received = make(chan *http.Request, 16)
+			bodies   = make(chan []byte, 16)
+		)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) <= atomic.LoadInt32(&failFor) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			body, _ := ioutil.ReadAll(r.Body)
+			received <- r
+			bodies <- body
+		}))
+		defer srv.Close()
+
+		convey.Convey("Event is signed and retried until accepted", func() {
+			atomic.StoreInt32(&failFor, 2)
+
+			n := NewNotifier(Config{URL: srv.URL, Secret: "s3cret", MaxRetries: 2, RetryWait: 10 * time.Millisecond}, nil)
+			defer n.Stop()
+
+			err := n.deliver(gossip.Event{Type: gossip.EventLeadershipGained, Node: "node_1"})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(atomic.LoadInt32(&attempts), convey.ShouldEqual, 3)
+
+			r, body := <-received, <-bodies
+			convey.So(r.Header.Get(HeaderEvent), convey.ShouldEqual, gossip.EventLeadershipGained)
+			convey.So(r.Header.Get(HeaderSignature), convey.ShouldEqual, Sign("s3cret", body))
+		})
+
+		convey.Convey("Event is dropped after the retries", func() {
+			atomic.StoreInt32(&failFor, 10)
+
+			n := NewNotifier(Config{URL: srv.URL, MaxRetries: 1, RetryWait: 10 * time.Millisecond}, nil)
+			defer n.Stop()
+
+			err := n.deliver(gossip.Event{Type: gossip.EventLeadershipLost})
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(atomic.LoadInt32(&attempts), convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("Unknown event type is refused", func() {
+			n := NewNotifier(Config{URL: srv.URL, Events: []string{"leader_elected"}}, nil)
+			convey.So(n.Start(), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("Leadership of the cluster is sent to the URL", func() {
+			c := testcluster.New(t, testcluster.Options{Nodes: 3})
+			leader := c.WaitLeader(5 * time.Second)
+			target := c.Node((c.Index(leader) + 1) % 3)
+
+			n := NewNotifier(Config{URL: srv.URL, Events: []string{gossip.EventLeadershipGained}}, target.Gossip())
+			convey.So(n.Start(), convey.ShouldBeNil)
+			defer n.Stop()
+
+			_, err := leader.Gossip().TransferLeadership(target.ID)
+			convey.So(err, convey.ShouldBeNil)
+
+			select {
+			case r := <-received:
+				convey.So(r.Header.Get(HeaderEvent), convey.ShouldEqual, gossip.EventLeadershipGained)
+			case <-time.After(5 * time.Second):
+				convey.So("webhook is not called", convey.ShouldBeEmpty)
+			}
+		})
+	})
+}